@@ -1,38 +1,163 @@
 package main
 
 import (
+	"container/list"
 	"context"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"cloud_project/internal/backoff"
+	"cloud_project/pkg/metrics"
+
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// peerLookupTimeout bounds each parallel peer request so a cache miss
+// doesn't end up waiting on a slow or unreachable peer before falling back
+// to the origin.
+const peerLookupTimeout = 500 * time.Millisecond
+
 type edgeConfig struct {
-	Name        string
-	Port        string
-	DBHost      string
-	DBPort      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	OriginURL   string
-	TopologyURL string
-	ConnectedPeers []string // Peers connected to this edge
+	Name             string
+	Port             string
+	DBHost           string
+	DBPort           string
+	DBUser           string
+	DBPassword       string
+	DBName           string
+	OriginURL        string
+	TopologyURL      string
+	ConnectedPeers   []string // Peers connected to this edge
+	CacheMaxBytes    int64    // 0 means unbounded
+	CacheMaxSegments int      // 0 means unbounded
+	WarmupSongs      []string // songs to prefetch fully on startup
+	PrefetchAhead    int      // number of subsequent segments to prefetch on a request
+	MemCacheBytes    int64    // 0 disables the in-process hot tier
+}
+
+// cacheStats tracks hit/miss/eviction counters exposed via /stats so
+// experiments can measure working-set behavior of the edge cache.
+type cacheStats struct {
+	hits    int64
+	misses  int64
+	evicted int64
+}
+
+// prefetchWorkers bounds how many prefetch fetches can run against the
+// origin concurrently, regardless of how many segments get queued.
+const prefetchWorkers = 4
+
+// prefetchQueueSize bounds how many prefetch jobs can be pending; once full,
+// further enqueues are dropped since prefetching is best-effort.
+const prefetchQueueSize = 256
+
+type prefetchJob struct {
+	segmentID string
+}
+
+// inflightFetch coalesces concurrent fetches of the same segment onto a
+// single origin request (classic thundering-herd fix).
+type inflightFetch struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
 }
 
 type edgeApp struct {
-	cfg    edgeConfig
-	db     *sql.DB
-	server *http.Server
-	client *http.Client
+	cfg           edgeConfig
+	db            *sql.DB
+	server        *http.Server
+	client        *http.Client
+	stats         cacheStats
+	prefetchQueue chan prefetchJob
+	inflight      sync.Map // segmentID -> *inflightFetch
+	backoffPolicy backoff.Policy
+	memCache      *memTier
+	metrics       *metrics.Metrics
+	registry      *prometheus.Registry
+	originSem     chan struct{} // bounds concurrent origin fetches
+}
+
+// memEntry is one node in the in-process hot tier's LRU list.
+type memEntry struct {
+	id   string
+	data []byte
+}
+
+// memTier is a byte-bounded in-memory LRU sitting in front of Postgres.
+// It holds the working set in RAM so the common case never touches the
+// database, while Postgres remains the persistent warm tier.
+type memTier struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newMemTier(maxBytes int64) *memTier {
+	return &memTier{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (m *memTier) Get(id string) ([]byte, bool) {
+	if m == nil || m.maxBytes <= 0 {
+		return nil, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[id]
+	if !ok {
+		return nil, false
+	}
+	m.ll.MoveToFront(elem)
+	return elem.Value.(*memEntry).data, true
+}
+
+func (m *memTier) Put(id string, data []byte) {
+	if m == nil || m.maxBytes <= 0 || int64(len(data)) > m.maxBytes {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.items[id]; ok {
+		m.curBytes -= int64(len(elem.Value.(*memEntry).data))
+		elem.Value.(*memEntry).data = data
+		m.curBytes += int64(len(data))
+		m.ll.MoveToFront(elem)
+	} else {
+		elem := m.ll.PushFront(&memEntry{id: id, data: data})
+		m.items[id] = elem
+		m.curBytes += int64(len(data))
+	}
+	for m.curBytes > m.maxBytes {
+		oldest := m.ll.Back()
+		if oldest == nil {
+			break
+		}
+		m.ll.Remove(oldest)
+		ent := oldest.Value.(*memEntry)
+		delete(m.items, ent.id)
+		m.curBytes -= int64(len(ent.data))
+	}
 }
 
 func loadConfig() edgeConfig {
@@ -46,19 +171,90 @@ func loadConfig() edgeConfig {
 	}
 	
 	return edgeConfig{
-		Name:        getenv("EDGE_NAME", "edge-1"),
-		Port:        getenv("EDGE_PORT", "8082"),
-		DBHost:      getenv("DB_HOST", "localhost"),
-		DBPort:      getenv("DB_PORT", "5432"),
-		DBUser:      getenv("DB_USER", "media"),
-		DBPassword:  getenv("DB_PASSWORD", "media_pass"),
-		DBName:      getenv("DB_NAME", "hls"),
-		OriginURL:   getenv("ORIGIN_URL", "http://origin:8081"),
-		TopologyURL: getenv("TOPOLOGY_URL", "http://topology:8090"),
-		ConnectedPeers: connectedPeers,
+		Name:             getenv("EDGE_NAME", "edge-1"),
+		Port:             getenv("EDGE_PORT", "8082"),
+		DBHost:           getenv("DB_HOST", "localhost"),
+		DBPort:           getenv("DB_PORT", "5432"),
+		DBUser:           getenv("DB_USER", "media"),
+		DBPassword:       getenv("DB_PASSWORD", "media_pass"),
+		DBName:           getenv("DB_NAME", "hls"),
+		OriginURL:        getenv("ORIGIN_URL", "http://origin:8081"),
+		TopologyURL:      getenv("TOPOLOGY_URL", "http://topology:8090"),
+		ConnectedPeers:   connectedPeers,
+		CacheMaxBytes:    getenvInt64("EDGE_CACHE_MAX_BYTES", 0),
+		CacheMaxSegments: int(getenvInt64("EDGE_CACHE_MAX_SEGMENTS", 0)),
+		WarmupSongs:      getenvList("WARMUP_SONGS"),
+		PrefetchAhead:    int(getenvInt64("PREFETCH_AHEAD", 2)),
+		MemCacheBytes:    getenvInt64("EDGE_MEM_CACHE_BYTES", 0),
 	}
 }
 
+func getenvList(key string) []string {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return nil
+	}
+	items := strings.Split(raw, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+func getenvInt64(key string, fallback int64) int64 {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getenvFloat(key string, fallback float64) float64 {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// loadBackoffPolicy builds the shared retry policy for origin, peer, and
+// topology calls, tunable via env vars on top of backoff.DefaultPolicy.
+func loadBackoffPolicy() backoff.Policy {
+	p := backoff.DefaultPolicy()
+	p.InitialInterval = time.Duration(getenvInt64("BACKOFF_INITIAL_MS", p.InitialInterval.Milliseconds())) * time.Millisecond
+	p.MaxInterval = time.Duration(getenvInt64("BACKOFF_MAX_INTERVAL_MS", p.MaxInterval.Milliseconds())) * time.Millisecond
+	p.Multiplier = getenvFloat("BACKOFF_MULTIPLIER", p.Multiplier)
+	p.RandomizationFactor = getenvFloat("BACKOFF_RANDOMIZATION_FACTOR", p.RandomizationFactor)
+	p.MaxElapsedTime = time.Duration(getenvInt64("BACKOFF_MAX_ELAPSED_MS", p.MaxElapsedTime.Milliseconds())) * time.Millisecond
+	return p
+}
+
+// parseRetryAfter reads a Retry-After header (seconds or HTTP-date form)
+// and returns how long to wait, or 0 if absent/unparseable.
+func parseRetryAfter(resp *http.Response) time.Duration {
+	raw := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if raw == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(raw); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
 func getenv(key, fallback string) string {
 	val := strings.TrimSpace(os.Getenv(key))
 	if val == "" {
@@ -76,6 +272,8 @@ func (a *edgeApp) initDB(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
+	a.db.SetMaxOpenConns(int(getenvInt64("DB_MAX_OPEN_CONNS", 25)))
+	a.db.SetMaxIdleConns(int(getenvInt64("DB_MAX_IDLE_CONNS", 25)))
 
 	// Retry connection with timeout
 	maxRetries := 10
@@ -91,7 +289,7 @@ func (a *edgeApp) initDB(ctx context.Context) error {
 		}
 	}
 
-	// Create segments table (same as origin)
+	// Create segments table (same as origin, plus last_access_at for LRU eviction)
 	createTable := `
 	CREATE TABLE IF NOT EXISTS segments (
 		id VARCHAR(255) PRIMARY KEY,
@@ -99,12 +297,14 @@ func (a *edgeApp) initDB(ctx context.Context) error {
 		bitrate VARCHAR(50),
 		segment_index INTEGER,
 		data BYTEA NOT NULL,
-		created_at TIMESTAMP DEFAULT NOW()
+		created_at TIMESTAMP DEFAULT NOW(),
+		last_access_at TIMESTAMP DEFAULT NOW()
 	);
 	CREATE INDEX IF NOT EXISTS idx_song_id ON segments(song_id);
 	CREATE INDEX IF NOT EXISTS idx_segment_id ON segments(id);
+	CREATE INDEX IF NOT EXISTS idx_last_access_at ON segments(last_access_at);
 	`
-	
+
 	if _, err := a.db.ExecContext(ctx, createTable); err != nil {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
@@ -113,40 +313,116 @@ func (a *edgeApp) initDB(ctx context.Context) error {
 	return nil
 }
 
-func (a *edgeApp) fetchFromOrigin(ctx context.Context, segmentID string) ([]byte, error) {
-	url := fmt.Sprintf("%s/segments/%s", a.cfg.OriginURL, segmentID)
-	
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+// fetchFromPeers asks each of ConnectedPeers for segmentID in parallel and
+// returns the data from the first peer that has it. Peer requests are marked
+// peer_only=1 so peers answer from their own cache instead of recursing into
+// their own peer/origin fallback, and each request gets a short deadline so a
+// slow or dead peer can't stall the whole lookup.
+func (a *edgeApp) fetchFromPeers(ctx context.Context, segmentID string) ([]byte, error) {
+	if len(a.cfg.ConnectedPeers) == 0 {
+		return nil, fmt.Errorf("no connected peers")
 	}
 
-	resp, err := a.client.Do(req)
-	if err != nil {
-		return nil, err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
 	}
-	defer resp.Body.Close()
+	results := make(chan result, len(a.cfg.ConnectedPeers))
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("origin returned status %d", resp.StatusCode)
+	for _, peer := range a.cfg.ConnectedPeers {
+		peer := strings.TrimSpace(peer)
+		if peer == "" {
+			continue
+		}
+		go func(peerURL string) {
+			data, err := a.fetchFromPeer(ctx, peerURL, segmentID)
+			results <- result{data: data, err: err}
+		}(peer)
 	}
 
-	var segResp map[string]string
-	if err := json.NewDecoder(resp.Body).Decode(&segResp); err != nil {
-		return nil, err
+	var lastErr error
+	for range a.cfg.ConnectedPeers {
+		res := <-results
+		if res.err == nil {
+			return res.data, nil
+		}
+		lastErr = res.err
 	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no connected peers")
+	}
+	return nil, fmt.Errorf("all peers missed segment %s: %w", segmentID, lastErr)
+}
 
-	data, err := base64.StdEncoding.DecodeString(segResp["payload"])
+func (a *edgeApp) fetchFromPeer(ctx context.Context, peerURL, segmentID string) ([]byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, peerLookupTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/segments/%s?peer_only=1", strings.TrimSuffix(peerURL, "/"), segmentID)
+
+	var data []byte
+	b := backoff.New(a.backoffPolicy)
+	err := backoff.Retry(reqCtx, b, func() (time.Duration, error) {
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return parseRetryAfter(resp), fmt.Errorf("peer %s returned status %d", peerURL, resp.StatusCode)
+		}
+
+		var segResp map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&segResp); err != nil {
+			return 0, err
+		}
+		data, err = base64.StdEncoding.DecodeString(segResp["payload"])
+		return 0, err
+	})
+	return data, err
+}
+
+// errOriginBusy is returned when the origin concurrency semaphore is full,
+// so callers can respond 503 with Retry-After instead of queuing forever.
+var errOriginBusy = fmt.Errorf("origin fetch concurrency limit reached")
+
+func (a *edgeApp) fetchFromOrigin(ctx context.Context, segmentID string) ([]byte, error) {
+	select {
+	case a.originSem <- struct{}{}:
+		defer func() { <-a.originSem }()
+	default:
+		return nil, errOriginBusy
+	}
+
+	url := fmt.Sprintf("%s/segments/%s", a.cfg.OriginURL, segmentID)
+
+	var data []byte
+	b := backoff.New(a.backoffPolicy)
+	err := backoff.Retry(ctx, b, func() (time.Duration, error) {
+		fetched, retryAfter, ferr := a.doFetchFromOrigin(ctx, url)
+		if ferr == nil {
+			data = fetched
+		}
+		return retryAfter, ferr
+	})
 	if err != nil {
-		return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		return nil, err
 	}
 
-	// Store in edge database (unlimited cache)
+	// Store in edge database (bounded by EDGE_CACHE_MAX_BYTES/SEGMENTS)
 	parts := strings.Split(segmentID, "/")
 	songID := ""
 	bitrate := ""
 	segmentIndex := 0
-	
+
 	if len(parts) >= 3 {
 		songID = parts[0]
 		bitrate = parts[1]
@@ -157,10 +433,7 @@ func (a *edgeApp) fetchFromOrigin(ctx context.Context, segmentID string) ([]byte
 		}
 	}
 
-	_, err = a.db.ExecContext(ctx,
-		"INSERT INTO segments (id, song_id, bitrate, segment_index, data) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data",
-		segmentID, songID, bitrate, segmentIndex, data)
-	if err != nil {
+	if err := a.storeSegment(ctx, segmentID, songID, bitrate, segmentIndex, data); err != nil {
 		log.Printf("[%s] Warning: failed to cache segment %s: %v", a.cfg.Name, segmentID, err)
 	}
 
@@ -168,6 +441,96 @@ func (a *edgeApp) fetchFromOrigin(ctx context.Context, segmentID string) ([]byte
 	return data, nil
 }
 
+// doFetchFromOrigin performs a single GET attempt against the origin. On a
+// 429/503 the Retry-After header (if present) is returned so the caller's
+// backoff loop honors the server's requested delay instead of the computed
+// jittered interval.
+func (a *edgeApp) doFetchFromOrigin(ctx context.Context, url string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseRetryAfter(resp), fmt.Errorf("origin returned status %d", resp.StatusCode)
+	}
+
+	var segResp map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&segResp); err != nil {
+		return nil, 0, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(segResp["payload"])
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid base64 payload: %w", err)
+	}
+	return data, 0, nil
+}
+
+// storeSegment inserts (or refreshes) a segment and evicts the
+// least-recently-accessed segments until the cache is back under its
+// configured bounds. The insert and eviction happen in one transaction so a
+// concurrent read never observes a cache that is over budget.
+func (a *edgeApp) storeSegment(ctx context.Context, segmentID, songID, bitrate string, segmentIndex int, data []byte) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO segments (id, song_id, bitrate, segment_index, data, last_access_at) VALUES ($1, $2, $3, $4, $5, NOW()) ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, last_access_at = NOW()",
+		segmentID, songID, bitrate, segmentIndex, data)
+	if err != nil {
+		return err
+	}
+
+	if err := a.evictLocked(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// evictLocked deletes segments in ascending last_access_at order until the
+// cache is under both EDGE_CACHE_MAX_BYTES and EDGE_CACHE_MAX_SEGMENTS (a
+// zero value means that bound is not enforced).
+func (a *edgeApp) evictLocked(ctx context.Context, tx *sql.Tx) error {
+	if a.cfg.CacheMaxBytes <= 0 && a.cfg.CacheMaxSegments <= 0 {
+		return nil
+	}
+
+	for {
+		var totalBytes int64
+		var totalSegments int
+		if err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(octet_length(data)), 0), COUNT(*) FROM segments").Scan(&totalBytes, &totalSegments); err != nil {
+			return err
+		}
+
+		overBytes := a.cfg.CacheMaxBytes > 0 && totalBytes > a.cfg.CacheMaxBytes
+		overSegments := a.cfg.CacheMaxSegments > 0 && totalSegments > a.cfg.CacheMaxSegments
+		if !overBytes && !overSegments {
+			return nil
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"DELETE FROM segments WHERE id = (SELECT id FROM segments ORDER BY last_access_at ASC LIMIT 1)")
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		atomic.AddInt64(&a.stats.evicted, 1)
+	}
+}
+
 func (a *edgeApp) fetchSongFromOrigin(ctx context.Context, songID string) error {
 	// Fetch all segments for a song from origin
 	url := fmt.Sprintf("%s/songs/%s", a.cfg.OriginURL, songID)
@@ -209,7 +572,7 @@ func (a *edgeApp) fetchSongFromOrigin(ctx context.Context, songID string) error
 		if !ok {
 			continue
 		}
-		_, err := a.fetchFromOrigin(ctx, segmentID)
+		_, err := a.fetchFromOriginDeduped(ctx, segmentID)
 		if err != nil {
 			log.Printf("[%s] Warning: failed to fetch segment %s: %v", a.cfg.Name, segmentID, err)
 		}
@@ -219,6 +582,105 @@ func (a *edgeApp) fetchSongFromOrigin(ctx context.Context, songID string) error
 	return nil
 }
 
+// fetchFromOriginDeduped wraps fetchFromOrigin so that concurrent callers
+// asking for the same segmentID coalesce onto a single origin request,
+// instead of each triggering their own fetch (thundering herd).
+func (a *edgeApp) fetchFromOriginDeduped(ctx context.Context, segmentID string) ([]byte, error) {
+	entry := &inflightFetch{}
+	entry.wg.Add(1)
+	actual, loaded := a.inflight.LoadOrStore(segmentID, entry)
+	if loaded {
+		existing := actual.(*inflightFetch)
+		existing.wg.Wait()
+		return existing.data, existing.err
+	}
+	defer func() {
+		a.inflight.Delete(segmentID)
+		entry.wg.Done()
+	}()
+	entry.data, entry.err = a.fetchFromOrigin(ctx, segmentID)
+	return entry.data, entry.err
+}
+
+// startPrefetchWorkers runs a small, bounded pool of workers draining
+// a.prefetchQueue so prefetching never opens more than prefetchWorkers
+// concurrent origin connections.
+func (a *edgeApp) startPrefetchWorkers(ctx context.Context) {
+	for i := 0; i < prefetchWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case job := <-a.prefetchQueue:
+					a.prefetchSegment(ctx, job.segmentID)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (a *edgeApp) prefetchSegment(ctx context.Context, segmentID string) {
+	var exists bool
+	if err := a.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE id = $1)", segmentID).Scan(&exists); err == nil && exists {
+		return
+	}
+	if _, err := a.fetchFromOriginDeduped(ctx, segmentID); err != nil {
+		log.Printf("[%s] prefetch of %s failed: %v", a.cfg.Name, segmentID, err)
+	}
+}
+
+// enqueuePrefetch schedules a best-effort background fetch; if the queue is
+// full the job is simply dropped since prefetching must never block the
+// request that triggered it.
+func (a *edgeApp) enqueuePrefetch(segmentID string) {
+	select {
+	case a.prefetchQueue <- prefetchJob{segmentID: segmentID}:
+	default:
+		log.Printf("[%s] prefetch queue full, dropping %s", a.cfg.Name, segmentID)
+	}
+}
+
+// triggerPrefetch schedules the next PrefetchAhead segments after segmentID
+// (e.g. song/bitrate/segment005.ts -> segment006.ts..segment007.ts) so a
+// sequential HLS playback stays ahead of the player's cache misses.
+func (a *edgeApp) triggerPrefetch(segmentID string) {
+	if a.cfg.PrefetchAhead <= 0 {
+		return
+	}
+	parts := strings.Split(segmentID, "/")
+	if len(parts) < 3 {
+		return
+	}
+	songID, bitrate, segName := parts[0], parts[1], parts[2]
+	if !strings.HasPrefix(segName, "segment") || !strings.HasSuffix(segName, ".ts") {
+		return
+	}
+	var index int
+	if _, err := fmt.Sscanf(segName, "segment%d.ts", &index); err != nil {
+		return
+	}
+	for i := 1; i <= a.cfg.PrefetchAhead; i++ {
+		nextID := fmt.Sprintf("%s/%s/segment%03d.ts", songID, bitrate, index+i)
+		a.enqueuePrefetch(nextID)
+	}
+}
+
+// warmupSongs prefetches every configured WARMUP_SONGS entry on startup.
+func (a *edgeApp) warmupSongs(ctx context.Context) {
+	for _, songID := range a.cfg.WarmupSongs {
+		if songID == "" {
+			continue
+		}
+		go func(id string) {
+			log.Printf("[%s] Warming up song %s", a.cfg.Name, id)
+			if err := a.fetchSongFromOrigin(ctx, id); err != nil {
+				log.Printf("[%s] Warmup of song %s failed: %v", a.cfg.Name, id, err)
+			}
+		}(songID)
+	}
+}
+
 func (a *edgeApp) startHTTP(ctx context.Context) *http.Server {
 	mux := http.NewServeMux()
 	
@@ -230,6 +692,52 @@ func (a *edgeApp) startHTTP(ctx context.Context) *http.Server {
 		fmt.Fprintf(w, "%s: ok", a.cfg.Name)
 	})
 
+	mux.Handle("/metrics", promhttp.HandlerFor(a.registry, promhttp.HandlerOpts{}))
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		var totalBytes int64
+		var totalSegments int
+		if err := a.db.QueryRowContext(r.Context(),
+			"SELECT COALESCE(SUM(octet_length(data)), 0), COUNT(*) FROM segments").Scan(&totalBytes, &totalSegments); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"hits":            atomic.LoadInt64(&a.stats.hits),
+			"misses":          atomic.LoadInt64(&a.stats.misses),
+			"evicted":         atomic.LoadInt64(&a.stats.evicted),
+			"bytes_used":      totalBytes,
+			"segments_cached": totalSegments,
+			"max_bytes":       a.cfg.CacheMaxBytes,
+			"max_segments":    a.cfg.CacheMaxSegments,
+		})
+	})
+
+	mux.HandleFunc("/admin/warmup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Songs []string `json:"songs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Songs) == 0 {
+			http.Error(w, "songs list required", http.StatusBadRequest)
+			return
+		}
+		for _, songID := range req.Songs {
+			songID := songID
+			go func() {
+				if err := a.fetchSongFromOrigin(context.Background(), songID); err != nil {
+					log.Printf("[%s] Manual warmup of song %s failed: %v", a.cfg.Name, songID, err)
+				}
+			}()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"status": "scheduled", "songs": req.Songs})
+	})
+
 	mux.HandleFunc("/segments/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -241,27 +749,76 @@ func (a *edgeApp) startHTTP(ctx context.Context) *http.Server {
 			http.Error(w, "segment id required", http.StatusBadRequest)
 			return
 		}
+		peerOnly := r.URL.Query().Get("peer_only") == "1"
+
+		// Hot tier first: an in-process LRU avoids a Postgres round trip
+		// for the working set entirely.
+		if data, ok := a.memCache.Get(segmentID); ok {
+			a.metrics.TierAccessTotal.WithLabelValues("mem").Inc()
+			log.Printf("[%s] MEM HIT segment %s", a.cfg.Name, segmentID)
+			if !peerOnly {
+				a.triggerPrefetch(segmentID)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"id":      segmentID,
+				"payload": base64.StdEncoding.EncodeToString(data),
+			})
+			return
+		}
 
-		// Try to fetch from edge cache first
+		// Warm tier: Postgres.
 		var data []byte
 		err := a.db.QueryRowContext(r.Context(),
 			"SELECT data FROM segments WHERE id = $1", segmentID).Scan(&data)
-		
-		if err == sql.ErrNoRows {
-			// Not in cache, fetch from origin
-			log.Printf("[%s] Segment %s not in cache, fetching from origin...", a.cfg.Name, segmentID)
-			data, err = a.fetchFromOrigin(r.Context(), segmentID)
+
+		switch {
+		case err == nil:
+			atomic.AddInt64(&a.stats.hits, 1)
+			a.metrics.TierAccessTotal.WithLabelValues("db").Inc()
+			log.Printf("[%s] HIT segment %s", a.cfg.Name, segmentID)
+			a.db.ExecContext(r.Context(), "UPDATE segments SET last_access_at = NOW() WHERE id = $1", segmentID)
+		case err == sql.ErrNoRows && peerOnly:
+			// Peers must answer from their own cache only, never recurse.
+			atomic.AddInt64(&a.stats.misses, 1)
+			log.Printf("[%s] MISS segment %s (peer_only)", a.cfg.Name, segmentID)
+			http.Error(w, "segment not found", http.StatusNotFound)
+			return
+		case err == sql.ErrNoRows:
+			atomic.AddInt64(&a.stats.misses, 1)
+			data, err = a.fetchFromPeers(r.Context(), segmentID)
+			if err == nil {
+				a.metrics.TierAccessTotal.WithLabelValues("peer").Inc()
+				log.Printf("[%s] PEER segment %s", a.cfg.Name, segmentID)
+				break
+			}
+			log.Printf("[%s] Segment %s not cached or peered, fetching from origin...", a.cfg.Name, segmentID)
+			data, err = a.fetchFromOriginDeduped(r.Context(), segmentID)
+			if errors.Is(err, errOriginBusy) {
+				log.Printf("[%s] Origin concurrency limit reached for segment %s", a.cfg.Name, segmentID)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "origin busy", http.StatusServiceUnavailable)
+				return
+			}
 			if err != nil {
-				log.Printf("[%s] Failed to fetch segment %s from origin: %v", a.cfg.Name, segmentID, err)
+				log.Printf("[%s] ORIGIN segment %s failed: %v", a.cfg.Name, segmentID, err)
 				http.Error(w, "segment not found", http.StatusNotFound)
 				return
 			}
-		} else if err != nil {
+			a.metrics.TierAccessTotal.WithLabelValues("origin").Inc()
+			log.Printf("[%s] ORIGIN segment %s", a.cfg.Name, segmentID)
+		default:
 			log.Printf("[%s] Error fetching segment %s: %v", a.cfg.Name, segmentID, err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
 
+		a.memCache.Put(segmentID, data)
+
+		if !peerOnly {
+			a.triggerPrefetch(segmentID)
+		}
+
 		// Return segment as base64 JSON
 		resp := map[string]string{
 			"id":      segmentID,
@@ -317,8 +874,12 @@ func (a *edgeApp) startHTTP(ctx context.Context) *http.Server {
 	})
 
 	server := &http.Server{
-		Addr:    ":" + a.cfg.Port,
-		Handler: mux,
+		Addr:              ":" + a.cfg.Port,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
 	}
 	a.server = server
 
@@ -334,26 +895,55 @@ func (a *edgeApp) startHTTP(ctx context.Context) *http.Server {
 
 func main() {
 	cfg := loadConfig()
+	metricsObj := metrics.NewMetrics()
+	registry := prometheus.NewRegistry()
+	if err := metricsObj.Register(registry); err != nil {
+		log.Fatalf("[%s] Failed to register metrics: %v", cfg.Name, err)
+	}
 	app := &edgeApp{
-		cfg:    cfg,
-		client: &http.Client{Timeout: 30 * time.Second},
+		cfg:           cfg,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		backoffPolicy: loadBackoffPolicy(),
+		prefetchQueue: make(chan prefetchJob, prefetchQueueSize),
+		memCache:      newMemTier(cfg.MemCacheBytes),
+		metrics:       metricsObj,
+		registry:      registry,
+		originSem:     make(chan struct{}, int(getenvInt64("ORIGIN_MAX_CONCURRENCY", 16))),
 	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+
+	initCtx, cancelInit := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelInit()
 
 	// Initialize database
-	if err := app.initDB(ctx); err != nil {
+	if err := app.initDB(initCtx); err != nil {
 		log.Fatalf("[%s] Failed to initialize database: %v", cfg.Name, err)
 	}
 
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTP server
-	app.startHTTP(context.Background())
+	app.startHTTP(rootCtx)
 
 	// Register with topology service
-	go app.registerWithTopology(context.Background())
+	go app.registerWithTopology(rootCtx)
+
+	// Start the prefetch worker pool and warm up any configured songs
+	app.startPrefetchWorkers(rootCtx)
+	app.warmupSongs(rootCtx)
 
-	// Wait for shutdown
+	<-rootCtx.Done()
+	log.Printf("[%s] Shutting down...", cfg.Name)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelShutdown()
+	if err := app.server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[%s] HTTP server shutdown error: %v", cfg.Name, err)
+	}
+	if err := app.db.Close(); err != nil {
+		log.Printf("[%s] Error closing database: %v", cfg.Name, err)
+	}
+	log.Printf("[%s] Shutdown complete", cfg.Name)
 	select {}
 }
 
@@ -365,49 +955,40 @@ func (a *edgeApp) registerWithTopology(ctx context.Context) {
 		return
 	}
 	
-	// Retry registration with exponential backoff
-	maxRetries := 5
+	// Retry registration using the shared exponential-backoff-with-jitter policy.
 	client := &http.Client{Timeout: 5 * time.Second}
-	
-	for i := 0; i < maxRetries; i++ {
-		// Use connected peers from config
-		payload := map[string]interface{}{
-			"peer_id":   a.cfg.Name,
-			"region":    "global",
-			"neighbors": a.cfg.ConnectedPeers,
-		}
-		
-		body, _ := json.Marshal(payload)
+	payload := map[string]interface{}{
+		"peer_id":   a.cfg.Name,
+		"region":    "global",
+		"neighbors": a.cfg.ConnectedPeers,
+	}
+	body, _ := json.Marshal(payload)
+
+	b := backoff.New(a.backoffPolicy)
+	err := backoff.Retry(ctx, b, func() (time.Duration, error) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.TopologyURL+"/edges", strings.NewReader(string(body)))
 		if err != nil {
-			log.Printf("[%s] Failed to create topology request: %v", a.cfg.Name, err)
-			return
+			return 0, err
 		}
 		req.Header.Set("Content-Type", "application/json")
-		
+
 		resp, err := client.Do(req)
 		if err != nil {
-			if i < maxRetries-1 {
-				waitTime := time.Duration(1<<uint(i)) * time.Second // Exponential backoff: 1s, 2s, 4s, 8s
-				log.Printf("[%s] Failed to register with topology (attempt %d/%d), retrying in %v: %v", a.cfg.Name, i+1, maxRetries, waitTime, err)
-				time.Sleep(waitTime)
-				continue
-			}
-			log.Printf("[%s] Failed to register with topology after %d attempts: %v", a.cfg.Name, maxRetries, err)
-			return
+			log.Printf("[%s] Failed to register with topology, retrying: %v", a.cfg.Name, err)
+			return 0, err
 		}
 		defer resp.Body.Close()
-		
+
 		if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK {
-			log.Printf("[%s] Registered with topology service", a.cfg.Name)
-			return
-		}
-		
-		if i < maxRetries-1 {
-			waitTime := time.Duration(1<<uint(i)) * time.Second
-			log.Printf("[%s] Topology returned status %d (attempt %d/%d), retrying in %v", a.cfg.Name, resp.StatusCode, i+1, maxRetries, waitTime)
-			time.Sleep(waitTime)
+			return 0, nil
 		}
+		log.Printf("[%s] Topology returned status %d, retrying", a.cfg.Name, resp.StatusCode)
+		return parseRetryAfter(resp), fmt.Errorf("topology returned status %d", resp.StatusCode)
+	})
+	if err != nil {
+		log.Printf("[%s] Failed to register with topology: %v", a.cfg.Name, err)
+		return
 	}
+	log.Printf("[%s] Registered with topology service", a.cfg.Name)
 }
 
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dhtID is a 160-bit Kademlia node/key ID - a plain SHA-1 digest, kept
+// as a fixed-size array so it's cheap to XOR and compare.
+type dhtID [sha1.Size]byte
+
+func hashID(s string) dhtID {
+	return sha1.Sum([]byte(s))
+}
+
+func (id dhtID) Hex() string {
+	return hex.EncodeToString(id[:])
+}
+
+// xorDistance is the Kademlia metric: the two IDs' bytes XORed together,
+// read as a big-endian integer so "closer" just means "smaller".
+func xorDistance(a, b dhtID) *big.Int {
+	var x [sha1.Size]byte
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+	return new(big.Int).SetBytes(x[:])
+}
+
+// bucketIndex returns which of self's 160 k-buckets other belongs in:
+// bucket i holds peers whose distance is in [2^i, 2^(i+1)). A distance
+// of zero (other == self) has no bucket; callers skip that case.
+func bucketIndex(self, other dhtID) int {
+	dist := xorDistance(self, other)
+	if dist.Sign() == 0 {
+		return -1
+	}
+	return dist.BitLen() - 1
+}
+
+// dhtK is the bucket size / replication factor: how many contacts a
+// bucket holds and how many nodes a published record is stored at.
+// dhtAlpha is the lookup parallelism: how many closest-unqueried
+// contacts get asked per round of an iterative walk. Both are the
+// standard Kademlia paper's defaults.
+const (
+	dhtK     = 20
+	dhtAlpha = 3
+
+	// dhtLookupBudget bounds how long FindProviders spends walking the
+	// overlay before FindSegment gives up on it and falls back to the
+	// tiered peer/edge/origin scan.
+	dhtLookupBudget = 200 * time.Millisecond
+)
+
+// canonicalSegmentKey hashes a segment ID to its DHT key, first folding
+// the two spellings FindSegment already treats as equivalent
+// ("segment003.ts" and "song_003") down to one canonical string so a
+// provider announced under either spelling is found under both.
+func canonicalSegmentKey(segmentID string) dhtID {
+	num := -1
+	switch {
+	case len(segmentID) >= 12 && segmentID[:8] == "segment":
+		fmt.Sscanf(segmentID, "segment%03d.ts", &num)
+	case len(segmentID) >= 6 && segmentID[:4] == "song":
+		fmt.Sscanf(segmentID, "song_%03d", &num)
+	}
+	canonical := segmentID
+	if num >= 0 {
+		canonical = fmt.Sprintf("seg:%03d", num)
+	}
+	return hashID(canonical)
+}
+
+// DHT is a Kademlia-style overlay layered on top of NetworkTopology's
+// node set: every topology node ID gets a 160-bit DHT ID (SHA-1 of the
+// string ID), and a per-node k-bucket table approximates what that node
+// would know about the rest of the network if it had joined via real
+// FIND_NODE traffic. FindProviders and Announce both converge on a
+// target key with an iterative, alpha-parallel walk instead of scanning
+// every node, so lookup cost grows with log(N) hops rather than N.
+type DHT struct {
+	mu sync.RWMutex
+
+	ids       map[string]dhtID          // topology node ID -> DHT ID
+	buckets   map[string]map[int][]string // topology node ID -> bucket index -> contact node IDs
+	providers map[string]map[string]bool // segment key hex -> set of topology node IDs holding it
+	bootstrap string                     // entry point for a walk with no caller-supplied starting node
+}
+
+func NewDHT() *DHT {
+	return &DHT{
+		ids:       make(map[string]dhtID),
+		buckets:   make(map[string]map[int][]string),
+		providers: make(map[string]map[string]bool),
+	}
+}
+
+// Register gives nodeID a DHT ID if it doesn't have one yet, and makes
+// it the walk entry point if it's the first node registered.
+func (d *DHT) Register(nodeID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.ids[nodeID]; exists {
+		return
+	}
+	d.ids[nodeID] = hashID(nodeID)
+	d.buckets[nodeID] = make(map[int][]string)
+	if d.bootstrap == "" {
+		d.bootstrap = nodeID
+	}
+}
+
+// RefreshBuckets rebuilds every registered node's k-buckets against
+// every other registered node. Real Kademlia nodes populate their
+// buckets gradually as FIND_NODE traffic passes through them after
+// joining one at a time; this simulator doesn't send that traffic, so it
+// bootstraps the whole routing table in one pass instead once the
+// topology is done being built.
+func (d *DHT) RefreshBuckets() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	all := make([]string, 0, len(d.ids))
+	for id := range d.ids {
+		all = append(all, id)
+	}
+	for _, self := range all {
+		for _, other := range all {
+			d.insertContactLocked(self, other)
+		}
+	}
+}
+
+// insertContactLocked records other in self's bucket for other's
+// distance from self, dropping it if that bucket is already at dhtK
+// contacts. Real Kademlia pings the bucket's least-recently-seen contact
+// before evicting it in favor of a fresher one; this simulator has no
+// notion of contacts going stale, so a full bucket just stays full.
+func (d *DHT) insertContactLocked(self, other string) {
+	if self == other {
+		return
+	}
+	idx := bucketIndex(d.ids[self], d.ids[other])
+	if idx < 0 {
+		return
+	}
+	bucket := d.buckets[self][idx]
+	for _, existing := range bucket {
+		if existing == other {
+			return
+		}
+	}
+	if len(bucket) >= dhtK {
+		return
+	}
+	d.buckets[self][idx] = append(bucket, other)
+}
+
+// contacts flattens nodeID's entire bucket table into one slice - what a
+// FIND_NODE/FIND_VALUE request to nodeID would return.
+func (d *DHT) contacts(nodeID string) []string {
+	var out []string
+	for _, bucket := range d.buckets[nodeID] {
+		out = append(out, bucket...)
+	}
+	return out
+}
+
+// closestN sorts candidates by distance to target and returns the n
+// closest, deduplicated.
+func (d *DHT) closestN(candidates []string, target dhtID, n int) []string {
+	seen := make(map[string]bool, len(candidates))
+	unique := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if !seen[c] {
+			seen[c] = true
+			unique = append(unique, c)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return xorDistance(d.ids[unique[i]], target).Cmp(xorDistance(d.ids[unique[j]], target)) < 0
+	})
+	if len(unique) > n {
+		unique = unique[:n]
+	}
+	return unique
+}
+
+// converge runs the iterative alpha-parallel lookup: starting from
+// start's own contacts, each round asks the alpha closest not-yet-queried
+// nodes in the shortlist for their contacts, folds the results in, and
+// keeps going until the closest dhtK entries have all been queried, the
+// deadline passes, or (when keyHex is non-empty) a provider record turns
+// up - the FIND_VALUE early exit, since there's no point continuing a
+// walk for content once a copy of it has been found.
+func (d *DHT) converge(target dhtID, start, keyHex string, deadline time.Time) (shortlist []string, providers []string, hops int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if start == "" {
+		return nil, nil, 0
+	}
+
+	queried := map[string]bool{}
+	short := d.closestN(d.contacts(start), target, dhtK)
+	short = append(short, start)
+	short = d.closestN(short, target, dhtK)
+
+	for {
+		if time.Now().After(deadline) {
+			break
+		}
+		var batch []string
+		for _, id := range short {
+			if !queried[id] {
+				batch = append(batch, id)
+				if len(batch) == dhtAlpha {
+					break
+				}
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		hops++
+
+		for _, id := range batch {
+			queried[id] = true
+			short = append(short, d.contacts(id)...)
+		}
+		short = d.closestN(short, target, dhtK)
+
+		if keyHex != "" {
+			if holders := d.providers[keyHex]; len(holders) > 0 {
+				for holder := range holders {
+					providers = append(providers, holder)
+				}
+				return short, providers, hops
+			}
+		}
+
+		done := true
+		for _, id := range short {
+			if !queried[id] {
+				done = false
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+	return short, providers, hops
+}
+
+// Announce walks the overlay to find the dhtK nodes closest to
+// segmentID's key and records that nodeID holds it. It returns which
+// nodes ended up storing the record and how many overlay hops the walk
+// took, for callers that want to report on DHT behavior.
+func (d *DHT) Announce(nodeID, segmentID string) (storedAt []string, hops int) {
+	key := canonicalSegmentKey(segmentID)
+	keyHex := key.Hex()
+
+	d.mu.RLock()
+	start := d.bootstrap
+	d.mu.RUnlock()
+
+	storedAt, _, hops = d.converge(key, start, "", time.Now().Add(dhtLookupBudget))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.providers[keyHex] == nil {
+		d.providers[keyHex] = make(map[string]bool)
+	}
+	d.providers[keyHex][nodeID] = true
+	return storedAt, hops
+}
+
+// FindProviders walks the overlay looking for a provider record of
+// segmentID, returning up to k provider node IDs and how many hops the
+// walk took. It gives up once budget elapses, leaving it to the caller
+// to fall back to a different strategy.
+func (d *DHT) FindProviders(segmentID string, k int, budget time.Duration) (provs []string, hops int) {
+	key := canonicalSegmentKey(segmentID)
+	keyHex := key.Hex()
+
+	d.mu.RLock()
+	start := d.bootstrap
+	d.mu.RUnlock()
+
+	_, provs, hops = d.converge(key, start, keyHex, time.Now().Add(budget))
+	if len(provs) > k {
+		provs = provs[:k]
+	}
+	return provs, hops
+}
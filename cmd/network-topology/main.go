@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,11 +10,14 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kalash/CDN-simulator/pkg/health"
 	"github.com/kalash/CDN-simulator/pkg/metrics"
+	"github.com/kalash/CDN-simulator/pkg/reputation"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -29,6 +33,12 @@ type NetworkNode struct {
 	Latency     map[string]int  `json:"latency"`     // Latency to other nodes (ms)
 	IsOnline    bool            `json:"isOnline"`
 	LastSeen    time.Time       `json:"lastSeen"`
+
+	// NextAttemptAt mirrors this node's pkg/health circuit state: zero
+	// while the circuit is closed, otherwise when its backoff next allows
+	// a request. Kept on the node itself so GET /topology can surface it
+	// without a second round-trip to the health tracker.
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitempty"`
 }
 
 // NetworkTopology manages the entire network structure
@@ -36,6 +46,16 @@ type NetworkTopology struct {
 	mu    sync.RWMutex
 	nodes map[string]*NetworkNode
 	edges map[string][]string // Adjacency list for routing
+	dht   *DHT                // Kademlia-style overlay for O(log N) provider lookups, see dht.go
+
+	inFlight sync.Map // node ID -> *atomic.Int64, requests currently being served, for LatencySelector
+
+	reputation *reputation.Tracker // per-peer-pair upload/download ratios, for RarestFirstSelector
+	health     *health.Tracker     // per-node circuit breaker state, see recordNodeOutcome
+
+	selectorMu   sync.RWMutex
+	selectors    map[string]PeerSelector
+	selectorName string
 }
 
 type statusRecorder struct {
@@ -70,12 +90,114 @@ type RequestResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// assumedSegmentBytes stands in for the actual transfer size when a peer
+// hit records upload/download into the reputation ledger - the simulator
+// doesn't move real bytes, so every P2P hit is treated as one HLS
+// segment's worth of traffic for reciprocity-scoring purposes.
+const assumedSegmentBytes = 256 * 1024
+
 var metricsObj *metrics.Metrics
 
+// peeringMgr federates this instance's FindSegment out to independently-run
+// NetworkTopology instances it has peered with (see peering.go). nil until
+// main initializes it, the same pattern metricsObj already uses.
+var peeringMgr *PeeringManager
+
+// defaultSelector is the selector findClosestNode falls back to until an
+// operator switches it via POST /config/selector, preserving the
+// shortest-hop behavior FindSegment always had before selectors existed.
+const defaultSelector = "shortest-hop"
+
 func NewNetworkTopology() *NetworkTopology {
-	return &NetworkTopology{
-		nodes: make(map[string]*NetworkNode),
-		edges: make(map[string][]string),
+	nt := &NetworkTopology{
+		nodes:      make(map[string]*NetworkNode),
+		edges:      make(map[string][]string),
+		dht:        NewDHT(),
+		reputation: reputation.NewTracker(),
+		health:     health.NewTracker(),
+	}
+	nt.selectors = map[string]PeerSelector{
+		"shortest-hop": NewShortestHopSelector(nt),
+		"latency":      NewLatencySelector(nt),
+		"rarest-first": NewRarestFirstSelector(nt, nt.reputation),
+	}
+	nt.selectorName = defaultSelector
+	return nt
+}
+
+// SetSelector switches the PeerSelector findClosestNode defers to. It
+// reports false (and leaves the active selector unchanged) if name isn't
+// registered.
+func (nt *NetworkTopology) SetSelector(name string) bool {
+	nt.selectorMu.Lock()
+	defer nt.selectorMu.Unlock()
+	if _, ok := nt.selectors[name]; !ok {
+		return false
+	}
+	nt.selectorName = name
+	return true
+}
+
+// SelectorName reports which PeerSelector is currently active.
+func (nt *NetworkTopology) SelectorName() string {
+	nt.selectorMu.RLock()
+	defer nt.selectorMu.RUnlock()
+	return nt.selectorName
+}
+
+func (nt *NetworkTopology) currentSelector() PeerSelector {
+	nt.selectorMu.RLock()
+	defer nt.selectorMu.RUnlock()
+	return nt.selectors[nt.selectorName]
+}
+
+// beginRequest/endRequest/inFlightCount track how many requests are
+// currently being served against a node, independently of nt.mu so they
+// can be called from inside code already holding it (FindSegment holds
+// an RLock for its whole body). LatencySelector uses the count as a load
+// penalty.
+func (nt *NetworkTopology) beginRequest(nodeID string) {
+	v, _ := nt.inFlight.LoadOrStore(nodeID, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+}
+
+func (nt *NetworkTopology) endRequest(nodeID string) {
+	if v, ok := nt.inFlight.Load(nodeID); ok {
+		v.(*atomic.Int64).Add(-1)
+	}
+}
+
+func (nt *NetworkTopology) inFlightCount(nodeID string) int64 {
+	if v, ok := nt.inFlight.Load(nodeID); ok {
+		return v.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// recordNodeOutcome feeds a real request outcome back into nt.health (see
+// pkg/health), for POST /nodes/{id}/report. It mirrors the result onto
+// NetworkNode.NextAttemptAt for GET /topology and onto the
+// node_circuit_state gauge for dashboards.
+func (nt *NetworkTopology) recordNodeOutcome(nodeID string, success bool) {
+	if success {
+		nt.health.ReportSuccess(nodeID)
+	} else {
+		nt.health.ReportFailure(nodeID)
+	}
+
+	nt.mu.Lock()
+	if node, ok := nt.nodes[nodeID]; ok {
+		node.NextAttemptAt = nt.health.NextAttemptAt(nodeID)
+	}
+	nt.mu.Unlock()
+
+	current := nt.health.State(nodeID)
+	for _, s := range []health.State{health.StateClosed, health.StateOpen, health.StateHalfOpen} {
+		value := 0.0
+		if s == current {
+			value = 1.0
+		}
+		metricsObj.NodeCircuitState.WithLabelValues(nodeID, string(s)).Set(value)
 	}
 }
 
@@ -85,6 +207,21 @@ func (nt *NetworkTopology) AddNode(node *NetworkNode) {
 
 	nt.nodes[node.ID] = node
 	nt.edges[node.ID] = make([]string, 0)
+	nt.dht.Register(node.ID)
+}
+
+// FindProviders looks up up to k providers of segmentID via the DHT
+// overlay instead of scanning every node, giving FindSegment a
+// logarithmic-hop alternative to its tiered peer/edge/origin scan.
+func (nt *NetworkTopology) FindProviders(segmentID string, k int) ([]string, int) {
+	return nt.dht.FindProviders(segmentID, k, dhtLookupBudget)
+}
+
+// Announce publishes that nodeID holds segmentID to the DHT overlay's k
+// closest nodes to segmentID's key, so a later FindProviders call can
+// locate it.
+func (nt *NetworkTopology) Announce(nodeID, segmentID string) ([]string, int) {
+	return nt.dht.Announce(nodeID, segmentID)
 }
 
 func (nt *NetworkTopology) ConnectNodes(node1ID, node2ID string) {
@@ -181,6 +318,27 @@ func (nt *NetworkTopology) FindSegment(segmentID, fromNode string) *RequestRespo
 		altSegmentID = fmt.Sprintf("segment%03d.ts", segmentNum)
 	}
 
+	// 0. Try the DHT overlay first - a provider lookup costs O(log N)
+	// hops instead of the O(N) scans below. If it doesn't turn up a
+	// provider within its bounded time budget (not yet announced, or the
+	// walk just ran long), fall through to the tiered scan as before.
+	if providers, _ := nt.FindProviders(segmentID, 1); len(providers) > 0 {
+		if closest := nt.findClosestNode(fromNode, providers); closest != "" {
+			nt.beginRequest(closest)
+			defer nt.endRequest(closest)
+			final_src = "dht"
+			metricsObj.NodeRequests.WithLabelValues("dht", "hit").Inc()
+			path, hops := nt.FindShortestPath(fromNode, closest)
+			response.Success = true
+			response.Source = "dht"
+			response.Hops = hops
+			response.Path = path
+			response.Latency = nt.calculateLatency(path)
+			return response
+		}
+	}
+	metricsObj.NodeRequests.WithLabelValues("dht", "miss").Inc()
+
 	// 1. Check P2P peers (within 3 hops) - check both formats
 	peerNodes := nt.findPeersWithSegment(segmentID, fromNode, 3)
 	if len(peerNodes) == 0 && altSegmentID != "" {
@@ -190,6 +348,8 @@ func (nt *NetworkTopology) FindSegment(segmentID, fromNode string) *RequestRespo
 		// Find closest peer
 		closestPeer := nt.findClosestNode(fromNode, peerNodes)
 		if closestPeer != "" {
+			nt.beginRequest(closestPeer)
+			defer nt.endRequest(closestPeer)
 			final_src = "peer"
 			metricsObj.NodeRequests.WithLabelValues("peer", "hit").Inc()
 			path, hops := nt.FindShortestPath(fromNode, closestPeer)
@@ -198,6 +358,12 @@ func (nt *NetworkTopology) FindSegment(segmentID, fromNode string) *RequestRespo
 			response.Hops = hops
 			response.Path = path
 			response.Latency = nt.calculateLatency(path)
+			// Serving a P2P peer directly is the reciprocity-relevant case
+			// RarestFirstSelector's tit-for-tat scoring depends on; edge/
+			// origin aren't peers trading with each other so they're left
+			// out of the ledger.
+			nt.reputation.RecordUpload(closestPeer, fromNode, assumedSegmentBytes)
+			nt.reputation.RecordDownload(fromNode, closestPeer, assumedSegmentBytes)
 			return response
 		}
 	}
@@ -211,6 +377,8 @@ func (nt *NetworkTopology) FindSegment(segmentID, fromNode string) *RequestRespo
 	if len(edgeNodes) > 0 {
 		closestEdge := nt.findClosestNode(fromNode, edgeNodes)
 		if closestEdge != "" {
+			nt.beginRequest(closestEdge)
+			defer nt.endRequest(closestEdge)
 			final_src = "edge"
 			metricsObj.NodeRequests.WithLabelValues("edge", "hit").Inc()
 			path, hops := nt.FindShortestPath(fromNode, closestEdge)
@@ -232,6 +400,8 @@ func (nt *NetworkTopology) FindSegment(segmentID, fromNode string) *RequestRespo
 	if len(originNodes) > 0 {
 		closestOrigin := nt.findClosestNode(fromNode, originNodes)
 		if closestOrigin != "" {
+			nt.beginRequest(closestOrigin)
+			defer nt.endRequest(closestOrigin)
 			final_src = "origin"
 			metricsObj.NodeRequests.WithLabelValues("origin", "hit").Inc()
 			path, hops := nt.FindShortestPath(fromNode, closestOrigin)
@@ -245,6 +415,24 @@ func (nt *NetworkTopology) FindSegment(segmentID, fromNode string) *RequestRespo
 	}
 	metricsObj.NodeRequests.WithLabelValues("origin", "miss").Inc()
 
+	// 4. Federate out to any peered clusters (see peering.go) - other
+	// independently-run NetworkTopology instances that might hold
+	// segmentID without either side merging node sets. Queried last since
+	// it's the only tier that leaves the process.
+	if peeringMgr != nil {
+		if fed := peeringMgr.FederatedFindSegment(context.Background(), segmentID, fromNode); fed != nil {
+			final_src = "federated"
+			metricsObj.NodeRequests.WithLabelValues("federated", "hit").Inc()
+			response.Success = true
+			response.Source = "federated"
+			response.Hops = fed.Hops
+			response.Path = fed.Path
+			response.Latency = fed.Latency
+			return response
+		}
+		metricsObj.NodeRequests.WithLabelValues("federated", "miss").Inc()
+	}
+
 	response.Success = false
 	return response
 }
@@ -268,7 +456,7 @@ func (nt *NetworkTopology) findPeersWithSegment(segmentID, fromNode string, maxH
 			continue
 		}
 
-		if node, exists := nt.nodes[current]; exists && node.Type == "peer" {
+		if node, exists := nt.nodes[current]; exists && node.Type == "peer" && !nt.health.Blocked(current) {
 			// Check both segment formats
 			if node.Storage[segmentID] {
 				peers = append(peers, current)
@@ -341,23 +529,58 @@ func (nt *NetworkTopology) findOriginServersWithSegment(segmentID string) []stri
 	return origins
 }
 
+// findClosestNode used to always break ties by hop count itself; it now
+// hands candidates to whichever PeerSelector is currently configured (see
+// SetSelector), so an operator can A/B shortest-hop, latency-weighted and
+// tit-for-tat selection against the same running topology. Candidates
+// whose circuit is open and still backing off (see pkg/health) are
+// excluded before the selector ever sees them.
 func (nt *NetworkTopology) findClosestNode(fromNode string, candidates []string) string {
 	if len(candidates) == 0 {
 		return ""
 	}
 
-	closest := candidates[0]
-	minHops := 999
-
-	for _, candidate := range candidates {
-		_, hops := nt.FindShortestPath(fromNode, candidate)
-		if hops < minHops && hops > 0 {
-			minHops = hops
-			closest = candidate
+	nodes := make([]*NetworkNode, 0, len(candidates))
+	for _, id := range candidates {
+		if node, ok := nt.nodes[id]; ok && !nt.health.Blocked(id) {
+			nodes = append(nodes, node)
 		}
 	}
+	if len(nodes) == 0 {
+		return ""
+	}
 
-	return closest
+	chosen, err := nt.currentSelector().Select(context.Background(), nodes, Request{FromNode: fromNode})
+	if err != nil || chosen == nil {
+		return ""
+	}
+	// Claim is a no-op unless chosen's backoff had just elapsed, in which
+	// case this is the one half-open trial request its circuit allows.
+	nt.health.Claim(chosen.ID)
+	return chosen.ID
+}
+
+// SegmentCatalogBloom builds a Bloom filter over every segment ID any
+// node in this topology currently stores, for GET /peering/catalog - the
+// compact summary a peer's Reconcile loop fetches so it can skip a
+// federated lookup here without a network round-trip whenever
+// MayContain already says no.
+func (nt *NetworkTopology) SegmentCatalogBloom() ([]byte, uint32, uint32) {
+	nt.mu.RLock()
+	defer nt.mu.RUnlock()
+	seen := make(map[string]struct{})
+	for _, node := range nt.nodes {
+		for segmentID, has := range node.Storage {
+			if has {
+				seen[segmentID] = struct{}{}
+			}
+		}
+	}
+	f := newSegmentBloom(len(seen))
+	for segmentID := range seen {
+		f.add(segmentID)
+	}
+	return f.bits, f.m, f.k
 }
 
 func (nt *NetworkTopology) calculateLatency(path []string) int {
@@ -387,6 +610,10 @@ func main() {
 	// Create realistic network topology
 	createRealisticTopology(topology)
 
+	selfAddr := getenv("TOPOLOGY_SELF_ADDR", "http://localhost:"+port)
+	peeringMgr = NewPeeringManager(selfAddr)
+	go peeringMgr.Reconcile(context.Background())
+
 	// Start HTTP server
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
@@ -470,11 +697,16 @@ func main() {
 		}
 
 		topology.mu.Lock()
-		if node, exists := topology.nodes[data.NodeID]; exists {
-			node.Storage[data.SegmentID] = true
+		_, exists := topology.nodes[data.NodeID]
+		if exists {
+			topology.nodes[data.NodeID].Storage[data.SegmentID] = true
 		}
 		topology.mu.Unlock()
 
+		if exists {
+			topology.Announce(data.NodeID, data.SegmentID)
+		}
+
 		metricsObj.HTTPRequestTotal.WithLabelValues(
 			r.Method,
 			strconv.Itoa(rec.Status),
@@ -513,15 +745,21 @@ func main() {
 			return
 		}
 
+		var seeded []string
 		topology.mu.Lock()
 		for i := 1; i <= 5; i++ {
 			id := fmt.Sprintf("peer-%d", i)
 			if node, ok := topology.nodes[id]; ok && node.Type == "peer" {
 				node.Storage[data.SegmentID] = true
+				seeded = append(seeded, id)
 			}
 		}
 		topology.mu.Unlock()
 
+		for _, id := range seeded {
+			topology.Announce(id, data.SegmentID)
+		}
+
 		metricsObj.HTTPRequestTotal.WithLabelValues(
 			r.Method,
 			strconv.Itoa(rec.Status),
@@ -529,6 +767,238 @@ func main() {
 		).Inc()
 	})
 
+	r.Post("/dht/announce", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		var data struct {
+			NodeID    string `json:"nodeId"`
+			SegmentID string `json:"segmentId"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(rec, err.Error(), http.StatusBadRequest)
+			metricsObj.HTTPRequestTotal.WithLabelValues(
+				r.Method,
+				strconv.Itoa(rec.Status),
+				"/dht/announce",
+			).Inc()
+			return
+		}
+
+		storedAt, hops := topology.Announce(data.NodeID, data.SegmentID)
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(map[string]interface{}{
+			"storedAt": storedAt,
+			"hops":     hops,
+		})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/dht/announce",
+		).Inc()
+	})
+
+	r.Get("/dht/find", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		segmentID := r.URL.Query().Get("segmentId")
+		k := dhtK
+		if kParam := r.URL.Query().Get("k"); kParam != "" {
+			if parsed, err := strconv.Atoi(kParam); err == nil && parsed > 0 {
+				k = parsed
+			}
+		}
+
+		providers, hops := topology.FindProviders(segmentID, k)
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(map[string]interface{}{
+			"providers": providers,
+			"hops":      hops,
+		})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/dht/find",
+		).Inc()
+	})
+
+	r.Get("/peers/{id}/reputation", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		id := chi.URLParam(r, "id")
+		snapshots := topology.reputation.For(id)
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(map[string]interface{}{
+			"peer":       id,
+			"reputation": snapshots,
+		})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/peers/{id}/reputation",
+		).Inc()
+	})
+
+	r.Post("/config/selector", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		var data struct {
+			Name string `json:"name"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(rec, err.Error(), http.StatusBadRequest)
+			metricsObj.HTTPRequestTotal.WithLabelValues(
+				r.Method,
+				strconv.Itoa(rec.Status),
+				"/config/selector",
+			).Inc()
+			return
+		}
+
+		if !topology.SetSelector(data.Name) {
+			http.Error(rec, fmt.Sprintf("unknown selector %q", data.Name), http.StatusBadRequest)
+			metricsObj.HTTPRequestTotal.WithLabelValues(
+				r.Method,
+				strconv.Itoa(rec.Status),
+				"/config/selector",
+			).Inc()
+			return
+		}
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(map[string]interface{}{
+			"selector": topology.SelectorName(),
+		})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/config/selector",
+		).Inc()
+	})
+
+	r.Post("/nodes/{id}/report", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		id := chi.URLParam(r, "id")
+		var data struct {
+			Success   bool `json:"success"`
+			LatencyMs int  `json:"latencyMs"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(rec, err.Error(), http.StatusBadRequest)
+			metricsObj.HTTPRequestTotal.WithLabelValues(
+				r.Method,
+				strconv.Itoa(rec.Status),
+				"/nodes/{id}/report",
+			).Inc()
+			return
+		}
+
+		topology.recordNodeOutcome(id, data.Success)
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(map[string]interface{}{
+			"node":  id,
+			"state": topology.health.State(id),
+		})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/nodes/{id}/report",
+		).Inc()
+	})
+
+	r.Post("/peering/token", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(peeringMgr.IssueToken())
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/peering/token",
+		).Inc()
+	})
+
+	r.Post("/peering/establish", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		var data struct {
+			Token PeeringToken `json:"token"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(rec, err.Error(), http.StatusBadRequest)
+			metricsObj.HTTPRequestTotal.WithLabelValues(
+				r.Method,
+				strconv.Itoa(rec.Status),
+				"/peering/establish",
+			).Inc()
+			return
+		}
+
+		peering, err := peeringMgr.Establish(data.Token)
+		if err != nil {
+			http.Error(rec, err.Error(), http.StatusBadRequest)
+			metricsObj.HTTPRequestTotal.WithLabelValues(
+				r.Method,
+				strconv.Itoa(rec.Status),
+				"/peering/establish",
+			).Inc()
+			return
+		}
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(peering)
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/peering/establish",
+		).Inc()
+	})
+
+	r.Get("/peering", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(map[string]interface{}{
+			"peerings": peeringMgr.List(),
+		})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/peering",
+		).Inc()
+	})
+
+	r.Get("/peering/catalog", func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, Status: 200}
+
+		bits, m, k := topology.SegmentCatalogBloom()
+
+		rec.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rec).Encode(catalogBloomWire{Bits: bits, M: m, K: k})
+
+		metricsObj.HTTPRequestTotal.WithLabelValues(
+			r.Method,
+			strconv.Itoa(rec.Status),
+			"/peering/catalog",
+		).Inc()
+	})
+
 	log.Printf("Network topology service listening on port %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, r))
 }
@@ -647,6 +1117,28 @@ func createRealisticTopology(topology *NetworkTopology) {
 		}
 	}
 
+	// Every node is registered by now, so the DHT overlay can bootstrap
+	// its k-buckets against the full node set in one pass (see
+	// DHT.RefreshBuckets), then each node's existing Storage gets
+	// announced so FindProviders has something to find right away.
+	topology.dht.RefreshBuckets()
+	topology.mu.RLock()
+	type storedSegment struct {
+		nodeID, segmentID string
+	}
+	var toAnnounce []storedSegment
+	for _, node := range topology.nodes {
+		for segmentID, has := range node.Storage {
+			if has {
+				toAnnounce = append(toAnnounce, storedSegment{node.ID, segmentID})
+			}
+		}
+	}
+	topology.mu.RUnlock()
+	for _, s := range toAnnounce {
+		topology.Announce(s.nodeID, s.segmentID)
+	}
+
 	log.Printf("Created network topology with %d nodes", len(topology.nodes))
 }
 
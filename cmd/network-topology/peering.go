@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// federatedLookupTimeout bounds both how long a single peer's /request
+// call gets and how long FindSegment's whole federated tier waits across
+// every established peer combined - a remote cluster miss or network
+// hiccup shouldn't stall a local request indefinitely.
+const federatedLookupTimeout = 300 * time.Millisecond
+
+// reconcileInterval is how often Reconcile refreshes every established
+// peering's segment-catalog bloom filter.
+const reconcileInterval = 30 * time.Second
+
+// PeeringToken is what POST /peering/token hands out: enough for a
+// remote NetworkTopology instance to address this one and verify the
+// token wasn't forged, Consul-style peering without either side
+// importing the other's node set. Signature is ed25519 over every other
+// field, so a remote only has to trust that it's really talking to the
+// holder of PublicKey's private key - not any shared secret.
+type PeeringToken struct {
+	PeeringID string    `json:"peeringId"`
+	Address   string    `json:"address"` // base URL this service is reachable at
+	PublicKey []byte    `json:"publicKey"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	Signature []byte    `json:"signature"`
+}
+
+func (t PeeringToken) signingPayload() []byte {
+	buf, _ := json.Marshal(struct {
+		PeeringID string    `json:"peeringId"`
+		Address   string    `json:"address"`
+		PublicKey []byte    `json:"publicKey"`
+		IssuedAt  time.Time `json:"issuedAt"`
+	}{t.PeeringID, t.Address, t.PublicKey, t.IssuedAt})
+	return buf
+}
+
+// Peering is what this service knows about one established peer.
+type Peering struct {
+	PeeringID     string    `json:"peeringId"`
+	Address       string    `json:"address"`
+	PublicKey     []byte    `json:"publicKey,omitempty"`
+	EstablishedAt time.Time `json:"establishedAt"`
+	LastSeen      time.Time `json:"lastSeen"`
+	Healthy       bool      `json:"healthy"`
+
+	// bloom is the remote's segment catalog as of the last successful
+	// Reconcile tick; nil until the first fetch succeeds, in which case
+	// FederatedFindSegment has to query the peer directly to find out.
+	bloom *segmentBloom
+}
+
+// PeeringManager issues and verifies peering tokens, tracks established
+// peerings, and federates FindSegment's fourth tier out to them.
+type PeeringManager struct {
+	address string // this service's own reachable base URL, embedded in tokens it issues
+	pub     ed25519.PublicKey
+	priv    ed25519.PrivateKey
+	client  *http.Client
+
+	mu       sync.RWMutex
+	peerings map[string]*Peering
+}
+
+func NewPeeringManager(address string) *PeeringManager {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		panic(fmt.Sprintf("peering: generating keypair: %v", err))
+	}
+	return &PeeringManager{
+		address:  address,
+		pub:      pub,
+		priv:     priv,
+		client:   &http.Client{Timeout: federatedLookupTimeout},
+		peerings: make(map[string]*Peering),
+	}
+}
+
+// IssueToken mints a fresh, signed PeeringToken advertising this
+// service's address and public key.
+func (pm *PeeringManager) IssueToken() PeeringToken {
+	tok := PeeringToken{
+		PeeringID: fmt.Sprintf("peering_%d", time.Now().UnixNano()),
+		Address:   pm.address,
+		PublicKey: []byte(pm.pub),
+		IssuedAt:  time.Now(),
+	}
+	tok.Signature = ed25519.Sign(pm.priv, tok.signingPayload())
+	return tok
+}
+
+// Establish verifies token's self-signature and imports the remote side
+// as a peer. It doesn't contact the remote itself - the token already
+// carries its address and public key - so the first real network contact
+// with a newly-established peer happens on the next Reconcile tick or
+// federated FindSegment query.
+func (pm *PeeringManager) Establish(token PeeringToken) (*Peering, error) {
+	if len(token.PublicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("peering: malformed public key")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(token.PublicKey), token.signingPayload(), token.Signature) {
+		return nil, errors.New("peering: invalid token signature")
+	}
+	if token.Address == "" || token.PeeringID == "" {
+		return nil, errors.New("peering: token missing address or peering id")
+	}
+
+	p := &Peering{
+		PeeringID:     token.PeeringID,
+		Address:       token.Address,
+		PublicKey:     token.PublicKey,
+		EstablishedAt: time.Now(),
+		LastSeen:      time.Now(),
+		Healthy:       true,
+	}
+	pm.mu.Lock()
+	pm.peerings[p.PeeringID] = p
+	pm.mu.Unlock()
+	return p, nil
+}
+
+// List returns a snapshot of every established peering, for GET /peering.
+func (pm *PeeringManager) List() []Peering {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	out := make([]Peering, 0, len(pm.peerings))
+	for _, p := range pm.peerings {
+		out = append(out, *p)
+	}
+	return out
+}
+
+// FederatedFindSegment queries every established peer not already known
+// (via its reconciled bloom filter) to be missing segmentID, in
+// parallel, and returns whichever answers first with a hit. It's the
+// fourth tier FindSegment falls to after an origin miss, federating
+// lookups across independently-run NetworkTopology instances without
+// merging either side's node set.
+func (pm *PeeringManager) FederatedFindSegment(ctx context.Context, segmentID, fromNode string) *RequestResponse {
+	pm.mu.RLock()
+	candidates := make([]*Peering, 0, len(pm.peerings))
+	for _, p := range pm.peerings {
+		if p.bloom != nil && !p.bloom.MayContain(segmentID) {
+			continue // reconciled catalog says the remote definitely doesn't have it
+		}
+		candidates = append(candidates, p)
+	}
+	pm.mu.RUnlock()
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, federatedLookupTimeout)
+	defer cancel()
+
+	results := make(chan *RequestResponse, len(candidates))
+	for _, p := range candidates {
+		go func(p *Peering) {
+			resp, err := pm.queryPeer(ctx, p, segmentID, fromNode)
+			if err != nil {
+				resp = nil
+			}
+			results <- resp
+		}(p)
+	}
+
+	for range candidates {
+		select {
+		case resp := <-results:
+			if resp != nil && resp.Success {
+				return resp
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (pm *PeeringManager) queryPeer(ctx context.Context, p *Peering, segmentID, fromNode string) (*RequestResponse, error) {
+	body, err := json.Marshal(Request{SegmentID: segmentID, FromNode: fromNode})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(p.Address, "/")+"/request", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := pm.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out RequestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Reconcile runs until ctx is cancelled, periodically refreshing every
+// established peering's segment-catalog bloom filter, so most federated
+// lookups can be skipped without a network round-trip whenever
+// MayContain already says no.
+func (pm *PeeringManager) Reconcile(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pm.reconcileOnce(ctx)
+		}
+	}
+}
+
+func (pm *PeeringManager) reconcileOnce(ctx context.Context) {
+	pm.mu.RLock()
+	peerings := make([]*Peering, 0, len(pm.peerings))
+	for _, p := range pm.peerings {
+		peerings = append(peerings, p)
+	}
+	pm.mu.RUnlock()
+
+	for _, p := range peerings {
+		filter, healthy := pm.fetchCatalog(ctx, p)
+		pm.mu.Lock()
+		if cur, ok := pm.peerings[p.PeeringID]; ok {
+			cur.Healthy = healthy
+			if healthy {
+				cur.LastSeen = time.Now()
+				cur.bloom = filter
+			}
+		}
+		pm.mu.Unlock()
+	}
+}
+
+// catalogBloomWire is what GET /peering/catalog serves and fetchCatalog
+// decodes: a remote's segment catalog collapsed into a Bloom filter's
+// raw bits plus the (m, k) needed to test it.
+type catalogBloomWire struct {
+	Bits []byte `json:"bits"`
+	M    uint32 `json:"m"`
+	K    uint32 `json:"k"`
+}
+
+func (pm *PeeringManager) fetchCatalog(ctx context.Context, p *Peering) (*segmentBloom, bool) {
+	ctx, cancel := context.WithTimeout(ctx, federatedLookupTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Address, "/")+"/peering/catalog", nil)
+	if err != nil {
+		return nil, false
+	}
+	resp, err := pm.client.Do(req)
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false
+	}
+	var wire catalogBloomWire
+	if err := json.NewDecoder(resp.Body).Decode(&wire); err != nil {
+		return nil, false
+	}
+	return fromBits(wire.Bits, wire.M, wire.K), true
+}
+
+// Bloom filter sizing, mirroring the standard m = n*10, k = 7 tuning for
+// roughly a 1% false-positive rate at capacity. This is a small,
+// self-contained copy rather than an import of the other module's
+// pkg/bloom, since cmd/network-topology never depends on cloud_project/*
+// packages (see dht.go's own self-contained Kademlia implementation for
+// the same reasoning).
+const (
+	bloomBitsPerEntry = 10
+	bloomHashFuncs    = 7
+	bloomMinBits      = 64
+)
+
+type segmentBloom struct {
+	bits []byte
+	m, k uint32
+}
+
+func newSegmentBloom(n int) *segmentBloom {
+	bits := uint32(n) * bloomBitsPerEntry
+	if bits < bloomMinBits {
+		bits = bloomMinBits
+	}
+	return &segmentBloom{bits: make([]byte, (bits+7)/8), m: bits, k: bloomHashFuncs}
+}
+
+func fromBits(raw []byte, m, k uint32) *segmentBloom {
+	if m == 0 {
+		m = bloomMinBits
+	}
+	if k == 0 {
+		k = bloomHashFuncs
+	}
+	return &segmentBloom{bits: raw, m: m, k: k}
+}
+
+func (f *segmentBloom) add(key string) {
+	h1, h2 := bloomSplit(key)
+	for i := uint32(0); i < f.k; i++ {
+		idx := bloomIndex(h1, h2, i, f.m)
+		f.bits[idx/8] |= 1 << (idx % 8)
+	}
+}
+
+// MayContain reports whether key could be in the remote's catalog: false
+// means definitely not, true means present or a false positive.
+func (f *segmentBloom) MayContain(key string) bool {
+	h1, h2 := bloomSplit(key)
+	for i := uint32(0); i < f.k; i++ {
+		idx := bloomIndex(h1, h2, i, f.m)
+		if idx/8 >= uint32(len(f.bits)) || f.bits[idx/8]&(1<<(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomSplit(key string) (h1, h2 uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(key))
+	b := fnv.New64()
+	b.Write([]byte(key))
+	return a.Sum64(), b.Sum64()
+}
+
+func bloomIndex(h1, h2 uint64, i, m uint32) uint32 {
+	return uint32((h1 + uint64(i)*h2) % uint64(m))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/kalash/CDN-simulator/pkg/reputation"
+)
+
+// errNoCandidates is returned by a PeerSelector when it's handed an empty
+// candidate list - callers already guard against this, but a selector
+// called directly (e.g. from a future test) shouldn't panic on it.
+var errNoCandidates = errors.New("no candidates to select from")
+
+// PeerSelector picks which of several nodes known to hold a segment a
+// request should be routed to. findClosestNode defers to whichever
+// selector is currently configured (see NetworkTopology.SetSelector), so
+// an operator can A/B shortest-hop routing against latency- or
+// reputation-aware alternatives against the same running topology.
+type PeerSelector interface {
+	Select(ctx context.Context, candidates []*NetworkNode, req Request) (*NetworkNode, error)
+}
+
+// ShortestHopSelector is the original findClosestNode behavior: the
+// candidate reachable in the fewest BFS hops from the requester, ties
+// broken by candidate order.
+type ShortestHopSelector struct {
+	nt *NetworkTopology
+}
+
+func NewShortestHopSelector(nt *NetworkTopology) *ShortestHopSelector {
+	return &ShortestHopSelector{nt: nt}
+}
+
+func (s *ShortestHopSelector) Select(ctx context.Context, candidates []*NetworkNode, req Request) (*NetworkNode, error) {
+	if len(candidates) == 0 {
+		return nil, errNoCandidates
+	}
+	best := candidates[0]
+	minHops := -1
+	for _, c := range candidates {
+		_, hops := s.nt.FindShortestPath(req.FromNode, c.ID)
+		if hops <= 0 {
+			continue
+		}
+		if minHops == -1 || hops < minHops {
+			minHops = hops
+			best = c
+		}
+	}
+	return best, nil
+}
+
+// loadPenaltyMs is how many extra milliseconds one in-flight request
+// against a candidate adds to LatencySelector's score, approximating
+// queueing delay under load.
+const loadPenaltyMs = 20.0
+
+// defaultLatencyMs is used when fromNode has no recorded Latency entry
+// for a candidate, matching calculateLatency's own default for an
+// unknown hop.
+const defaultLatencyMs = 50.0
+
+// LatencySelector scores each candidate by its direct Latency entry from
+// the requester (falling back to defaultLatencyMs for an unknown pair)
+// plus a penalty for how many requests the candidate is currently
+// serving, so a nearby-but-overloaded peer loses to a farther-but-idle
+// one instead of ShortestHopSelector's pure hop count.
+type LatencySelector struct {
+	nt *NetworkTopology
+}
+
+func NewLatencySelector(nt *NetworkTopology) *LatencySelector {
+	return &LatencySelector{nt: nt}
+}
+
+func (s *LatencySelector) Select(ctx context.Context, candidates []*NetworkNode, req Request) (*NetworkNode, error) {
+	if len(candidates) == 0 {
+		return nil, errNoCandidates
+	}
+	s.nt.mu.RLock()
+	from, fromExists := s.nt.nodes[req.FromNode]
+	s.nt.mu.RUnlock()
+
+	var best *NetworkNode
+	bestScore := math.MaxFloat64
+	for _, c := range candidates {
+		latency := defaultLatencyMs
+		if fromExists {
+			if ms, ok := from.Latency[c.ID]; ok {
+				latency = float64(ms)
+			}
+		}
+		score := latency + float64(s.nt.inFlightCount(c.ID))*loadPenaltyMs
+		if score < bestScore {
+			bestScore = score
+			best = c
+		}
+	}
+	return best, nil
+}
+
+// RarestFirstSelector is BitTorrent-inspired: candidates are scored first
+// by tit-for-tat reciprocity - has this peer historically given back at
+// least as much as it received from the requester? - and, among
+// candidates tied on that, by how few segments they hold overall, on the
+// theory that a specialist holding less-replicated content is worth
+// favoring the same way a real BitTorrent client prioritizes rare pieces.
+type RarestFirstSelector struct {
+	nt  *NetworkTopology
+	rep *reputation.Tracker
+}
+
+func NewRarestFirstSelector(nt *NetworkTopology, rep *reputation.Tracker) *RarestFirstSelector {
+	return &RarestFirstSelector{nt: nt, rep: rep}
+}
+
+func (s *RarestFirstSelector) Select(ctx context.Context, candidates []*NetworkNode, req Request) (*NetworkNode, error) {
+	if len(candidates) == 0 {
+		return nil, errNoCandidates
+	}
+	var best *NetworkNode
+	var bestRatio float64
+	var bestRarity int
+	for _, c := range candidates {
+		ratio := s.rep.Ratio(c.ID, req.FromNode)
+		rarity := len(c.Storage)
+		if best == nil || ratio > bestRatio || (ratio == bestRatio && rarity < bestRarity) {
+			best, bestRatio, bestRarity = c, ratio, rarity
+		}
+	}
+	return best, nil
+}
@@ -5,12 +5,15 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,32 +21,76 @@ import (
 )
 
 type originConfig struct {
-	Port         string
-	DBHost       string
-	DBPort       string
-	DBUser       string
-	DBPassword   string
-	DBName       string
-	SongPath     string
-	SegmentDir   string
+	Port        string
+	DBHost      string
+	DBPort      string
+	DBUser      string
+	DBPassword  string
+	DBName      string
+	SongPath    string
+	SegmentDir  string
+	Ladder      []Rendition
+	Storage     string
+	S3Bucket    string
+	S3Prefix    string
+	LRUMaxBytes int64
 }
 
 type originApp struct {
 	cfg    originConfig
 	db     *sql.DB
+	store  SegmentStore
 	server *http.Server
 }
 
+// Rendition is one rung of the ABR ladder: a named audio bitrate (or, for
+// a video source, a resolution/bitrate pair) segmentSong transcodes the
+// source into.
+type Rendition struct {
+	Name       string `json:"name"`
+	Bitrate    string `json:"bitrate"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+func defaultLadder() []Rendition {
+	return []Rendition{
+		{Name: "64k", Bitrate: "64k"},
+		{Name: "128k", Bitrate: "128k"},
+		{Name: "256k", Bitrate: "256k"},
+	}
+}
+
+// loadLadder reads the ABR ladder from LADDER_CONFIG (a JSON array of
+// {"name", "bitrate", "resolution"} renditions), falling back to a
+// default 64k/128k/256k audio ladder if it's unset or malformed.
+func loadLadder() []Rendition {
+	raw := strings.TrimSpace(os.Getenv("LADDER_CONFIG"))
+	if raw == "" {
+		return defaultLadder()
+	}
+	var ladder []Rendition
+	if err := json.Unmarshal([]byte(raw), &ladder); err != nil || len(ladder) == 0 {
+		log.Printf("[origin] Invalid LADDER_CONFIG, falling back to default ladder: %v", err)
+		return defaultLadder()
+	}
+	return ladder
+}
+
 func loadConfig() originConfig {
 	return originConfig{
-		Port:         getenv("ORIGIN_PORT", "8081"),
-		DBHost:       getenv("DB_HOST", "localhost"),
-		DBPort:       getenv("DB_PORT", "5432"),
-		DBUser:       getenv("DB_USER", "media"),
-		DBPassword:   getenv("DB_PASSWORD", "media_pass"),
-		DBName:       getenv("DB_NAME", "hls"),
-		SongPath:     getenv("SONG_PATH", "Rick-Roll-Sound-Effect.mp3"),
-		SegmentDir:   getenv("SEGMENT_DIR", "./segments"),
+		Port:        getenv("ORIGIN_PORT", "8081"),
+		DBHost:      getenv("DB_HOST", "localhost"),
+		DBPort:      getenv("DB_PORT", "5432"),
+		DBUser:      getenv("DB_USER", "media"),
+		DBPassword:  getenv("DB_PASSWORD", "media_pass"),
+		DBName:      getenv("DB_NAME", "hls"),
+		SongPath:    getenv("SONG_PATH", "Rick-Roll-Sound-Effect.mp3"),
+		SegmentDir:  getenv("SEGMENT_DIR", "./segments"),
+		Ladder:      loadLadder(),
+		Storage:     getenv("ORIGIN_STORAGE", "postgres"),
+		S3Bucket:    getenv("S3_BUCKET", ""),
+		S3Prefix:    getenv("S3_PREFIX", ""),
+		LRUMaxBytes: getenvInt64("LRU_MAX_BYTES", 64*1024*1024),
 	}
 }
 
@@ -55,6 +102,18 @@ func getenv(key, fallback string) string {
 	return val
 }
 
+func getenvInt64(key string, fallback int64) int64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
@@ -91,11 +150,13 @@ func (a *originApp) initDB(ctx context.Context) error {
 		song_id VARCHAR(255) NOT NULL,
 		bitrate VARCHAR(50),
 		segment_index INTEGER,
+		duration REAL NOT NULL DEFAULT 10,
 		data BYTEA NOT NULL,
 		created_at TIMESTAMP DEFAULT NOW()
 	);
 	CREATE INDEX IF NOT EXISTS idx_song_id ON segments(song_id);
 	CREATE INDEX IF NOT EXISTS idx_segment_id ON segments(id);
+	ALTER TABLE segments ADD COLUMN IF NOT EXISTS duration REAL NOT NULL DEFAULT 10;
 	`
 	
 	if _, err := a.db.ExecContext(ctx, createTable); err != nil {
@@ -137,52 +198,78 @@ func (a *originApp) segmentSong(ctx context.Context) error {
 	}
 
 	songID := "rickroll"
-	bitrate := "128k"
-	outputDir := filepath.Join(a.cfg.SegmentDir, songID, bitrate)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output dir: %w", err)
-	}
 
-	// Check if segments already exist in DB
-	var count int
-	err := a.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM segments WHERE song_id = $1", songID).Scan(&count)
-	if err == nil && count > 0 {
-		log.Printf("[origin] Segments for %s already exist in database (%d segments)", songID, count)
+	// Check if segments already exist in the store
+	existing, err := a.store.List(ctx, songID)
+	if err == nil && len(existing) > 0 {
+		log.Printf("[origin] Segments for %s already exist in store (%d segments)", songID, len(existing))
 		return nil
 	}
 
-	log.Printf("[origin] Segmenting song: %s (found at: %s)", a.cfg.SongPath, songPath)
-	
 	// Find ffmpeg executable
 	ffmpegPath := "ffmpeg"
-	if portableFFmpeg := filepath.Join("ffmpeg-portable", "ffmpeg-8.0-essentials_build", "bin", "ffmpeg.exe"); 
+	if portableFFmpeg := filepath.Join("ffmpeg-portable", "ffmpeg-8.0-essentials_build", "bin", "ffmpeg.exe");
 		fileExists(portableFFmpeg) {
 		ffmpegPath = portableFFmpeg
 	} else if portableFFmpegLinux := filepath.Join("ffmpeg-portable", "ffmpeg-8.0-essentials_build", "bin", "ffmpeg");
 		fileExists(portableFFmpegLinux) {
 		ffmpegPath = portableFFmpegLinux
 	}
-	
+
+	for _, rendition := range a.cfg.Ladder {
+		if err := a.segmentRendition(ctx, ffmpegPath, songPath, songID, rendition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// segmentRendition transcodes songPath into one ABR rung and stores its
+// segments under song_id/bitrate/segment in the segments table, the
+// per-rendition body the single-bitrate version of segmentSong used to
+// run once inline.
+func (a *originApp) segmentRendition(ctx context.Context, ffmpegPath, songPath, songID string, rendition Rendition) error {
+	bitrate := rendition.Bitrate
+	outputDir := filepath.Join(a.cfg.SegmentDir, songID, bitrate)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output dir: %w", err)
+	}
+
+	log.Printf("[origin] Segmenting song: %s (found at: %s) rendition=%s", a.cfg.SongPath, songPath, rendition.Name)
+
 	// Use ffmpeg to create HLS segments
 	playlistPath := filepath.Join(outputDir, "playlist.m3u8")
 	segmentPattern := filepath.Join(outputDir, "segment%03d.ts")
-	
-	cmd := exec.CommandContext(ctx, ffmpegPath,
+
+	args := []string{
 		"-i", songPath,
 		"-c:a", "aac",
-		"-b:a", "128k",
+		"-b:a", bitrate,
+	}
+	if rendition.Resolution != "" {
+		args = append(args, "-s", rendition.Resolution)
+	}
+	args = append(args,
 		"-f", "hls",
 		"-hls_time", "10",
 		"-hls_playlist_type", "vod",
 		"-hls_segment_filename", segmentPattern,
 		playlistPath,
 	)
-	
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	
+
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %w", err)
+		return fmt.Errorf("ffmpeg failed for rendition %s: %w", rendition.Name, err)
+	}
+
+	durations, err := parseHLSDurations(playlistPath)
+	if err != nil {
+		log.Printf("[origin] Warning: failed to read segment durations from %s: %v", playlistPath, err)
+		durations = map[string]float64{}
 	}
 
 	// Read and store segments in database
@@ -191,7 +278,7 @@ func (a *originApp) segmentSong(ctx context.Context) error {
 		return fmt.Errorf("failed to glob segments: %w", err)
 	}
 
-	log.Printf("[origin] Found %d segments, storing in database...", len(segmentFiles))
+	log.Printf("[origin] Found %d segments for rendition %s, storing...", len(segmentFiles), rendition.Name)
 
 	for i, segFile := range segmentFiles {
 		data, err := os.ReadFile(segFile)
@@ -204,27 +291,81 @@ func (a *originApp) segmentSong(ctx context.Context) error {
 		segName := filepath.Base(segFile)
 		segmentID := fmt.Sprintf("%s/%s/%s", songID, bitrate, segName)
 
-		// Store in database
-		_, err = a.db.ExecContext(ctx,
-			"INSERT INTO segments (id, song_id, bitrate, segment_index, data) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data",
-			segmentID, songID, bitrate, i, data)
-		if err != nil {
+		duration, ok := durations[segName]
+		if !ok {
+			duration = 10
+		}
+
+		meta := SegmentMeta{ID: segmentID, SongID: songID, Bitrate: bitrate, Index: i, Duration: duration}
+		if err := a.store.Put(ctx, meta, data); err != nil {
 			log.Printf("[origin] Warning: failed to store segment %s: %v", segmentID, err)
 			continue
 		}
 	}
 
-	log.Printf("[origin] Successfully stored %d segments in database", len(segmentFiles))
+	log.Printf("[origin] Successfully stored %d segments for rendition %s", len(segmentFiles), rendition.Name)
 	return nil
 }
 
+// parseHLSDurations reads ffmpeg's own HLS playlist output and returns
+// each segment filename's #EXTINF duration, so stored segments carry the
+// same durations a player would see in a freshly generated playlist
+// rather than an assumed flat value.
+func parseHLSDurations(playlistPath string) (map[string]float64, error) {
+	data, err := os.ReadFile(playlistPath)
+	if err != nil {
+		return nil, err
+	}
+
+	durations := make(map[string]float64)
+	var pending float64
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#EXTINF:") {
+			val := strings.TrimSuffix(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if d, err := strconv.ParseFloat(val, 64); err == nil {
+				pending = d
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		durations[filepath.Base(line)] = pending
+	}
+	return durations, nil
+}
+
+// bitrateToBandwidth converts a ffmpeg-style bitrate string like "128k"
+// or "2m" into bits/sec, the BANDWIDTH attribute value master playlists
+// advertise per rendition. Returns 0 if bitrate doesn't parse.
+func bitrateToBandwidth(bitrate string) int {
+	b := strings.ToLower(strings.TrimSpace(bitrate))
+	mult := 1
+	switch {
+	case strings.HasSuffix(b, "k"):
+		mult = 1_000
+		b = strings.TrimSuffix(b, "k")
+	case strings.HasSuffix(b, "m"):
+		mult = 1_000_000
+		b = strings.TrimSuffix(b, "m")
+	}
+	n, err := strconv.Atoi(b)
+	if err != nil {
+		return 0
+	}
+	return n * mult
+}
+
 func (a *originApp) startHTTP(ctx context.Context) *http.Server {
 	mux := http.NewServeMux()
 	
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		if err := a.db.PingContext(r.Context()); err != nil {
-			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
-			return
+		if a.db != nil {
+			if err := a.db.PingContext(r.Context()); err != nil {
+				http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+				return
+			}
 		}
 		fmt.Fprint(w, "origin: ok")
 	})
@@ -241,11 +382,8 @@ func (a *originApp) startHTTP(ctx context.Context) *http.Server {
 			return
 		}
 
-		// Fetch segment from database
-		var data []byte
-		err := a.db.QueryRowContext(r.Context(),
-			"SELECT data FROM segments WHERE id = $1", segmentID).Scan(&data)
-		if err == sql.ErrNoRows {
+		data, err := a.store.Get(r.Context(), segmentID)
+		if errors.Is(err, errSegmentNotFound) {
 			http.NotFound(w, r)
 			return
 		}
@@ -272,24 +410,17 @@ func (a *originApp) startHTTP(ctx context.Context) *http.Server {
 			return
 		}
 
-		rows, err := a.db.QueryContext(r.Context(),
-			"SELECT id, segment_index FROM segments WHERE song_id = $1 ORDER BY segment_index", songID)
+		metas, err := a.store.List(r.Context(), songID)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
 
 		var segments []map[string]interface{}
-		for rows.Next() {
-			var id string
-			var index int
-			if err := rows.Scan(&id, &index); err != nil {
-				continue
-			}
+		for _, m := range metas {
 			segments = append(segments, map[string]interface{}{
-				"id":    id,
-				"index": index,
+				"id":    m.ID,
+				"index": m.Index,
 			})
 		}
 
@@ -300,6 +431,96 @@ func (a *originApp) startHTTP(ctx context.Context) *http.Server {
 		})
 	})
 
+	mux.HandleFunc("/master/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		songID := strings.TrimPrefix(r.URL.Path, "/master/")
+		if songID == "" {
+			http.Error(w, "song id required", http.StatusBadRequest)
+			return
+		}
+
+		metas, err := a.store.List(r.Context(), songID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		seen := make(map[string]bool)
+		var bitrates []string
+		for _, m := range metas {
+			if seen[m.Bitrate] {
+				continue
+			}
+			seen[m.Bitrate] = true
+			bitrates = append(bitrates, m.Bitrate)
+		}
+		sort.Strings(bitrates)
+		if len(bitrates) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		var sb strings.Builder
+		sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+		for _, bitrate := range bitrates {
+			fmt.Fprintf(&sb, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"mp4a.40.2\"\n", bitrateToBandwidth(bitrate))
+			fmt.Fprintf(&sb, "/playlist/%s/%s\n", songID, bitrate)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprint(w, sb.String())
+	})
+
+	mux.HandleFunc("/playlist/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/playlist/")
+		songID, bitrate, found := strings.Cut(rest, "/")
+		if !found || songID == "" || bitrate == "" {
+			http.Error(w, "song id and bitrate required", http.StatusBadRequest)
+			return
+		}
+
+		metas, err := a.store.List(r.Context(), songID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		var segs []SegmentMeta
+		targetDuration := 10
+		for _, m := range metas {
+			if m.Bitrate != bitrate {
+				continue
+			}
+			if int(m.Duration+0.5) > targetDuration {
+				targetDuration = int(m.Duration + 0.5)
+			}
+			segs = append(segs, m)
+		}
+		if len(segs) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MEDIA-SEQUENCE:0\n", targetDuration)
+		for _, seg := range segs {
+			fmt.Fprintf(&sb, "#EXTINF:%.3f,\n/segments/%s\n", seg.Duration, seg.ID)
+		}
+		sb.WriteString("#EXT-X-ENDLIST\n")
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprint(w, sb.String())
+	})
+
 	server := &http.Server{
 		Addr:    ":" + a.cfg.Port,
 		Handler: mux,
@@ -319,16 +540,25 @@ func (a *originApp) startHTTP(ctx context.Context) *http.Server {
 func main() {
 	cfg := loadConfig()
 	app := &originApp{cfg: cfg}
-	
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Initialize database
-	if err := app.initDB(ctx); err != nil {
-		log.Fatalf("[origin] Failed to initialize database: %v", err)
+	// Only the postgres backend (bare or lru+postgres) needs a database
+	// connection; fs and s3 don't.
+	if strings.Contains(strings.ToLower(cfg.Storage), "postgres") {
+		if err := app.initDB(ctx); err != nil {
+			log.Fatalf("[origin] Failed to initialize database: %v", err)
+		}
+	}
+
+	store, err := loadStorage(ctx, cfg, app.db)
+	if err != nil {
+		log.Fatalf("[origin] Failed to initialize storage backend: %v", err)
 	}
+	app.store = store
 
-	// Segment song and store in database
+	// Segment song and store via the configured backend
 	if err := app.segmentSong(ctx); err != nil {
 		log.Fatalf("[origin] Failed to segment song: %v", err)
 	}
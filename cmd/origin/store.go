@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// SegmentMeta is the catalog row for one stored HLS segment - ID, which
+// song/bitrate/position it belongs to, and its duration - independent of
+// which SegmentStore backend is actually holding its bytes.
+type SegmentMeta struct {
+	ID       string  `json:"id"`
+	SongID   string  `json:"song_id"`
+	Bitrate  string  `json:"bitrate"`
+	Index    int     `json:"segment_index"`
+	Duration float64 `json:"duration"`
+}
+
+// errSegmentNotFound is what Get returns when id isn't in the store, so
+// handlers can tell "missing" apart from a backend failure without
+// depending on a backend-specific sentinel like sql.ErrNoRows.
+var errSegmentNotFound = errors.New("segment not found")
+
+// SegmentStore is where segmentSong writes transcoded HLS segments and
+// where the HTTP handlers read them back from, so neither has to know
+// which backend is selected. postgresStore keeps the original
+// all-in-the-database behavior; fsStore and s3Store let a large catalog
+// live outside Postgres; lruMemoryStore wraps any of the three with a
+// bounded in-memory hot cache. Picked via ORIGIN_STORAGE, see
+// loadStorage.
+type SegmentStore interface {
+	Put(ctx context.Context, meta SegmentMeta, data []byte) error
+	Get(ctx context.Context, id string) ([]byte, error)
+	List(ctx context.Context, songID string) ([]SegmentMeta, error)
+	Exists(ctx context.Context, id string) bool
+}
+
+// loadStorage builds the SegmentStore selected by ORIGIN_STORAGE:
+// "postgres" (default), "fs", "s3", or any of those prefixed "lru+" to
+// front it with a bounded in-memory cache. db is only read when the
+// postgres backend is selected.
+func loadStorage(ctx context.Context, cfg originConfig, db *sql.DB) (SegmentStore, error) {
+	kind := strings.ToLower(strings.TrimSpace(cfg.Storage))
+	if kind == "" {
+		kind = "postgres"
+	}
+
+	lru := false
+	if strings.HasPrefix(kind, "lru+") {
+		lru = true
+		kind = strings.TrimPrefix(kind, "lru+")
+	}
+
+	var backing SegmentStore
+	switch kind {
+	case "postgres":
+		if db == nil {
+			return nil, fmt.Errorf("loadStorage: postgres backend requires a database connection")
+		}
+		backing = newPostgresStore(db)
+	case "fs":
+		backing = newFSStore(cfg.SegmentDir)
+	case "s3":
+		store, err := newS3Store(ctx, cfg.S3Bucket, cfg.S3Prefix)
+		if err != nil {
+			return nil, err
+		}
+		backing = store
+	default:
+		return nil, fmt.Errorf("loadStorage: unknown ORIGIN_STORAGE %q", cfg.Storage)
+	}
+
+	if lru {
+		return newLRUMemoryStore(backing, cfg.LRUMaxBytes), nil
+	}
+	return backing, nil
+}
+
+// postgresStore is the original segmentSong/HTTP-handler behavior:
+// segment bytes and their catalog row live in the same "segments" table.
+type postgresStore struct {
+	db *sql.DB
+}
+
+func newPostgresStore(db *sql.DB) *postgresStore {
+	return &postgresStore{db: db}
+}
+
+func (s *postgresStore) Put(ctx context.Context, meta SegmentMeta, data []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO segments (id, song_id, bitrate, segment_index, duration, data) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, duration = EXCLUDED.duration",
+		meta.ID, meta.SongID, meta.Bitrate, meta.Index, meta.Duration, data)
+	return err
+}
+
+func (s *postgresStore) Get(ctx context.Context, id string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM segments WHERE id = $1", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errSegmentNotFound
+	}
+	return data, err
+}
+
+func (s *postgresStore) Exists(ctx context.Context, id string) bool {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE id = $1)", id).Scan(&exists)
+	return err == nil && exists
+}
+
+func (s *postgresStore) List(ctx context.Context, songID string) ([]SegmentMeta, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, song_id, bitrate, segment_index, duration FROM segments WHERE song_id = $1 ORDER BY segment_index", songID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metas []SegmentMeta
+	for rows.Next() {
+		var m SegmentMeta
+		if err := rows.Scan(&m.ID, &m.SongID, &m.Bitrate, &m.Index, &m.Duration); err != nil {
+			return nil, err
+		}
+		metas = append(metas, m)
+	}
+	return metas, rows.Err()
+}
+
+// fsStore writes segment bytes straight to disk under root (SEGMENT_DIR)
+// at their ID's own path, skipping the database round-trip and reusing
+// ffmpeg's on-disk output layout. Each segment's SegmentMeta is kept in a
+// sidecar "<id>.meta.json" file next to it, since the filesystem itself
+// has nowhere else to hold bitrate/index/duration.
+type fsStore struct {
+	root string
+}
+
+func newFSStore(root string) *fsStore {
+	return &fsStore{root: root}
+}
+
+func (s *fsStore) segmentPath(id string) string {
+	return filepath.Join(s.root, filepath.FromSlash(id))
+}
+
+func (s *fsStore) Put(ctx context.Context, meta SegmentMeta, data []byte) error {
+	segPath := s.segmentPath(meta.ID)
+	if err := os.MkdirAll(filepath.Dir(segPath), 0755); err != nil {
+		return fmt.Errorf("fsStore: mkdir: %w", err)
+	}
+	if err := os.WriteFile(segPath, data, 0644); err != nil {
+		return fmt.Errorf("fsStore: write segment: %w", err)
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("fsStore: marshal meta: %w", err)
+	}
+	if err := os.WriteFile(segPath+".meta.json", metaBytes, 0644); err != nil {
+		return fmt.Errorf("fsStore: write meta: %w", err)
+	}
+	return nil
+}
+
+func (s *fsStore) Get(ctx context.Context, id string) ([]byte, error) {
+	data, err := os.ReadFile(s.segmentPath(id))
+	if os.IsNotExist(err) {
+		return nil, errSegmentNotFound
+	}
+	return data, err
+}
+
+func (s *fsStore) Exists(ctx context.Context, id string) bool {
+	_, err := os.Stat(s.segmentPath(id))
+	return err == nil
+}
+
+func (s *fsStore) List(ctx context.Context, songID string) ([]SegmentMeta, error) {
+	songDir := filepath.Join(s.root, songID)
+	if _, err := os.Stat(songDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var metas []SegmentMeta
+	err := filepath.WalkDir(songDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".meta.json") {
+			return nil
+		}
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var meta SegmentMeta
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return err
+		}
+		metas = append(metas, meta)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Index < metas[j].Index })
+	return metas, nil
+}
+
+// s3Store keeps segment bytes and their sidecar SegmentMeta as objects in
+// an S3 bucket under prefix, for origins that need to scale out
+// horizontally without sharing a filesystem or a single Postgres
+// instance.
+type s3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Store(ctx context.Context, bucket, prefix string) (*s3Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("newS3Store: S3_BUCKET is required for ORIGIN_STORAGE=s3")
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("newS3Store: load AWS config: %w", err)
+	}
+	return &s3Store{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *s3Store) key(id string) string {
+	return path.Join(s.prefix, id)
+}
+
+func (s *s3Store) metaKey(id string) string {
+	return s.key(id) + ".meta.json"
+}
+
+func (s *s3Store) Put(ctx context.Context, meta SegmentMeta, data []byte) error {
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(meta.ID)),
+		Body:   bytes.NewReader(data),
+	}); err != nil {
+		return fmt.Errorf("s3Store: put segment: %w", err)
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("s3Store: marshal meta: %w", err)
+	}
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.metaKey(meta.ID)),
+		Body:   bytes.NewReader(metaBytes),
+	}); err != nil {
+		return fmt.Errorf("s3Store: put meta: %w", err)
+	}
+	return nil
+}
+
+func (s *s3Store) Get(ctx context.Context, id string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(id)),
+	})
+	if err != nil {
+		return nil, errSegmentNotFound
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (s *s3Store) Exists(ctx context.Context, id string) bool {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(id)),
+	})
+	return err == nil
+}
+
+func (s *s3Store) List(ctx context.Context, songID string) ([]SegmentMeta, error) {
+	prefix := path.Join(s.prefix, songID)
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var metas []SegmentMeta
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3Store: list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if !strings.HasSuffix(*obj.Key, ".meta.json") {
+				continue
+			}
+			out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: obj.Key})
+			if err != nil {
+				return nil, fmt.Errorf("s3Store: get meta: %w", err)
+			}
+			raw, err := io.ReadAll(out.Body)
+			out.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			var meta SegmentMeta
+			if err := json.Unmarshal(raw, &meta); err != nil {
+				return nil, err
+			}
+			metas = append(metas, meta)
+		}
+	}
+
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Index < metas[j].Index })
+	return metas, nil
+}
+
+// lruEntry is one cached segment's payload, kept in lruMemoryStore's
+// eviction list alongside its ID so eviction can free the map entry too.
+type lruEntry struct {
+	id   string
+	data []byte
+}
+
+// lruMemoryStore wraps another SegmentStore with a bounded-byte-budget
+// LRU cache of hot segment payloads in front of it: Get checks the cache
+// before falling through to backing, and Put always writes through to
+// backing (a just-transcoded segment is also the likeliest next Get, so
+// it's seeded into the cache too). List and Exists pass straight through
+// to backing, since the catalog itself is cheap to query.
+type lruMemoryStore struct {
+	backing  SegmentStore
+	maxBytes int64
+
+	mu        sync.Mutex
+	usedBytes int64
+	ll        *list.List
+	items     map[string]*list.Element
+}
+
+func newLRUMemoryStore(backing SegmentStore, maxBytes int64) *lruMemoryStore {
+	if maxBytes <= 0 {
+		maxBytes = 64 * 1024 * 1024
+	}
+	return &lruMemoryStore{
+		backing:  backing,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *lruMemoryStore) Put(ctx context.Context, meta SegmentMeta, data []byte) error {
+	if err := s.backing.Put(ctx, meta, data); err != nil {
+		return err
+	}
+	s.cache(meta.ID, data)
+	return nil
+}
+
+func (s *lruMemoryStore) Get(ctx context.Context, id string) ([]byte, error) {
+	if data, ok := s.lookup(id); ok {
+		return data, nil
+	}
+	data, err := s.backing.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.cache(id, data)
+	return data, nil
+}
+
+func (s *lruMemoryStore) Exists(ctx context.Context, id string) bool {
+	if _, ok := s.lookup(id); ok {
+		return true
+	}
+	return s.backing.Exists(ctx, id)
+}
+
+func (s *lruMemoryStore) List(ctx context.Context, songID string) ([]SegmentMeta, error) {
+	return s.backing.List(ctx, songID)
+}
+
+func (s *lruMemoryStore) lookup(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.items[id]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(elem)
+	return elem.Value.(*lruEntry).data, true
+}
+
+func (s *lruMemoryStore) cache(id string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[id]; ok {
+		s.usedBytes -= int64(len(elem.Value.(*lruEntry).data))
+		elem.Value.(*lruEntry).data = data
+		s.ll.MoveToFront(elem)
+	} else {
+		elem := s.ll.PushFront(&lruEntry{id: id, data: data})
+		s.items[id] = elem
+	}
+	s.usedBytes += int64(len(data))
+
+	for s.usedBytes > s.maxBytes {
+		back := s.ll.Back()
+		if back == nil {
+			break
+		}
+		s.ll.Remove(back)
+		ent := back.Value.(*lruEntry)
+		delete(s.items, ent.id)
+		s.usedBytes -= int64(len(ent.data))
+	}
+}
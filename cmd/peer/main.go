@@ -1,24 +1,41 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"cloud_project/internal/backoff"
+	"cloud_project/internal/peer/breaker"
 	cachepkg "cloud_project/internal/peer/cache"
 	rttpkg "cloud_project/internal/peer/rtt"
+	schedulerpkg "cloud_project/internal/peer/scheduler"
 	signalclient "cloud_project/internal/peer/signalling"
 	trackerclient "cloud_project/internal/peer/tracker"
+	"cloud_project/internal/peer/wantlist"
+	"cloud_project/internal/peer/webseed"
+	"cloud_project/internal/priorityqueue"
+	"cloud_project/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type peerConfig struct {
@@ -26,42 +43,106 @@ type peerConfig struct {
 	Port              string
 	Neighbors         []string
 	TrackerURL        string
+	TrackerPSK        string // Pre-shared key for signed announces, if this peer has been provisioned one
 	TopologyURL       string
 	SignalURL         string
 	EdgeURLs          []string // List of edge server URLs
+	WebSeedURLs       []string // Origin CDN URLs to fall back to when P2P and edges both fail
+	WebSeedPathTmpl   string   // Optional Sprintf template ("%s/blobs/%s") for non-flat webseed layouts
+	ChecksumsPath     string   // Path to a checksums.json from tools/ffmpeg, used to verify webseed downloads
 	Room              string
 	Region            string
 	RTTms             int
 	HeartbeatInterval time.Duration
 	CacheCapacity     int
+	CachePolicy       string  // "lru" (default), "lfu", or "tinylfu"
+	SegmentAdvertise  string  // "full" (default) ships Segments; "bloom" ships a Bloom filter instead
+	BloomCounting     bool    // when true and SegmentAdvertise is "bloom", track the filter incrementally via a counting Bloom filter
+	Scheduler         string  // "fifo" (default), "lowest-rtt", or "least-loaded" peer-selection policy
+	QueueBands        int     // number of priority bands in the outbound segment-send queue
+	QueueCapacity     int     // per-band capacity of the outbound segment-send queue
+	QueueWorkers      int     // number of workers draining the outbound segment-send queue
+	CapacityAlpha     float64 // exponent applied to RTT when weighting distribution allocations
+
+	SendRetryMaxAttempts int           // attempts sendSegmentToPeer makes before giving up on one send
+	SendBreakerThreshold int           // consecutive send failures to a peer before its circuit breaker opens
+	SendBreakerCooldown  time.Duration // how long an open breaker stays open before a half-open probe
 }
 
 type peerApp struct {
-	cfg          peerConfig
-	cache        *cachepkg.LRU
-	tracker      *trackerclient.Client
-	signal       *signalclient.Client
-	server       *http.Server
-	heartbeatTrg chan struct{}
-	rttMeasurer  *rttpkg.Measurer
-	httpClient   *http.Client
+	cfg           peerConfig
+	cache         cachepkg.Policy
+	tracker       *trackerclient.Client
+	trackerStream *trackerclient.StreamClient
+	signal        *signalclient.Client
+	webseed       *webseed.Fetcher
+	scheduler     schedulerpkg.Scheduler
+	wants         *wantlist.Manager
+	sendQueue     *priorityqueue.Queue
+	sendBreaker   *breaker.Registry
+	server        *http.Server
+	heartbeatTrg  chan struct{}
+	rttMeasurer   *rttpkg.Measurer
+	httpClient    *http.Client
+	metrics       *metrics.Metrics
+	registry      *prometheus.Registry
+
+	inFlight            atomic.Int32 // number of requestSegment calls currently in progress
+	pathsMu             sync.Mutex
+	recentObservedPaths [][]string // last recentPathsCap distribution paths, most recent last
 }
 
-func newPeerApp(cfg peerConfig) *peerApp {
-	app := &peerApp{
-		cfg:          cfg,
-		cache:        cachepkg.NewLRU(cfg.CacheCapacity),
-		tracker:      trackerclient.NewClient(cfg.TrackerURL),
-		heartbeatTrg: make(chan struct{}, 1),
-		rttMeasurer:  rttpkg.NewMeasurer(),
-		httpClient:   &http.Client{Timeout: 5 * time.Second},
+func newPeerApp(cfg peerConfig, metricsObj *metrics.Metrics, registry *prometheus.Registry) *peerApp {
+	var checksums webseed.ChecksumIndex
+	if cfg.ChecksumsPath != "" {
+		loaded, err := webseed.LoadChecksums(cfg.ChecksumsPath)
+		if err != nil {
+			log.Printf("[%s] loading checksums from %s failed, webseed downloads won't be verified: %v", cfg.Name, cfg.ChecksumsPath, err)
+		} else {
+			checksums = loaded
+		}
+	}
+	rttMeasurer := rttpkg.NewMeasurer()
+	webseedFetcher := webseed.NewFetcher(cfg.WebSeedURLs, &http.Client{Timeout: 10 * time.Second}, checksums, rttMeasurer)
+	if cfg.WebSeedPathTmpl != "" {
+		webseedFetcher = webseedFetcher.WithPathTemplate(cfg.WebSeedPathTmpl)
 	}
+	app := &peerApp{
+		cfg:           cfg,
+		cache:         cachepkg.NewPolicy(cfg.CachePolicy, cfg.CacheCapacity, metricsObj),
+		tracker:       trackerclient.NewClient(cfg.TrackerURL, cfg.TrackerPSK),
+		trackerStream: trackerclient.NewStreamClient(cfg.TrackerURL, cfg.Name),
+		webseed:       webseedFetcher,
+		scheduler:     schedulerpkg.New(cfg.Scheduler, rttMeasurer),
+		wants:         wantlist.NewManager(),
+		sendBreaker:   breaker.New(cfg.SendBreakerThreshold, cfg.SendBreakerCooldown),
+		heartbeatTrg:  make(chan struct{}, 1),
+		rttMeasurer:   rttMeasurer,
+		httpClient:    &http.Client{Timeout: 5 * time.Second},
+		metrics:       metricsObj,
+		registry:      registry,
+	}
+	app.sendQueue = priorityqueue.New(cfg.QueueBands, cfg.QueueCapacity, cfg.QueueWorkers, cfg.Name,
+		func(ctx context.Context, item priorityqueue.Item) error {
+			return app.sendSegmentToPeer(ctx, item.PeerID, item.SegID, item.Data)
+		}, metricsObj)
+	app.trackerStream.OnPush(app.handleTrackerPush)
 	if cfg.SignalURL != "" {
 		app.signal = signalclient.NewClient(cfg.SignalURL, cfg.Room, cfg.Name, cfg.Neighbors)
 	}
 	return app
 }
 
+// handleTrackerPush logs a push notification from the tracker's stream.
+// peer_wants tells this peer another peer is about to request a segment
+// it holds; topology_changed tells it the graph around it moved. Neither
+// needs to act beyond logging today - the former is picked up by the
+// requester's ordinary fetch, the latter by the next announce - but the
+// hook point is here for callers that want to react sooner.
+func (a *peerApp) handleTrackerPush(msg trackerclient.PushMessage) {
+	log.Printf("[%s] tracker push: %s segment=%s peer=%s", a.cfg.Name, msg.Type, msg.SegmentID, msg.PeerID)
+}
+
 func loadConfig() peerConfig {
 	name := getenv("PEER_NAME", "peer")
 	port := getenv("PEER_PORT", "8080")
@@ -73,6 +154,7 @@ func loadConfig() peerConfig {
 		}
 	}
 	trackerURL := getenv("TRACKER_URL", "http://localhost:7070")
+	trackerPSK := getenv("TRACKER_PSK", "")
 	topologyURL := getenv("TOPOLOGY_URL", "http://localhost:8090")
 	signalURL := getenv("SIGNAL_URL", "ws://localhost:7080/ws")
 	rawEdgeURLs := strings.TrimSpace(os.Getenv("EDGE_URLS"))
@@ -83,25 +165,62 @@ func loadConfig() peerConfig {
 			edgeURLs[i] = strings.TrimSpace(edgeURLs[i])
 		}
 	}
+	rawWebSeedURLs := strings.TrimSpace(os.Getenv("WEBSEED_URLS"))
+	var webSeedURLs []string
+	if rawWebSeedURLs != "" {
+		webSeedURLs = strings.Split(rawWebSeedURLs, ",")
+		for i := range webSeedURLs {
+			webSeedURLs[i] = strings.TrimSpace(webSeedURLs[i])
+		}
+	}
+	checksumsPath := getenv("WEBSEED_CHECKSUMS_PATH", "")
+	webSeedPathTmpl := getenv("WEBSEED_PATH_TEMPLATE", "")
 	room := getenv("PEER_ROOM", "default")
 	region := getenv("PEER_REGION", "global")
 	rtt := getenvInt("PEER_RTT_MS", 25)
 	hbInterval := time.Duration(getenvInt("HEARTBEAT_INTERVAL_SEC", 30)) * time.Second
 	cacheCap := getenvInt("CACHE_CAPACITY", 64)
+	cachePolicy := getenv("CACHE_POLICY", "lru")
+	segmentAdvertise := getenv("PEER_SEGMENT_ADVERTISE_MODE", "full")
+	bloomCounting := getenv("PEER_BLOOM_COUNTING", "") == "1"
+	scheduler := getenv("PEER_SCHEDULER", "fifo")
+	queueBands := getenvInt("PEER_QUEUE_BANDS", 3)
+	queueCapacity := getenvInt("PEER_QUEUE_CAPACITY", 32)
+	queueWorkers := getenvInt("PEER_QUEUE_WORKERS", 4)
+	capacityAlpha := getenvFloat("PEER_CAPACITY_ALPHA", 1.0)
+	sendRetryMaxAttempts := getenvInt("PEER_SEND_RETRY_ATTEMPTS", 3)
+	sendBreakerThreshold := getenvInt("PEER_SEND_BREAKER_THRESHOLD", 3)
+	sendBreakerCooldown := time.Duration(getenvInt("PEER_SEND_BREAKER_COOLDOWN_SEC", 30)) * time.Second
 
 	return peerConfig{
 		Name:              name,
 		Port:              port,
 		Neighbors:         neighbors,
 		TrackerURL:        trackerURL,
+		TrackerPSK:        trackerPSK,
 		TopologyURL:       topologyURL,
 		SignalURL:         signalURL,
 		EdgeURLs:          edgeURLs,
+		WebSeedURLs:       webSeedURLs,
+		WebSeedPathTmpl:   webSeedPathTmpl,
+		ChecksumsPath:     checksumsPath,
 		Room:              room,
 		Region:            region,
 		RTTms:             rtt,
 		HeartbeatInterval: hbInterval,
 		CacheCapacity:     cacheCap,
+		CachePolicy:       cachePolicy,
+		SegmentAdvertise:  segmentAdvertise,
+		BloomCounting:     bloomCounting,
+		Scheduler:         scheduler,
+		QueueBands:        queueBands,
+		QueueCapacity:     queueCapacity,
+		QueueWorkers:      queueWorkers,
+		CapacityAlpha:     capacityAlpha,
+
+		SendRetryMaxAttempts: sendRetryMaxAttempts,
+		SendBreakerThreshold: sendBreakerThreshold,
+		SendBreakerCooldown:  sendBreakerCooldown,
 	}
 }
 
@@ -125,6 +244,18 @@ func getenvInt(key string, def int) int {
 	return i
 }
 
+func getenvFloat(key string, def float64) float64 {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
 func considerNeighborList(items []string) []string {
 	result := make([]string, 0, len(items))
 	seen := map[string]struct{}{}
@@ -147,6 +278,7 @@ func (a *peerApp) startHTTP(ctx context.Context) *http.Server {
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		fmt.Fprintf(w, "%s: ok", a.cfg.Name)
 	})
+	mux.Handle("/metrics", promhttp.HandlerFor(a.registry, promhttp.HandlerOpts{}))
 	mux.HandleFunc("/peers", func(w http.ResponseWriter, _ *http.Request) {
 		fmt.Fprintf(w, strings.Join(a.cfg.Neighbors, ","))
 	})
@@ -199,6 +331,121 @@ func (a *peerApp) startHTTP(ctx context.Context) *http.Server {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/net-diag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		neighbors := make([]netDiagNeighbor, 0, len(a.cfg.Neighbors))
+		for _, n := range a.cfg.Neighbors {
+			neighbors = append(neighbors, netDiagNeighbor{PeerID: n, RTTms: a.rttMeasurer.BlendedEstimate(n)})
+		}
+		writeJSON(w, netDiagResponse{
+			PeerID:      a.cfg.Name,
+			Neighbors:   neighbors,
+			CacheSize:   len(a.cache.Keys()),
+			InFlight:    int(a.inFlight.Load()),
+			RecentPaths: a.recentPaths(),
+		})
+	})
+	mux.HandleFunc("/net-diag/trace", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req traceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		path := req.Path
+		if len(path) == 0 {
+			if req.Target == "" {
+				http.Error(w, "target or path required", http.StatusBadRequest)
+				return
+			}
+			resolved, err := a.resolveTracePath(r.Context(), req.Target)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			path = resolved
+		}
+		writeJSON(w, a.runTrace(r.Context(), path))
+	})
+	mux.HandleFunc("/segments/raw/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/segments/raw/")
+		if id == "" {
+			http.Error(w, "segment id required", http.StatusBadRequest)
+			return
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, http.MaxBytesReader(w, r.Body, maxRawSegmentBytes)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data := buf.Bytes()
+		a.cache.Put(cachepkg.Segment{ID: id, Data: data})
+		a.segmentLanded(id, data)
+		a.triggerHeartbeat()
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/wantlist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req wantlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.PeerID == "" {
+			http.Error(w, "peer_id required", http.StatusBadRequest)
+			return
+		}
+		a.wants.Apply(req.PeerID, req.Add, req.Remove)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/haves", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Query().Get("mode") == "bloom" {
+			snapshot := cachepkg.BloomSnapshot(a.cache, 0, 0)
+			m, k, n := snapshot.Params()
+			writeJSON(w, havesBloomResponse{Bloom: snapshot.Bits(), M: m, K: k, N: n})
+			return
+		}
+		writeJSON(w, havesResponse{Segments: a.cache.Keys()})
+	})
+	mux.HandleFunc("/capacity", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		free := a.cfg.CacheCapacity - len(a.cache.Keys())
+		if free < 0 {
+			free = 0
+		}
+		writeJSON(w, capacityResponse{
+			FreeSegments: free,
+			AvgRTTms:     a.calculateAverageNeighborRTT(),
+			CPULoad:      runtime.NumGoroutine(),
+		})
+	})
+	mux.HandleFunc("/signalling", func(w http.ResponseWriter, r *http.Request) {
+		if a.signal == nil {
+			http.Error(w, "signalling not configured", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]any{"healthy": a.signal.Healthy()})
+	})
 	mux.HandleFunc("/rtt", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -287,6 +534,79 @@ type fetchSegmentResponse struct {
 	Payload string `json:"payload"`
 }
 
+// wantlistRequest is the POST /wantlist body: a batch of want-list
+// deltas peerID is announcing about itself.
+type wantlistRequest struct {
+	PeerID string           `json:"peer_id"`
+	Add    []wantlist.Entry `json:"add,omitempty"`
+	Remove []string         `json:"remove,omitempty"`
+}
+
+// havesResponse is the default GET /haves body: the full list of
+// segment IDs this peer currently holds.
+type havesResponse struct {
+	Segments []string `json:"segments"`
+}
+
+// havesBloomResponse is the GET /haves?mode=bloom body: a Bloom filter
+// snapshot of the held segments, in the same wire format used for
+// announce/heartbeat payloads.
+type havesBloomResponse struct {
+	Bloom []byte `json:"bloom"`
+	M     uint32 `json:"m"`
+	K     uint32 `json:"k"`
+	N     uint32 `json:"n"`
+}
+
+// capacityResponse is the GET /capacity body a node reports to a
+// requester planning a weighted distribution: how many more segments it
+// can hold, its average RTT to its own neighbors, and a lightweight load
+// proxy. True CPU usage isn't available without adding a dependency this
+// repo doesn't carry, so CPULoad is approximated by goroutine count -
+// good enough to tell "busy" from "idle" in this simulator.
+type capacityResponse struct {
+	FreeSegments int `json:"free_segments"`
+	AvgRTTms     int `json:"avg_rtt_ms"`
+	CPULoad      int `json:"cpu_load"`
+}
+
+// netDiagNeighbor is one entry in netDiagResponse's neighbor list.
+type netDiagNeighbor struct {
+	PeerID string `json:"peer_id"`
+	RTTms  int    `json:"rtt_ms"`
+}
+
+// netDiagResponse is the GET /net-diag body: this node's current view
+// of its immediate overlay neighborhood.
+type netDiagResponse struct {
+	PeerID      string            `json:"peer_id"`
+	Neighbors   []netDiagNeighbor `json:"neighbors"`
+	CacheSize   int               `json:"cache_size"`
+	InFlight    int               `json:"in_flight"`
+	RecentPaths [][]string        `json:"recent_paths"`
+}
+
+// traceRequest is the POST /net-diag/trace body. Callers kicking off a
+// trace supply Target and let this node resolve the path via topology;
+// a node continuing someone else's walk is instead handed the already-
+// resolved remaining Path directly.
+type traceRequest struct {
+	Target string   `json:"target,omitempty"`
+	Path   []string `json:"path,omitempty"`
+}
+
+// traceHop is one hop's measured RTT in a trace walk.
+type traceHop struct {
+	PeerID string `json:"peer_id"`
+	RTTms  int    `json:"rtt_ms"`
+}
+
+// traceResponse is the POST /net-diag/trace body: per-hop timings from
+// the receiving node onward to the end of the path.
+type traceResponse struct {
+	Hops []traceHop `json:"hops"`
+}
+
 func (a *peerApp) storeSegment(req storeSegmentRequest) error {
 	if req.ID == "" || req.Payload == "" {
 		return fmt.Errorf("id and payload required")
@@ -296,9 +616,392 @@ func (a *peerApp) storeSegment(req storeSegmentRequest) error {
 		return fmt.Errorf("invalid base64 payload: %w", err)
 	}
 	a.cache.Put(cachepkg.Segment{ID: req.ID, Data: data})
+	a.segmentLanded(req.ID, data)
 	return nil
 }
 
+// announceSegmentAdded streams a segment_added delta to the tracker in
+// place of waiting for the next full heartbeat to re-send this peer's
+// whole segment set. It's a no-op (falling back to the regular
+// heartbeat/announce path) whenever the stream isn't up.
+func (a *peerApp) announceSegmentAdded(segmentID string) {
+	if a.trackerStream == nil || !a.trackerStream.Healthy() {
+		return
+	}
+	a.trackerStream.Send(trackerclient.StreamEvent{Type: "segment_added", SegmentID: segmentID})
+}
+
+// segmentLanded is called every time data for segmentID ends up in the
+// local cache, from whatever source (peer, edge, webseed, or a direct
+// push). It cancels our own want-list entry for segmentID - recovering
+// it the moment it arrives rather than waiting for the next
+// reconciliation tick - and pushes the segment on to any neighbor that
+// told us (via POST /wantlist) it wants it, the Bitswap-style reactive
+// half of the want-list protocol.
+func (a *peerApp) segmentLanded(segmentID string, data []byte) {
+	a.announceSegmentAdded(segmentID)
+	a.wants.RemoveWant(segmentID)
+	for _, peerID := range a.wants.NeighborsWanting(segmentID) {
+		peerID := peerID
+		go func() {
+			pushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := a.sendSegmentToPeer(pushCtx, peerID, segmentID, data); err != nil {
+				log.Printf("[%s] failed to push wanted segment %s to %s: %v", a.cfg.Name, segmentID, peerID, err)
+				return
+			}
+			a.wants.ClearPeerWant(peerID, segmentID)
+		}()
+	}
+}
+
+// announceWant tells every neighbor that this peer now wants segmentID,
+// so they can push it the moment it lands on their side. It's
+// fire-and-forget like reportBadPeer: a neighbor missing the announce
+// just means this peer falls back to the next heartbeat's
+// reconcileWants pass instead.
+func (a *peerApp) announceWant(segmentID string, priority int) {
+	body := wantlistRequest{
+		PeerID: a.cfg.Name,
+		Add:    []wantlist.Entry{{SegmentID: segmentID, Priority: priority}},
+	}
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("[%s] failed to marshal want announcement for %s: %v", a.cfg.Name, segmentID, err)
+		return
+	}
+	for _, neighbor := range a.cfg.Neighbors {
+		neighbor := neighbor
+		go func() {
+			url := fmt.Sprintf("http://%s:%s/wantlist", neighbor, a.cfg.Port)
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonData)))
+			if err != nil {
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := a.httpClient.Do(req)
+			if err != nil {
+				log.Printf("[%s] announcing want for %s to %s failed: %v", a.cfg.Name, segmentID, neighbor, err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+}
+
+// reconcileWants runs once per heartbeat tick: for each still-open want,
+// it asks every neighbor what they have (full list or Bloom snapshot,
+// whichever PEER_SEGMENT_ADVERTISE_MODE the neighbor happens to be
+// running), picks the lowest-RTT neighbor that claims to have it, and
+// pulls it directly - recovering wants that the reactive push in
+// segmentLanded missed (the neighbor hadn't landed the segment yet when
+// it was announced) without waiting on the next push-distribution pass.
+func (a *peerApp) reconcileWants(ctx context.Context) {
+	open := a.wants.Wants()
+	if len(open) == 0 || len(a.cfg.Neighbors) == 0 {
+		return
+	}
+
+	haves := make(map[string]map[string]bool, len(a.cfg.Neighbors)) // neighbor -> segmentID -> has
+	for _, neighbor := range a.cfg.Neighbors {
+		segments, err := a.fetchHaves(ctx, neighbor)
+		if err != nil {
+			log.Printf("[%s] fetching haves from %s failed: %v", a.cfg.Name, neighbor, err)
+			continue
+		}
+		haves[neighbor] = segments
+	}
+
+	for _, want := range open {
+		bestNeighbor := ""
+		bestRTT := 0
+		for neighbor, segments := range haves {
+			if !segments[want.SegmentID] {
+				continue
+			}
+			rtt := a.rttMeasurer.BlendedEstimate(neighbor)
+			if bestNeighbor == "" || (rtt > 0 && rtt < bestRTT) {
+				bestNeighbor = neighbor
+				bestRTT = rtt
+			}
+		}
+		if bestNeighbor == "" {
+			continue
+		}
+		data, _, err := a.fetchSegmentFromPeer(ctx, bestNeighbor, want.SegmentID)
+		if err != nil {
+			log.Printf("[%s] reconciling want %s from %s failed: %v", a.cfg.Name, want.SegmentID, bestNeighbor, err)
+			continue
+		}
+		a.cache.Put(cachepkg.Segment{ID: want.SegmentID, Data: data})
+		a.segmentLanded(want.SegmentID, data)
+	}
+}
+
+// fetchHaves retrieves neighbor's current segment set via GET /haves,
+// keyed for quick membership tests against this peer's open wants.
+func (a *peerApp) fetchHaves(ctx context.Context, neighbor string) (map[string]bool, error) {
+	url := fmt.Sprintf("http://%s:%s/haves", neighbor, a.cfg.Port)
+	reqCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("neighbor returned status %d", resp.StatusCode)
+	}
+
+	var have havesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&have); err != nil {
+		return nil, err
+	}
+	segments := make(map[string]bool, len(have.Segments))
+	for _, id := range have.Segments {
+		segments[id] = true
+	}
+	return segments, nil
+}
+
+// fetchCapacity queries nodeID's GET /capacity for use by
+// planDistribution's weighted allocation.
+func (a *peerApp) fetchCapacity(ctx context.Context, nodeID string) (capacityResponse, error) {
+	url := fmt.Sprintf("http://%s:%s/capacity", nodeID, a.cfg.Port)
+	reqCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return capacityResponse{}, err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return capacityResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return capacityResponse{}, fmt.Errorf("node returned status %d", resp.StatusCode)
+	}
+	var capResp capacityResponse
+	if err := json.NewDecoder(resp.Body).Decode(&capResp); err != nil {
+		return capacityResponse{}, err
+	}
+	return capResp, nil
+}
+
+// nodeAllocation is one intermediate node's share of a song's segments,
+// as computed by planDistribution.
+type nodeAllocation struct {
+	nodeID       string
+	weight       float64
+	freeSegments int
+	count        int
+}
+
+// planDistribution weighs each intermediate node in pathStr (excluding
+// ourselves) by free cache capacity over RTT^alpha - w_i =
+// freeSegments_i / rtt_i^alpha - and splits segmentCount proportionally
+// via largest-remainder rounding so the totals land exactly on
+// segmentCount, capped so no node is handed more than it has room for.
+// A node we can't reach gets weight zero and count zero; its share
+// rolls over to requestSong's own "remaining segments" pass.
+func (a *peerApp) planDistribution(ctx context.Context, pathStr []string, segmentCount int) []nodeAllocation {
+	var allocs []nodeAllocation
+	for _, nodeID := range pathStr {
+		if nodeID == a.cfg.Name {
+			continue
+		}
+		if !a.sendBreaker.Allow(nodeID) {
+			log.Printf("[%s] %s's circuit breaker is open, rerouting its share elsewhere", a.cfg.Name, nodeID)
+			allocs = append(allocs, nodeAllocation{nodeID: nodeID})
+			continue
+		}
+		capResp, err := a.fetchCapacity(ctx, nodeID)
+		if err != nil {
+			log.Printf("[%s] capacity probe for %s failed, giving it no share: %v", a.cfg.Name, nodeID, err)
+			allocs = append(allocs, nodeAllocation{nodeID: nodeID})
+			continue
+		}
+		rtt := a.rttMeasurer.BlendedEstimate(nodeID)
+		if rtt <= 0 {
+			rtt = a.rttMeasurer.Get(nodeID)
+		}
+		if rtt <= 0 {
+			rtt = a.cfg.RTTms
+		}
+		weight := 0.0
+		if capResp.FreeSegments > 0 && rtt > 0 {
+			weight = float64(capResp.FreeSegments) / math.Pow(float64(rtt), a.cfg.CapacityAlpha)
+		}
+		allocs = append(allocs, nodeAllocation{nodeID: nodeID, weight: weight, freeSegments: capResp.FreeSegments})
+	}
+
+	totalWeight := 0.0
+	for _, al := range allocs {
+		totalWeight += al.weight
+	}
+	if totalWeight == 0 {
+		return allocs
+	}
+
+	type remainder struct {
+		idx   int
+		value float64
+	}
+	remainders := make([]remainder, 0, len(allocs))
+	assigned := 0
+	for i := range allocs {
+		raw := allocs[i].weight / totalWeight * float64(segmentCount)
+		count := int(raw)
+		if allocs[i].freeSegments > 0 && count > allocs[i].freeSegments {
+			count = allocs[i].freeSegments
+		}
+		allocs[i].count = count
+		assigned += count
+		remainders = append(remainders, remainder{idx: i, value: raw - math.Floor(raw)})
+	}
+
+	sort.Slice(remainders, func(i, j int) bool { return remainders[i].value > remainders[j].value })
+	for _, r := range remainders {
+		if assigned >= segmentCount {
+			break
+		}
+		al := &allocs[r.idx]
+		if al.freeSegments > 0 && al.count >= al.freeSegments {
+			continue
+		}
+		al.count++
+		assigned++
+	}
+	return allocs
+}
+
+// recentPathsCap bounds how many distribution paths net-diag remembers.
+const recentPathsCap = 10
+
+// recordPath appends path to the bounded history net-diag reports,
+// dropping the oldest entry once recentPathsCap is exceeded.
+func (a *peerApp) recordPath(path []string) {
+	cp := make([]string, len(path))
+	copy(cp, path)
+
+	a.pathsMu.Lock()
+	defer a.pathsMu.Unlock()
+	a.recentObservedPaths = append(a.recentObservedPaths, cp)
+	if len(a.recentObservedPaths) > recentPathsCap {
+		a.recentObservedPaths = a.recentObservedPaths[len(a.recentObservedPaths)-recentPathsCap:]
+	}
+}
+
+// recentPaths returns a copy of the recorded distribution path history.
+func (a *peerApp) recentPaths() [][]string {
+	a.pathsMu.Lock()
+	defer a.pathsMu.Unlock()
+	out := make([][]string, len(a.recentObservedPaths))
+	copy(out, a.recentObservedPaths)
+	return out
+}
+
+// resolveTracePath asks the topology service for the path from this
+// node to target, the same query requestSong uses to plan distribution.
+func (a *peerApp) resolveTracePath(ctx context.Context, target string) ([]string, error) {
+	url := fmt.Sprintf("%s/path?from=%s&to=%s", a.cfg.TopologyURL, a.cfg.Name, target)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("topology returned status %d for path query", resp.StatusCode)
+	}
+
+	var pathData map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&pathData); err != nil {
+		return nil, err
+	}
+	path, ok := pathData["path"].([]interface{})
+	if !ok || len(path) == 0 {
+		return nil, fmt.Errorf("invalid or empty path from topology")
+	}
+	pathStr := make([]string, 0, len(path))
+	for _, p := range path {
+		if s, ok := p.(string); ok {
+			pathStr = append(pathStr, s)
+		}
+	}
+	return pathStr, nil
+}
+
+// runTrace implements the recursive hop of POST /net-diag/trace: it
+// measures RTT to path[1] (the next hop) and, if more hops remain, asks
+// path[1] to continue the walk with the rest of the path, mirroring
+// IPFS's recursive network-diagnostic collection. The result is the
+// ordered list of per-hop timings from this node onward.
+func (a *peerApp) runTrace(ctx context.Context, path []string) traceResponse {
+	if len(path) < 2 {
+		return traceResponse{}
+	}
+	next := path[1]
+	start := time.Now()
+	url := fmt.Sprintf("http://%s:%s/health", next, a.cfg.Port)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	hopRTT := 0
+	if err == nil {
+		if resp, doErr := a.httpClient.Do(req); doErr == nil {
+			resp.Body.Close()
+			hopRTT = int(time.Since(start).Milliseconds())
+		}
+	}
+	hops := []traceHop{{PeerID: next, RTTms: hopRTT}}
+
+	if len(path) > 2 {
+		if continued, err := a.forwardTrace(ctx, next, path[1:]); err == nil {
+			hops = append(hops, continued.Hops...)
+		} else {
+			log.Printf("[%s] net-diag trace: forwarding to %s failed: %v", a.cfg.Name, next, err)
+		}
+	}
+	return traceResponse{Hops: hops}
+}
+
+// forwardTrace asks nodeID to continue a trace walk over the remaining
+// path via its own POST /net-diag/trace.
+func (a *peerApp) forwardTrace(ctx context.Context, nodeID string, path []string) (traceResponse, error) {
+	url := fmt.Sprintf("http://%s:%s/net-diag/trace", nodeID, a.cfg.Port)
+	body, err := json.Marshal(traceRequest{Path: path})
+	if err != nil {
+		return traceResponse{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return traceResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return traceResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return traceResponse{}, fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+	var out traceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return traceResponse{}, err
+	}
+	return out, nil
+}
+
 func (a *peerApp) triggerHeartbeat() {
 	select {
 	case a.heartbeatTrg <- struct{}{}:
@@ -316,27 +1019,50 @@ func (a *peerApp) heartbeatLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			a.emitHeartbeat(ctx)
+			a.reconcileWants(ctx)
+			a.reportBreakerMetrics()
+			a.pushPEXUpdate(ctx)
 		case <-a.heartbeatTrg:
 			a.emitHeartbeat(ctx)
 		}
 	}
 }
 
+// segmentAdvertisement is what emitAnnounce/emitHeartbeat ship to the
+// tracker in place of a raw Segments list: either the list itself
+// (default), or a Bloom filter over the same set when cfg.SegmentAdvertise
+// is "bloom" - sub-kilobyte even at 10k cache entries, at the cost of
+// occasional false positives that fetchSegmentFromPeer's 404 path and
+// requestSegment's candidate ordering have to tolerate.
+func (a *peerApp) segmentAdvertisement() ([]string, []byte, uint32, uint32, uint32) {
+	if a.cfg.SegmentAdvertise != "bloom" {
+		return a.cache.Keys(), nil, 0, 0, 0
+	}
+	snapshot := cachepkg.BloomSnapshot(a.cache, 0, 0)
+	m, k, n := snapshot.Params()
+	return nil, snapshot.Bits(), m, k, n
+}
+
 func (a *peerApp) emitAnnounce(ctx context.Context) {
 	if a.tracker == nil {
 		return
 	}
-	segments := a.cache.Keys()
-	
+	segments, bloomBits, bloomM, bloomK, bloomN := a.segmentAdvertisement()
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.rttMeasurer.TargetTimeout("tracker"))
+	defer cancel()
+
 	// Measure RTT to tracker
 	trackerRTT := a.rttMeasurer.Get("tracker")
 	if trackerRTT == 0 {
 		// First time, measure it
 		url := fmt.Sprintf("%s/healthz", a.cfg.TrackerURL)
-		if rtt, err := a.rttMeasurer.MeasureHTTP(ctx, a.httpClient, http.MethodGet, url); err == nil {
+		if rtt, err := a.rttMeasurer.MeasureHTTP(reqCtx, a.httpClient, http.MethodGet, url); err == nil {
 			a.rttMeasurer.Update("tracker", rtt)
+			a.rttMeasurer.UpdateQoS("tracker", time.Duration(rtt)*time.Millisecond)
 			trackerRTT = rtt
 		} else {
+			a.rttMeasurer.PenalizeQoS("tracker")
 			// Fallback to average or default
 			avg := a.rttMeasurer.GetAverage()
 			if avg == 0 {
@@ -346,31 +1072,39 @@ func (a *peerApp) emitAnnounce(ctx context.Context) {
 			}
 		}
 	}
-	
-	// Use average RTT to neighbors as our representative RTT
-	avgNeighborRTT := a.calculateAverageNeighborRTT()
-	if avgNeighborRTT == 0 {
-		avgNeighborRTT = trackerRTT
+
+	// Announce the blended QoS estimate rather than a raw neighbor
+	// average, so the tracker sees a stable value instead of jitter.
+	blendedRTT := a.rttMeasurer.BlendedEstimate("tracker")
+	if blendedRTT == 0 {
+		blendedRTT = trackerRTT
 	}
-	if avgNeighborRTT == 0 {
-		avgNeighborRTT = a.cfg.RTTms // Final fallback
+	if blendedRTT == 0 {
+		blendedRTT = a.cfg.RTTms // Final fallback
 	}
-	
+
 	payload := trackerclient.AnnouncePayload{
-		PeerID:    a.cfg.Name,
-		Room:      a.cfg.Room,
-		Region:    a.cfg.Region,
-		RTTms:     avgNeighborRTT, // Use measured RTT instead of static
-		Segments:  segments,
-		Neighbors: a.cfg.Neighbors,
-	}
-	if err := a.tracker.Announce(ctx, payload); err != nil {
+		PeerID:        a.cfg.Name,
+		Room:          a.cfg.Room,
+		Region:        a.cfg.Region,
+		RTTms:         blendedRTT, // Use blended QoS estimate instead of static
+		Segments:      segments,
+		Neighbors:     a.cfg.Neighbors,
+		WebSeeds:      a.cfg.WebSeedURLs,
+		SegmentsBloom: bloomBits,
+		SegmentsM:     bloomM,
+		SegmentsK:     bloomK,
+		SegmentsN:     bloomN,
+	}
+	if err := a.tracker.Announce(reqCtx, payload); err != nil {
+		a.rttMeasurer.PenalizeQoS("tracker")
 		log.Printf("[%s] tracker announce failed: %v", a.cfg.Name, err)
 	} else {
 		// Measure RTT to tracker after successful announce
 		url := fmt.Sprintf("%s/healthz", a.cfg.TrackerURL)
-		if rtt, err := a.rttMeasurer.MeasureHTTP(ctx, a.httpClient, http.MethodGet, url); err == nil {
+		if rtt, err := a.rttMeasurer.MeasureHTTP(reqCtx, a.httpClient, http.MethodGet, url); err == nil {
 			a.rttMeasurer.Update("tracker", rtt)
+			a.rttMeasurer.UpdateQoS("tracker", time.Duration(rtt)*time.Millisecond)
 		}
 	}
 }
@@ -379,23 +1113,93 @@ func (a *peerApp) emitHeartbeat(ctx context.Context) {
 	if a.tracker == nil {
 		return
 	}
-	segments := a.cache.Keys()
+	// While the tracker stream is up, a neighbor_changed delta plus the
+	// rtt_sample this peer is already measuring keep the tracker current
+	// at O(1) cost regardless of cache size - no need for the full
+	// Segments/Neighbors POST below.
+	if a.trackerStream != nil && a.trackerStream.Healthy() {
+		a.trackerStream.Send(trackerclient.StreamEvent{Type: "neighbor_changed", Neighbors: a.cfg.Neighbors})
+		if rtt := a.rttMeasurer.Get("tracker"); rtt > 0 {
+			a.trackerStream.Send(trackerclient.StreamEvent{Type: "rtt_sample", RTTms: rtt})
+		}
+		return
+	}
+
+	segments, bloomBits, bloomM, bloomK, bloomN := a.segmentAdvertisement()
 	payload := trackerclient.HeartbeatPayload{
-		PeerID:    a.cfg.Name,
-		Segments:  segments,
-		Neighbors: a.cfg.Neighbors,
+		PeerID:        a.cfg.Name,
+		Segments:      segments,
+		Neighbors:     a.cfg.Neighbors,
+		SegmentsBloom: bloomBits,
+		SegmentsM:     bloomM,
+		SegmentsK:     bloomK,
+		SegmentsN:     bloomN,
 	}
-	if err := a.tracker.Heartbeat(ctx, payload); err != nil {
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.rttMeasurer.TargetTimeout("tracker"))
+	defer cancel()
+
+	if err := a.tracker.Heartbeat(reqCtx, payload); err != nil {
+		a.rttMeasurer.PenalizeQoS("tracker")
 		log.Printf("[%s] tracker heartbeat failed: %v", a.cfg.Name, err)
 	} else {
 		// Measure RTT to tracker after successful heartbeat
 		url := fmt.Sprintf("%s/healthz", a.cfg.TrackerURL)
-		if rtt, err := a.rttMeasurer.MeasureHTTP(ctx, a.httpClient, http.MethodGet, url); err == nil {
+		if rtt, err := a.rttMeasurer.MeasureHTTP(reqCtx, a.httpClient, http.MethodGet, url); err == nil {
 			a.rttMeasurer.Update("tracker", rtt)
+			a.rttMeasurer.UpdateQoS("tracker", time.Duration(rtt)*time.Millisecond)
 		}
 	}
 }
 
+// pushPEXUpdate reports this peer's own observed-good neighbors to the
+// topology manager's peer-exchange endpoint (see internal/topology.PEX),
+// so other peers can learn about them via PEX instead of everyone having
+// to announce through the tracker. Only neighbors this peer has actually
+// measured an RTT to are reported, since those are the ones it can
+// vouch for as connectable.
+func (a *peerApp) pushPEXUpdate(ctx context.Context) {
+	if a.cfg.TopologyURL == "" {
+		return
+	}
+	rtts := a.rttMeasurer.GetAll()
+	if len(rtts) == 0 {
+		return
+	}
+	peers := make([]map[string]any, 0, len(rtts))
+	for peerID, rtt := range rtts {
+		if peerID == "tracker" {
+			continue
+		}
+		peers = append(peers, map[string]any{
+			"peer_id":     peerID,
+			"region":      a.cfg.Region,
+			"rtt_ms":      rtt,
+			"connectable": rtt > 0,
+		})
+	}
+	if len(peers) == 0 {
+		return
+	}
+	body, err := json.Marshal(map[string]any{"peer_id": a.cfg.Name, "peers": peers})
+	if err != nil {
+		return
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, a.cfg.TopologyURL+"/peers/exchange", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		log.Printf("[%s] pex push failed: %v", a.cfg.Name, err)
+		return
+	}
+	resp.Body.Close()
+}
+
 // calculateAverageNeighborRTT calculates the average RTT to all neighbors
 func (a *peerApp) calculateAverageNeighborRTT() int {
 	if len(a.cfg.Neighbors) == 0 {
@@ -420,24 +1224,37 @@ func (a *peerApp) calculateAverageNeighborRTT() int {
 // Returns the segment data, RTT in milliseconds, and any error
 func (a *peerApp) fetchSegmentFromPeer(ctx context.Context, peerID, segmentID string) ([]byte, int, error) {
 	url := fmt.Sprintf("http://%s:%s/segments/%s", peerID, a.cfg.Port, segmentID)
-	
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.rttMeasurer.TargetTimeout(peerID))
+	defer cancel()
+
 	// Measure RTT while fetching
 	start := time.Now()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, 0, err
 	}
 	resp, err := a.httpClient.Do(req)
 	if err != nil {
+		a.rttMeasurer.PenalizeQoS(peerID)
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	rtt := int(time.Since(start).Milliseconds())
-	
+
 	// Update RTT measurement for this peer
 	a.rttMeasurer.Update(peerID, rtt)
-	
+	a.rttMeasurer.UpdateQoS(peerID, time.Duration(rtt)*time.Millisecond)
+
 	if resp.StatusCode != http.StatusOK {
+		a.rttMeasurer.PenalizeQoS(peerID)
+		if resp.StatusCode == http.StatusNotFound {
+			// A 404 here means peerID's advertised Bloom filter (if it's
+			// advertising one) gave a false positive for segmentID -
+			// deprioritize it for this segment's bucket until the entry
+			// expires, rather than treating it like an ordinary failure.
+			a.rttMeasurer.RecordNegativeHit(peerID, segmentID)
+		}
 		return nil, rtt, fmt.Errorf("peer returned status %d", resp.StatusCode)
 	}
 	
@@ -457,23 +1274,29 @@ func (a *peerApp) fetchSegmentFromPeer(ctx context.Context, peerID, segmentID st
 // fetchSegmentFromEdge fetches a segment from an edge server
 func (a *peerApp) fetchSegmentFromEdge(ctx context.Context, edgeURL, segmentID string) ([]byte, int, error) {
 	url := fmt.Sprintf("%s/segments/%s", edgeURL, segmentID)
-	
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.rttMeasurer.TargetTimeout(edgeURL))
+	defer cancel()
+
 	start := time.Now()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, 0, err
 	}
 	resp, err := a.httpClient.Do(req)
 	if err != nil {
+		a.rttMeasurer.PenalizeQoS(edgeURL)
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	rtt := int(time.Since(start).Milliseconds())
-	
+
 	// Update RTT measurement for this edge
 	a.rttMeasurer.Update(edgeURL, rtt)
-	
+	a.rttMeasurer.UpdateQoS(edgeURL, time.Duration(rtt)*time.Millisecond)
+
 	if resp.StatusCode != http.StatusOK {
+		a.rttMeasurer.PenalizeQoS(edgeURL)
 		return nil, rtt, fmt.Errorf("edge returned status %d", resp.StatusCode)
 	}
 	
@@ -501,34 +1324,31 @@ func (a *peerApp) findBestEdge(ctx context.Context) (string, error) {
 		return a.cfg.EdgeURLs[0], nil
 	}
 	
-	// Measure RTT to all edges and find best
+	// Measure RTT to all edges and pick the one with the lowest blended
+	// QoS estimate, rather than the last raw sample, so a single slow
+	// probe doesn't bounce us off an otherwise-healthy edge.
 	bestEdge := a.cfg.EdgeURLs[0]
-	bestRTT := a.rttMeasurer.Get(bestEdge)
-	if bestRTT == 0 {
-		// Measure it
-		url := fmt.Sprintf("%s/health", bestEdge)
-		if rtt, err := a.rttMeasurer.MeasureHTTP(ctx, a.httpClient, http.MethodGet, url); err == nil {
-			a.rttMeasurer.Update(bestEdge, rtt)
-			bestRTT = rtt
-		}
-	}
-	
-	for _, edgeURL := range a.cfg.EdgeURLs[1:] {
-		rtt := a.rttMeasurer.Get(edgeURL)
-		if rtt == 0 {
-			// Measure it
+	bestScore := 0
+
+	for _, edgeURL := range a.cfg.EdgeURLs {
+		if a.rttMeasurer.Get(edgeURL) == 0 {
+			probeCtx, cancel := context.WithTimeout(ctx, a.rttMeasurer.TargetTimeout(edgeURL))
 			url := fmt.Sprintf("%s/health", edgeURL)
-			if measuredRTT, err := a.rttMeasurer.MeasureHTTP(ctx, a.httpClient, http.MethodGet, url); err == nil {
+			if measuredRTT, err := a.rttMeasurer.MeasureHTTP(probeCtx, a.httpClient, http.MethodGet, url); err == nil {
 				a.rttMeasurer.Update(edgeURL, measuredRTT)
-				rtt = measuredRTT
+				a.rttMeasurer.UpdateQoS(edgeURL, time.Duration(measuredRTT)*time.Millisecond)
+			} else {
+				a.rttMeasurer.PenalizeQoS(edgeURL)
 			}
+			cancel()
 		}
-		if rtt > 0 && (bestRTT == 0 || rtt < bestRTT) {
-			bestRTT = rtt
+		score := a.rttMeasurer.BlendedEstimate(edgeURL)
+		if score > 0 && (bestScore == 0 || score < bestScore) {
+			bestScore = score
 			bestEdge = edgeURL
 		}
 	}
-	
+
 	return bestEdge, nil
 }
 
@@ -544,7 +1364,33 @@ type segmentRequestResult struct {
 
 // requestSegment handles the full routing logic: P2P → Edge → Origin
 // Returns segment data, source type, path info, and error
+// reportBadPeer classifies a failed fetch from peerID and reports it to
+// the tracker, which bans the peer once enough corroborating reports
+// come in. It's fire-and-forget: a report failing to land shouldn't
+// hold up the caller's own fallback to the next peer.
+func (a *peerApp) reportBadPeer(peerID string, fetchErr error) {
+	reason := "timeout"
+	switch {
+	case errors.Is(fetchErr, context.DeadlineExceeded):
+		reason = "timeout"
+	case strings.Contains(fetchErr.Error(), "invalid base64 payload"):
+		reason = "protocol_violation"
+	case strings.Contains(fetchErr.Error(), "returned status"):
+		return
+	}
+	go func() {
+		reportCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := a.tracker.ReportBadPeer(reportCtx, peerID, reason); err != nil {
+			log.Printf("[%s] reporting bad peer %s failed: %v", a.cfg.Name, peerID, err)
+		}
+	}()
+}
+
 func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmentRequestResult, error) {
+	a.inFlight.Add(1)
+	defer a.inFlight.Add(-1)
+
 	// Step 1: Check local cache
 	if seg, ok := a.cache.Get(segmentID); ok {
 		return &segmentRequestResult{
@@ -556,7 +1402,14 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 			EstRTTms: 0,
 		}, nil
 	}
-	
+
+	// Not in cache - register it on our want-list and tell our neighbors,
+	// so even if every avenue below fails this request, the background
+	// reconciliation loop (and a neighbor's reactive push once it lands
+	// the segment itself) can still recover it without another call here.
+	a.wants.AddWant(segmentID, 1)
+	go a.announceWant(segmentID, 1)
+
 	// Step 2: Try P2P - query tracker
 	type trackerPeer struct {
 		PeerID string `json:"peer_id"`
@@ -569,7 +1422,7 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 		Peers   []trackerPeer `json:"peers"`
 	}
 	
-	trackerURL := fmt.Sprintf("%s/segments/%s?region=%s", a.cfg.TrackerURL, segmentID, a.cfg.Region)
+	trackerURL := fmt.Sprintf("%s/segments/%s?region=%s&peer=%s", a.cfg.TrackerURL, segmentID, a.cfg.Region, a.cfg.Name)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, trackerURL, nil)
 	if err != nil {
 		return nil, err
@@ -580,31 +1433,67 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 		var trackerResp trackerResponse
 		if err := json.NewDecoder(resp.Body).Decode(&trackerResp); err == nil {
 			resp.Body.Close()
-			
-			// Try fetching from best peer
+
+			// Bloom-advertised peers can show up here on a false positive;
+			// stable-partition any peer with a recent 404 for this
+			// segment's bucket to the back rather than dropping it, since
+			// the tracker's own ranking is otherwise still the best signal
+			// we have.
+			ordered := make([]trackerPeer, 0, len(trackerResp.Peers))
+			var suspect []trackerPeer
 			for _, peer := range trackerResp.Peers {
-				// Get path information to peer
-				pathURL := fmt.Sprintf("%s/path?from=%s&to=%s", a.cfg.TopologyURL, a.cfg.Name, peer.PeerID)
-				pathReq, err := http.NewRequestWithContext(ctx, http.MethodGet, pathURL, nil)
-				var pathInfo map[string]interface{}
-				if err == nil {
-					pathResp, err := a.httpClient.Do(pathReq)
-					if err == nil && pathResp.StatusCode == http.StatusOK {
-						json.NewDecoder(pathResp.Body).Decode(&pathInfo)
-						pathResp.Body.Close()
+				if a.rttMeasurer.IsNegativeHit(peer.PeerID, segmentID) {
+					suspect = append(suspect, peer)
+					continue
+				}
+				ordered = append(ordered, peer)
+			}
+			trackerResp.Peers = append(ordered, suspect...)
+
+			candidates := make([]schedulerpkg.Candidate, 0, len(trackerResp.Peers))
+			for _, peer := range trackerResp.Peers {
+				candidates = append(candidates, schedulerpkg.Candidate{PeerID: peer.PeerID, RTTms: peer.RTTms})
+			}
+			candidates = a.scheduler.Pick(candidates, segmentID)
+
+			if len(candidates) > 0 {
+				hedgeK := 2
+				if hedgeK > len(candidates) {
+					hedgeK = len(candidates)
+				}
+				hedgeAfter := a.rttMeasurer.TargetTimeout(candidates[0].PeerID) / 2
+
+				fetchFn := func(fctx context.Context, c schedulerpkg.Candidate, segID string) ([]byte, int, error) {
+					data, rtt, err := a.fetchSegmentFromPeer(fctx, c.PeerID, segID)
+					if err != nil && !errors.Is(err, context.Canceled) {
+						a.reportBadPeer(c.PeerID, err)
 					}
+					return data, rtt, err
 				}
-				
-				data, rtt, err := a.fetchSegmentFromPeer(ctx, peer.PeerID, segmentID)
+
+				result, err := schedulerpkg.HedgeFetch(ctx, a.scheduler, candidates, segmentID, hedgeK, hedgeAfter, fetchFn)
 				if err == nil {
 					// Store in cache
-					a.cache.Put(cachepkg.Segment{ID: segmentID, Data: data})
+					a.cache.Put(cachepkg.Segment{ID: segmentID, Data: result.Data})
+					a.segmentLanded(segmentID, result.Data)
 					a.triggerHeartbeat()
-					
+
+					// Get path information to the winning peer
+					pathURL := fmt.Sprintf("%s/path?from=%s&to=%s", a.cfg.TopologyURL, a.cfg.Name, result.Candidate.PeerID)
+					pathReq, pathErr := http.NewRequestWithContext(ctx, http.MethodGet, pathURL, nil)
+					var pathInfo map[string]interface{}
+					if pathErr == nil {
+						pathResp, pathErr := a.httpClient.Do(pathReq)
+						if pathErr == nil && pathResp.StatusCode == http.StatusOK {
+							json.NewDecoder(pathResp.Body).Decode(&pathInfo)
+							pathResp.Body.Close()
+						}
+					}
+
 					// Extract path information
-					path := []string{a.cfg.Name, peer.PeerID}
+					path := []string{a.cfg.Name, result.Candidate.PeerID}
 					hops := 1
-					estRTT := rtt
+					estRTT := result.RTTms
 					if pathInfo != nil {
 						if p, ok := pathInfo["path"].([]interface{}); ok {
 							path = make([]string, 0, len(p))
@@ -621,16 +1510,16 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 							estRTT = int(r)
 						}
 					}
-					
-					log.Printf("[%s] Fetched segment %s from P2P peer %s | Path: %v | Hops: %d | Est. RTT: %dms | Actual RTT: %dms", 
-						a.cfg.Name, segmentID, peer.PeerID, path, hops, estRTT, rtt)
-					
+
+					log.Printf("[%s] Fetched segment %s from P2P peer %s | Path: %v | Hops: %d | Est. RTT: %dms | Actual RTT: %dms",
+						a.cfg.Name, segmentID, result.Candidate.PeerID, path, hops, estRTT, result.RTTms)
+
 					return &segmentRequestResult{
-						Data:     data,
+						Data:     result.Data,
 						Source:   "p2p",
 						Path:     path,
 						Hops:     hops,
-						RTTms:    rtt,
+						RTTms:    result.RTTms,
 						EstRTTms: estRTT,
 					}, nil
 				}
@@ -666,6 +1555,7 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 		if err == nil {
 			// Store in cache
 			a.cache.Put(cachepkg.Segment{ID: segmentID, Data: data})
+			a.segmentLanded(segmentID, data)
 			a.triggerHeartbeat()
 			
 			// Extract path information
@@ -727,6 +1617,7 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 			data, rtt, err := a.fetchSegmentFromEdge(ctx, otherEdge, segmentID)
 			if err == nil {
 				a.cache.Put(cachepkg.Segment{ID: segmentID, Data: data})
+				a.segmentLanded(segmentID, data)
 				a.triggerHeartbeat()
 				
 				path := []string{a.cfg.Name, otherEdgeName}
@@ -764,7 +1655,25 @@ func (a *peerApp) requestSegment(ctx context.Context, segmentID string) (*segmen
 		}
 	}
 	
-	return nil, fmt.Errorf("segment not found in P2P network, edge servers, or origin")
+	// Step 4: P2P and edges both failed (or the topology graph had no
+	// path to any of them) - race the configured webseeds as a last
+	// resort, same graceful-degradation role BitTorrent clients give
+	// HTTP webseeds when the swarm is sparse.
+	data, source, err := a.webseed.Fetch(ctx, segmentID)
+	if err == nil {
+		a.cache.Put(cachepkg.Segment{ID: segmentID, Data: data})
+		a.segmentLanded(segmentID, data)
+		a.triggerHeartbeat()
+		log.Printf("[%s] Fetched segment %s from webseed %s", a.cfg.Name, segmentID, source)
+		return &segmentRequestResult{
+			Data:   data,
+			Source: "webseed",
+			Path:   []string{a.cfg.Name, source},
+			Hops:   1,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("segment not found in P2P network, edge servers, or webseeds: %w", err)
 }
 
 // requestSong requests an entire song and distributes segments along the path
@@ -827,8 +1736,9 @@ func (a *peerApp) requestSong(ctx context.Context, songID string) error {
 		estRTT = int(r)
 	}
 	
-	log.Printf("[%s] Requesting song %s from edge %s | Path: %v | Hops: %d | Est. RTT: %dms", 
+	log.Printf("[%s] Requesting song %s from edge %s | Path: %v | Hops: %d | Est. RTT: %dms",
 		a.cfg.Name, songID, edgeURL, pathStr, hops, estRTT)
+	a.recordPath(pathStr)
 	
 	// Get all segments for the song from edge
 	segmentsURL := fmt.Sprintf("%s/songs/%s", edgeURL, songID)
@@ -868,34 +1778,33 @@ func (a *peerApp) requestSong(ctx context.Context, songID string) error {
 		return fmt.Errorf("no segments found for song %s", songID)
 	}
 	
-	// Distribute segments: segmentCount / pathLength per node
-	segmentsPerNode := segmentCount / pathLength
-	if segmentsPerNode == 0 {
-		segmentsPerNode = 1
-	}
-	
-	log.Printf("[%s] Distributing %d segments along path of length %d (%d segments per node)", 
-		a.cfg.Name, segmentCount, pathLength, segmentsPerNode)
-	
+	// Distribute segments along the path, weighted by each intermediate
+	// node's free cache capacity and RTT rather than splitting evenly -
+	// a congested or nearly-full node gets fewer segments, an
+	// unreachable one gets none (its share rolls over to us below).
+	allocs := a.planDistribution(ctx, pathStr, segmentCount)
+
+	log.Printf("[%s] Distributing %d segments along path of length %d: %v",
+		a.cfg.Name, segmentCount, pathLength, allocs)
+
 	// Distribute segments to each node in path (excluding ourselves from intermediate distribution)
 	segmentIndex := 0
-	for _, nodeID := range pathStr {
-		if nodeID == a.cfg.Name {
-			// Skip ourselves in the distribution loop - we'll get remaining segments at the end
-			continue
-		}
-		
-		// Assign segmentsPerNode segments to this node
-		for j := 0; j < segmentsPerNode && segmentIndex < segmentCount; j++ {
+	distributedCount := 0
+	for pathIndex, alloc := range allocs {
+		// Nodes nearer the requester (lower pathIndex) get higher
+		// priority, since their sends unblock the requester sooner.
+		priority := pathIndex
+
+		for j := 0; j < alloc.count && segmentIndex < segmentCount; j++ {
 			if seg, ok := segments[segmentIndex].(map[string]interface{}); ok {
 				if segID, ok := seg["id"].(string); ok {
-					// Fetch segment from edge and send to intermediate peer
+					// Fetch segment from edge and queue it for the intermediate
+					// peer - the send-side priority queue takes it from here so
+					// one slow neighbor can't stall the rest of this loop.
 					data, _, err := a.fetchSegmentFromEdge(ctx, edgeURL, segID)
 					if err == nil {
-						// Send segment to intermediate peer for caching
-						if sendErr := a.sendSegmentToPeer(ctx, nodeID, segID, data); sendErr != nil {
-							log.Printf("[%s] Warning: failed to send segment %s to %s: %v", a.cfg.Name, segID, nodeID, sendErr)
-						}
+						a.sendQueue.Push(priorityqueue.Item{PeerID: alloc.nodeID, SegID: segID, Data: data, Priority: priority})
+						distributedCount++
 					} else {
 						log.Printf("[%s] Warning: failed to fetch segment %s from edge: %v", a.cfg.Name, segID, err)
 					}
@@ -904,7 +1813,7 @@ func (a *peerApp) requestSong(ctx context.Context, songID string) error {
 			segmentIndex++
 		}
 	}
-	
+
 	// Requesting peer gets all remaining segments
 	for segmentIndex < segmentCount {
 		if seg, ok := segments[segmentIndex].(map[string]interface{}); ok {
@@ -912,6 +1821,7 @@ func (a *peerApp) requestSong(ctx context.Context, songID string) error {
 				data, _, err := a.fetchSegmentFromEdge(ctx, edgeURL, segID)
 				if err == nil {
 					a.cache.Put(cachepkg.Segment{ID: segID, Data: data})
+					a.segmentLanded(segID, data)
 				} else {
 					log.Printf("[%s] Warning: failed to fetch segment %s from edge: %v", a.cfg.Name, segID, err)
 				}
@@ -919,49 +1829,158 @@ func (a *peerApp) requestSong(ctx context.Context, songID string) error {
 		}
 		segmentIndex++
 	}
-	
-	// Calculate how many segments were distributed vs cached locally
-	distributedCount := (pathLength - 1) * segmentsPerNode // Excluding ourselves
+
 	localCount := segmentCount - distributedCount
-	
-	log.Printf("[%s] Successfully distributed song %s: %d segments cached locally, %d segments distributed to %d intermediate nodes", 
-		a.cfg.Name, songID, localCount, distributedCount, pathLength-1)
+
+	log.Printf("[%s] Successfully distributed song %s: %d segments cached locally, %d segments distributed to %d intermediate nodes",
+		a.cfg.Name, songID, localCount, distributedCount, len(allocs))
 	
 	a.triggerHeartbeat()
 	return nil
 }
 
-// sendSegmentToPeer sends a segment to another peer for caching
+// maxRawSegmentBytes caps how much a single POST /segments/raw body may
+// carry, so a misbehaving sender can't force unbounded buffering.
+const maxRawSegmentBytes = 64 * 1024 * 1024
+
+// errRawUnsupported signals that the destination peer doesn't expose
+// POST /segments/raw (an older build), so sendSegmentToPeer should fall
+// back to the JSON path instead of treating it as a hard failure.
+var errRawUnsupported = errors.New("peer: raw segment transfer not supported")
+
+// errBreakerOpen is returned when sendSegmentToPeer short-circuits
+// without attempting a send because peerID's circuit breaker is open.
+var errBreakerOpen = errors.New("peer: destination circuit breaker open")
+
+// sendSegmentToPeer sends a segment to another peer for caching. It
+// prefers the raw octet-stream path, which avoids base64's ~33% size
+// inflation and lets the receiver stream the body straight into its
+// cache instead of decoding a JSON-wrapped payload; if the peer doesn't
+// support it yet, it falls back to the original JSON-over-/segments
+// path so mixed-version fleets keep working.
+//
+// The send is retried with jittered exponential backoff up to
+// cfg.SendRetryMaxAttempts times, and peerID's circuit breaker is
+// consulted first: a peer that has failed SendBreakerThreshold times in
+// a row is skipped outright for SendBreakerCooldown rather than spending
+// another retry budget on it. planDistribution checks the same breaker
+// before handing out shares, so a tripped peer's segments are already
+// routed elsewhere by the time this is called for its next chance.
 func (a *peerApp) sendSegmentToPeer(ctx context.Context, peerID, segmentID string, data []byte) error {
+	if !a.sendBreaker.Allow(peerID) {
+		return errBreakerOpen
+	}
+	err := a.sendWithRetry(ctx, func(attemptCtx context.Context) error {
+		sendErr := a.sendSegmentRaw(attemptCtx, peerID, segmentID, data)
+		if sendErr == nil {
+			return nil
+		}
+		if errors.Is(sendErr, errRawUnsupported) {
+			return a.sendSegmentJSON(attemptCtx, peerID, segmentID, data)
+		}
+		return sendErr
+	})
+	if err != nil {
+		a.sendBreaker.RecordFailure(peerID)
+		return err
+	}
+	a.sendBreaker.RecordSuccess(peerID)
+	return nil
+}
+
+// sendWithRetry runs attempt up to cfg.SendRetryMaxAttempts times,
+// sleeping a jittered, exponentially increasing interval between
+// failures. It gives up early if ctx is cancelled between attempts.
+func (a *peerApp) sendWithRetry(ctx context.Context, attempt func(context.Context) error) error {
+	b := backoff.New(backoff.DefaultPolicy())
+	var lastErr error
+	for try := 1; try <= a.cfg.SendRetryMaxAttempts; try++ {
+		lastErr = attempt(ctx)
+		if lastErr == nil {
+			return nil
+		}
+		if try == a.cfg.SendRetryMaxAttempts {
+			break
+		}
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return lastErr
+}
+
+// reportBreakerMetrics publishes every destination peer's current send
+// circuit breaker state to the CircuitBreakerState gauge, so an operator
+// can see a tripped neighbor on /metrics without grepping logs.
+func (a *peerApp) reportBreakerMetrics() {
+	if a.metrics == nil || a.metrics.CircuitBreakerState == nil {
+		return
+	}
+	for peerID, state := range a.sendBreaker.States() {
+		a.metrics.CircuitBreakerState.WithLabelValues(a.cfg.Name, peerID).Set(float64(state))
+	}
+}
+
+func (a *peerApp) sendSegmentRaw(ctx context.Context, peerID, segmentID string, data []byte) error {
+	url := fmt.Sprintf("http://%s:%s/segments/raw/%s", peerID, a.cfg.Port, segmentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return errRawUnsupported
+	default:
+		return fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+}
+
+func (a *peerApp) sendSegmentJSON(ctx context.Context, peerID, segmentID string, data []byte) error {
 	url := fmt.Sprintf("http://%s:%s/segments", peerID, a.cfg.Port)
 	payload := base64.StdEncoding.EncodeToString(data)
-	
+
 	body := map[string]string{
 		"id":      segmentID,
 		"payload": payload,
 	}
-	
+
 	jsonData, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonData)))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	
+
 	resp, err := a.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	
+
 	if resp.StatusCode != http.StatusCreated {
 		return fmt.Errorf("peer returned status %d", resp.StatusCode)
 	}
-	
+
 	return nil
 }
 
@@ -974,6 +1993,9 @@ func (a *peerApp) startNeighborProbe(ctx context.Context) {
 			return
 		case <-ticker.C:
 			for _, neighbor := range a.cfg.Neighbors {
+				if ctx.Err() != nil {
+					return
+				}
 				url := fmt.Sprintf("http://%s:%s/health", neighbor, a.cfg.Port)
 				// Measure RTT to neighbor
 				rtt, err := a.rttMeasurer.MeasureHTTP(ctx, &client, http.MethodGet, url)
@@ -993,11 +2015,37 @@ func (a *peerApp) writeSignal(ctx context.Context) {
 	if a.signal == nil {
 		return
 	}
+	a.signal.OnConnect(func() {
+		log.Printf("[%s] signalling connected", a.cfg.Name)
+		a.registerWebseeds(ctx)
+	})
+	a.signal.OnDisconnect(func(err error) {
+		log.Printf("[%s] signalling disconnected: %v", a.cfg.Name, err)
+	})
 	if err := a.signal.Connect(ctx); err != nil {
 		log.Printf("[%s] signalling connect failed: %v", a.cfg.Name, err)
 	}
 }
 
+// registerWebseeds announces each configured edge URL to the signalling
+// hub as a webseed peer, so ShortestPath queries in this room can route
+// to a nearby edge when no P2P holder has the segment. It measures RTT
+// the same way neighbor probing does, so the estimate is comparable.
+func (a *peerApp) registerWebseeds(ctx context.Context) {
+	for _, edgeURL := range a.cfg.EdgeURLs {
+		rtt, err := a.rttMeasurer.MeasureHTTP(ctx, a.httpClient, http.MethodGet, edgeURL+"/health")
+		if err != nil {
+			log.Printf("[%s] webseed RTT probe failed for %s: %v", a.cfg.Name, edgeURL, err)
+		} else {
+			a.rttMeasurer.Update(edgeURL, rtt)
+		}
+		webseedID := "webseed:" + edgeURL
+		if err := a.signal.RegisterWebseed(webseedID, edgeURL); err != nil {
+			log.Printf("[%s] register webseed %s failed: %v", a.cfg.Name, edgeURL, err)
+		}
+	}
+}
+
 func writeJSON(w http.ResponseWriter, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(payload)
@@ -1005,7 +2053,12 @@ func writeJSON(w http.ResponseWriter, payload any) {
 
 func main() {
 	cfg := loadConfig()
-	app := newPeerApp(cfg)
+	metricsObj := metrics.NewMetrics()
+	registry := prometheus.NewRegistry()
+	if err := metricsObj.Register(registry); err != nil {
+		log.Fatalf("[%s] failed to register metrics: %v", cfg.Name, err)
+	}
+	app := newPeerApp(cfg, metricsObj, registry)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -1021,6 +2074,16 @@ func main() {
 		defer wg.Done()
 		app.startNeighborProbe(ctx)
 	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.rttMeasurer.RunQoSTuner(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.trackerStream.Connect(ctx)
+	}()
 	go app.writeSignal(ctx)
 
 	waitForShutdown(app, cancel, &wg)
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"cloud_project/pkg/metrics"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 )
 
 type Message struct {
@@ -16,73 +24,262 @@ type Message struct {
 	From string                 `json:"from"`
 	To   string                 `json:"to"`
 	Data map[string]interface{} `json:"data"`
+
+	// Transport lets two peers negotiate which delivery path an offer/
+	// answer applies to: "ws" (this signaling connection carries the
+	// data itself), "webrtc" (the usual SDP/ICE exchange), or
+	// "webtransport" (fetch the segment from a wt-edge instance
+	// instead). Empty means "webrtc", the original default.
+	Transport string `json:"transport,omitempty"`
+}
+
+// envelope is what Hub publishes to a room's Redis channel so every
+// signaling instance sharing that room - not just the one that handled
+// the request - delivers it to its own locally-connected clients.
+// Origin lets the publishing instance's own subscriber ignore its own
+// envelope, since it already delivered locally before publishing.
+type envelope struct {
+	Kind    string  `json:"kind"` // "broadcast" or "direct"
+	To      string  `json:"to,omitempty"`
+	Origin  string  `json:"origin"`
+	Message Message `json:"message"`
 }
 
+// maxClientDrops is how many sends a client may miss (its send buffer
+// was full) before Hub gives up on it and closes the connection, per
+// signaling#chunk5-3: a slow client shouldn't be able to sit on a full
+// buffer and silently eat every future SDP/ICE message forever.
+const maxClientDrops = 20
+
 type Client struct {
 	id   string
 	room string
 	conn *websocket.Conn
 	send chan Message
+
+	dropped   atomic.Int32
+	closeOnce sync.Once
+}
+
+func (c *Client) close() {
+	c.closeOnce.Do(func() { c.conn.Close() })
 }
 
 type Hub struct {
 	mu      sync.RWMutex
 	clients map[string]*Client
 	rooms   map[string]map[string]*Client
+
+	// broker and instanceID are optional: a nil broker makes Hub behave
+	// like a single instance, which is what the tests in this package
+	// (none today) and a one-replica deployment both want.
+	broker     *redis.Client
+	instanceID string
+	subCancel  map[string]context.CancelFunc
+
+	m *metrics.Metrics
 }
 
-func NewHub() *Hub {
-	return &Hub{clients: map[string]*Client{}, rooms: map[string]map[string]*Client{}}
+func NewHub(broker *redis.Client, instanceID string, m *metrics.Metrics) *Hub {
+	return &Hub{
+		clients:    map[string]*Client{},
+		rooms:      map[string]map[string]*Client{},
+		broker:     broker,
+		instanceID: instanceID,
+		subCancel:  map[string]context.CancelFunc{},
+		m:          m,
+	}
 }
 
 func (h *Hub) Join(c *Client, room string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	c.room = room
 	if h.rooms[room] == nil {
 		h.rooms[room] = map[string]*Client{}
 	}
 	h.rooms[room][c.id] = c
+	clients, rooms := h.roomCounts(room)
+
+	var subCtx context.Context
+	var startSub bool
+	if h.broker != nil {
+		if _, ok := h.subCancel[room]; !ok {
+			var cancel context.CancelFunc
+			subCtx, cancel = context.WithCancel(context.Background())
+			h.subCancel[room] = cancel
+			startSub = true
+		}
+	}
+	h.mu.Unlock()
+
+	if startSub {
+		go h.subscribeRoom(subCtx, room)
+	}
+	h.reportRoomMetrics(room, clients, rooms)
 }
 
 func (h *Hub) Leave(c *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	if r := h.rooms[c.room]; r != nil {
 		delete(r, c.id)
+		if len(r) == 0 {
+			delete(h.rooms, c.room)
+		}
 	}
 	delete(h.clients, c.id)
+	var cancel context.CancelFunc
+	if _, ok := h.rooms[c.room]; !ok {
+		if cc, ok := h.subCancel[c.room]; ok {
+			cancel = cc
+			delete(h.subCancel, c.room)
+		}
+	}
+	clients, rooms := h.roomCounts(c.room)
+	h.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	h.reportRoomMetrics(c.room, clients, rooms)
+}
+
+// roomCounts returns the current client count for room and the total
+// room count; callers must already hold h.mu.
+func (h *Hub) roomCounts(room string) (clients, rooms int) {
+	return len(h.rooms[room]), len(h.rooms)
+}
+
+func (h *Hub) reportRoomMetrics(room string, clients, rooms int) {
+	if h.m == nil {
+		return
+	}
+	h.m.SignalingClients.WithLabelValues(room).Set(float64(clients))
+	h.m.SignalingRooms.Set(float64(rooms))
 }
 
 func (h *Hub) Broadcast(room string, m Message) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
-	for _, c := range h.rooms[room] {
+	peers := h.rooms[room]
+	h.mu.RUnlock()
+	for _, c := range peers {
+		h.trySend(c, m)
+	}
+	h.publish(room, envelope{Kind: "broadcast", Origin: h.instanceID, Message: m})
+}
+
+func (h *Hub) Direct(to string, m Message) {
+	h.mu.RLock()
+	c := h.clients[to]
+	h.mu.RUnlock()
+	if c != nil {
+		h.trySend(c, m)
+	}
+	h.publish(m.Room, envelope{Kind: "direct", To: to, Origin: h.instanceID, Message: m})
+}
+
+// trySend enqueues m on c's buffered channel without blocking the
+// caller. A full buffer means m is dropped and counted rather than
+// stalling Broadcast/Direct on one slow client; once a client racks up
+// maxClientDrops dropped sends it's presumed unreachable and closed, so
+// its id frees up for a reconnect instead of quietly swallowing every
+// future message.
+func (h *Hub) trySend(c *Client, m Message) {
+	select {
+	case c.send <- m:
+		if h.m != nil {
+			h.m.SignalingMessagesSent.WithLabelValues(c.room, m.Type).Inc()
+		}
+		return
+	default:
+	}
+	if h.m != nil {
+		h.m.SignalingDropped.WithLabelValues(c.room, c.id).Inc()
+	}
+	if c.dropped.Add(1) >= maxClientDrops {
+		c.close()
+	}
+}
+
+func (h *Hub) publish(room string, env envelope) {
+	if h.broker == nil {
+		return
+	}
+	payload, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("marshal signaling envelope: %v", err)
+		return
+	}
+	if err := h.broker.Publish(context.Background(), roomChannel(room), payload).Err(); err != nil {
+		log.Printf("publish to room %s: %v", room, err)
+	}
+}
+
+// subscribeRoom relays envelopes other instances published for room to
+// whichever clients are connected to it locally. It runs for as long as
+// at least one local client is in the room; Leave cancels ctx once the
+// room empties out locally.
+func (h *Hub) subscribeRoom(ctx context.Context, room string) {
+	sub := h.broker.Subscribe(ctx, roomChannel(room))
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
 		select {
-		case c.send <- m:
-		default:
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			h.deliverRemote(room, msg.Payload)
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-func (h *Hub) Direct(to string, m Message) {
+func (h *Hub) deliverRemote(room, payload string) {
+	var env envelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil || env.Origin == h.instanceID {
+		return
+	}
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	if c := h.clients[to]; c != nil {
-		select {
-		case c.send <- m:
-		default:
+	switch env.Kind {
+	case "broadcast":
+		for _, c := range h.rooms[room] {
+			h.trySend(c, env.Message)
+		}
+	case "direct":
+		if c, ok := h.clients[env.To]; ok {
+			h.trySend(c, env.Message)
 		}
 	}
 }
 
+func roomChannel(room string) string {
+	return "signaling:room:" + room
+}
+
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 
 func main() {
 	addr := getenv("WS_ADDR", ":8091")
-	hub := NewHub()
+	redisAddr := getenv("REDIS_ADDR", "localhost:6379")
+
+	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("redis connection failed: %v", err)
+	}
+	instanceID := fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+
+	metricsObj := metrics.NewMetrics()
+	registry := prometheus.NewRegistry()
+	if err := metricsObj.Register(registry); err != nil {
+		log.Fatalf("failed to register metrics: %v", err)
+	}
+
+	hub := NewHub(rdb, instanceID, metricsObj)
 
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -121,15 +318,15 @@ func main() {
 				}
 			case "leave":
 				hub.Leave(c)
-				_ = conn.Close()
+				c.close()
 				return
 			}
 		}
 		hub.Leave(c)
-		_ = conn.Close()
+		c.close()
 	})
 
-	log.Printf("signaling listening on %s", addr)
+	log.Printf("signaling listening on %s (redis=%s)", addr, redisAddr)
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
 
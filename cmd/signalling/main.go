@@ -6,9 +6,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"cloud_project/internal/events"
 	"cloud_project/internal/signalling"
 	"github.com/gorilla/websocket"
 )
@@ -21,8 +23,42 @@ type inboundMessage struct {
 	Neighbors []string          `json:"neighbors"`
 	Metadata  map[string]any    `json:"metadata"`
 	Payload   map[string]string `json:"payload"`
+	Peers     []peerInfoMessage `json:"peers"`
+
+	// SDP/Candidate/SDPMid/SDPMLineIndex/RequestID/Hops carry the WebRTC
+	// offer/answer/ICE-candidate exchange and path-response message
+	// types; all of them are point-to-point (see Target above for the
+	// recipient) so the hub relays them through rather than acting on
+	// them itself.
+	SDP           string   `json:"sdp,omitempty"`
+	Candidate     string   `json:"candidate,omitempty"`
+	SDPMid        string   `json:"sdp_mid,omitempty"`
+	SDPMLineIndex *int     `json:"sdp_mline_index,omitempty"`
+	RequestID     string   `json:"request_id,omitempty"`
+	Hops          []string `json:"hops,omitempty"`
+
+	// K is request_kpaths' requested path count; zero means "use the
+	// default" rather than "return nothing".
+	K int `json:"k,omitempty"`
+}
+
+// peerInfoMessage is the wire shape of a gossiped peer in a pex_add
+// message; it mirrors signalling.PeerInfo rather than embedding it
+// directly, matching how announce's Neighbors are decoded as plain
+// strings and converted below.
+type peerInfoMessage struct {
+	Peer     string         `json:"peer"`
+	Metadata map[string]any `json:"metadata"`
 }
 
+// defaultKPaths is how many parallel paths request_kpaths returns when
+// the request doesn't specify K.
+const defaultKPaths = 3
+
+// defaultTURNTTL is how long a TURN allocation's credentials stay valid
+// when /turn's ttl query param is absent.
+const defaultTURNTTL = 10 * time.Minute
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  2048,
 	WriteBufferSize: 2048,
@@ -33,14 +69,25 @@ var upgrader = websocket.Upgrader{
 
 func main() {
 	addr := env("SIGNAL_ADDR", ":7080")
+	turnSecret := env("TURN_SECRET", "dev-turn-secret")
 	hub := signalling.NewHub()
+	eventBus := events.NewBus()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handleWebsocket(hub, w, r)
+		handleWebsocket(hub, eventBus, w, r)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		events.ServeWS(eventBus, w, r)
+	})
+	mux.HandleFunc("/turn", func(w http.ResponseWriter, r *http.Request) {
+		handleTURNAllocation(turnSecret, w, r)
+	})
+	mux.HandleFunc("/room/", func(w http.ResponseWriter, r *http.Request) {
+		handleTopology(hub, w, r)
 	})
 
 	log.Printf("Signalling server listening on %s", addr)
@@ -55,7 +102,7 @@ func main() {
 	}
 }
 
-func handleWebsocket(hub *signalling.Hub, w http.ResponseWriter, r *http.Request) {
+func handleWebsocket(hub *signalling.Hub, bus *events.Bus, w http.ResponseWriter, r *http.Request) {
 	peer := r.URL.Query().Get("peer")
 	room := r.URL.Query().Get("room")
 	if peer == "" || room == "" {
@@ -73,7 +120,11 @@ func handleWebsocket(hub *signalling.Hub, w http.ResponseWriter, r *http.Request
 
 	connection := signalling.NewConnection(signalling.PeerID(peer), conn)
 	hub.Register(room, connection)
-	defer hub.Unregister(room, signalling.PeerID(peer))
+	bus.Publish("connect", map[string]any{"room": room, "peer": peer})
+	defer func() {
+		hub.Unregister(room, signalling.PeerID(peer))
+		bus.Publish("disconnect", map[string]any{"room": room, "peer": peer})
+	}()
 
 	go connection.WriteLoop(ctx)
 
@@ -83,14 +134,56 @@ func handleWebsocket(hub *signalling.Hub, w http.ResponseWriter, r *http.Request
 			log.Printf("invalid message from %s: %v", peer, err)
 			return
 		}
-		processMessage(ctx, hub, room, connection, inbound)
+		processMessage(ctx, hub, bus, room, connection, inbound)
 	})
 	if err != nil {
 		log.Printf("read loop ended for %s: %v", peer, err)
 	}
 }
 
-func processMessage(ctx context.Context, hub *signalling.Hub, room string, conn *signalling.Connection, msg inboundMessage) {
+// handleTURNAllocation hands the requesting peer short-lived HMAC-signed
+// TURN REST API credentials (see signalling.TURNCredentials) so a
+// browser behind a symmetric NAT can still relay media through a TURN
+// server provisioned with the same static-auth-secret.
+func handleTURNAllocation(secret string, w http.ResponseWriter, r *http.Request) {
+	peer := r.URL.Query().Get("peer")
+	if peer == "" {
+		http.Error(w, "peer is required", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultTURNTTL
+	if raw := r.URL.Query().Get("ttl"); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	username, password := signalling.TURNCredentials(secret, signalling.PeerID(peer), ttl)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"username": username,
+		"password": password,
+		"ttl":      int(ttl.Seconds()),
+	})
+}
+
+// handleTopology serves GET /room/{id}/topology: the current adjacency
+// graph for that room, as JSON, for observability.
+func handleTopology(hub *signalling.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/room/")
+	room, suffix, found := strings.Cut(rest, "/")
+	if !found || suffix != "topology" || room == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hub.Topology(room))
+}
+
+func processMessage(ctx context.Context, hub *signalling.Hub, bus *events.Bus, room string, conn signalling.Conn, msg inboundMessage) {
 	switch strings.ToLower(msg.Type) {
 	case "announce":
 		neighbors := make([]signalling.PeerID, 0, len(msg.Neighbors))
@@ -107,18 +200,117 @@ func processMessage(ctx context.Context, hub *signalling.Hub, room string, conn
 			Neighbors: neighbors,
 			Metadata:  msg.Metadata,
 		})
+		bus.Publish("announce", map[string]any{"room": room, "peer": msg.Peer, "neighbors": msg.Neighbors})
 	case "request_path":
 		target := signalling.PeerID(msg.Target)
-		resp, err := hub.ShortestPath(room, conn.Peer, target)
+		resp, err := hub.ShortestPath(room, conn.PeerID(), target)
 		if err != nil {
-			log.Printf("path error %s->%s: %v", conn.Peer, target, err)
+			log.Printf("path error %s->%s: %v", conn.PeerID(), target, err)
 			return
 		}
 		if err := hub.BroadcastPath(ctx, room, resp.Path); err != nil {
 			log.Printf("broadcast path: %v", err)
 		}
+		bus.Publish("lookup", map[string]any{"room": room, "from": conn.PeerID(), "to": target, "path": resp.Path})
+	case "request_kpaths":
+		target := signalling.PeerID(msg.Target)
+		k := msg.K
+		if k <= 0 {
+			k = defaultKPaths
+		}
+		paths, err := hub.KShortestPaths(room, conn.PeerID(), target, k)
+		if err != nil {
+			log.Printf("kpaths error %s->%s: %v", conn.PeerID(), target, err)
+			return
+		}
+		if err := hub.BroadcastMultipath(ctx, room, paths); err != nil {
+			log.Printf("broadcast multipath: %v", err)
+		}
+		bus.Publish("lookup", map[string]any{"room": room, "from": conn.PeerID(), "to": target, "paths": paths})
+	case "pex_request":
+		neighbors := make([]signalling.PeerID, 0, len(msg.Neighbors))
+		for _, n := range msg.Neighbors {
+			n = strings.TrimSpace(n)
+			if n == "" {
+				continue
+			}
+			neighbors = append(neighbors, signalling.PeerID(n))
+		}
+		peers, ok := hub.PEXSample(room, conn.PeerID(), neighbors)
+		if !ok {
+			return
+		}
+		conn.SendPEX(ctx, peers)
+	case "pex_add":
+		peers := make([]signalling.PeerInfo, 0, len(msg.Peers))
+		for _, p := range msg.Peers {
+			id := strings.TrimSpace(p.Peer)
+			if id == "" {
+				continue
+			}
+			peers = append(peers, signalling.PeerInfo{Peer: signalling.PeerID(id), Metadata: p.Metadata})
+		}
+		hub.MergePeers(room, peers)
+	case "register_webseed":
+		baseURL := msg.Payload["base_url"]
+		if baseURL == "" {
+			log.Printf("register_webseed from %s missing base_url", msg.Peer)
+			return
+		}
+		hub.RegisterWebseed(room, signalling.PeerID(msg.Peer), baseURL)
+		bus.Publish("topology_mutation", map[string]any{"room": room, "webseed": msg.Peer, "base_url": baseURL})
+	case "path-response":
+		to := signalling.PeerID(msg.Target)
+		if to == "" {
+			log.Printf("%s from %s missing target", msg.Type, msg.Peer)
+			return
+		}
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("marshal %s for relay: %v", msg.Type, err)
+			return
+		}
+		if err := hub.Relay(ctx, room, to, raw); err != nil {
+			log.Printf("relay %s %s->%s: %v", msg.Type, conn.PeerID(), to, err)
+		}
+	case "offer", "answer", "ice-candidate":
+		to := signalling.PeerID(msg.Target)
+		if to == "" {
+			log.Printf("%s from %s missing target", msg.Type, msg.Peer)
+			return
+		}
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("marshal %s for relay: %v", msg.Type, err)
+			return
+		}
+		from := conn.PeerID()
+		var relayErr error
+		switch strings.ToLower(msg.Type) {
+		case "offer":
+			relayErr = hub.Offer(ctx, room, from, to, raw)
+		case "answer":
+			relayErr = hub.Answer(ctx, room, from, to, raw)
+		case "ice-candidate":
+			relayErr = hub.ICECandidate(ctx, room, from, to, raw)
+		}
+		if relayErr != nil {
+			log.Printf("relay %s %s->%s: %v", msg.Type, from, to, relayErr)
+		}
+	case "ice_candidates_request":
+		target := signalling.PeerID(msg.Target)
+		payload, err := json.Marshal(map[string]any{
+			"type":       "ice_candidates",
+			"peer":       target,
+			"candidates": hub.ICECandidates(room, target),
+		})
+		if err != nil {
+			log.Printf("marshal ice candidates for %s: %v", target, err)
+			return
+		}
+		conn.SendRaw(ctx, payload)
 	default:
-		log.Printf("unhandled message type %s from %s", msg.Type, conn.Peer)
+		log.Printf("unhandled message type %s from %s", msg.Type, conn.PeerID())
 	}
 }
 
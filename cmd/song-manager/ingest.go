@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clientMinDownloadPause mirrors mediamtx's HLS client: never refetch
+	// the source playlist more often than this, regardless of its own
+	// target duration.
+	clientMinDownloadPause = 1 * time.Second
+	ingestSegmentQueueSize = 32
+)
+
+// HLSPuller mirrors mediamtx's hls/client.go design: it periodically
+// refetches a remote media playlist, downloads whichever segments it
+// hasn't already seen through a bounded segmentQueue, and mirrors them
+// into this service's own assets/songs/{id}/ HLS layout so the rest of
+// the CDN can serve an external live stream like any locally encoded
+// song.
+type HLSPuller struct {
+	songID       string
+	sourceURL    *url.URL
+	songDir      string
+	client       *http.Client
+	segmentQueue chan MediaSegment
+
+	mu                    sync.Mutex
+	downloadedSegmentURIs map[string]struct{}
+	segments              []MediaSegment
+	targetDuration        int
+	stopped               bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newHLSPuller(songID, sourceURL, songDir string) (*HLSPuller, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sourceUrl %q: %w", sourceURL, err)
+	}
+	return &HLSPuller{
+		songID:                songID,
+		sourceURL:             u,
+		songDir:               songDir,
+		client:                &http.Client{Timeout: 15 * time.Second},
+		segmentQueue:          make(chan MediaSegment, ingestSegmentQueueSize),
+		downloadedSegmentURIs: make(map[string]struct{}),
+		stop:                  make(chan struct{}),
+		done:                  make(chan struct{}),
+	}, nil
+}
+
+// Stop signals Run to exit - on the next poll tick for a live source, or
+// immediately once the current segmentQueue has drained - and blocks
+// until it has.
+func (p *HLSPuller) Stop() {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	p.mu.Unlock()
+	close(p.stop)
+	<-p.done
+}
+
+// Run pulls sourceURL until the source playlist reports #EXT-X-ENDLIST
+// (VOD) or Stop is called (live), updating the song's segments
+// incrementally as each new segment lands.
+func (p *HLSPuller) Run() {
+	defer close(p.done)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.downloadLoop()
+	}()
+
+	for {
+		playlist, err := p.fetchPlaylist()
+		if err != nil {
+			log.Printf("ingest %s: fetching playlist failed: %v", p.songID, err)
+		} else {
+			p.mu.Lock()
+			p.targetDuration = playlist.TargetDuration
+			p.mu.Unlock()
+			p.queueNewSegments(playlist)
+			if playlist.EndList {
+				close(p.segmentQueue)
+				wg.Wait()
+				p.writeLocalPlaylist(true)
+				songManager.UpdateSongStatus(p.songID, "ready")
+				return
+			}
+		}
+
+		select {
+		case <-p.stop:
+			close(p.segmentQueue)
+			wg.Wait()
+			p.writeLocalPlaylist(false)
+			return
+		case <-time.After(clientMinDownloadPause):
+		}
+	}
+}
+
+func (p *HLSPuller) fetchPlaylist() (*MediaPlaylist, error) {
+	resp, err := p.client.Get(p.sourceURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return parseMediaPlaylistReader(resp.Body, p.sourceURL.String())
+}
+
+// queueNewSegments hands every segment in playlist that
+// downloadedSegmentURIs hasn't already seen to segmentQueue, marking it
+// seen immediately so the next poll's refetch doesn't requeue it before
+// the download completes.
+func (p *HLSPuller) queueNewSegments(playlist *MediaPlaylist) {
+	for _, seg := range playlist.Segments {
+		p.mu.Lock()
+		_, seen := p.downloadedSegmentURIs[seg.Filename]
+		if !seen {
+			p.downloadedSegmentURIs[seg.Filename] = struct{}{}
+		}
+		p.mu.Unlock()
+		if seen {
+			continue
+		}
+		p.segmentQueue <- seg
+	}
+}
+
+// downloadLoop drains segmentQueue, downloading each segment and folding
+// it into the song's segment list as it lands. It returns once
+// segmentQueue is closed and empty.
+func (p *HLSPuller) downloadLoop() {
+	for seg := range p.segmentQueue {
+		if err := p.downloadSegment(seg.Filename); err != nil {
+			log.Printf("ingest %s: downloading segment %s failed: %v", p.songID, seg.Filename, err)
+			continue
+		}
+		localName := filepath.Base(seg.Filename)
+
+		p.mu.Lock()
+		p.segments = append(p.segments, MediaSegment{Filename: localName, Duration: seg.Duration})
+		segments := make([]string, len(p.segments))
+		for i, s := range p.segments {
+			segments[i] = s.Filename
+		}
+		p.mu.Unlock()
+
+		songManager.UpdateSongSegments(p.songID, segments, []string{"source"}, fmt.Sprintf("/hls/%s/playlist.m3u8", p.songID))
+		p.writeLocalPlaylist(false)
+		updateNetworkTopology(p.songID, []string{localName})
+	}
+}
+
+// downloadSegment resolves segURI against the primary playlist URL (it's
+// frequently relative) and saves it under songDir using its base name.
+func (p *HLSPuller) downloadSegment(segURI string) error {
+	segURL, err := p.sourceURL.Parse(segURI)
+	if err != nil {
+		return fmt.Errorf("resolving segment URI %q: %w", segURI, err)
+	}
+	resp, err := p.client.Get(segURL.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	f, err := os.Create(filepath.Join(p.songDir, filepath.Base(segURI)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	return err
+}
+
+// writeLocalPlaylist rewrites playlist.m3u8 from the segments downloaded
+// so far, appending #EXT-X-ENDLIST once the source has signalled the end
+// of a VOD stream, and updates the song's reported duration to match.
+func (p *HLSPuller) writeLocalPlaylist(endList bool) error {
+	p.mu.Lock()
+	segments := append([]MediaSegment(nil), p.segments...)
+	targetDuration := p.targetDuration
+	p.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	var total float64
+	for _, seg := range segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", seg.Duration, seg.Filename)
+		total += seg.Duration
+	}
+	if endList {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	if err := os.WriteFile(filepath.Join(p.songDir, "playlist.m3u8"), []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	songManager.UpdateSongDuration(p.songID, total)
+	return nil
+}
+
+// activePullers tracks every in-flight ingestion by song ID so
+// DELETE /ingest/{id} can stop a live pull.
+var (
+	activePullersMu sync.Mutex
+	activePullers   = make(map[string]*HLSPuller)
+)
+
+func registerPuller(songID string, p *HLSPuller) {
+	activePullersMu.Lock()
+	activePullers[songID] = p
+	activePullersMu.Unlock()
+}
+
+// stopPuller stops and unregisters songID's puller, reporting whether
+// one was running.
+func stopPuller(songID string) bool {
+	activePullersMu.Lock()
+	p, ok := activePullers[songID]
+	if ok {
+		delete(activePullers, songID)
+	}
+	activePullersMu.Unlock()
+	if !ok {
+		return false
+	}
+	p.Stop()
+	return true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Loudness is one EBU R128 loudnorm two-pass measurement, plus the
+// ReplayGain 2.0 tags derived from it against TargetLUFS.
+type Loudness struct {
+	TargetLUFS     float64 `json:"targetLufs"`
+	MeasuredI      float64 `json:"measuredIntegratedLufs"`
+	MeasuredTP     float64 `json:"measuredTruePeakDb"`
+	MeasuredLRA    float64 `json:"measuredLoudnessRangeLu"`
+	MeasuredThresh float64 `json:"measuredThresholdLufs"`
+	TrackGainDb    float64 `json:"replaygainTrackGainDb"` // REPLAYGAIN_TRACK_GAIN
+	TrackPeak      float64 `json:"replaygainTrackPeak"`   // REPLAYGAIN_TRACK_PEAK, linear 0-1+
+}
+
+// targetLUFS reads TARGET_LUFS (default -16, a common streaming-platform
+// target) to normalize every catalog track to a consistent loudness.
+func targetLUFS() float64 {
+	v, err := strconv.ParseFloat(getenv("TARGET_LUFS", "-16"), 64)
+	if err != nil {
+		return -16
+	}
+	return v
+}
+
+// measureLoudness runs loudnorm's first (measurement) pass against
+// inputPath and parses its reported integrated loudness/true-peak/LRA,
+// deriving ReplayGain 2.0 track gain and peak against targetLUFS. The
+// second pass (loudnormFilter) feeds these measured_* values back in so
+// the actual encode is a single accurate normalization rather than
+// loudnorm's less precise single-pass dynamic mode.
+func measureLoudness(inputPath string, targetLUFS float64) (*Loudness, error) {
+	cmd := exec.Command("ffmpeg",
+		"-i", inputPath,
+		"-af", fmt.Sprintf("loudnorm=I=%.1f:TP=-1.5:LRA=11:print_format=json", targetLUFS),
+		"-f", "null", "-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("loudnorm measurement pass failed: %w", err)
+	}
+
+	out := stderr.Bytes()
+	start := bytes.LastIndexByte(out, '{')
+	end := bytes.LastIndexByte(out, '}')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no loudnorm JSON found in ffmpeg output")
+	}
+
+	var raw struct {
+		InputI      string `json:"input_i"`
+		InputTP     string `json:"input_tp"`
+		InputLRA    string `json:"input_lra"`
+		InputThresh string `json:"input_thresh"`
+	}
+	if err := json.Unmarshal(out[start:end+1], &raw); err != nil {
+		return nil, fmt.Errorf("parsing loudnorm JSON: %w", err)
+	}
+
+	measuredI, _ := strconv.ParseFloat(raw.InputI, 64)
+	measuredTP, _ := strconv.ParseFloat(raw.InputTP, 64)
+	measuredLRA, _ := strconv.ParseFloat(raw.InputLRA, 64)
+	measuredThresh, _ := strconv.ParseFloat(raw.InputThresh, 64)
+
+	return &Loudness{
+		TargetLUFS:     targetLUFS,
+		MeasuredI:      measuredI,
+		MeasuredTP:     measuredTP,
+		MeasuredLRA:    measuredLRA,
+		MeasuredThresh: measuredThresh,
+		TrackGainDb:    targetLUFS - measuredI,
+		TrackPeak:      math.Pow(10, measuredTP/20),
+	}, nil
+}
+
+// filterArg builds the measured, linear-mode loudnorm filter string for
+// ffmpeg's second (encode) pass.
+func (l *Loudness) filterArg() string {
+	return fmt.Sprintf(
+		"loudnorm=I=%.1f:TP=-1.5:LRA=11:measured_I=%.2f:measured_TP=%.2f:measured_LRA=%.2f:measured_thresh=%.2f",
+		l.TargetLUFS, l.MeasuredI, l.MeasuredTP, l.MeasuredLRA, l.MeasuredThresh,
+	)
+}
+
+// writeLoudnessSidecar writes the measurement plus its derived
+// ReplayGain tags as replaygain.json alongside the HLS output, since the
+// variant playlists this simulator emits have no standard tag for
+// carrying track-level loudness metadata the way an ID3/Vorbis comment
+// would in the source file.
+func writeLoudnessSidecar(outputDir string, l *Loudness) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "replaygain.json"), data, 0644)
+}
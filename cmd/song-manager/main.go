@@ -23,27 +23,68 @@ type Song struct {
 	ID          string    `json:"id"`
 	Title       string    `json:"title"`
 	Artist      string    `json:"artist"`
+	Album       string    `json:"album,omitempty"`
+	AlbumArtist string    `json:"albumArtist,omitempty"`
+	TrackNumber int       `json:"trackNumber,omitempty"`
+	Year        int       `json:"year,omitempty"`
+	Genre       string    `json:"genre,omitempty"`
+	ArtworkURL  string    `json:"artworkUrl,omitempty"`
 	Duration    float64   `json:"duration"`
 	Bitrates    []string  `json:"bitrates"`
 	Segments    []string  `json:"segments"`
 	UploadTime  time.Time `json:"uploadTime"`
 	Status      string    `json:"status"` // "processing", "ready", "error"
 	PlaylistURL string    `json:"playlistUrl"`
+	Loudness    *Loudness `json:"loudness,omitempty"`
+	SourcePath  string    `json:"-"` // original upload, for radio.go's remux
 }
 
+// SongManager is an in-memory cache over a durable Store: reads never
+// touch disk, and every mutation writes through to the store so a
+// restart can recover the catalog instead of forgetting it while the
+// on-disk HLS assets are orphaned.
 type SongManager struct {
+	store Store
 	songs map[string]*Song
 	mu    sync.RWMutex
 }
 
-var songManager = &SongManager{
-	songs: make(map[string]*Song),
+// NewSongManager loads store's existing rows into the in-memory cache.
+func NewSongManager(store Store) *SongManager {
+	sm := &SongManager{store: store, songs: make(map[string]*Song)}
+	rows, err := store.List()
+	if err != nil {
+		log.Printf("song store: failed to load existing catalog: %v", err)
+	}
+	for _, song := range rows {
+		sm.songs[song.ID] = song
+	}
+	return sm
+}
+
+func mustOpenStore(path string) Store {
+	store, err := newFileStore(path)
+	if err != nil {
+		log.Fatalf("failed to open song store %s: %v", path, err)
+	}
+	return store
+}
+
+var songManager = NewSongManager(mustOpenStore(getenv("SONG_STORE_PATH", filepath.Join("assets", "state.db"))))
+
+var radioStation = NewRadioStation(getenv("RADIO_GENRE", "Simulated"))
+
+func (sm *SongManager) persist(song *Song) {
+	if err := sm.store.Put(song); err != nil {
+		log.Printf("song store: failed to persist song %s: %v", song.ID, err)
+	}
 }
 
 func (sm *SongManager) AddSong(song *Song) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.songs[song.ID] = song
+	sm.persist(song)
 }
 
 func (sm *SongManager) GetSong(id string) *Song {
@@ -67,16 +108,53 @@ func (sm *SongManager) UpdateSongStatus(id, status string) {
 	defer sm.mu.Unlock()
 	if song, exists := sm.songs[id]; exists {
 		song.Status = status
+		sm.persist(song)
+	}
+}
+
+// UpdateSongDuration records the song's true duration, summed from the
+// canonical media playlist's #EXTINF values rather than assumed from a
+// fixed segment count.
+func (sm *SongManager) UpdateSongDuration(id string, duration float64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if song, exists := sm.songs[id]; exists {
+		song.Duration = duration
+		sm.persist(song)
 	}
 }
 
-func (sm *SongManager) UpdateSongSegments(id string, segments []string, bitrates []string) {
+// UpdateSongLoudness records a song's EBU R128 loudnorm measurement and
+// derived ReplayGain tags, ahead of the encode that applies them.
+func (sm *SongManager) UpdateSongLoudness(id string, loud *Loudness) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if song, exists := sm.songs[id]; exists {
+		song.Loudness = loud
+		sm.persist(song)
+	}
+}
+
+func (sm *SongManager) UpdateSongSegments(id string, segments []string, bitrates []string, playlistURL string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	if song, exists := sm.songs[id]; exists {
 		song.Segments = segments
 		song.Bitrates = bitrates
+		song.PlaylistURL = playlistURL
 		song.Status = "ready"
+		sm.persist(song)
+	}
+}
+
+// UpdateSongArtwork records the URL the extracted cover art is served
+// from, once extractCoverArt has finished.
+func (sm *SongManager) UpdateSongArtwork(id, artworkURL string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if song, exists := sm.songs[id]; exists {
+		song.ArtworkURL = artworkURL
+		sm.persist(song)
 	}
 }
 
@@ -102,31 +180,71 @@ func processAudioFile(file multipart.File, header *multipart.FileHeader, title,
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
 
+	// Embedded tags fill in whatever the form didn't supply; a failed
+	// probe just means the upload falls back to the form fields alone.
+	tags, err := probeTags(uploadPath)
+	if err != nil {
+		log.Printf("tag extraction failed for song %s, falling back to form fields: %v", songID, err)
+		tags = &Tags{}
+	}
+	if title == "" {
+		title = tags.Title
+	}
+	if artist == "" {
+		artist = tags.Artist
+	}
+
 	// Create song object
 	song := &Song{
-		ID:         songID,
-		Title:      title,
-		Artist:     artist,
-		UploadTime: time.Now(),
-		Status:     "processing",
+		ID:          songID,
+		Title:       title,
+		Artist:      artist,
+		Album:       tags.Album,
+		AlbumArtist: tags.AlbumArtist,
+		TrackNumber: tags.TrackNumber,
+		Year:        tags.Year,
+		Genre:       tags.Genre,
+		UploadTime:  time.Now(),
+		Status:      "processing",
+		SourcePath:  uploadPath,
 	}
 
 	// Process audio in background
 	go func() {
-		if err := processAudioToHLS(uploadPath, songDir, songID); err != nil {
+		if tags.HasArtwork {
+			if _, err := extractCoverArt(uploadPath, songDir); err != nil {
+				log.Printf("cover art extraction failed for song %s: %v", songID, err)
+			} else {
+				songManager.UpdateSongArtwork(songID, fmt.Sprintf("/songs/%s/cover", songID))
+			}
+		}
+
+		// Optional pre-transcode analysis stage: a failed measurement
+		// just means the encode proceeds unnormalized rather than
+		// failing the whole upload.
+		loud, err := measureLoudness(uploadPath, targetLUFS())
+		if err != nil {
+			log.Printf("loudness analysis failed for song %s, continuing without normalization: %v", songID, err)
+			loud = nil
+		} else {
+			songManager.UpdateSongLoudness(songID, loud)
+		}
+
+		playlist, err := processAudioToHLS(uploadPath, songDir, songID, loud)
+		if err != nil {
 			log.Printf("Error processing audio for song %s: %v", songID, err)
 			songManager.UpdateSongStatus(songID, "error")
 			return
 		}
 
-		// Generate segments list
-		segments := []string{}
-		for i := 0; i < 8; i++ { // Assuming 8 segments
-			segments = append(segments, fmt.Sprintf("segment%03d.ts", i))
+		segments := make([]string, len(playlist.Segments))
+		for i, seg := range playlist.Segments {
+			segments[i] = seg.Filename
 		}
 
-		bitrates := []string{"128k", "192k"}
-		songManager.UpdateSongSegments(songID, segments, bitrates)
+		playlistURL := fmt.Sprintf("/hls/%s/master.m3u8", songID)
+		songManager.UpdateSongSegments(songID, segments, ladderBitrates(), playlistURL)
+		songManager.UpdateSongDuration(songID, playlist.TotalDuration())
 
 		// Update network topology with new segments
 		updateNetworkTopology(songID, segments)
@@ -137,36 +255,60 @@ func processAudioFile(file multipart.File, header *multipart.FileHeader, title,
 	return song, nil
 }
 
-func processAudioToHLS(inputPath, outputDir, songID string) error {
-	bitrates := []string{"128k", "192k"}
-
-	for _, bitrate := range bitrates {
-		bitrateDir := filepath.Join(outputDir, bitrate)
+// processAudioToHLS encodes every rung of the ABR ladder and writes the
+// master playlist. It returns the canonical media playlist - the first
+// rendition's, since hls_time is fixed across renditions so every
+// rendition of the same source shares the same segment boundaries -
+// parsed from disk so the caller gets the true segment names and
+// durations ffmpeg actually produced instead of an assumed count.
+func processAudioToHLS(inputPath, outputDir, songID string, loud *Loudness) (*MediaPlaylist, error) {
+	ladder := ladder()
+	var variants []variantInfo
+	var canonicalPlaylistFile string
+
+	for i, r := range ladder {
+		bitrateDir := filepath.Join(outputDir, r.Bitrate)
 		if err := os.MkdirAll(bitrateDir, 0755); err != nil {
-			return fmt.Errorf("failed to create bitrate directory: %w", err)
+			return nil, fmt.Errorf("failed to create bitrate directory: %w", err)
 		}
 
 		playlistFile := filepath.Join(bitrateDir, "playlist.m3u8")
 		segmentPattern := filepath.Join(bitrateDir, "segment%03d.ts")
+		if i == 0 {
+			canonicalPlaylistFile = playlistFile
+		}
 
-		// Use FFmpeg to create HLS segments
+		// Use FFmpeg to create HLS segments, on whichever encoder path
+		// activeHWAccel detected at startup, normalized to loud's target
+		// loudness if a measurement pass succeeded.
 		// It is expected that ffmpeg is installed in the system which is running this.
-		cmd := exec.Command("ffmpeg",
-			"-i", inputPath,
-			"-c:a", "aac",
-			"-b:a", bitrate,
-			"-hls_time", "4",
-			"-hls_playlist_type", "vod",
-			"-hls_segment_filename", segmentPattern,
-			playlistFile,
-		)
-
+		cmd := exec.Command("ffmpeg", ffmpegArgs(activeHWAccel, inputPath, r, playlistFile, segmentPattern, loud)...)
 		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("FFmpeg failed for %s: %w", bitrate, err)
+			return nil, fmt.Errorf("FFmpeg failed for %s: %w", r.Bitrate, err)
+		}
+
+		info, err := probeVariant(filepath.Join(bitrateDir, "segment000.ts"), r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe %s variant: %w", r.Bitrate, err)
+		}
+		variants = append(variants, info)
+	}
+
+	if err := masterPlaylist(outputDir, variants); err != nil {
+		return nil, fmt.Errorf("failed to write master playlist: %w", err)
+	}
+
+	if loud != nil {
+		if err := writeLoudnessSidecar(outputDir, loud); err != nil {
+			return nil, fmt.Errorf("failed to write loudness sidecar: %w", err)
 		}
 	}
 
-	return nil
+	canonical, err := parseMediaPlaylist(canonicalPlaylistFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", canonicalPlaylistFile, err)
+	}
+	return canonical, nil
 }
 
 func updateNetworkTopology(songID string, segments []string) {
@@ -220,9 +362,107 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// findSongPlaylist locates songDir's canonical media playlist: the first
+// ABR rung under a master.m3u8, or the root playlist.m3u8 an HLS
+// ingestion (ingest.go) writes directly. It reports the URL path the
+// song's PlaylistURL should point at alongside the on-disk path to parse.
+func findSongPlaylist(songDir string) (playlistURL, mediaPath string, ok bool) {
+	if _, err := os.Stat(filepath.Join(songDir, "master.m3u8")); err == nil {
+		entries, _ := os.ReadDir(songDir)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			candidate := filepath.Join(songDir, entry.Name(), "playlist.m3u8")
+			if _, err := os.Stat(candidate); err == nil {
+				return "master.m3u8", candidate, true
+			}
+		}
+	}
+	if candidate := filepath.Join(songDir, "playlist.m3u8"); fileExists(candidate) {
+		return "playlist.m3u8", candidate, true
+	}
+	return "", "", false
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// reconcileSongStore scans assets/songs/*/ against the store at startup:
+// directories with a finished playlist that the store never learned
+// about (e.g. the process crashed between encoding and UpdateSongSegments)
+// are re-imported, rows whose backing directory has since vanished are
+// marked "deleted", and updateNetworkTopology is re-driven for every
+// still-ready song so restarted origin/edge peers get repopulated.
+func reconcileSongStore() {
+	songsRoot := filepath.Join("assets", "songs")
+	entries, err := os.ReadDir(songsRoot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("reconcile: scanning %s failed: %v", songsRoot, err)
+		}
+		return
+	}
+
+	onDisk := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		songID := entry.Name()
+		onDisk[songID] = true
+		if songManager.GetSong(songID) != nil {
+			continue
+		}
+
+		playlistURL, mediaPath, ok := findSongPlaylist(filepath.Join(songsRoot, songID))
+		if !ok {
+			continue // still mid-encode, or not a song directory at all
+		}
+		playlist, err := parseMediaPlaylist(mediaPath)
+		if err != nil {
+			log.Printf("reconcile: parsing %s failed: %v", mediaPath, err)
+			continue
+		}
+		segments := make([]string, len(playlist.Segments))
+		for i, seg := range playlist.Segments {
+			segments[i] = seg.Filename
+		}
+		songManager.AddSong(&Song{
+			ID:          songID,
+			Title:       songID,
+			Duration:    playlist.TotalDuration(),
+			Bitrates:    []string{"source"},
+			Segments:    segments,
+			UploadTime:  time.Now(),
+			Status:      "ready",
+			PlaylistURL: fmt.Sprintf("/hls/%s/%s", songID, playlistURL),
+		})
+		log.Printf("reconcile: re-imported orphaned song directory %s", songID)
+	}
+
+	for id, song := range songManager.GetAllSongs() {
+		if !onDisk[id] {
+			if song.Status != "deleted" {
+				songManager.UpdateSongStatus(id, "deleted")
+				log.Printf("reconcile: marking song %s deleted, directory missing", id)
+			}
+			continue
+		}
+		if song.Status == "ready" {
+			updateNetworkTopology(id, song.Segments)
+		}
+	}
+}
+
 func main() {
 	port := getenv("PORT", "8093")
 
+	reconcileSongStore()
+	go radioStation.Run()
+
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
@@ -231,10 +471,15 @@ func main() {
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(corsMiddleware)
 
-	// Health check
+	// Health check, also reporting which transcode encoder path is active
+	// so an operator can confirm TRANSCODE_HWACCEL actually took effect.
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "ok",
+			"hwaccel": activeHWAccel,
+		})
 	})
 
 	// Get all songs
@@ -256,6 +501,33 @@ func main() {
 		json.NewEncoder(w).Encode(song)
 	})
 
+	// Get a song's EBU R128/ReplayGain loudness measurement
+	r.Get("/songs/{id}/loudness", func(w http.ResponseWriter, r *http.Request) {
+		songID := chi.URLParam(r, "id")
+		song := songManager.GetSong(songID)
+		if song == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if song.Loudness == nil {
+			http.Error(w, "loudness not yet measured for this song", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(song.Loudness)
+	})
+
+	// Get a song's extracted cover art
+	r.Get("/songs/{id}/cover", func(w http.ResponseWriter, r *http.Request) {
+		songID := chi.URLParam(r, "id")
+		song := songManager.GetSong(songID)
+		if song == nil || song.ArtworkURL == "" {
+			http.Error(w, "no cover art for this song", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("assets", "songs", songID, "cover.jpg"))
+	})
+
 	// Upload new song
 	r.Post("/upload", func(w http.ResponseWriter, r *http.Request) {
 		// Parse multipart form
@@ -265,13 +537,10 @@ func main() {
 			return
 		}
 
-		// Get form values
+		// Form values are optional overrides now - tag extraction in
+		// processAudioFile fills in whatever's left blank.
 		title := r.FormValue("title")
 		artist := r.FormValue("artist")
-		if title == "" || artist == "" {
-			http.Error(w, "Title and artist are required", http.StatusBadRequest)
-			return
-		}
 
 		// Get uploaded file
 		file, header, err := r.FormFile("audio")
@@ -282,10 +551,16 @@ func main() {
 		defer file.Close()
 
 		// Check file type
-		if !strings.HasSuffix(strings.ToLower(header.Filename), ".mp3") &&
-			!strings.HasSuffix(strings.ToLower(header.Filename), ".wav") &&
-			!strings.HasSuffix(strings.ToLower(header.Filename), ".m4a") {
-			http.Error(w, "Only MP3, WAV, and M4A files are supported", http.StatusBadRequest)
+		name := strings.ToLower(header.Filename)
+		supported := false
+		for _, ext := range []string{".mp3", ".wav", ".m4a", ".flac", ".ogg", ".opus", ".tta"} {
+			if strings.HasSuffix(name, ext) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			http.Error(w, "Only MP3, WAV, M4A, FLAC, Ogg/Opus, and TTA files are supported", http.StatusBadRequest)
 			return
 		}
 
@@ -304,6 +579,88 @@ func main() {
 		json.NewEncoder(w).Encode(song)
 	})
 
+	// Add a ready song to the live-radio playback queue
+	r.Post("/radio/enqueue/{songID}", func(w http.ResponseWriter, r *http.Request) {
+		songID := chi.URLParam(r, "songID")
+		if err := radioStation.Enqueue(songID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Skip straight to the next queued song
+	r.Post("/radio/skip", func(w http.ResponseWriter, r *http.Request) {
+		radioStation.Skip()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Report the track currently on air
+	r.Get("/radio/now-playing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(radioStation.NowPlaying())
+	})
+
+	// Live Icecast/ICY-compatible MP3 stream
+	r.Get("/radio/stream.mp3", radioStation.ServeHTTP)
+
+	// Mirror a remote HLS source into the local catalog
+	r.Post("/ingest/hls", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SourceURL string `json:"sourceUrl"`
+			Title     string `json:"title"`
+			Artist    string `json:"artist"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.SourceURL == "" {
+			http.Error(w, "sourceUrl is required", http.StatusBadRequest)
+			return
+		}
+
+		songID := fmt.Sprintf("song_%d", time.Now().UnixNano())
+		songDir := filepath.Join("assets", "songs", songID)
+		if err := os.MkdirAll(songDir, 0755); err != nil {
+			http.Error(w, fmt.Sprintf("failed to create song directory: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		puller, err := newHLSPuller(songID, req.SourceURL, songDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		song := &Song{
+			ID:          songID,
+			Title:       req.Title,
+			Artist:      req.Artist,
+			Bitrates:    []string{"source"},
+			UploadTime:  time.Now(),
+			Status:      "processing",
+			PlaylistURL: fmt.Sprintf("/hls/%s/playlist.m3u8", songID),
+		}
+		songManager.AddSong(song)
+		registerPuller(songID, puller)
+		go puller.Run()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(song)
+	})
+
+	// Stop an in-progress live ingestion
+	r.Delete("/ingest/{id}", func(w http.ResponseWriter, r *http.Request) {
+		songID := chi.URLParam(r, "id")
+		if !stopPuller(songID) {
+			http.Error(w, "no active ingestion for this song", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
 	// Serve HLS files
 	r.Handle("/hls/*", http.StripPrefix("/hls/", http.FileServer(http.Dir("assets/songs/"))))
 
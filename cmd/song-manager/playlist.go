@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MediaSegment is one #EXTINF entry in an RFC 8216 media playlist: a
+// segment's filename and its reported duration in seconds.
+type MediaSegment struct {
+	Filename string
+	Duration float64
+}
+
+// MediaPlaylist is the subset of an HLS media playlist processAudioFile
+// cares about: the segment list (true names and durations, as opposed to
+// the i < 8 assumption it used to make), the target duration, and
+// whether the playlist is complete.
+type MediaPlaylist struct {
+	TargetDuration int
+	Segments       []MediaSegment
+	EndList        bool
+}
+
+// TotalDuration sums every segment's #EXTINF duration - the real song
+// duration, rather than whatever ffprobe on the source file might claim
+// after lossy re-encoding shifts things slightly.
+func (p *MediaPlaylist) TotalDuration() float64 {
+	var total float64
+	for _, s := range p.Segments {
+		total += s.Duration
+	}
+	return total
+}
+
+// parseMediaPlaylist reads an RFC 8216 media playlist from path, pairing
+// each #EXTINF duration with the segment URI on the following line.
+func parseMediaPlaylist(path string) (*MediaPlaylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening playlist %s: %w", path, err)
+	}
+	defer f.Close()
+	return parseMediaPlaylistReader(f, path)
+}
+
+// parseMediaPlaylistReader is parseMediaPlaylist's underlying scanner,
+// split out so ingest.go's remote HLS puller can parse a playlist
+// fetched over HTTP without writing it to disk first. name is only used
+// to label errors.
+func parseMediaPlaylistReader(r io.Reader, name string) (*MediaPlaylist, error) {
+	playlist := &MediaPlaylist{}
+	var pendingDuration float64
+	havePending := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			d, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			if err == nil {
+				playlist.TargetDuration = d
+			}
+		case strings.HasPrefix(line, "#EXT-X-ENDLIST"):
+			playlist.EndList = true
+		case strings.HasPrefix(line, "#EXTINF:"):
+			fields := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)
+			d, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing #EXTINF duration in %s: %w", name, err)
+			}
+			pendingDuration = d
+			havePending = true
+		case strings.HasPrefix(line, "#"):
+			continue // other tags (#EXTM3U, #EXT-X-VERSION, #EXT-X-PLAYLIST-TYPE, ...) don't affect segment discovery
+		default:
+			if !havePending {
+				return nil, fmt.Errorf("segment URI %q in %s with no preceding #EXTINF", line, name)
+			}
+			playlist.Segments = append(playlist.Segments, MediaSegment{Filename: line, Duration: pendingDuration})
+			havePending = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading playlist %s: %w", name, err)
+	}
+	return playlist, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	radioRingCapacity = 64    // chunks buffered per listener before the oldest is dropped
+	radioChunkSize    = 4096  // bytes read from ffmpeg's stdout per chunk
+	icyMetaInt        = 16000 // bytes of audio between ICY metadata frames
+	icyBitrateKbps    = 128
+)
+
+// listenerRing is a fixed-capacity ring buffer of audio chunks for one
+// subscriber. push overwrites the oldest unread chunk once full, so a
+// slow listener falls behind - and hears a dropout - instead of blocking
+// the single encoder goroutine every listener shares.
+type listenerRing struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    [][]byte
+	head   int
+	tail   int
+	count  int
+	closed bool
+}
+
+func newListenerRing(capacity int) *listenerRing {
+	r := &listenerRing{buf: make([][]byte, capacity)}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *listenerRing) push(chunk []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.buf[r.head] = chunk
+	r.head = (r.head + 1) % len(r.buf)
+	if r.count == len(r.buf) {
+		r.tail = (r.tail + 1) % len(r.buf)
+	} else {
+		r.count++
+	}
+	r.cond.Signal()
+}
+
+// pop blocks until a chunk is available or the ring is closed, in which
+// case it returns false.
+func (r *listenerRing) pop() ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.count == 0 && !r.closed {
+		r.cond.Wait()
+	}
+	if r.count == 0 {
+		return nil, false
+	}
+	chunk := r.buf[r.tail]
+	r.tail = (r.tail + 1) % len(r.buf)
+	r.count--
+	return chunk, true
+}
+
+func (r *listenerRing) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// radioListener is one subscriber to the live stream.
+type radioListener struct {
+	ring *listenerRing
+}
+
+// NowPlaying is the track currently being broadcast, returned verbatim by
+// GET /radio/now-playing and used to build each listener's ICY metadata
+// frames.
+type NowPlaying struct {
+	SongID    string    `json:"songId"`
+	Title     string    `json:"title"`
+	Artist    string    `json:"artist"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func (n *NowPlaying) streamTitle() string {
+	if n == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s - %s", n.Artist, n.Title)
+}
+
+// RadioStation maintains the live-radio playback queue, transmuxes
+// whichever song is playing into continuous MP3, and fans the resulting
+// byte stream out to every subscribed listener - the MeteorLight
+// streaming-queue design, adapted to the song catalog this service
+// already manages.
+type RadioStation struct {
+	mu        sync.Mutex
+	queue     []string
+	listeners map[*radioListener]struct{}
+	now       *NowPlaying
+	skip      chan struct{}
+	genre     string
+}
+
+func NewRadioStation(genre string) *RadioStation {
+	return &RadioStation{
+		listeners: make(map[*radioListener]struct{}),
+		skip:      make(chan struct{}, 1),
+		genre:     genre,
+	}
+}
+
+// Enqueue appends songID to the playback queue. It errors if the song
+// doesn't exist or hasn't finished transcoding yet.
+func (s *RadioStation) Enqueue(songID string) error {
+	song := songManager.GetSong(songID)
+	if song == nil {
+		return fmt.Errorf("song %s not found", songID)
+	}
+	if song.Status != "ready" {
+		return fmt.Errorf("song %s is not ready yet (status %s)", songID, song.Status)
+	}
+	s.mu.Lock()
+	s.queue = append(s.queue, songID)
+	s.mu.Unlock()
+	return nil
+}
+
+// Skip advances straight to the next queued song, the same way
+// bbc-on-ice's poller moves the ICY title on when a track ends early.
+func (s *RadioStation) Skip() {
+	select {
+	case s.skip <- struct{}{}:
+	default:
+	}
+}
+
+func (s *RadioStation) dequeue() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return "", false
+	}
+	songID := s.queue[0]
+	s.queue = s.queue[1:]
+	return songID, true
+}
+
+// NowPlaying reports the track currently being broadcast, or nil if the
+// station is idle.
+func (s *RadioStation) NowPlaying() *NowPlaying {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+func (s *RadioStation) setNowPlaying(song *Song) {
+	s.mu.Lock()
+	s.now = &NowPlaying{SongID: song.ID, Title: song.Title, Artist: song.Artist, StartedAt: time.Now()}
+	s.mu.Unlock()
+}
+
+// Subscribe registers a new listener. Callers must Unsubscribe once the
+// client disconnects.
+func (s *RadioStation) Subscribe() *radioListener {
+	l := &radioListener{ring: newListenerRing(radioRingCapacity)}
+	s.mu.Lock()
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	return l
+}
+
+func (s *RadioStation) Unsubscribe(l *radioListener) {
+	s.mu.Lock()
+	delete(s.listeners, l)
+	s.mu.Unlock()
+	l.ring.close()
+}
+
+func (s *RadioStation) broadcast(chunk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for l := range s.listeners {
+		l.ring.push(chunk)
+	}
+}
+
+// Run drives the station forever: pulling the next queued song,
+// transmuxing it to continuous MP3, and broadcasting the output to every
+// subscribed listener. Call it from its own goroutine; it never returns.
+func (s *RadioStation) Run() {
+	for {
+		songID, ok := s.dequeue()
+		if !ok {
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		song := songManager.GetSong(songID)
+		if song == nil || song.SourcePath == "" {
+			continue
+		}
+		s.setNowPlaying(song)
+		s.playSong(song)
+	}
+}
+
+// playSong remuxes song's source file to MP3 via ffmpeg and streams its
+// stdout to every listener in radioChunkSize chunks, stopping early if
+// Skip is called while it's playing.
+func (s *RadioStation) playSong(song *Song) {
+	cmd := exec.Command("ffmpeg",
+		"-i", song.SourcePath,
+		"-vn",
+		"-c:a", "libmp3lame",
+		"-b:a", fmt.Sprintf("%dk", icyBitrateKbps),
+		"-f", "mp3",
+		"pipe:1",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("radio: failed to open ffmpeg pipe for song %s: %v", song.ID, err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("radio: failed to start ffmpeg for song %s: %v", song.ID, err)
+		return
+	}
+	defer cmd.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, radioChunkSize)
+		for {
+			n, readErr := stdout.Read(buf)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buf[:n])
+				s.broadcast(chunk)
+			}
+			if readErr != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-s.skip:
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+// ServeHTTP streams the station's live MP3 output, interleaving
+// Icecast-style metadata frames for clients that request them with
+// Icy-MetaData: 1.
+func (s *RadioStation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wantsMeta := r.Header.Get("Icy-MetaData") == "1"
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("icy-name", "CDN Simulator Radio")
+	w.Header().Set("icy-genre", s.genre)
+	w.Header().Set("icy-br", strconv.Itoa(icyBitrateKbps))
+	if wantsMeta {
+		w.Header().Set("icy-metaint", strconv.Itoa(icyMetaInt))
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, canFlush := w.(http.Flusher)
+
+	listener := s.Subscribe()
+	defer s.Unsubscribe(listener)
+
+	bytesSinceMeta := 0
+	for {
+		chunk, ok := listener.ring.pop()
+		if !ok {
+			return
+		}
+		for len(chunk) > 0 {
+			if wantsMeta && bytesSinceMeta == icyMetaInt {
+				if err := writeICYMetaFrame(w, s.NowPlaying().streamTitle()); err != nil {
+					return
+				}
+				bytesSinceMeta = 0
+			}
+			n := len(chunk)
+			if wantsMeta {
+				if remain := icyMetaInt - bytesSinceMeta; remain < n {
+					n = remain
+				}
+			}
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return
+			}
+			bytesSinceMeta += n
+			chunk = chunk[n:]
+		}
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+}
+
+// writeICYMetaFrame writes one ICY inline metadata frame: a single
+// length byte (counted in 16-byte blocks) followed by a null-padded
+// "StreamTitle='...';" string - the format every Icecast/SHOUTcast
+// client expects interleaved every icy-metaint bytes of audio.
+func writeICYMetaFrame(w io.Writer, title string) error {
+	meta := fmt.Sprintf("StreamTitle='%s';", strings.ReplaceAll(title, "'", ""))
+	blocks := (len(meta) + 15) / 16
+	padded := make([]byte, blocks*16)
+	copy(padded, meta)
+	if _, err := w.Write([]byte{byte(blocks)}); err != nil {
+		return err
+	}
+	_, err := w.Write(padded)
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists the song catalog across restarts, decoupling
+// SongManager's bookkeeping from how a song actually survives a crash.
+type Store interface {
+	Put(song *Song) error
+	Get(id string) (*Song, error)
+	List() ([]*Song, error)
+	Delete(id string) error
+}
+
+// fileStore is the default Store: the whole catalog as one JSON document,
+// rewritten atomically (temp file + rename) on every mutation so a crash
+// mid-write leaves the previous state.db intact - the same durability
+// guarantee a real embedded database gives, without pulling in a
+// modernc.org/sqlite or BoltDB dependency this sandbox has no module
+// file to declare.
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+	rows map[string]*Song
+}
+
+func newFileStore(path string) (*fileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating store directory: %w", err)
+	}
+	fs := &fileStore{path: path, rows: make(map[string]*Song)}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *fileStore) load() error {
+	data, err := os.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading store %s: %w", fs.path, err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var rows map[string]*Song
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("parsing store %s: %w", fs.path, err)
+	}
+	fs.rows = rows
+	return nil
+}
+
+// persist rewrites the whole store atomically: write to a temp file in
+// the same directory, then rename over the target, so a crash mid-write
+// can never leave state.db half-written.
+func (fs *fileStore) persist() error {
+	data, err := json.MarshalIndent(fs.rows, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.path)
+}
+
+func (fs *fileStore) Put(song *Song) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.rows[song.ID] = song
+	return fs.persist()
+}
+
+func (fs *fileStore) Get(id string) (*Song, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	song, ok := fs.rows[id]
+	if !ok {
+		return nil, fmt.Errorf("song %s not found in store", id)
+	}
+	return song, nil
+}
+
+func (fs *fileStore) List() ([]*Song, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	out := make([]*Song, 0, len(fs.rows))
+	for _, song := range fs.rows {
+		out = append(out, song)
+	}
+	return out, nil
+}
+
+func (fs *fileStore) Delete(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.rows, id)
+	return fs.persist()
+}
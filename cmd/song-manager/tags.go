@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Tags is the subset of a source file's embedded container tags
+// processAudioFile cares about, read via ffprobe so FLAC/Opus/Ogg/TTA and
+// ID3-tagged MP3/M4A inputs are all handled through one code path instead
+// of a format-specific tag library per container.
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	TrackNumber int
+	Year        int
+	Genre       string
+	HasArtwork  bool
+}
+
+// probeTags runs ffprobe against inputPath and reads back its
+// format-level tags plus whether a video stream flagged as an attached
+// picture (embedded cover art) is present.
+func probeTags(inputPath string) (*Tags, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_format", "-show_streams",
+		"-print_format", "json",
+		inputPath,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed for %s: %w", inputPath, err)
+	}
+
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType   string `json:"codec_type"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("parsing ffprobe output for %s: %w", inputPath, err)
+	}
+
+	// Tag keys vary by container (Vorbis comments are upper-cased by
+	// convention, ID3/MP4 atoms usually aren't), so check both cases.
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if v := probe.Format.Tags[k]; v != "" {
+				return v
+			}
+			if v := probe.Format.Tags[strings.ToUpper(k)]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	tags := &Tags{
+		Title:       get("title"),
+		Artist:      get("artist"),
+		Album:       get("album"),
+		AlbumArtist: get("album_artist", "albumartist"),
+		Genre:       get("genre"),
+	}
+
+	if track := get("track"); track != "" {
+		// ffprobe often reports "3/12"; take the number ahead of the slash.
+		if n, err := strconv.Atoi(strings.SplitN(track, "/", 2)[0]); err == nil {
+			tags.TrackNumber = n
+		}
+	}
+	if date := get("date", "year"); len(date) >= 4 {
+		if y, err := strconv.Atoi(date[:4]); err == nil {
+			tags.Year = y
+		}
+	}
+
+	for _, s := range probe.Streams {
+		if s.CodecType == "video" && s.Disposition.AttachedPic == 1 {
+			tags.HasArtwork = true
+			break
+		}
+	}
+
+	return tags, nil
+}
+
+// extractCoverArt pulls inputPath's attached-picture stream into
+// outputDir/cover.jpg for GET /songs/{id}/cover to serve.
+func extractCoverArt(inputPath, outputDir string) (string, error) {
+	coverPath := filepath.Join(outputDir, "cover.jpg")
+	cmd := exec.Command("ffmpeg", "-y",
+		"-i", inputPath,
+		"-an", "-vcodec", "copy",
+		coverPath,
+	)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("extracting cover art from %s: %w", inputPath, err)
+	}
+	return coverPath, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Rendition is one rung of the ABR ladder: an audio bitrate encoded with
+// Codec, producing its own HLS media playlist under outputDir/Bitrate/.
+type Rendition struct {
+	Bitrate string // e.g. "128k" - also used as the variant's directory name
+	Codec   string // "aac", "libfdk_aac", or "libopus"
+}
+
+// defaultLadder is the rendition ladder processAudioToHLS encodes when no
+// TRANSCODE_CODEC override is set: five AAC bitrates spanning
+// low-bandwidth mobile up to near-lossless listening.
+var defaultLadder = []Rendition{
+	{Bitrate: "64k", Codec: "aac"},
+	{Bitrate: "96k", Codec: "aac"},
+	{Bitrate: "128k", Codec: "aac"},
+	{Bitrate: "192k", Codec: "aac"},
+	{Bitrate: "256k", Codec: "aac"},
+}
+
+// ladder returns the configured rendition ladder, honoring
+// TRANSCODE_CODEC to swap every rung's codec (aac, libfdk_aac, libopus)
+// without needing a rung-by-rung override.
+func ladder() []Rendition {
+	codec := getenv("TRANSCODE_CODEC", "")
+	if codec == "" {
+		return defaultLadder
+	}
+	out := make([]Rendition, len(defaultLadder))
+	for i, r := range defaultLadder {
+		out[i] = Rendition{Bitrate: r.Bitrate, Codec: codec}
+	}
+	return out
+}
+
+// ladderBitrates returns the configured ladder's bitrate labels, for
+// Song.Bitrates.
+func ladderBitrates() []string {
+	l := ladder()
+	out := make([]string, len(l))
+	for i, r := range l {
+		out[i] = r.Bitrate
+	}
+	return out
+}
+
+// HWAccel identifies which hardware encoder path, if any, ffmpeg
+// invocations should use.
+type HWAccel string
+
+const (
+	HWAccelNone  HWAccel = "none"
+	HWAccelVAAPI HWAccel = "vaapi"
+	HWAccelNVENC HWAccel = "nvenc"
+)
+
+// detectHWAccel reads TRANSCODE_HWACCEL (vaapi|nvenc|none, default none)
+// and confirms the backing device/toolchain is actually present,
+// mirroring go-transcode's pluggable acceleration backends - an operator
+// opts in, but a missing /dev/dri or nvidia-smi falls back to software
+// instead of failing every upload.
+func detectHWAccel() HWAccel {
+	switch HWAccel(strings.ToLower(getenv("TRANSCODE_HWACCEL", "none"))) {
+	case HWAccelVAAPI:
+		if _, err := os.Stat("/dev/dri/renderD128"); err == nil {
+			return HWAccelVAAPI
+		}
+		log.Printf("TRANSCODE_HWACCEL=vaapi requested but /dev/dri/renderD128 not found, falling back to software encoding")
+	case HWAccelNVENC:
+		if _, err := exec.LookPath("nvidia-smi"); err == nil {
+			return HWAccelNVENC
+		}
+		log.Printf("TRANSCODE_HWACCEL=nvenc requested but nvidia-smi not found, falling back to software encoding")
+	}
+	return HWAccelNone
+}
+
+// activeHWAccel is detected once at startup; ffmpeg invocations and
+// /health both read it rather than re-probing hardware per request.
+var activeHWAccel = detectHWAccel()
+
+// ffmpegArgs builds the ffmpeg invocation for one rendition, prefixing a
+// hardware-accelerated encoder path when accel is available and, when
+// loud is non-nil, applying its measured loudnorm second pass so every
+// rendition comes out at the same target loudness.
+func ffmpegArgs(accel HWAccel, inputPath string, r Rendition, playlistFile, segmentPattern string, loud *Loudness) []string {
+	var args []string
+	switch accel {
+	case HWAccelVAAPI:
+		args = append(args, "-vaapi_device", "/dev/dri/renderD128")
+	case HWAccelNVENC:
+		args = append(args, "-hwaccel", "cuda")
+	}
+	args = append(args, "-i", inputPath)
+	if loud != nil {
+		args = append(args, "-af", loud.filterArg())
+	}
+	args = append(args,
+		"-c:a", r.Codec,
+		"-b:a", r.Bitrate,
+		"-hls_time", "4",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", segmentPattern,
+		playlistFile,
+	)
+	return args
+}
+
+// variantInfo is what ffprobe tells us about one encoded rendition, the
+// BANDWIDTH/CODECS attributes masterPlaylist needs for its
+// #EXT-X-STREAM-INF lines.
+type variantInfo struct {
+	Rendition
+	BandwidthBps int
+	CodecTag     string
+}
+
+// probeVariant shells out to ffprobe against one encoded segment to read
+// back its actual bitrate and codec, rather than trusting the requested
+// bitrate string verbatim - encoders rarely hit the target exactly, and
+// BANDWIDTH is supposed to reflect reality.
+func probeVariant(segmentPath string, r Rendition) (variantInfo, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=bit_rate,codec_name",
+		"-of", "json",
+		segmentPath,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return variantInfo{}, fmt.Errorf("ffprobe failed for %s: %w", segmentPath, err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			BitRate   string `json:"bit_rate"`
+			CodecName string `json:"codec_name"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return variantInfo{}, fmt.Errorf("parsing ffprobe output for %s: %w", segmentPath, err)
+	}
+
+	info := variantInfo{Rendition: r, CodecTag: hlsCodecString(r.Codec)}
+	if len(probe.Streams) > 0 {
+		if bps, err := strconv.Atoi(probe.Streams[0].BitRate); err == nil {
+			info.BandwidthBps = bps
+		}
+		if name := probe.Streams[0].CodecName; name != "" {
+			info.CodecTag = hlsCodecString(name)
+		}
+	}
+	if info.BandwidthBps == 0 {
+		info.BandwidthBps = requestedBitrateBps(r.Bitrate)
+	}
+	return info, nil
+}
+
+// hlsCodecString maps an encoder/codec name to the RFC 6381 string
+// #EXT-X-STREAM-INF's CODECS attribute expects.
+func hlsCodecString(codec string) string {
+	switch codec {
+	case "aac", "libfdk_aac":
+		return "mp4a.40.2" // AAC-LC
+	case "opus", "libopus":
+		return "opus"
+	default:
+		return codec
+	}
+}
+
+// requestedBitrateBps parses an ffmpeg bitrate string like "128k" into
+// bits per second, the fallback BANDWIDTH value when ffprobe couldn't
+// report one.
+func requestedBitrateBps(bitrate string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(bitrate, "k"))
+	return n * 1000
+}
+
+// masterPlaylist writes master.m3u8 in outputDir, one #EXT-X-STREAM-INF
+// entry per variant pointing at its media playlist, so players can pick
+// a rendition adaptively instead of being locked to whichever bitrate a
+// direct link happened to point at.
+func masterPlaylist(outputDir string, variants []variantInfo) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, v := range variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=%q\n", v.BandwidthBps, v.CodecTag)
+		fmt.Fprintf(&b, "%s/playlist.m3u8\n", v.Bitrate)
+	}
+	return os.WriteFile(filepath.Join(outputDir, "master.m3u8"), []byte(b.String()), 0644)
+}
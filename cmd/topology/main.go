@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"cloud_project/internal/topology"
 )
@@ -18,10 +22,46 @@ type upsertRequest struct {
 	Metadata  map[string]any `json:"metadata"`
 }
 
+// defaultGossipPushInterval/defaultGossipAntiEntropyInterval are how
+// often Gossiper fans out recent changes and runs a Merkle digest
+// reconciliation, respectively. Anti-entropy runs far less often since
+// it's only there to catch what push rounds missed.
+const (
+	defaultGossipPushInterval        = 1 * time.Second
+	defaultGossipAntiEntropyInterval = 10 * time.Second
+	defaultGossipFanout              = 3
+
+	// defaultProbeInterval is how often probeLoop re-measures every known
+	// edge, refreshing its LastProbed timestamp so JitterPenalizedWeight's
+	// staleness proxy doesn't de-prioritize a link just because nothing
+	// else has touched it lately.
+	defaultProbeInterval = 15 * time.Second
+
+	// defaultHealthDeltaInterval is how often healthDeltaLoop pushes a
+	// StreamHub.PublishHealthDelta of every peer's current RTT sample, so
+	// /graph/stream viewers see node health/color refresh even during a
+	// stretch with no actual Upsert/Remove.
+	defaultHealthDeltaInterval = 5 * time.Second
+)
+
 func main() {
 	addr := env("TOPOLOGY_ADDR", ":8090")
 	graph := topology.NewGraph()
 	mux := http.NewServeMux()
+
+	seedPeers := splitCSV(env("SEED_PEERS", ""))
+	fanout := defaultGossipFanout
+	if raw := env("GOSSIP_FANOUT", ""); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			fanout = parsed
+		}
+	}
+	gossiper := topology.NewGossiper(graph, seedPeers, fanout)
+	go gossiper.Run(context.Background(), defaultGossipPushInterval, defaultGossipAntiEntropyInterval)
+	pex := topology.NewPEX(graph)
+	go probeLoop(context.Background(), graph, defaultProbeInterval)
+	streamHub := topology.NewStreamHub(graph)
+	go healthDeltaLoop(context.Background(), graph, streamHub, defaultHealthDeltaInterval)
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
@@ -59,6 +99,7 @@ func main() {
 	mux.HandleFunc("/graph", func(w http.ResponseWriter, r *http.Request) {
 		topology.WriteJSON(w, http.StatusOK, graph.Snapshot())
 	})
+	mux.HandleFunc("/graph/stream", streamHub.ServeStream)
 	mux.HandleFunc("/graph/ui", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
@@ -132,8 +173,8 @@ func main() {
   <header>
     <h1>Peer Network Graph</h1>
     <div class="subtitle">
-      Data from <code>/graph</code> &mdash; nodes are peers, edges are neighbor links.
-      <button id="refreshBtn" style="margin-left:12px;padding:4px 10px;border-radius:4px;border:none;background:#2563eb;color:white;cursor:pointer;">Refresh Now</button>
+      Live from <code>/graph/stream</code> &mdash; nodes are peers, edges are neighbor links, color is RTT.
+      <button id="refreshBtn" style="margin-left:12px;padding:4px 10px;border-radius:4px;border:none;background:#2563eb;color:white;cursor:pointer;">Reconnect</button>
     </div>
   </header>
   <svg id="graph"></svg>
@@ -149,10 +190,23 @@ func main() {
     const nodeLayer = svg.append("g");
     let linkSelection = linkLayer.selectAll("line");
     let nodeSelection = nodeLayer.selectAll("g");
-    const canonicalOrder = [];
 
-    function showTooltip(evt, text) {
-      tooltip.textContent = text;
+    // state is the single source of truth redraw() joins against; it's
+    // mutated in place by applySnapshot/applyDiff rather than rebuilt from
+    // scratch on every message, so a node keeps its position (and a
+    // viewer keeps their place) across live updates instead of the whole
+    // layout jumping on each change.
+    const nodes = new Map(); // id -> { id, x, y, rttMs }
+    const links = new Map(); // "a::b" -> { source: id, target: id }
+    let placed = 0; // count of positions ever assigned, for nextPosition
+
+    function canonicalKey(a, b) {
+      return a < b ? a + "::" + b : b + "::" + a;
+    }
+
+    function showTooltip(evt, d) {
+      const rtt = Number.isFinite(d.rttMs) ? d.rttMs + "ms" : "no RTT sample";
+      tooltip.textContent = d.id + " (" + rtt + ")";
       tooltip.style.left = (evt.clientX + 10) + "px";
       tooltip.style.top = (evt.clientY + 10) + "px";
       tooltip.style.opacity = "1";
@@ -161,87 +215,75 @@ func main() {
       tooltip.style.opacity = "0";
     }
 
-    function keyForLink(d) {
-      const src = d.source.id || d.source;
-      const tgt = d.target.id || d.target;
-      return src < tgt ? src + "-" + tgt : tgt + "-" + src;
+    // nextPosition places the placed-th node on a sunflower spiral: each
+    // node's angle/radius depends only on its own placement index, not on
+    // how many nodes exist overall, so adding later nodes never shifts an
+    // already-placed one - the "keep the force layout stable" requirement
+    // without running an actual force simulation.
+    const goldenAngle = Math.PI * (3 - Math.sqrt(5));
+    // expectedNodes is just a scale factor for how fast the spiral grows
+    // outward per placement - not a hard cap, just keeps a typical-sized
+    // swarm spread across the available radius instead of bunched at the
+    // center.
+    const expectedNodes = 200;
+    function nextPosition() {
+      const idx = placed++;
+      const centerX = width / 2;
+      const centerY = height / 2;
+      const spacing = Math.min(width, height) / 2 - 80;
+      const radius = Math.min(spacing, spacing * Math.sqrt(idx / expectedNodes));
+      const angle = idx * goldenAngle;
+      return {
+        x: centerX + radius * Math.cos(angle),
+        y: centerY + radius * Math.sin(angle),
+      };
     }
 
-    function canonicalKey(a, b) {
-      return a < b ? a + "::" + b : b + "::" + a;
+    function ensureNode(id) {
+      let node = nodes.get(id);
+      if (!node) {
+        const pos = nextPosition();
+        node = { id, x: pos.x, y: pos.y, rttMs: undefined };
+        nodes.set(id, node);
+      }
+      return node;
     }
 
-    function renderGraph(data) {
-      const nodesMap = new Map();
-      const linkMap = new Map();
-      console.log(data);
-
-      Object.entries(data).forEach(([peer, neighbors]) => {
-        if (!nodesMap.has(peer)) nodesMap.set(peer, { id: peer });
-        neighbors.forEach(n => {
-          if (!nodesMap.has(n)) nodesMap.set(n, { id: n });
-          const key = canonicalKey(peer, n);
-          if (!linkMap.has(key)) {
-            linkMap.set(key, { source: peer, target: n });
-          }
-        });
-      });
-
-      const links = Array.from(linkMap.values());
-
-      const nodes = Array.from(nodesMap.values()).sort((a, b) => {
-        const aNum = parseInt(a.id.replace(/[^0-9]/g, ""), 10);
-        const bNum = parseInt(b.id.replace(/[^0-9]/g, ""), 10);
-        if (Number.isNaN(aNum) || Number.isNaN(bNum)) {
-          return a.id.localeCompare(b.id);
-        }
-        return aNum - bNum;
-      });
+    function rttColor(rttMs) {
+      if (!Number.isFinite(rttMs)) return "#475569"; // no sample yet: neutral gray
+      if (rttMs < 50) return "#22c55e"; // healthy
+      if (rttMs < 150) return "#eab308"; // degraded
+      return "#ef4444"; // unhealthy
+    }
 
-      nodes.forEach(node => {
-        if (!canonicalOrder.includes(node.id)) {
-          canonicalOrder.push(node.id);
-        }
-      });
-      const centerX = width / 2;
-      const centerY = height / 2;
-      const radius = Math.min(width, height) / 2 - 80;
-      const count = canonicalOrder.length || 1;
-      const positionMap = new Map();
-      canonicalOrder.forEach((id, idx) => {
-        const angle = (2 * Math.PI * idx) / count;
-        positionMap.set(id, {
-          x: centerX + radius * Math.cos(angle),
-          y: centerY + radius * Math.sin(angle),
-        });
-      });
-      nodes.forEach(node => {
-        const pos = positionMap.get(node.id);
-        node.x = pos?.x ?? centerX;
-        node.y = pos?.y ?? centerY;
-      });
+    function keyForLink(d) {
+      return canonicalKey(d.source, d.target);
+    }
 
-      const nodeById = new Map(nodes.map(n => [n.id, n]));
-      const resolvedLinks = links
+    function redraw() {
+      const nodeList = Array.from(nodes.values());
+      const resolvedLinks = Array.from(links.values())
         .map(l => {
-          const source = nodeById.get(l.source);
-          const target = nodeById.get(l.target);
+          const source = nodes.get(l.source);
+          const target = nodes.get(l.target);
           if (!source || !target) return null;
           return { source, target };
         })
         .filter(Boolean);
 
-      linkSelection = linkSelection
-        .data(resolvedLinks, keyForLink);
+      linkSelection = linkSelection.data(resolvedLinks, keyForLink);
       linkSelection.exit().remove();
       const linkEnter = linkSelection.enter()
         .append("line")
         .attr("class", "link");
       linkSelection = linkEnter.merge(linkSelection);
+      linkSelection
+        .attr("x1", d => d.source.x)
+        .attr("y1", d => d.source.y)
+        .attr("x2", d => d.target.x)
+        .attr("y2", d => d.target.y);
 
-      nodeSelection = nodeSelection
-        .data(nodes, d => d.id);
-
+      nodeSelection = nodeSelection.data(nodeList, d => d.id);
       nodeSelection.exit().remove();
 
       const nodeEnter = nodeSelection.enter()
@@ -250,8 +292,7 @@ func main() {
 
       nodeEnter.append("circle")
         .attr("r", 10)
-        .attr("fill", d => d.id.startsWith("peer-") ? "#22c55e" : "#38bdf8")
-        .on("mouseover", (evt, d) => showTooltip(evt, d.id))
+        .on("mouseover", (evt, d) => showTooltip(evt, d))
         .on("mouseout", hideTooltip)
         .on("click", (_, d) => {
           svg.selectAll(".node").classed("node--selected", n => n.id === d.id);
@@ -265,29 +306,139 @@ func main() {
 
       nodeSelection = nodeEnter.merge(nodeSelection);
       nodeSelection.attr("transform", d => "translate(" + d.x + "," + d.y + ")");
+      nodeSelection.select("circle").attr("fill", d => rttColor(d.rttMs));
+    }
 
-      linkSelection
-        .attr("x1", d => d.source.x)
-        .attr("y1", d => d.source.y)
-        .attr("x2", d => d.target.x)
-        .attr("y2", d => d.target.y);
+    function applySnapshot(snapshot) {
+      nodes.clear();
+      links.clear();
+      placed = 0;
+      Object.entries(snapshot || {}).forEach(([peer, neighbors]) => {
+        ensureNode(peer);
+        (neighbors || []).forEach(n => {
+          ensureNode(n);
+          links.set(canonicalKey(peer, n), { source: peer, target: n });
+        });
+      });
+      redraw();
     }
 
-    function fetchGraph() {
-      fetch("/graph?ts=" + Date.now())
-        .then(r => r.json())
-        .then(renderGraph)
-        .catch(err => {
-          console.error("Failed to load /graph:", err);
+    function applyDiff(diff) {
+      (diff.removed_edges || []).forEach(([a, b]) => links.delete(canonicalKey(a, b)));
+      (diff.removed_nodes || []).forEach(id => {
+        nodes.delete(id);
+        Array.from(links.keys()).forEach(key => {
+          if (key.startsWith(id + "::") || key.endsWith("::" + id)) links.delete(key);
         });
+      });
+      (diff.added_nodes || []).forEach(ensureNode);
+      (diff.added_edges || []).forEach(([a, b]) => {
+        ensureNode(a);
+        ensureNode(b);
+        links.set(canonicalKey(a, b), { source: a, target: b });
+      });
+      Object.entries(diff.updated_metrics || {}).forEach(([id, rec]) => {
+        ensureNode(id).rttMs = rec.rtt_ms;
+      });
+      redraw();
     }
 
-    document.getElementById("refreshBtn").addEventListener("click", fetchGraph);
-    fetchGraph();
+    function connectStream() {
+      const params = new URLSearchParams(window.location.search);
+      const qs = params.toString();
+      const proto = window.location.protocol === "https:" ? "wss:" : "ws:";
+      const ws = new WebSocket(proto + "//" + window.location.host + "/graph/stream" + (qs ? "?" + qs : ""));
+      ws.onmessage = evt => {
+        const msg = JSON.parse(evt.data);
+        if (msg.type === "snapshot") {
+          applySnapshot(msg.snapshot);
+        } else if (msg.type === "diff") {
+          applyDiff(msg.diff || {});
+        }
+      };
+      ws.onclose = () => {
+        console.warn("/graph/stream closed, reconnecting in 2s");
+        setTimeout(connectStream, 2000);
+      };
+      ws.onerror = () => ws.close();
+      return ws;
+    }
+
+    let socket = connectStream();
+    document.getElementById("refreshBtn").addEventListener("click", () => {
+      socket.close();
+      socket = connectStream();
+    });
   </script>
 </body>
 </html>`))
 	})
+	mux.HandleFunc("/gossip/push", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var records []topology.PeerRecord
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gossiper.ApplyPush(r.Context(), records)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/gossip/digest", func(w http.ResponseWriter, r *http.Request) {
+		node, ok := graph.Digest(r.URL.Query().Get("path"))
+		if !ok {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+		topology.WriteJSON(w, http.StatusOK, node)
+	})
+	mux.HandleFunc("/peers/exchange", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlePEXPull(pex, w, r)
+		case http.MethodPost:
+			handlePEXPush(pex, w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/find_node", func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target required", http.StatusBadRequest)
+			return
+		}
+		k := 0
+		if raw := r.URL.Query().Get("k"); raw != "" {
+			if parsed, err := strconv.Atoi(raw); err == nil {
+				k = parsed
+			}
+		}
+		topology.WriteJSON(w, http.StatusOK, map[string]any{
+			"target": target,
+			"peers":  graph.FindNode(target, k),
+		})
+	})
+	mux.HandleFunc("/depth", func(w http.ResponseWriter, r *http.Request) {
+		topology.WriteJSON(w, http.StatusOK, map[string]any{
+			"depth": graph.NeighbourhoodDepth(),
+		})
+	})
+	mux.HandleFunc("/paths", func(w http.ResponseWriter, r *http.Request) {
+		from := r.URL.Query().Get("from")
+		if from == "" {
+			http.Error(w, "from required", http.StatusBadRequest)
+			return
+		}
+		dist, prev := graph.Dijkstra(from, graph.EdgeWeight)
+		topology.WriteJSON(w, http.StatusOK, map[string]any{
+			"from": from,
+			"cost": dist,
+			"prev": prev,
+		})
+	})
 	mux.HandleFunc("/path", func(w http.ResponseWriter, r *http.Request) {
 		from := r.URL.Query().Get("from")
 		to := r.URL.Query().Get("to")
@@ -295,13 +446,52 @@ func main() {
 			http.Error(w, "from/to required", http.StatusBadRequest)
 			return
 		}
-		path, err := graph.BFS(from, to)
+		metric := r.URL.Query().Get("metric")
+		if metric == "" {
+			// No metric requested: keep the original hop-count BFS
+			// behavior so existing callers don't break.
+			path, err := graph.BFS(from, to)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			topology.WriteJSON(w, http.StatusOK, map[string]any{
+				"path": path,
+			})
+			return
+		}
+		weight, ok := weightFuncForMetric(graph, metric)
+		if !ok {
+			http.Error(w, "unknown metric (want rtt, latency-bw, or loss)", http.StatusBadRequest)
+			return
+		}
+		if raw := r.URL.Query().Get("k"); raw != "" {
+			k, err := strconv.Atoi(raw)
+			if err != nil || k <= 0 {
+				http.Error(w, "k must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			paths, err := graph.KShortestPaths(from, to, k, weight)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			topology.WriteJSON(w, http.StatusOK, map[string]any{
+				"metric": metric,
+				"paths":  paths,
+			})
+			return
+		}
+		path, cost, err := graph.ShortestWeightedPath(from, to, weight)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
 		topology.WriteJSON(w, http.StatusOK, map[string]any{
-			"path": path,
+			"metric":  metric,
+			"path":    path,
+			"weights": hopWeights(path, weight),
+			"cost":    cost,
 		})
 	})
 
@@ -315,6 +505,54 @@ func main() {
 	}
 }
 
+// handlePEXPull serves GET /peers/exchange?peer_id=X&have=a,b,c: up to
+// pexMaxPeers peers X doesn't already have, encoded in PEX's compact
+// wire format, plus the peer IDs recently dropped from the graph.
+func handlePEXPull(pex *topology.PEX, w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peer_id")
+	if peerID == "" {
+		http.Error(w, "peer_id required", http.StatusBadRequest)
+		return
+	}
+	have := make(map[string]struct{})
+	for _, id := range splitCSV(r.URL.Query().Get("have")) {
+		have[id] = struct{}{}
+	}
+	peers, dropped, ok := pex.Pull(peerID, have)
+	if !ok {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	topology.WriteJSON(w, http.StatusOK, map[string]any{
+		"peers":   base64.StdEncoding.EncodeToString(topology.EncodePEX(peers)),
+		"dropped": dropped,
+	})
+}
+
+// pexPushRequest is the POST /peers/exchange body: a peer reporting the
+// peers it has itself observed to be good, with per-peer RTT and
+// reachability.
+type pexPushRequest struct {
+	PeerID string             `json:"peer_id"`
+	Peers  []topology.PEXPeer `json:"peers"`
+}
+
+// handlePEXPush serves POST /peers/exchange: a peer pushing back its
+// own observed-good peers.
+func handlePEXPush(pex *topology.PEX, w http.ResponseWriter, r *http.Request) {
+	var req pexPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PeerID == "" {
+		http.Error(w, "peer_id required", http.StatusBadRequest)
+		return
+	}
+	pex.Push(req.PeerID, req.Peers)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func env(key, fallback string) string {
 	val := strings.TrimSpace(os.Getenv(key))
 	if val == "" {
@@ -322,3 +560,93 @@ func env(key, fallback string) string {
 	}
 	return val
 }
+
+// splitCSV splits a comma-separated env var (SEED_PEERS' shape - this
+// codebase configures everything through env vars rather than flags)
+// into trimmed, non-empty entries.
+func splitCSV(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// weightFuncForMetric maps a /path?metric= value to the WeightFunc it
+// names; ok is false for an unrecognized metric.
+func weightFuncForMetric(graph *topology.Graph, metric string) (topology.WeightFunc, bool) {
+	switch metric {
+	case "rtt":
+		return graph.EdgeWeight, true
+	case "latency-bw":
+		return graph.LatencyBandwidthWeight, true
+	case "loss":
+		return graph.LossWeight, true
+	default:
+		return nil, false
+	}
+}
+
+// hopWeights returns weight(path[i], path[i+1]) for each consecutive
+// pair in path, so a /path response can show per-hop cost alongside the
+// total.
+func hopWeights(path []string, weight topology.WeightFunc) []float64 {
+	if len(path) < 2 {
+		return nil
+	}
+	weights := make([]float64, len(path)-1)
+	for i := range weights {
+		weights[i] = weight(path[i], path[i+1])
+	}
+	return weights
+}
+
+// probeLoop periodically re-measures every known edge by re-applying its
+// last-known stats through ProbeEdge, so LastProbed stays fresh even for
+// links nothing else has touched recently - standing in for the active
+// probing a real deployment would run, since this simulator has no real
+// network to measure.
+func probeLoop(ctx context.Context, graph *topology.Graph, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for peerID, neighbors := range graph.Snapshot() {
+				for _, neighbor := range neighbors {
+					rtt, bw, loss, ok := graph.EdgeStats(peerID, neighbor)
+					if !ok {
+						continue
+					}
+					graph.ProbeEdge(peerID, neighbor, rtt, bw, loss)
+				}
+			}
+		}
+	}
+}
+
+// healthDeltaLoop periodically pushes every known peer's current state
+// through hub.PublishHealthDelta, so a /graph/stream viewer's node
+// color/health indicators stay fresh even across a stretch with no
+// Upsert/Remove to otherwise trigger a diff.
+func healthDeltaLoop(ctx context.Context, graph *topology.Graph, hub *topology.StreamHub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updated := make(map[string]topology.PeerRecord)
+			for peerID := range graph.Snapshot() {
+				updated[peerID] = graph.ToRecord(peerID)
+			}
+			hub.PublishHealthDelta(updated)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"sort"
@@ -29,6 +34,12 @@ type AnnounceRequest struct {
 	ConnectedPeers []string `json:"connectedPeers"`
 	MaxConnections int      `json:"maxConnections"`
 	UploadSlots    int      `json:"uploadSlots"`
+	// Event is BitTorrent's announce event: "started", "completed" or
+	// "stopped". Empty means a routine re-announce. "stopped" deregisters
+	// the peer immediately instead of waiting for cleanup's TTL sweep;
+	// "completed" credits Segments toward each segment's scrape downloaded
+	// counter.
+	Event string `json:"event,omitempty"`
 }
 
 type PeerInfo struct {
@@ -46,18 +57,78 @@ type PeerInfo struct {
 	UploadSlots    int      `json:"uploadSlots"`
 }
 
+// banStrikeThreshold is how many distinct misbehavior reports a peer
+// accumulates before Report auto-bans its last known source IP - mirrors
+// minReportsBeforeBan in the Redis-backed tracker (internal/tracker),
+// simplified to a flat strike count since this tracker keeps no
+// success-rate bookkeeping.
+const banStrikeThreshold = 3
+
+// PeerSelectionWeights controls how GetPeers' "weighted" strategy scores
+// candidate peers - each weight scales the matching signal's contribution
+// before they're summed, tuned via the TRACKER_W_* env vars.
+type PeerSelectionWeights struct {
+	Region       float64
+	RTT          float64
+	Bandwidth    float64
+	Availability float64
+	FreeSlots    float64
+	SeedBoost    float64
+}
+
+func defaultWeights() PeerSelectionWeights {
+	return PeerSelectionWeights{
+		Region:       1.0,
+		RTT:          1.0,
+		Bandwidth:    1.0,
+		Availability: 1.0,
+		FreeSlots:    1.0,
+		SeedBoost:    0.5,
+	}
+}
+
+func loadWeights() PeerSelectionWeights {
+	w := defaultWeights()
+	w.Region = getenvFloat("TRACKER_W_REGION", w.Region)
+	w.RTT = getenvFloat("TRACKER_W_RTT", w.RTT)
+	w.Bandwidth = getenvFloat("TRACKER_W_BW", w.Bandwidth)
+	w.Availability = getenvFloat("TRACKER_W_AVAILABILITY", w.Availability)
+	w.FreeSlots = getenvFloat("TRACKER_W_SLOTS", w.FreeSlots)
+	w.SeedBoost = getenvFloat("TRACKER_W_SEED", w.SeedBoost)
+	return w
+}
+
+func getenvFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
 type InMemoryTracker struct {
-	mu      sync.RWMutex
-	peers   map[string]*PeerInfo
-	segments map[string]map[string]bool // segment -> peerId -> true
-	ttl     time.Duration
+	mu          sync.RWMutex
+	peers       map[string]*PeerInfo
+	segments    map[string]map[string]bool // segment -> peerId -> true
+	completions map[string]int64           // segment -> lifetime completed-download count
+	peerIPs     map[string]string          // peerId -> last announced source IP
+	peerStrikes map[string]int             // peerId -> misbehavior strike count
+	badPeerIPs  map[string]bool            // banned source IPs
+	weights     PeerSelectionWeights
+	ttl         time.Duration
 }
 
-func NewInMemoryTracker(ttl time.Duration) *InMemoryTracker {
+func NewInMemoryTracker(ttl time.Duration, weights PeerSelectionWeights) *InMemoryTracker {
 	t := &InMemoryTracker{
-		peers:    make(map[string]*PeerInfo),
-		segments: make(map[string]map[string]bool),
-		ttl:      ttl,
+		peers:       make(map[string]*PeerInfo),
+		segments:    make(map[string]map[string]bool),
+		completions: make(map[string]int64),
+		peerIPs:     make(map[string]string),
+		peerStrikes: make(map[string]int),
+		badPeerIPs:  make(map[string]bool),
+		weights:     weights,
+		ttl:         ttl,
 	}
 	
 	// Start cleanup goroutine
@@ -78,6 +149,8 @@ func (t *InMemoryTracker) cleanup() {
 		for peerID, peer := range t.peers {
 			if now-peer.LastSeen > int64(t.ttl.Seconds()) {
 				delete(t.peers, peerID)
+				delete(t.peerIPs, peerID)
+				delete(t.peerStrikes, peerID)
 				// Remove from segment mappings
 				for segment, peerMap := range t.segments {
 					delete(peerMap, peerID)
@@ -92,10 +165,18 @@ func (t *InMemoryTracker) cleanup() {
 	}
 }
 
-func (t *InMemoryTracker) Announce(peer *AnnounceRequest) {
+// Announce records peer's latest state and the source IP it announced
+// from. It refuses to register a peer whose srcIP is currently banned,
+// returning an error instead - the badPeerIPs counterpart of the
+// Redis-backed tracker's IsBanned check in HandleAnnounce.
+func (t *InMemoryTracker) Announce(peer *AnnounceRequest, srcIP string) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	
+
+	if srcIP != "" && t.badPeerIPs[srcIP] {
+		return fmt.Errorf("peer %s: source IP %s is banned", peer.PeerID, srcIP)
+	}
+
 	now := time.Now().Unix()
 	peerInfo := &PeerInfo{
 		PeerID:         peer.PeerID,
@@ -111,9 +192,10 @@ func (t *InMemoryTracker) Announce(peer *AnnounceRequest) {
 		MaxConnections: peer.MaxConnections,
 		UploadSlots:    peer.UploadSlots,
 	}
-	
+
 	t.peers[peer.PeerID] = peerInfo
-	
+	t.peerIPs[peer.PeerID] = srcIP
+
 	// Update segment mappings
 	for _, segment := range peer.Segments {
 		segment = strings.TrimSpace(segment)
@@ -125,49 +207,473 @@ func (t *InMemoryTracker) Announce(peer *AnnounceRequest) {
 		}
 		t.segments[segment][peer.PeerID] = true
 	}
+	return nil
+}
+
+// PeerQuery parameterizes GetPeers' candidate set and ranking strategy.
+type PeerQuery struct {
+	Segment  string
+	Region   string
+	Count    int
+	Strategy string   // "weighted" (default), "rtt", "random", or "rarest"
+	Segments []string // "rarest" only: break ties by global rarity across these segments
 }
 
-func (t *InMemoryTracker) GetPeers(segment string, region string, count int) []PeerInfo {
+// GetPeers returns up to q.Count peers announced for q.Segment, ranked by
+// q.Strategy:
+//   - "weighted" (default): combines region match, RTT, bandwidth,
+//     availability, free upload slots, and a seed-peer boost into one
+//     score via t.weights.
+//   - "rtt": the original region-match-then-RTT-then-peerID ordering.
+//   - "random": shuffled, for load-spreading or chaos testing.
+//   - "rarest": prioritizes peers holding the rarest of q.Segments, so a
+//     requester helps replicate underreplicated content first.
+func (t *InMemoryTracker) GetPeers(q PeerQuery) []PeerInfo {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	
-	peerMap, exists := t.segments[segment]
+
+	peerMap, exists := t.segments[q.Segment]
 	if !exists {
 		return []PeerInfo{}
 	}
-	
+
 	peers := make([]PeerInfo, 0, len(peerMap))
 	for peerID := range peerMap {
 		if peer, exists := t.peers[peerID]; exists {
 			peers = append(peers, *peer)
 		}
 	}
-	
-	// Sort by region match (desc), then RTT (asc), then peerID (asc)
-	sort.Slice(peers, func(i, j int) bool {
-		rim := boolToInt(peers[i].Region == region)
-		rjm := boolToInt(peers[j].Region == region)
-		if rim != rjm {
-			return rim > rjm
+
+	switch q.Strategy {
+	case "random":
+		rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	case "rarest":
+		type scored struct {
+			peer   PeerInfo
+			rarity int
 		}
-		if peers[i].RTT != peers[j].RTT {
-			return peers[i].RTT < peers[j].RTT
+		arr := make([]scored, len(peers))
+		for i, peer := range peers {
+			arr[i] = scored{peer: peer, rarity: t.rarestReplicaCount(peer.PeerID, q.Segments)}
 		}
-		return peers[i].PeerID < peers[j].PeerID
-	})
-	
+		sort.Slice(arr, func(i, j int) bool {
+			if arr[i].rarity != arr[j].rarity {
+				return arr[i].rarity < arr[j].rarity
+			}
+			return arr[i].peer.PeerID < arr[j].peer.PeerID
+		})
+		for i := range arr {
+			peers[i] = arr[i].peer
+		}
+	case "rtt":
+		// Sort by region match (desc), then RTT (asc), then peerID (asc)
+		sort.Slice(peers, func(i, j int) bool {
+			rim := boolToInt(peers[i].Region == q.Region)
+			rjm := boolToInt(peers[j].Region == q.Region)
+			if rim != rjm {
+				return rim > rjm
+			}
+			if peers[i].RTT != peers[j].RTT {
+				return peers[i].RTT < peers[j].RTT
+			}
+			return peers[i].PeerID < peers[j].PeerID
+		})
+	default: // "weighted"
+		type scored struct {
+			peer  PeerInfo
+			score float64
+		}
+		arr := make([]scored, len(peers))
+		for i, peer := range peers {
+			arr[i] = scored{peer: peer, score: weightedScore(peer, q.Region, t.weights)}
+		}
+		sort.Slice(arr, func(i, j int) bool {
+			if arr[i].score != arr[j].score {
+				return arr[i].score > arr[j].score
+			}
+			return arr[i].peer.PeerID < arr[j].peer.PeerID
+		})
+		for i := range arr {
+			peers[i] = arr[i].peer
+		}
+	}
+
+	count := q.Count
+	if count <= 0 {
+		count = 10
+	}
 	if len(peers) > count {
 		peers = peers[:count]
 	}
-	
+
 	return peers
 }
 
+// rarestReplicaCount returns the fewest global replicas among segs that
+// peerID actually holds, or math.MaxInt32 if it holds none of them - the
+// "rarest" strategy's priority signal. Callers must already hold t.mu.
+func (t *InMemoryTracker) rarestReplicaCount(peerID string, segs []string) int {
+	best := math.MaxInt32
+	for _, seg := range segs {
+		seg = strings.TrimSpace(seg)
+		if seg == "" {
+			continue
+		}
+		peerMap, ok := t.segments[seg]
+		if !ok || !peerMap[peerID] {
+			continue
+		}
+		if n := len(peerMap); n < best {
+			best = n
+		}
+	}
+	return best
+}
+
+// parseBandwidth converts a bandwidth string like "500kbps", "2Mbps", or
+// "10mbps" into bits/sec. A bare number with no recognized suffix is
+// assumed to already be bits/sec. Unparseable strings return 0.
+func parseBandwidth(s string) float64 {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0
+	}
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "gbps"):
+		mult = 1_000_000_000
+		s = strings.TrimSuffix(s, "gbps")
+	case strings.HasSuffix(s, "mbps"):
+		mult = 1_000_000
+		s = strings.TrimSuffix(s, "mbps")
+	case strings.HasSuffix(s, "kbps"):
+		mult = 1_000
+		s = strings.TrimSuffix(s, "kbps")
+	case strings.HasSuffix(s, "bps"):
+		s = strings.TrimSuffix(s, "bps")
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return n * mult
+}
+
+// weightedScore scores one candidate peer for GetPeers' "weighted"
+// strategy against region - higher is better.
+func weightedScore(peer PeerInfo, region string, w PeerSelectionWeights) float64 {
+	regionScore := float64(boolToInt(peer.Region == region))
+	rttScore := 1.0 / (1.0 + float64(peer.RTT))
+	bwScore := math.Min(parseBandwidth(peer.Bandwidth)/10_000_000, 1.0)
+	availScore := peer.Availability
+
+	freeSlots := peer.UploadSlots - len(peer.ConnectedPeers)
+	var slotScore float64
+	if peer.UploadSlots > 0 {
+		slotScore = math.Max(float64(freeSlots), 0) / float64(peer.UploadSlots)
+	}
+	seedScore := float64(boolToInt(peer.IsSeedPeer))
+
+	return w.Region*regionScore +
+		w.RTT*rttScore +
+		w.Bandwidth*bwScore +
+		w.Availability*availScore +
+		w.FreeSlots*slotScore +
+		w.SeedBoost*seedScore
+}
+
+// Deregister removes peerID from the tracker and every segment it had
+// announced - event=stopped's graceful exit, instead of waiting for
+// cleanup's TTL sweep to notice it's gone.
+func (t *InMemoryTracker) Deregister(peerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.peers, peerID)
+	delete(t.peerIPs, peerID)
+	delete(t.peerStrikes, peerID)
+	for segment, peerMap := range t.segments {
+		delete(peerMap, peerID)
+		if len(peerMap) == 0 {
+			delete(t.segments, segment)
+		}
+	}
+}
+
+// ReportRequest is submitted by a CDN node that observed a peer serve a
+// bad copy of a segment - hash mismatch, timeout, or other misbehavior.
+type ReportRequest struct {
+	PeerID    string `json:"peerId"`
+	SegmentID string `json:"segmentId"`
+	Reason    string `json:"reason"`
+}
+
+// pruneIPLocked removes every peer last seen announcing from ip, from
+// peers and every segments mapping alike. Callers must already hold t.mu.
+func (t *InMemoryTracker) pruneIPLocked(ip string) {
+	for peerID, peerIP := range t.peerIPs {
+		if peerIP != ip {
+			continue
+		}
+		delete(t.peers, peerID)
+		delete(t.peerIPs, peerID)
+		delete(t.peerStrikes, peerID)
+		for segment, peerMap := range t.segments {
+			delete(peerMap, peerID)
+			if len(peerMap) == 0 {
+				delete(t.segments, segment)
+			}
+		}
+	}
+}
+
+// BanIP bans ip outright, pruning any peer currently announced from it.
+func (t *InMemoryTracker) BanIP(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.badPeerIPs[ip] = true
+	t.pruneIPLocked(ip)
+}
+
+// UnbanIP lifts a ban on ip, letting peers from it announce again.
+func (t *InMemoryTracker) UnbanIP(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.badPeerIPs, ip)
+}
+
+// BannedIPs returns every currently banned IP, sorted for stable output.
+func (t *InMemoryTracker) BannedIPs() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ips := make([]string, 0, len(t.badPeerIPs))
+	for ip := range t.badPeerIPs {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// Report records one misbehavior strike against req.PeerID, auto-banning
+// its last known source IP once banStrikeThreshold strikes accumulate.
+// strikes is the peer's running total; bannedIP is non-empty only on the
+// report that triggered the ban.
+func (t *InMemoryTracker) Report(req ReportRequest) (strikes int, bannedIP string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.peerStrikes[req.PeerID]++
+	strikes = t.peerStrikes[req.PeerID]
+	if strikes < banStrikeThreshold {
+		return strikes, ""
+	}
+
+	ip := t.peerIPs[req.PeerID]
+	if ip == "" || t.badPeerIPs[ip] {
+		return strikes, ""
+	}
+	t.badPeerIPs[ip] = true
+	t.pruneIPLocked(ip)
+	return strikes, ip
+}
+
+// RecordCompletion credits each of segments with one more lifetime
+// completed download - event=completed's contribution to /scrape's
+// "downloaded" count.
+func (t *InMemoryTracker) RecordCompletion(segments []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, segment := range segments {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		t.completions[segment]++
+	}
+}
+
+// ScrapeStats is one segment's BEP-48-style scrape tally: Complete mirrors
+// BitTorrent's "seeders" (peers holding the segment with IsSeedPeer set),
+// Incomplete mirrors "leechers" (the rest), and Downloaded is the lifetime
+// completed-download count RecordCompletion maintains.
+type ScrapeStats struct {
+	Complete   int   `json:"complete"`
+	Incomplete int   `json:"incomplete"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// Scrape reports ScrapeStats for segment, zero-valued if nobody has ever
+// announced or completed it.
+func (t *InMemoryTracker) Scrape(segment string) ScrapeStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats := ScrapeStats{Downloaded: t.completions[segment]}
+	for peerID := range t.segments[segment] {
+		peer, ok := t.peers[peerID]
+		if !ok {
+			continue
+		}
+		if peer.IsSeedPeer {
+			stats.Complete++
+		} else {
+			stats.Incomplete++
+		}
+	}
+	return stats
+}
+
+// parsePeerAddr extracts an IP and port from a PeerInfo.Addr such as
+// "ws://127.0.0.1:8091/ws" or a bare "host:port", resolving a hostname via
+// the local resolver if it isn't already a literal IP. ok is false when
+// addr doesn't carry a usable host:port, in which case the caller should
+// skip the peer rather than guess.
+func parsePeerAddr(addr string) (ip net.IP, port int, ok bool) {
+	if idx := strings.Index(addr, "://"); idx >= 0 {
+		addr = addr[idx+3:]
+	}
+	if idx := strings.Index(addr, "/"); idx >= 0 {
+		addr = addr[:idx]
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, false
+	}
+	p, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	if parsed := net.ParseIP(host); parsed != nil {
+		return parsed, p, true
+	}
+	resolved, err := net.LookupIP(host)
+	if err != nil || len(resolved) == 0 {
+		return nil, 0, false
+	}
+	return resolved[0], p, true
+}
+
+// compactPeerLists packs peers into BEP-23 compact form: v4 holds 6 bytes
+// per IPv4 peer (4-byte address, 2-byte big-endian port) concatenated,
+// v6 holds 18 bytes per IPv6 peer the same way. Peers whose Addr can't be
+// parsed are silently dropped rather than corrupting the fixed-width
+// encoding.
+func compactPeerLists(peers []PeerInfo) (v4, v6 []byte) {
+	for _, p := range peers {
+		ip, port, ok := parsePeerAddr(p.Addr)
+		if !ok {
+			continue
+		}
+		portBytes := []byte{byte(port >> 8), byte(port)}
+		if v4Addr := ip.To4(); v4Addr != nil {
+			v4 = append(v4, v4Addr...)
+			v4 = append(v4, portBytes...)
+		} else if v6Addr := ip.To16(); v6Addr != nil {
+			v6 = append(v6, v6Addr...)
+			v6 = append(v6, portBytes...)
+		}
+	}
+	return v4, v6
+}
+
+// bencodeEncode is the minimal bencode encoder this tracker needs to speak
+// BitTorrent's wire format: integers, byte strings (including raw binary,
+// for compact peer blobs), lists, and dictionaries with lexicographically
+// sorted keys, per the bencode spec.
+func bencodeEncode(v any) []byte {
+	switch val := v.(type) {
+	case int:
+		return []byte(fmt.Sprintf("i%de", val))
+	case int64:
+		return []byte(fmt.Sprintf("i%de", val))
+	case string:
+		return []byte(fmt.Sprintf("%d:%s", len(val), val))
+	case []byte:
+		out := []byte(fmt.Sprintf("%d:", len(val)))
+		return append(out, val...)
+	case []any:
+		var buf bytes.Buffer
+		buf.WriteByte('l')
+		for _, item := range val {
+			buf.Write(bencodeEncode(item))
+		}
+		buf.WriteByte('e')
+		return buf.Bytes()
+	case map[string]any:
+		var buf bytes.Buffer
+		buf.WriteByte('d')
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.Write(bencodeEncode(k))
+			buf.Write(bencodeEncode(val[k]))
+		}
+		buf.WriteByte('e')
+		return buf.Bytes()
+	default:
+		return []byte("0:")
+	}
+}
+
+// wantsBencode reports whether req asked for BitTorrent's bencoded wire
+// format, either explicitly via ?format=bencode or the way a real
+// BitTorrent client would via an Accept header, or implicitly by asking
+// for a compact peer list (which is only meaningful inside a bencoded
+// response).
+func wantsBencode(req *http.Request) bool {
+	q := req.URL.Query()
+	if q.Get("format") == "bencode" || q.Get("compact") == "1" {
+		return true
+	}
+	return strings.Contains(req.Header.Get("Accept"), "application/x-bittorrent")
+}
+
+// writeAnnounceResponse renders peers as a BitTorrent tracker would: a
+// compact binary blob under "peers"/"peers6" when requested, otherwise a
+// list of {peer id, ip, port} dicts, bencoded if wantsBencode(req) and
+// JSON otherwise.
+func writeAnnounceResponse(w http.ResponseWriter, req *http.Request, peers []PeerInfo, interval int) {
+	resp := map[string]any{"interval": interval}
+
+	if req.URL.Query().Get("compact") == "1" {
+		v4, v6 := compactPeerLists(peers)
+		resp["peers"] = v4
+		if len(v6) > 0 {
+			resp["peers6"] = v6
+		}
+	} else {
+		list := make([]any, 0, len(peers))
+		for _, p := range peers {
+			entry := map[string]any{"peer id": p.PeerID}
+			if ip, port, ok := parsePeerAddr(p.Addr); ok {
+				entry["ip"] = ip.String()
+				entry["port"] = port
+			}
+			list = append(list, entry)
+		}
+		resp["peers"] = list
+	}
+
+	if wantsBencode(req) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(bencodeEncode(resp))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func main() {
 	httpAddr := getenv("HTTP_ADDR", ":8090")
 	ttlSeconds := getenvInt("TRACKER_TTL_SECONDS", 120)
 	
-	tracker := NewInMemoryTracker(time.Duration(ttlSeconds) * time.Second)
+	tracker := NewInMemoryTracker(time.Duration(ttlSeconds)*time.Second, loadWeights())
 	
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
@@ -190,9 +696,43 @@ func main() {
 			http.Error(w, "peerId and segments required", http.StatusBadRequest)
 			return
 		}
-		
-		tracker.Announce(&body)
-		w.WriteHeader(http.StatusNoContent)
+
+		switch body.Event {
+		case "stopped":
+			tracker.Deregister(body.PeerID)
+		case "completed":
+			if err := tracker.Announce(&body, req.RemoteAddr); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			tracker.RecordCompletion(body.Segments)
+		default:
+			if err := tracker.Announce(&body, req.RemoteAddr); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		if !wantsBencode(req) && req.URL.Query().Get("compact") == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		seg := req.URL.Query().Get("seg")
+		if seg == "" {
+			seg = req.URL.Query().Get("info_hash")
+		}
+		if seg == "" && len(body.Segments) > 0 {
+			seg = body.Segments[0]
+		}
+		peers := tracker.GetPeers(PeerQuery{
+			Segment:  seg,
+			Region:   body.Region,
+			Count:    50,
+			Strategy: req.URL.Query().Get("strategy"),
+			Segments: splitCommaList(req.URL.Query().Get("segs")),
+		})
+		writeAnnounceResponse(w, req, peers, int(ttlSeconds))
 	})
 
 	r.Get("/peers", func(w http.ResponseWriter, req *http.Request) {
@@ -207,11 +747,100 @@ func main() {
 		}
 		region := req.URL.Query().Get("region")
 
-		peers := tracker.GetPeers(seg, region, wantCount)
+		peers := tracker.GetPeers(PeerQuery{
+			Segment:  seg,
+			Region:   region,
+			Count:    wantCount,
+			Strategy: req.URL.Query().Get("strategy"),
+			Segments: splitCommaList(req.URL.Query().Get("segs")),
+		})
+		if wantsBencode(req) {
+			writeAnnounceResponse(w, req, peers, int(ttlSeconds))
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(peers)
 	})
 
+	r.Get("/scrape", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		segs := append(append([]string{}, q["seg"]...), q["info_hash"]...)
+		if len(segs) == 0 {
+			http.Error(w, "seg or info_hash required", http.StatusBadRequest)
+			return
+		}
+
+		files := make(map[string]any, len(segs))
+		for _, seg := range segs {
+			stats := tracker.Scrape(seg)
+			files[seg] = map[string]any{
+				"complete":   stats.Complete,
+				"incomplete": stats.Incomplete,
+				"downloaded": stats.Downloaded,
+			}
+		}
+		resp := map[string]any{"files": files}
+
+		if wantsBencode(req) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write(bencodeEncode(resp))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	r.Post("/report", func(w http.ResponseWriter, req *http.Request) {
+		var body ReportRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.PeerID == "" || body.SegmentID == "" {
+			http.Error(w, "peerId and segmentId required", http.StatusBadRequest)
+			return
+		}
+
+		strikes, bannedIP := tracker.Report(body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"strikes": strikes,
+			"banned":  bannedIP != "",
+			"ip":      bannedIP,
+		})
+	})
+
+	r.Post("/ban", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			IP string `json:"ip"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.IP == "" {
+			http.Error(w, "ip required", http.StatusBadRequest)
+			return
+		}
+		tracker.BanIP(body.IP)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Delete("/ban/{ip}", func(w http.ResponseWriter, req *http.Request) {
+		ip := chi.URLParam(req, "ip")
+		if ip == "" {
+			http.Error(w, "ip required", http.StatusBadRequest)
+			return
+		}
+		tracker.UnbanIP(ip)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Get("/banned", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tracker.BannedIPs())
+	})
+
 	log.Printf("tracker listening on %s (in-memory)", httpAddr)
 	log.Fatal(http.ListenAndServe(httpAddr, r))
 }
@@ -232,6 +861,22 @@ func getenvInt(key string, def int) int {
 	return def
 }
 
+// splitCommaList splits a comma-separated query param like "segs=a,b,c"
+// into its trimmed, non-empty elements, or nil if s is blank.
+func splitCommaList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
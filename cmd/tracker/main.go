@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"cloud_project/internal/events"
 	"cloud_project/internal/tracker"
 	"github.com/redis/go-redis/v9"
 )
@@ -19,6 +23,7 @@ func main() {
 	redisAddr := env("REDIS_ADDR", "localhost:6379")
 	ttlSeconds := envInt("TRACKER_TTL_SECONDS", 120)
 	topologyURL := env("TOPOLOGY_URL", "http://localhost:8090")
+	adminToken := env("TRACKER_ADMIN_TOKEN", "")
 
 	rdb := redis.NewClient(&redis.Options{
 		Addr: redisAddr,
@@ -27,15 +32,31 @@ func main() {
 		log.Fatalf("redis connection failed: %v", err)
 	}
 
+	eventBus := events.NewBus()
+	streamHub := tracker.NewStreamHub()
 	service := tracker.NewService(rdb, tracker.Config{
 		TTL:         time.Duration(ttlSeconds) * time.Second,
 		TopologyURL: topologyURL,
+		Events:      eventBus,
+		AdminToken:  adminToken,
+		Stream:      streamHub,
 	})
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	service.StartReaper(ctx)
 
-<<<<<<< HEAD
+	scrapeIntervalSeconds := envInt("TRACKER_SCRAPE_INTERVAL_SECONDS", 30)
+	scraper := tracker.NewTrackerScraper(rdb, time.Duration(scrapeIntervalSeconds)*time.Second)
+	scraper.Start(ctx)
+
+	udpAddr := env("TRACKER_UDP_ADDR", ":7071")
+	udpServer := tracker.NewUDPServer(service)
+	go func() {
+		if err := udpServer.ListenAndServe(ctx, udpAddr); err != nil {
+			log.Printf("udp tracker server error: %v", err)
+		}
+	}()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -46,19 +67,20 @@ func main() {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		var req tracker.AnnounceRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-=======
-	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
-	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
-
-	r.Post("/announce", func(w http.ResponseWriter, req *http.Request) {
-		var body AnnounceRequest
-		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
->>>>>>> 19b5dca (p2p network creation, song segmentation + upload, segment distribution, simulation, visualisation)
+		if err := json.Unmarshal(body, &req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err := service.VerifyPeerAuth(r.Context(), req.PeerID, body, r.Header.Get("X-Peer-Auth")); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		if err := service.HandleAnnounce(r.Context(), req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -70,17 +92,66 @@ func main() {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		var req tracker.HeartbeatRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := json.Unmarshal(body, &req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err := service.VerifyPeerAuth(r.Context(), req.PeerID, body, r.Header.Get("X-Peer-Auth")); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		if err := service.HandleHeartbeat(r.Context(), req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	})
+	mux.HandleFunc("/admin/peers", func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(r, adminToken) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req tracker.ProvisionPeerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := service.ProvisionPeer(r.Context(), req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/admin/peers/", func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(r, adminToken) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		peerID := strings.TrimPrefix(r.URL.Path, "/admin/peers/")
+		if peerID == "" {
+			http.Error(w, "peer id required", http.StatusBadRequest)
+			return
+		}
+		if err := service.RevokePeer(r.Context(), peerID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
 	mux.HandleFunc("/segments/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -92,7 +163,96 @@ func main() {
 			return
 		}
 		region := r.URL.Query().Get("region")
-		resp, err := service.LookupSegment(r.Context(), segmentID, region)
+		requester := r.URL.Query().Get("peer")
+		resp, err := service.LookupSegment(r.Context(), segmentID, region, requester)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req tracker.ReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.SrcIP == "" {
+			req.SrcIP = clientIP(r)
+		}
+		if err := service.HandleReport(r.Context(), req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/scrape", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		segments := r.URL.Query()["segment"]
+		if len(segments) == 0 {
+			http.Error(w, "at least one segment query parameter required", http.StatusBadRequest)
+			return
+		}
+		resp, err := service.Scrape(r.Context(), segments)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/bans", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bans, err := service.ListBans(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bans)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		events.ServeWS(eventBus, w, r)
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		streamHub.ServeWS(service, w, r)
+	})
+	mux.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// capability queries the swarm by advertised role instead of by
+		// segment membership, so it doesn't require seg.
+		if capability := r.URL.Query().Get("capability"); capability != "" {
+			peers, err := service.PeersByCapability(r.Context(), capability)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(peers)
+			return
+		}
+		segmentID := r.URL.Query().Get("seg")
+		if segmentID == "" {
+			http.Error(w, "seg or capability query parameter required", http.StatusBadRequest)
+			return
+		}
+		region := r.URL.Query().Get("region")
+		requester := r.URL.Query().Get("peer")
+		resp, err := service.LookupSegment(r.Context(), segmentID, region, requester)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -105,12 +265,36 @@ func main() {
 		Addr:    addr,
 		Handler: mux,
 	}
-	log.Printf("Tracker listening on %s (redis=%s, ttl=%ds)", addr, redisAddr, ttlSeconds)
+	log.Printf("Tracker listening on %s (udp=%s, redis=%s, ttl=%ds)", addr, udpAddr, redisAddr, ttlSeconds)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("tracker server error: %v", err)
 	}
 }
 
+// adminAuthorized reports whether r carries the configured admin token
+// in X-Admin-Token. An empty token disables the admin endpoints
+// entirely, since there'd be nothing to compare against.
+func adminAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(token)) == 1
+}
+
+// clientIP extracts the reporting client's address, preferring
+// X-Forwarded-For (the tracker is typically deployed behind a proxy)
+// and falling back to the raw connection's remote address.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func env(key, fallback string) string {
 	val := strings.TrimSpace(os.Getenv(key))
 	if val == "" {
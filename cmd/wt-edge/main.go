@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_project/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// segmentFrameMagic tags the start of every unidirectional stream wt-edge
+// opens, so a browser reading it can sanity-check it landed on a segment
+// stream before parsing the SHA256 that follows.
+var segmentFrameMagic = [4]byte{'S', 'E', 'G', '1'}
+
+// wtEdgeConfig mirrors cmd/edge's getenv-driven config, trimmed down to
+// what a WebTransport terminator needs: where to fetch segments that
+// aren't already cached, and where to find its TLS certificate.
+type wtEdgeConfig struct {
+	Addr      string
+	OriginURL string
+	CertDir   string
+}
+
+func loadConfig() wtEdgeConfig {
+	return wtEdgeConfig{
+		Addr:      getenv("WT_ADDR", ":8443"),
+		OriginURL: getenv("ORIGIN_URL", "http://origin:8081"),
+		CertDir:   getenv("WT_CERT_DIR", "./certs"),
+	}
+}
+
+// wtEdgeApp fetches segments from origin (the same /segments/{id}
+// base64-JSON endpoint cmd/edge uses) and streams them to WebTransport
+// clients as unidirectional streams, one per segment.
+type wtEdgeApp struct {
+	cfg      wtEdgeConfig
+	client   *http.Client
+	cache    sync.Map // segment id -> []byte, best-effort in-memory dedup
+	metrics  *metrics.Metrics
+	registry *prometheus.Registry
+}
+
+func newWTEdgeApp(cfg wtEdgeConfig) *wtEdgeApp {
+	m := metrics.NewMetrics()
+	registry := prometheus.NewRegistry()
+	if err := m.Register(registry); err != nil {
+		log.Fatalf("[wt-edge] failed to register metrics: %v", err)
+	}
+	return &wtEdgeApp{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		metrics:  m,
+		registry: registry,
+	}
+}
+
+// fetchSegment returns segment's bytes, preferring the in-memory cache
+// over a round trip to origin.
+func (a *wtEdgeApp) fetchSegment(ctx context.Context, segmentID string) ([]byte, error) {
+	if cached, ok := a.cache.Load(segmentID); ok {
+		return cached.([]byte), nil
+	}
+
+	url := fmt.Sprintf("%s/segments/%s", a.cfg.OriginURL, segmentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("origin returned %d for segment %s", resp.StatusCode, segmentID)
+	}
+	var body struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(body.Payload)
+	if err != nil {
+		return nil, err
+	}
+	a.cache.Store(segmentID, data)
+	return data, nil
+}
+
+// serveSegment opens one unidirectional stream on session carrying
+// segmentFrameMagic, the segment's SHA256, and its bytes - in that
+// order, so the browser can verify the checksum before it's even
+// finished reading the payload.
+func (a *wtEdgeApp) serveSegment(ctx context.Context, session *webtransport.Session, segmentID string) error {
+	data, err := a.fetchSegment(ctx, segmentID)
+	if err != nil {
+		return err
+	}
+	stream, err := session.OpenUniStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	sum := sha256.Sum256(data)
+	header := make([]byte, 0, len(segmentFrameMagic)+len(sum))
+	header = append(header, segmentFrameMagic[:]...)
+	header = append(header, sum[:]...)
+	if _, err := stream.Write(header); err != nil {
+		return err
+	}
+	_, err = stream.Write(data)
+	return err
+}
+
+func (a *wtEdgeApp) handleWebTransport(wtServer *webtransport.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segmentID := strings.TrimSpace(r.URL.Query().Get("segment"))
+		if segmentID == "" {
+			http.Error(w, "segment query parameter required", http.StatusBadRequest)
+			return
+		}
+		session, err := wtServer.Upgrade(w, r)
+		if err != nil {
+			log.Printf("[wt-edge] upgrade failed for %s: %v", segmentID, err)
+			http.Error(w, "webtransport upgrade failed", http.StatusInternalServerError)
+			return
+		}
+		if err := a.serveSegment(r.Context(), session, segmentID); err != nil {
+			log.Printf("[wt-edge] serving segment %s: %v", segmentID, err)
+			session.CloseWithError(1, "segment fetch failed")
+			return
+		}
+	}
+}
+
+func main() {
+	cfg := loadConfig()
+	app := newWTEdgeApp(cfg)
+
+	certFile := filepath.Join(cfg.CertDir, "cert.pem")
+	keyFile := filepath.Join(cfg.CertDir, "key.pem")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("[wt-edge] loading TLS cert from %s: %v (run mkcert into WT_CERT_DIR first)", cfg.CertDir, err)
+	}
+
+	mux := http.NewServeMux()
+	wtServer := &webtransport.Server{
+		H3: http3.Server{
+			Addr:      cfg.Addr,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+			Handler:   mux,
+		},
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "wt-edge: ok")
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(app.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/wt", app.handleWebTransport(wtServer))
+
+	log.Printf("[wt-edge] WebTransport listening on %s (origin=%s, certs=%s)", cfg.Addr, cfg.OriginURL, cfg.CertDir)
+	if err := wtServer.ListenAndServe(); err != nil {
+		log.Fatalf("[wt-edge] server error: %v", err)
+	}
+}
+
+func getenv(key, fallback string) string {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+	return val
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"cloud_project/internal/topology"
 )
 
 type Peer struct {
@@ -28,6 +33,91 @@ type RoutingDecision struct {
 	Timestamp        int64  `json:"timestamp"`
 }
 
+// selfPeerID identifies this routing service to the topology manager's
+// PEX endpoint; topologyURL is where that manager listens by default
+// (see cmd/topology). pexWarmInterval caps how often warmPeerCache will
+// actually hit the network, so a tight request loop doesn't turn PEX
+// into the same per-segment tracker hit it's meant to replace.
+//
+// relayRTTBudget is the cost ceiling a multi-hop relay path has to beat
+// (under the topology manager's "latency-bw" metric) to be preferred
+// over falling back to EDGE_CACHE - the same 100ms bar a direct P2P peer
+// has to clear below in makeRoutingDecision.
+const (
+	selfPeerID      = "routing-service"
+	topologyURL     = "http://localhost:8090"
+	pexWarmInterval = 5 * time.Second
+	relayRTTBudget  = 100.0
+)
+
+// peerCache is the local peer cache makeRoutingDecision reads from
+// instead of calling queryTracker fresh for every segment; warmPeerCache
+// refreshes it periodically via peer exchange instead.
+type peerCache struct {
+	mu       sync.Mutex
+	peers    map[string]Peer
+	lastWarm time.Time
+}
+
+var pexCache = &peerCache{peers: make(map[string]Peer)}
+
+// warmPeerCache pulls fresh peers from the topology manager's PEX
+// endpoint and folds them into pexCache, evicting anything the manager
+// reports as recently dropped. It's a no-op if the cache was already
+// warmed within pexWarmInterval.
+func warmPeerCache() {
+	pexCache.mu.Lock()
+	if time.Since(pexCache.lastWarm) < pexWarmInterval {
+		pexCache.mu.Unlock()
+		return
+	}
+	have := make([]string, 0, len(pexCache.peers))
+	for id := range pexCache.peers {
+		have = append(have, id)
+	}
+	pexCache.lastWarm = time.Now()
+	pexCache.mu.Unlock()
+
+	url := fmt.Sprintf("%s/peers/exchange?peer_id=%s&have=%s", topologyURL, selfPeerID, strings.Join(have, ","))
+	resp, err := http.Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Peers   string   `json:"peers"`
+		Dropped []string `json:"dropped"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(body.Peers)
+	if err != nil {
+		return
+	}
+
+	pexCache.mu.Lock()
+	defer pexCache.mu.Unlock()
+	for _, id := range body.Dropped {
+		delete(pexCache.peers, id)
+	}
+	for _, p := range topology.DecodePEX(raw) {
+		pexCache.peers[p.PeerID] = Peer{PeerID: p.PeerID, Region: p.Region, RTT: p.RTTms}
+	}
+}
+
+// cachedPeers returns a snapshot of pexCache's current peers.
+func cachedPeers() []Peer {
+	pexCache.mu.Lock()
+	defer pexCache.mu.Unlock()
+	peers := make([]Peer, 0, len(pexCache.peers))
+	for _, p := range pexCache.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
 func main() {
 	trackerURL := "http://localhost:8090"
 	edgeURL := "http://localhost:8081"
@@ -47,6 +137,8 @@ func main() {
 
 	// Simulate 20 different client requests
 	for i := 0; i < 20; i++ {
+		warmPeerCache()
+
 		segment := segments[rand.Intn(len(segments))]
 		clientRegion := regions[rand.Intn(len(regions))]
 
@@ -83,8 +175,21 @@ func makeRoutingDecision(trackerURL, edgeURL, segment, clientRegion string) Rout
 		Timestamp:        time.Now().Unix(),
 	}
 
-	// Step 1: Query tracker for available peers
-	peers := queryTracker(trackerURL, segment, clientRegion)
+	// Step 1: Prefer the PEX-warmed local peer cache over a fresh
+	// tracker round trip. Within the cache, seed candidates via
+	// topology.Ring's rendezvous hashing rather than handing rankPeers
+	// the whole cache - segment ownership is stable under peer churn, so
+	// this keeps the same few peers in the running across requests for
+	// the same segment instead of re-ranking everyone from scratch. Only
+	// fall back to queryTracker if PEX hasn't handed us anything yet
+	// (e.g. right after startup) or the ring came up empty.
+	peers := cachedPeers()
+	if len(peers) > 0 {
+		peers = seedCandidates(peers, segment, clientRegion)
+	}
+	if len(peers) == 0 {
+		peers = queryTracker(trackerURL, segment, clientRegion)
+	}
 	decision.Peers = peers
 
 	// Step 2: Apply intelligent routing logic
@@ -100,6 +205,16 @@ func makeRoutingDecision(trackerURL, edgeURL, segment, clientRegion string) Rout
 			decision.RTT = bestPeer.RTT
 			decision.Reason = fmt.Sprintf("Fast peer available (RTT: %dms, Availability: %.1f%%)",
 				bestPeer.RTT, bestPeer.Availability*100)
+		} else if relay, cost, ok := queryRelayPath(trackerURL, selfPeerID, bestPeer.PeerID); ok && len(relay) > 2 && cost < relayRTTBudget {
+			// The direct peer's RTT is bad, but the topology manager
+			// found a cheaper multi-hop route through an intermediate
+			// peer (e.g. a fiber-connected relay) - prefer that over
+			// giving up on P2P entirely.
+			decision.Decision = "P2P_RELAY"
+			decision.Source = strings.Join(relay, "->")
+			decision.RTT = int(cost)
+			decision.Reason = fmt.Sprintf("Direct peer RTT too high (%dms); relaying through %s (cost %.0f)",
+				bestPeer.RTT, strings.Join(relay[1:len(relay)-1], ","), cost)
 		} else {
 			decision.Decision = "EDGE_CACHE"
 			decision.Source = "edge-server"
@@ -138,6 +253,84 @@ func queryTracker(trackerURL, segment, region string) []Peer {
 	return peers
 }
 
+// queryRelayPath asks the topology manager for the cheapest multi-hop
+// path from from to to under the "latency-bw" metric (see
+// cmd/topology's GET /path), so a direct peer with bad RTT can still be
+// routed to through a faster relay chain instead of falling back
+// straight to the edge cache.
+func queryRelayPath(topologyURL, from, to string) ([]string, float64, bool) {
+	url := fmt.Sprintf("%s/path?from=%s&to=%s&metric=latency-bw", topologyURL, from, to)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, 0, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, false
+	}
+	var body struct {
+		Path []string `json:"path"`
+		Cost float64  `json:"cost"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, false
+	}
+	return body.Path, body.Cost, true
+}
+
+// sameOrNearbyRegion returns a topology.Ring filter admitting peers in
+// clientRegion or one of isNearbyRegion's neighboring regions - the
+// region-affinity constraint seedCandidates passes to Owners, expressed
+// in terms of this file's own region-adjacency table rather than
+// duplicating it in the topology package.
+func sameOrNearbyRegion(clientRegion string) func(topology.Peer) bool {
+	return func(p topology.Peer) bool {
+		return p.Region == clientRegion || isNearbyRegion(p.Region, clientRegion)
+	}
+}
+
+// bandwidthMbps maps this demo's coarse Bandwidth tier string onto the
+// rough Mbps figure topology.Ring's virtual-node weighting expects.
+func bandwidthMbps(tier string) float64 {
+	switch tier {
+	case "fiber":
+		return 1000
+	case "cable":
+		return 100
+	case "dsl":
+		return 10
+	default:
+		return 1
+	}
+}
+
+// seedCandidates narrows peers down to the ones topology.Ring's
+// rendezvous hashing assigns ownership of segment to, restricted to
+// clientRegion or a nearby one via sameOrNearbyRegion - cheaper and far
+// more stable under peer churn than ranking the whole cache, since only
+// the peers actually competing for segment's ownership ever change.
+func seedCandidates(peers []Peer, segment, clientRegion string) []Peer {
+	byID := make(map[string]Peer, len(peers))
+	ringPeers := make([]topology.Peer, 0, len(peers))
+	for _, p := range peers {
+		byID[p.PeerID] = p
+		ringPeers = append(ringPeers, topology.Peer{
+			ID:            p.PeerID,
+			Region:        p.Region,
+			BandwidthMbps: bandwidthMbps(p.Bandwidth),
+			Available:     p.Availability > 0,
+		})
+	}
+	owners := topology.NewRing(ringPeers).Owners(segment, 5, sameOrNearbyRegion(clientRegion))
+	out := make([]Peer, 0, len(owners))
+	for _, o := range owners {
+		if p, ok := byID[o.ID]; ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func rankPeers(peers []Peer, clientRegion string) []Peer {
 	// Create a copy to avoid modifying original
 	rankedPeers := make([]Peer, len(peers))
@@ -0,0 +1,114 @@
+// Package backoff implements exponential backoff with jitter, modeled on
+// cenkalti/backoff's ExponentialBackOff. It gives outbound calls (origin
+// fetches, peer fetches, topology registration) a shared, tunable retry
+// policy instead of each call rolling its own ad-hoc retry loop.
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Stop is returned by NextBackOff once MaxElapsedTime has been exceeded,
+// signalling that the caller should give up.
+const Stop time.Duration = -1
+
+// Policy configures an exponential backoff curve.
+type Policy struct {
+	InitialInterval     time.Duration
+	MaxInterval         time.Duration
+	Multiplier          float64
+	RandomizationFactor float64
+	MaxElapsedTime      time.Duration // 0 means retry forever
+}
+
+// DefaultPolicy returns the policy used when no tuning is supplied:
+// 200ms initial, 5s cap per interval, 30s total budget.
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialInterval:     200 * time.Millisecond,
+		MaxInterval:         5 * time.Second,
+		Multiplier:          2,
+		RandomizationFactor: 0.5,
+		MaxElapsedTime:      30 * time.Second,
+	}
+}
+
+// BackOff tracks the mutable state (current interval, start time) of one
+// retry sequence. It is not safe for concurrent use; create one per retry
+// loop via New.
+type BackOff struct {
+	Policy
+	currentInterval time.Duration
+	start           time.Time
+}
+
+// New creates a BackOff ready to use. Call Reset before reusing it for a
+// second, unrelated retry sequence.
+func New(p Policy) *BackOff {
+	b := &BackOff{Policy: p}
+	b.Reset()
+	return b
+}
+
+// Reset restarts the interval and elapsed-time clock.
+func (b *BackOff) Reset() {
+	b.currentInterval = b.InitialInterval
+	b.start = time.Now()
+}
+
+// NextBackOff returns how long to wait before the next attempt, with full
+// jitter applied, or Stop if MaxElapsedTime has been exceeded.
+func (b *BackOff) NextBackOff() time.Duration {
+	if b.MaxElapsedTime > 0 && time.Since(b.start) > b.MaxElapsedTime {
+		return Stop
+	}
+	interval := b.currentInterval
+	next := time.Duration(float64(b.currentInterval) * b.Multiplier)
+	if b.MaxInterval > 0 && next > b.MaxInterval {
+		next = b.MaxInterval
+	}
+	b.currentInterval = next
+	return jitter(interval, b.RandomizationFactor)
+}
+
+func jitter(interval time.Duration, randomizationFactor float64) time.Duration {
+	if randomizationFactor <= 0 || interval <= 0 {
+		return interval
+	}
+	delta := randomizationFactor * float64(interval)
+	min := float64(interval) - delta
+	max := float64(interval) + delta
+	return time.Duration(min + rand.Float64()*(max-min))
+}
+
+// Operation is retried by Retry until it succeeds, the context is
+// cancelled, or the backoff's MaxElapsedTime is exceeded. A non-zero
+// retryAfter (e.g. parsed from a Retry-After header) overrides the
+// computed backoff interval for that attempt.
+type Operation func() (retryAfter time.Duration, err error)
+
+// Retry runs op, retrying on error according to b until it succeeds, ctx
+// is done, or b reports Stop. It returns the last error on give-up.
+func Retry(ctx context.Context, b *BackOff, op Operation) error {
+	b.Reset()
+	for {
+		retryAfter, err := op()
+		if err == nil {
+			return nil
+		}
+		wait := b.NextBackOff()
+		if wait == Stop {
+			return err
+		}
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
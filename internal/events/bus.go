@@ -0,0 +1,157 @@
+// Package events implements a small non-blocking pub/sub bus for
+// streaming structured JSON events (announces, heartbeats, reaps,
+// lookups, topology mutations, ...) out to live observers - dashboards,
+// debuggers, the demo tool - over a side channel like a WebSocket. Each
+// event is marshaled once and fanned out as a shared []byte, so a large
+// fleet of subscribers doesn't cost a re-marshal per connection.
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event is the wire shape published to every subscriber.
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data,omitempty"`
+	Ts   int64  `json:"ts"`
+}
+
+// subscriberBuffer bounds how many pending events a slow subscriber can
+// accumulate before new events are dropped for it; this keeps one
+// stalled observer from backing up the publisher or other subscribers.
+const subscriberBuffer = 100_000
+
+// Subscriber receives pre-encoded events matching its type filter.
+type Subscriber struct {
+	ch    chan []byte
+	types map[string]struct{} // nil means "all types"
+}
+
+// Events returns the channel of pre-encoded JSON events for this
+// subscriber. It is closed once the subscriber is unsubscribed.
+func (s *Subscriber) Events() <-chan []byte {
+	return s.ch
+}
+
+// Bus fans out published events to every currently registered
+// subscriber, filtered by event type.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// NewBus returns an empty Bus ready to accept subscribers and publishes.
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*Subscriber]struct{})}
+}
+
+// Subscribe registers a new subscriber. An empty types filters nothing
+// (the subscriber receives every event type); a non-empty types limits
+// it to just those types.
+func (b *Bus) Subscribe(types []string) *Subscriber {
+	sub := &Subscriber{ch: make(chan []byte, subscriberBuffer)}
+	if len(types) > 0 {
+		sub.types = make(map[string]struct{}, len(types))
+		for _, t := range types {
+			sub.types[t] = struct{}{}
+		}
+	}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes sub and closes its channel. Safe to call more
+// than once.
+func (b *Bus) Unsubscribe(sub *Subscriber) {
+	b.mu.Lock()
+	_, ok := b.subscribers[sub]
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+	if ok {
+		close(sub.ch)
+	}
+}
+
+// Publish marshals an event of the given type once and fans it out to
+// every matching subscriber. Delivery is non-blocking: a subscriber
+// whose buffer is full drops the event rather than stalling the
+// publisher.
+func (b *Bus) Publish(eventType string, data any) {
+	encoded, err := json.Marshal(Event{Type: eventType, Data: data, Ts: time.Now().UnixMilli()})
+	if err != nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscribers {
+		if sub.types != nil {
+			if _, ok := sub.types[eventType]; !ok {
+				continue
+			}
+		}
+		select {
+		case sub.ch <- encoded:
+		default:
+			// Subscriber's buffer is full; drop rather than block.
+		}
+	}
+}
+
+// subscribeMessage is sent by the client right after the WebSocket
+// upgrade to select which event types it wants; an omitted or empty
+// Types means "everything".
+type subscribeMessage struct {
+	Types []string `json:"types"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// ServeWS upgrades r to a WebSocket, reads the client's initial
+// subscription filter (if any), and streams matching pre-encoded
+// events from bus until the connection closes. Intended to back a
+// service's /events endpoint.
+func ServeWS(bus *Bus, w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var sub subscribeMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_ = conn.ReadJSON(&sub) // no filter message within the deadline just means "everything"
+
+	subscriber := bus.Subscribe(sub.Types)
+	defer bus.Unsubscribe(subscriber)
+
+	// The only purpose of reading after the initial filter is to notice
+	// the client going away (close frame, dropped connection); events
+	// never flow client->server after subscription.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for encoded := range subscriber.Events() {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, encoded); err != nil {
+			return
+		}
+	}
+}
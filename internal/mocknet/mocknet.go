@@ -0,0 +1,274 @@
+// Package mocknet provides an in-memory stand-in for the signalling and
+// tracker transports, modeled on libp2p's mocknet: a Conn implementing
+// the same surface as signalling.Connection, a Network that wires
+// hundreds of virtual peers into a signalling.Hub, and a fake HTTP
+// transport that routes tracker requests to an in-process handler. None
+// of it opens a real socket, so tests can drive large topologies
+// deterministically.
+package mocknet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_project/internal/signalling"
+)
+
+// ErrClosed is returned by ReadLoop once the connection has been closed.
+var ErrClosed = errors.New("mocknet: connection closed")
+
+// Link models the latency and drop-probability mocknet applies when
+// delivering a message, standing in for real network conditions so RTT
+// and bandwidth tests are reproducible.
+type Link struct {
+	Latency  time.Duration
+	DropProb float64
+}
+
+// Conn is an in-memory stand-in for signalling.Connection: it exposes
+// the same Send channel / ReadLoop / WriteLoop surface, plus PeerID,
+// SendPath, SendPEX and SendRaw so it satisfies signalling.Conn, letting
+// a Hub under test push to it exactly like a real WebSocket session.
+type Conn struct {
+	id   signalling.PeerID
+	link Link
+	rng  *rand.Rand
+
+	Send  chan []byte // outbound queue, mirrors signalling.Connection.Send
+	inbox chan []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newConn(id signalling.PeerID, link Link, rng *rand.Rand) *Conn {
+	return &Conn{
+		id:     id,
+		link:   link,
+		rng:    rng,
+		Send:   make(chan []byte, 32),
+		inbox:  make(chan []byte, 32),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *Conn) PeerID() signalling.PeerID { return c.id }
+
+func (c *Conn) SendPath(ctx context.Context, path []signalling.PeerID) {
+	payload, _ := json.Marshal(struct {
+		Type string               `json:"type"`
+		Path []signalling.PeerID `json:"path"`
+	}{"path", path})
+	select {
+	case c.Send <- payload:
+	case <-ctx.Done():
+	}
+}
+
+func (c *Conn) SendPEX(ctx context.Context, peers []signalling.PeerInfo) {
+	payload, _ := json.Marshal(struct {
+		Type  string                 `json:"type"`
+		Peers []signalling.PeerInfo `json:"peers"`
+	}{"pex_peers", peers})
+	select {
+	case c.Send <- payload:
+	case <-ctx.Done():
+	}
+}
+
+// SendRaw satisfies signalling.Conn's point-to-point relay method the
+// same way SendPath/SendPEX do: push onto Send, the channel a test reads
+// to observe what the Hub delivered to this peer.
+func (c *Conn) SendRaw(ctx context.Context, payload []byte) {
+	select {
+	case c.Send <- payload:
+	case <-ctx.Done():
+	}
+}
+
+// WriteLoop drains Send the way signalling.Connection's does. There's no
+// real socket behind it, so it simply discards messages once observed;
+// tests that need to inspect outbound traffic should read from Send
+// directly instead of starting WriteLoop.
+func (c *Conn) WriteLoop(ctx context.Context) {
+	for {
+		select {
+		case _, ok := <-c.Send:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// ReadLoop mirrors signalling.Connection.ReadLoop: it blocks, invoking
+// handle for every message Deliver placed in the inbox, until Close.
+func (c *Conn) ReadLoop(handle func([]byte)) error {
+	for {
+		select {
+		case msg, ok := <-c.inbox:
+			if !ok {
+				return ErrClosed
+			}
+			handle(msg)
+		case <-c.closed:
+			return ErrClosed
+		}
+	}
+}
+
+// Deliver simulates the peer sending msg to whatever is driving
+// ReadLoop, applying the connection's configured latency/drop-
+// probability first.
+func (c *Conn) Deliver(msg []byte) {
+	if c.link.DropProb > 0 && c.rng.Float64() < c.link.DropProb {
+		return
+	}
+	if c.link.Latency > 0 {
+		time.Sleep(c.link.Latency)
+	}
+	select {
+	case c.inbox <- msg:
+	case <-c.closed:
+	}
+}
+
+// Close ends the connection; a blocked ReadLoop or WriteLoop returns.
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+}
+
+// Network wires virtual peers into a signalling.Hub without opening any
+// real sockets, so tests can drive announce/PEX/path-request traffic
+// across hundreds of peers deterministically.
+type Network struct {
+	hub  *signalling.Hub
+	room string
+	rng  *rand.Rand
+
+	mu    sync.Mutex
+	peers map[signalling.PeerID]*Conn
+	links map[signalling.PeerID]Link
+
+	defaultLink Link
+}
+
+// NewNetwork creates a Network bound to hub/room. seed makes every
+// randomized decision the Network makes (currently: Deliver's drop
+// probability) reproducible across runs.
+func NewNetwork(hub *signalling.Hub, room string, seed int64) *Network {
+	return &Network{
+		hub:   hub,
+		room:  room,
+		rng:   rand.New(rand.NewSource(seed)),
+		peers: make(map[signalling.PeerID]*Conn),
+		links: make(map[signalling.PeerID]Link),
+	}
+}
+
+// SetDefaultLink sets the latency/drop-probability applied to peers that
+// don't have an override registered via SetLink.
+func (n *Network) SetDefaultLink(link Link) { n.defaultLink = link }
+
+// SetLink overrides the link used for one peer's connection.
+func (n *Network) SetLink(peer signalling.PeerID, link Link) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.links[peer] = link
+}
+
+func (n *Network) linkFor(peer signalling.PeerID) Link {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if l, ok := n.links[peer]; ok {
+		return l
+	}
+	return n.defaultLink
+}
+
+// AddPeer registers a new virtual peer's connection with the hub and
+// starts its WriteLoop, exactly like the real WS handler does for an
+// accepted connection. Callers drive inbound traffic via the returned
+// Conn's Deliver method.
+func (n *Network) AddPeer(ctx context.Context, peer signalling.PeerID) *Conn {
+	conn := newConn(peer, n.linkFor(peer), n.rng)
+	n.mu.Lock()
+	n.peers[peer] = conn
+	n.mu.Unlock()
+	n.hub.Register(n.room, conn)
+	go conn.WriteLoop(ctx)
+	return conn
+}
+
+// RemovePeer unregisters and closes peer's connection.
+func (n *Network) RemovePeer(peer signalling.PeerID) {
+	n.mu.Lock()
+	conn, ok := n.peers[peer]
+	delete(n.peers, peer)
+	n.mu.Unlock()
+	if !ok {
+		return
+	}
+	n.hub.Unregister(n.room, peer)
+	conn.Close()
+}
+
+// HTTPTransport is a fake http.RoundTripper that dispatches requests
+// straight to an in-process http.Handler keyed by scheme+host, the
+// tracker-announce equivalent of Conn: no socket, same interface
+// (http.RoundTripper) real client code already expects.
+type HTTPTransport struct {
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
+	latency  time.Duration
+}
+
+func NewHTTPTransport() *HTTPTransport {
+	return &HTTPTransport{handlers: make(map[string]http.Handler)}
+}
+
+// Register maps baseURL (e.g. "http://tracker") to handler; requests
+// whose scheme+host match are served in-process via httptest.
+func (t *HTTPTransport) Register(baseURL string, handler http.Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[strings.TrimSuffix(baseURL, "/")] = handler
+}
+
+// SetLatency adds a fixed delay before every request is served, so tests
+// can exercise client-side timeouts deterministically.
+func (t *HTTPTransport) SetLatency(d time.Duration) { t.latency = d }
+
+func (t *HTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := req.URL.Scheme + "://" + req.URL.Host
+	t.mu.RLock()
+	handler, ok := t.handlers[base]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("mocknet: no handler registered for %s", base)
+	}
+	if t.latency > 0 {
+		time.Sleep(t.latency)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// Client returns an *http.Client wired to this transport, for any
+// existing code that takes one (tracker.Client, rtt.Measurer.MeasureHTTP).
+func (t *HTTPTransport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
@@ -0,0 +1,105 @@
+package mocknet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"cloud_project/internal/signalling"
+)
+
+// TestNetworkDrivesHubGolden wires a fixed-size ring of virtual peers into
+// a Hub entirely through mocknet - Register via AddPeer, Announce, a
+// PEXSample, and a ShortestPath lookup - then checks the connectivity and
+// per-link latency percentile stats the mocknet deliverable exists to make
+// testable, all for a fixed seed so the run is reproducible.
+func TestNetworkDrivesHubGolden(t *testing.T) {
+	const peerCount = 20
+	const room = "golden-room"
+
+	hub := signalling.NewHub()
+	net := NewNetwork(hub, room, 42)
+
+	ctx := context.Background()
+	ids := make([]signalling.PeerID, peerCount)
+	conns := make([]*Conn, peerCount)
+	for i := 0; i < peerCount; i++ {
+		ids[i] = signalling.PeerID(fmt.Sprintf("peer-%d", i))
+		// Deterministic per-peer latency (2ms, 4ms, ..., 40ms) so the
+		// percentile assertions below don't depend on the network's RNG.
+		net.SetLink(ids[i], Link{Latency: time.Duration(2*(i+1)) * time.Millisecond})
+		conns[i] = net.AddPeer(ctx, ids[i])
+	}
+	defer func() {
+		for _, id := range ids {
+			net.RemovePeer(id)
+		}
+	}()
+
+	// Announce traffic: wire the peers into a ring, so connectivity forms
+	// a single cycle through every peer. Announce replaces the announcing
+	// peer's entire neighbor set each call, so each peer must declare both
+	// of its ring neighbors - declaring only the successor would have the
+	// next peer's own announce immediately clear the edge the predecessor
+	// just added.
+	for i, id := range ids {
+		predecessor := ids[(i-1+peerCount)%peerCount]
+		successor := ids[(i+1)%peerCount]
+		hub.Announce(room, signalling.Announcement{Peer: id, Neighbors: []signalling.PeerID{predecessor, successor}})
+	}
+
+	// Connectivity stats: every peer should have exactly 2 ring neighbors,
+	// and the whole room should be one connected component reachable from
+	// peer 0 via ShortestPath.
+	topology := hub.Topology(room)
+	if len(topology) != peerCount {
+		t.Fatalf("expected %d peers in topology, got %d", peerCount, len(topology))
+	}
+	for _, id := range ids {
+		if got := len(topology[id]); got != 2 {
+			t.Fatalf("peer %s: expected 2 neighbors in ring topology, got %d", id, got)
+		}
+	}
+	for _, id := range ids[1:] {
+		if _, err := hub.ShortestPath(room, ids[0], id); err != nil {
+			t.Fatalf("peer %s unreachable from %s: %v", id, ids[0], err)
+		}
+	}
+
+	// PEX traffic: peer 0 samples the room and should learn about every
+	// peer except itself and its two ring neighbors.
+	excluded := topology[ids[0]]
+	pexPeers, ok := hub.PEXSample(room, ids[0], excluded)
+	if !ok {
+		t.Fatal("expected PEXSample to succeed on its first call for peer-0")
+	}
+	wantPEX := peerCount - 1 - len(excluded)
+	if len(pexPeers) != wantPEX {
+		t.Fatalf("expected PEXSample to return %d peers, got %d", wantPEX, len(pexPeers))
+	}
+
+	// Path traffic: deliver a message to every peer's Conn and time how
+	// long Deliver takes, exercising mocknet's configured per-link latency
+	// end to end, then check the resulting distribution's connectivity
+	// percentiles land where the 2ms..40ms spread above implies.
+	latenciesMs := make([]float64, peerCount)
+	for i, conn := range conns {
+		start := time.Now()
+		conn.Deliver([]byte("ping"))
+		latenciesMs[i] = float64(time.Since(start).Milliseconds())
+	}
+	sort.Float64s(latenciesMs)
+	p50 := latenciesMs[peerCount/2]
+	p95 := latenciesMs[int(float64(peerCount)*0.95)]
+
+	// Generous slack either side: Deliver's own overhead and scheduler
+	// jitter add a little on top of the configured sleep.
+	if p50 < 18 || p50 > 30 {
+		t.Fatalf("p50 latency %.0fms outside the expected range for a 2-40ms link spread", p50)
+	}
+	if p95 < 34 {
+		t.Fatalf("p95 latency %.0fms lower than expected for the slowest configured links", p95)
+	}
+}
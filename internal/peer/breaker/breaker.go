@@ -0,0 +1,133 @@
+// Package breaker implements a per-key circuit breaker for outbound peer
+// sends. A key (typically a destination peer ID) that fails threshold
+// times in a row trips the breaker open, short-circuiting further calls
+// for a cooldown window instead of letting each one burn a full retry
+// budget against an unreachable node. Once the cooldown elapses the
+// breaker half-opens, letting a single probe call through to decide
+// whether to close again or reopen.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the lifecycle stage of one key's breaker.
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+// String renders State the way it's reported on /metrics and in logs.
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+type entry struct {
+	consecutiveFailures int
+	state               State
+	openedAt            time.Time
+}
+
+// Registry tracks one breaker per key. Safe for concurrent use.
+type Registry struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	threshold int
+	cooldown  time.Duration
+}
+
+// New returns a Registry whose breakers open after threshold consecutive
+// failures and stay open for cooldown before allowing a half-open probe.
+func New(threshold int, cooldown time.Duration) *Registry {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Registry{
+		entries:   make(map[string]*entry),
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether a call against key should proceed. A key with no
+// recorded failures, or whose breaker is Closed or HalfOpen, is always
+// allowed; an Open breaker is allowed only once cooldown has elapsed,
+// which also flips it to HalfOpen so the caller's result can resolve it.
+func (r *Registry) Allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[key]
+	if !ok || e.state != Open {
+		return true
+	}
+	if time.Since(e.openedAt) < r.cooldown {
+		return false
+	}
+	e.state = HalfOpen
+	return true
+}
+
+// RecordSuccess closes key's breaker and clears its failure streak.
+func (r *Registry) RecordSuccess(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[key]
+	if !ok {
+		return
+	}
+	e.consecutiveFailures = 0
+	e.state = Closed
+}
+
+// RecordFailure counts one more failure for key, opening its breaker
+// once threshold consecutive failures have accumulated (a single failed
+// half-open probe re-opens it immediately).
+func (r *Registry) RecordFailure(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[key]
+	if !ok {
+		e = &entry{}
+		r.entries[key] = e
+	}
+	e.consecutiveFailures++
+	if e.state == HalfOpen || e.consecutiveFailures >= r.threshold {
+		e.state = Open
+		e.openedAt = time.Now()
+	}
+}
+
+// State reports key's current breaker state, defaulting to Closed for a
+// key that has never been recorded.
+func (r *Registry) State(key string) State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[key]
+	if !ok {
+		return Closed
+	}
+	return e.state
+}
+
+// States returns a snapshot of every key this registry has a breaker
+// for, for callers exporting breaker state (e.g. to Prometheus).
+func (r *Registry) States() map[string]State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]State, len(r.entries))
+	for k, e := range r.entries {
+		out[k] = e.state
+	}
+	return out
+}
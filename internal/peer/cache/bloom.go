@@ -0,0 +1,20 @@
+package cache
+
+import "cloud_project/pkg/bloom"
+
+// BloomSnapshot builds a Bloom filter over p's current contents, sized
+// for m bits and k hash functions (pass 0, 0 to have bloom.Params size it
+// from len(p.Keys())). Used by emitAnnounce/emitHeartbeat to advertise
+// held segments in a fraction of the bytes a full Segments list would
+// take, at the cost of occasional false positives on lookup.
+func BloomSnapshot(p Policy, m, k uint32) *bloom.Filter {
+	keys := p.Keys()
+	if m == 0 || k == 0 {
+		m, k = bloom.Params(len(keys))
+	}
+	f := bloom.New(m, k)
+	for _, key := range keys {
+		f.Add(key)
+	}
+	return f
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"cloud_project/pkg/metrics"
+)
+
+const policyLFU = "lfu"
+
+type lfuEntry struct {
+	key  string
+	val  Segment
+	freq int
+}
+
+// LFU evicts the segment with the lowest access frequency, breaking ties
+// by recency within that frequency. Each frequency bucket is its own
+// doubly linked list, and minFreq tracks the lowest non-empty bucket, so
+// both Get and Put stay O(1) regardless of how skewed the access counts
+// get.
+type LFU struct {
+	mu       sync.Mutex
+	capacity int
+	minFreq  int
+	items    map[string]*list.Element
+	buckets  map[int]*list.List
+	metrics  *metrics.Metrics
+}
+
+func NewLFU(capacity int, m *metrics.Metrics) *LFU {
+	if capacity <= 0 {
+		capacity = 16
+	}
+	return &LFU{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		buckets:  make(map[int]*list.List),
+		metrics:  m,
+	}
+}
+
+func (l *LFU) Put(seg Segment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[seg.ID]; ok {
+		entry := elem.Value.(*lfuEntry)
+		entry.val = seg
+		l.touch(elem, entry)
+		return
+	}
+	entry := &lfuEntry{key: seg.ID, val: seg, freq: 1}
+	bucket := l.bucket(1)
+	l.items[seg.ID] = bucket.PushFront(entry)
+	l.minFreq = 1
+	if len(l.items) > l.capacity {
+		l.evictLocked()
+	}
+}
+
+func (l *LFU) Get(id string) (Segment, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[id]
+	if !ok {
+		recordMiss(l.metrics, policyLFU, id)
+		return Segment{}, false
+	}
+	entry := elem.Value.(*lfuEntry)
+	val := entry.val
+	l.touch(elem, entry)
+	recordHit(l.metrics, policyLFU, id)
+	return val, true
+}
+
+func (l *LFU) bucket(freq int) *list.List {
+	ll, ok := l.buckets[freq]
+	if !ok {
+		ll = list.New()
+		l.buckets[freq] = ll
+	}
+	return ll
+}
+
+// touch moves entry up to the next frequency bucket, bumping minFreq if
+// its old bucket emptied out and was the current minimum.
+func (l *LFU) touch(elem *list.Element, entry *lfuEntry) {
+	oldFreq := entry.freq
+	l.buckets[oldFreq].Remove(elem)
+	if l.buckets[oldFreq].Len() == 0 {
+		delete(l.buckets, oldFreq)
+		if l.minFreq == oldFreq {
+			l.minFreq++
+		}
+	}
+	entry.freq++
+	l.items[entry.key] = l.bucket(entry.freq).PushFront(entry)
+}
+
+func (l *LFU) Evict() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.evictLocked()
+}
+
+func (l *LFU) evictLocked() (string, bool) {
+	ll, ok := l.buckets[l.minFreq]
+	if !ok || ll.Len() == 0 {
+		return "", false
+	}
+	back := ll.Back()
+	entry := back.Value.(*lfuEntry)
+	ll.Remove(back)
+	if ll.Len() == 0 {
+		delete(l.buckets, l.minFreq)
+	}
+	delete(l.items, entry.key)
+	return entry.key, true
+}
+
+func (l *LFU) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.items))
+	for k := range l.items {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"cloud_project/pkg/metrics"
+)
+
+const policyLRU = "lru"
+
+type lruEntry struct {
+	key string
+	val Segment
+}
+
+// LRU evicts whichever segment was least recently Put or Get.
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	metrics  *metrics.Metrics
+}
+
+func NewLRU(capacity int, m *metrics.Metrics) *LRU {
+	if capacity <= 0 {
+		capacity = 16
+	}
+	return &LRU{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		metrics:  m,
+	}
+}
+
+func (l *LRU) Put(seg Segment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[seg.ID]; ok {
+		elem.Value.(*lruEntry).val = seg
+		l.ll.MoveToFront(elem)
+		return
+	}
+	elem := l.ll.PushFront(&lruEntry{key: seg.ID, val: seg})
+	l.items[seg.ID] = elem
+	if l.ll.Len() > l.capacity {
+		l.evictLocked()
+	}
+}
+
+func (l *LRU) Get(id string) (Segment, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[id]; ok {
+		l.ll.MoveToFront(elem)
+		recordHit(l.metrics, policyLRU, id)
+		return elem.Value.(*lruEntry).val, true
+	}
+	recordMiss(l.metrics, policyLRU, id)
+	return Segment{}, false
+}
+
+func (l *LRU) Evict() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.evictLocked()
+}
+
+func (l *LRU) evictLocked() (string, bool) {
+	elem := l.ll.Back()
+	if elem == nil {
+		return "", false
+	}
+	l.ll.Remove(elem)
+	ent := elem.Value.(*lruEntry)
+	delete(l.items, ent.key)
+	return ent.key, true
+}
+
+func (l *LRU) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.items))
+	for elem := l.ll.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*lruEntry).key)
+	}
+	return keys
+}
@@ -0,0 +1,43 @@
+package cache
+
+import "cloud_project/pkg/metrics"
+
+// Policy is a capacity-bounded segment store with a particular eviction
+// strategy. Implementations are safe for concurrent use.
+type Policy interface {
+	Put(seg Segment)
+	Get(id string) (Segment, bool)
+	Keys() []string
+	// Evict removes and returns the id the policy's strategy currently
+	// considers least valuable, or ("", false) if the policy is empty.
+	Evict() (string, bool)
+}
+
+// NewPolicy constructs the eviction policy named by name ("lru", "lfu",
+// or "tinylfu"; anything else falls back to "lru"). m is optional - if
+// non-nil, every Get records a per-segment hit/miss counter against it;
+// pass nil to run without metrics.
+func NewPolicy(name string, capacity int, m *metrics.Metrics) Policy {
+	switch name {
+	case "lfu":
+		return NewLFU(capacity, m)
+	case "tinylfu":
+		return NewTinyLFU(capacity, m)
+	default:
+		return NewLRU(capacity, m)
+	}
+}
+
+func recordHit(m *metrics.Metrics, policy, segment string) {
+	if m == nil {
+		return
+	}
+	m.CacheHitTotal.WithLabelValues(policy, segment).Inc()
+}
+
+func recordMiss(m *metrics.Metrics, policy, segment string) {
+	if m == nil {
+		return
+	}
+	m.CacheMissTotal.WithLabelValues(policy, segment).Inc()
+}
@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+
+	"cloud_project/pkg/metrics"
+)
+
+const policyTinyLFU = "tinylfu"
+
+// windowFraction is the share of total capacity given to the admission
+// window; protectedFraction is the share of what's left given to the
+// protected segment of the main cache, the remainder going to
+// probationary.
+const (
+	windowFraction    = 0.01
+	protectedFraction = 0.8
+)
+
+// cmSketch is a 4-hash count-min sketch used to estimate a segment's
+// access frequency in bounded space. Counts are halved once adds cross
+// resetAt so popularity decays and old hot segments stop crowding out
+// new ones.
+type cmSketch struct {
+	width   int
+	rows    [4][]uint16
+	adds    int
+	resetAt int
+}
+
+func newCMSketch(width int) *cmSketch {
+	if width < 16 {
+		width = 16
+	}
+	s := &cmSketch{width: width, resetAt: width * 10}
+	for i := range s.rows {
+		s.rows[i] = make([]uint16, width)
+	}
+	return s
+}
+
+func (s *cmSketch) indexes(key string) [4]uint32 {
+	var idx [4]uint32
+	for i := range idx {
+		h := fnv.New32a()
+		h.Write([]byte{byte(i)})
+		h.Write([]byte(key))
+		idx[i] = h.Sum32() % uint32(s.width)
+	}
+	return idx
+}
+
+func (s *cmSketch) Add(key string) {
+	for row, idx := range s.indexes(key) {
+		if s.rows[row][idx] < 65535 {
+			s.rows[row][idx]++
+		}
+	}
+	s.adds++
+	if s.adds >= s.resetAt {
+		s.decay()
+	}
+}
+
+func (s *cmSketch) Estimate(key string) uint16 {
+	min := uint16(65535)
+	for row, idx := range s.indexes(key) {
+		if s.rows[row][idx] < min {
+			min = s.rows[row][idx]
+		}
+	}
+	return min
+}
+
+func (s *cmSketch) decay() {
+	for row := range s.rows {
+		for i := range s.rows[row] {
+			s.rows[row][i] /= 2
+		}
+	}
+	s.adds = 0
+}
+
+// doorkeeper is a small bloom filter gating the count-min sketch: a key
+// only starts accumulating sketch frequency once the doorkeeper has seen
+// it before, so one-off segments don't pollute the estimate used to
+// admit genuinely repeated ones. It's cleared alongside the sketch decay
+// so both forget at the same rate.
+type doorkeeper struct {
+	bits []uint64
+	k    int
+}
+
+func newDoorkeeper(capacity int) *doorkeeper {
+	nbits := capacity * 8
+	if nbits < 64 {
+		nbits = 64
+	}
+	return &doorkeeper{bits: make([]uint64, (nbits+63)/64), k: 3}
+}
+
+func (d *doorkeeper) indexes(key string) []uint32 {
+	n := uint32(len(d.bits) * 64)
+	idx := make([]uint32, d.k)
+	for i := range idx {
+		h := fnv.New32a()
+		h.Write([]byte{byte(i + 100)})
+		h.Write([]byte(key))
+		idx[i] = h.Sum32() % n
+	}
+	return idx
+}
+
+// CheckAndSet reports whether key had already been marked seen, and
+// marks it seen either way.
+func (d *doorkeeper) CheckAndSet(key string) bool {
+	seen := true
+	for _, idx := range d.indexes(key) {
+		word, bit := idx/64, idx%64
+		if d.bits[word]&(1<<bit) == 0 {
+			seen = false
+			d.bits[word] |= 1 << bit
+		}
+	}
+	return seen
+}
+
+func (d *doorkeeper) Reset() {
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
+
+type tinyLFUEntry struct {
+	key string
+	val Segment
+}
+
+// TinyLFU is a W-TinyLFU cache: a small LRU admission window absorbs
+// recency spikes, and a count-min-sketch-gated doorkeeper decides which
+// evictees from that window are worth admitting into a segmented main
+// LRU (probationary, then protected once hit again). On skewed HLS
+// workloads - a handful of segments getting most of the requests - this
+// tracks LFU's hit rate without LFU's unbounded per-key counters.
+type TinyLFU struct {
+	mu sync.Mutex
+
+	windowCap    int
+	protectedCap int
+	probationCap int
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	items     map[string]*list.Element // current element, in whichever list holds it
+	locLists  map[*list.Element]*list.List
+
+	sketch *cmSketch
+	door   *doorkeeper
+
+	metrics *metrics.Metrics
+}
+
+func NewTinyLFU(capacity int, m *metrics.Metrics) *TinyLFU {
+	if capacity <= 0 {
+		capacity = 16
+	}
+	windowCap := int(float64(capacity) * windowFraction)
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	mainCap := capacity - windowCap
+	if mainCap < 2 {
+		mainCap = 2
+		if windowCap > capacity-mainCap {
+			windowCap = capacity - mainCap
+		}
+		if windowCap < 1 {
+			windowCap = 1
+		}
+	}
+	protectedCap := int(float64(mainCap) * protectedFraction)
+	if protectedCap < 1 {
+		protectedCap = 1
+	}
+	probationCap := mainCap - protectedCap
+	if probationCap < 1 {
+		probationCap = 1
+	}
+	return &TinyLFU{
+		windowCap:    windowCap,
+		protectedCap: protectedCap,
+		probationCap: probationCap,
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		items:        make(map[string]*list.Element),
+		locLists:     make(map[*list.Element]*list.List),
+		sketch:       newCMSketch(capacity * 8),
+		door:         newDoorkeeper(capacity),
+		metrics:      m,
+	}
+}
+
+// recordAccess feeds the frequency estimator. The doorkeeper must see a
+// key once before the sketch starts counting it.
+func (t *TinyLFU) recordAccess(key string) {
+	if t.door.CheckAndSet(key) {
+		t.sketch.Add(key)
+		if t.sketch.adds == 0 {
+			t.door.Reset()
+		}
+	}
+}
+
+func (t *TinyLFU) Put(seg Segment) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recordAccess(seg.ID)
+	if elem, ok := t.items[seg.ID]; ok {
+		elem.Value.(*tinyLFUEntry).val = seg
+		t.touchLocked(elem)
+		return
+	}
+	entry := &tinyLFUEntry{key: seg.ID, val: seg}
+	elem := t.window.PushFront(entry)
+	t.items[seg.ID] = elem
+	t.locLists[elem] = t.window
+	if t.window.Len() > t.windowCap {
+		t.admitFromWindow()
+	}
+}
+
+func (t *TinyLFU) Get(id string) (Segment, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recordAccess(id)
+	elem, ok := t.items[id]
+	if !ok {
+		recordMiss(t.metrics, policyTinyLFU, id)
+		return Segment{}, false
+	}
+	val := elem.Value.(*tinyLFUEntry).val
+	t.touchLocked(elem)
+	recordHit(t.metrics, policyTinyLFU, id)
+	return val, true
+}
+
+// touchLocked moves an accessed entry to the front of its list,
+// promoting it from probation to protected (demoting protection's own
+// LRU victim back to probation if that segment is now full).
+func (t *TinyLFU) touchLocked(elem *list.Element) {
+	ll := t.locLists[elem]
+	switch ll {
+	case t.probation:
+		t.probation.Remove(elem)
+		delete(t.locLists, elem)
+		t.promoteToProtected(elem.Value.(*tinyLFUEntry))
+	case t.protected:
+		t.protected.MoveToFront(elem)
+	default: // window
+		t.window.MoveToFront(elem)
+	}
+}
+
+func (t *TinyLFU) promoteToProtected(entry *tinyLFUEntry) {
+	if t.protected.Len() >= t.protectedCap {
+		if back := t.protected.Back(); back != nil {
+			demoted := back.Value.(*tinyLFUEntry)
+			t.protected.Remove(back)
+			delete(t.locLists, back)
+			newElem := t.probation.PushFront(demoted)
+			t.items[demoted.key] = newElem
+			t.locLists[newElem] = t.probation
+		}
+	}
+	elem := t.protected.PushFront(entry)
+	t.items[entry.key] = elem
+	t.locLists[elem] = t.protected
+}
+
+// admitFromWindow evicts the window's LRU victim and decides whether it
+// should enter probation: if probation has room it's admitted outright,
+// otherwise it competes against probation's own LRU victim by estimated
+// frequency and only the winner survives.
+func (t *TinyLFU) admitFromWindow() {
+	back := t.window.Back()
+	if back == nil {
+		return
+	}
+	candidate := back.Value.(*tinyLFUEntry)
+	t.window.Remove(back)
+	delete(t.items, candidate.key)
+	delete(t.locLists, back)
+
+	if t.probation.Len() < t.probationCap {
+		t.admitToProbation(candidate)
+		return
+	}
+	victimElem := t.probation.Back()
+	if victimElem == nil {
+		t.admitToProbation(candidate)
+		return
+	}
+	victim := victimElem.Value.(*tinyLFUEntry)
+	if t.sketch.Estimate(candidate.key) <= t.sketch.Estimate(victim.key) {
+		// Candidate loses to the incumbent; it's dropped entirely.
+		return
+	}
+	t.probation.Remove(victimElem)
+	delete(t.items, victim.key)
+	delete(t.locLists, victimElem)
+	t.admitToProbation(candidate)
+}
+
+func (t *TinyLFU) admitToProbation(entry *tinyLFUEntry) {
+	elem := t.probation.PushFront(entry)
+	t.items[entry.key] = elem
+	t.locLists[elem] = t.probation
+}
+
+func (t *TinyLFU) Evict() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.evictLocked()
+}
+
+// evictLocked drops the globally least-valuable segment: probation's LRU
+// victim first (that's the whole point of the segmented main cache),
+// falling back to protected, then the window, if probation is empty.
+func (t *TinyLFU) evictLocked() (string, bool) {
+	for _, ll := range []*list.List{t.probation, t.protected, t.window} {
+		if back := ll.Back(); back != nil {
+			entry := back.Value.(*tinyLFUEntry)
+			ll.Remove(back)
+			delete(t.items, entry.key)
+			delete(t.locLists, back)
+			return entry.key, true
+		}
+	}
+	return "", false
+}
+
+func (t *TinyLFU) Keys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.items))
+	for k := range t.items {
+		keys = append(keys, k)
+	}
+	return keys
+}
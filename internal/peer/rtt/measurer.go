@@ -2,23 +2,97 @@ package rtt
 
 import (
 	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"net/http"
 	"sync"
 	"time"
 )
 
+// bandwidthHalfLife controls how fast an idle peer's bandwidth estimate
+// decays back toward zero: with no new samples, avg halves every interval.
+const bandwidthHalfLife = 5 * time.Minute
+
+// QoS estimation, modeled on the geth downloader's peer quality scoring:
+// each target gets an EWMA RTT estimate and a confidence in [0,
+// confidenceMax] that grows with successful probes and decays (but
+// never to zero) on failures, so TargetTimeout can give a sparsely
+// sampled peer more slack than one we've measured heavily.
+const (
+	qosAlpha              = 0.3
+	confidenceInitial     = 1.0
+	confidenceIncrement   = 1000.0
+	confidenceDecayFactor = 0.9
+	confidenceMax         = 1e6
+
+	rttMinEstimate       = 5 * time.Millisecond
+	rttMaxEstimate       = 5 * time.Second
+	timeoutScalingFactor = 3.0
+
+	// qosTuneInterval is how often RunQoSTuner blends estimates toward
+	// the swarm mean.
+	qosTuneInterval = 10 * time.Second
+)
+
+type qosState struct {
+	rttEstimate   float64 // milliseconds
+	rttConfidence float64
+}
+
+// desiredMinResponsive and exploreRate tune SelectPeer's explore/exploit
+// balance: as the number of responsive tracked peers approaches
+// desiredMinResponsive, the probability of exploring an untracked peer
+// decays toward zero.
+const (
+	desiredMinResponsive = 20
+	exploreRate          = 0.1
+	uniformFallbackRate  = 0.2
+)
+
+// negativeHitBuckets and negativeHitTTL bound the 404 penalty map a
+// bloom-advertising peer's false positives feed: bucketing by hash
+// rather than keying on the full segment ID keeps memory flat regardless
+// of how many distinct segments churn through the cache, and the TTL
+// lets a stale negative expire rather than black-holing a peer forever
+// once it genuinely re-fetches the segment.
+const (
+	negativeHitBuckets = 256
+	negativeHitTTL     = 30 * time.Second
+)
+
+type bandwidthState struct {
+	avg        float64 // bytes/sec, time-decayed
+	lastUpdate time.Time
+}
+
 // Measurer tracks RTT measurements for different peers/endpoints
 type Measurer struct {
-	mu    sync.RWMutex
-	rtts  map[string]int // peer/endpoint -> RTT in milliseconds
-	count map[string]int // peer/endpoint -> number of measurements
+	mu        sync.RWMutex
+	rtts      map[string]int // peer/endpoint -> RTT in milliseconds
+	count     map[string]int // peer/endpoint -> number of measurements
+	bandwidth map[string]*bandwidthState
+	tracked   map[string]struct{} // peers we've sent a request to since connect
+	untracked map[string]struct{} // freshly announced peers we haven't tried yet
+	qos       map[string]*qosState
+
+	// negativeHits records, per peer, the bucket/expiry of a recent
+	// bloom-filter false positive (a 404 from fetchSegmentFromPeer),
+	// keyed by hash(segmentID) % negativeHitBuckets rather than the raw
+	// segment ID.
+	negativeHits map[string]map[uint32]time.Time
 }
 
 // NewMeasurer creates a new RTT measurer
 func NewMeasurer() *Measurer {
 	return &Measurer{
-		rtts:  make(map[string]int),
-		count: make(map[string]int),
+		rtts:         make(map[string]int),
+		count:        make(map[string]int),
+		bandwidth:    make(map[string]*bandwidthState),
+		tracked:      make(map[string]struct{}),
+		untracked:    make(map[string]struct{}),
+		qos:          make(map[string]*qosState),
+		negativeHits: make(map[string]map[uint32]time.Time),
 	}
 }
 
@@ -137,3 +211,292 @@ func (m *Measurer) GetCount(peerID string) int {
 	return m.count[peerID]
 }
 
+// UpdateQoS records a successful probe of sampleRTT against target,
+// folding it into the EWMA rttEstimate and growing confidence toward
+// confidenceMax. Unlike Update/Get's raw last sample, this is what
+// TargetTimeout and QoS-aware peer selection should read.
+func (m *Measurer) UpdateQoS(target string, sampleRTT time.Duration) {
+	if sampleRTT <= 0 {
+		return
+	}
+	sample := float64(sampleRTT.Milliseconds())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.qos[target]
+	if !ok {
+		m.qos[target] = &qosState{rttEstimate: sample, rttConfidence: confidenceInitial}
+		return
+	}
+	state.rttEstimate = (1-qosAlpha)*state.rttEstimate + qosAlpha*sample
+	state.rttConfidence = math.Min(confidenceMax, state.rttConfidence+confidenceIncrement)
+}
+
+// PenalizeQoS decays target's confidence after a failed probe (timeout,
+// error, non-OK status). Confidence never reaches zero, so one bad
+// sample can't permanently black-hole a peer that's answered fine
+// before.
+func (m *Measurer) PenalizeQoS(target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.qos[target]
+	if !ok {
+		m.qos[target] = &qosState{rttEstimate: float64(rttMaxEstimate.Milliseconds()), rttConfidence: confidenceInitial}
+		return
+	}
+	state.rttConfidence = math.Max(confidenceInitial, state.rttConfidence*confidenceDecayFactor)
+}
+
+// TargetTimeout derives a per-target request timeout from the blended
+// RTT estimate, widened as confidence drops so an under-sampled target
+// gets more slack than one with a long track record. Targets with no
+// samples yet fall back to rttMaxEstimate at the lowest confidence.
+func (m *Measurer) TargetTimeout(target string) time.Duration {
+	m.mu.RLock()
+	state, ok := m.qos[target]
+	m.mu.RUnlock()
+
+	estimate := float64(rttMaxEstimate.Milliseconds())
+	confidence := confidenceInitial
+	if ok {
+		estimate = state.rttEstimate
+		confidence = state.rttConfidence
+	}
+	if minMs := float64(rttMinEstimate.Milliseconds()); estimate < minMs {
+		estimate = minMs
+	}
+	if maxMs := float64(rttMaxEstimate.Milliseconds()); estimate > maxMs {
+		estimate = maxMs
+	}
+	timeoutMs := estimate * timeoutScalingFactor / (confidence / confidenceMax)
+	return time.Duration(timeoutMs) * time.Millisecond
+}
+
+// BlendedEstimate returns target's current QoS-tuned RTT estimate in
+// milliseconds, or 0 if it hasn't been sampled yet - useful for
+// announcing a stable RTT rather than one noisy last sample.
+func (m *Measurer) BlendedEstimate(target string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.qos[target]
+	if !ok {
+		return 0
+	}
+	return int(state.rttEstimate)
+}
+
+// RunQoSTuner periodically blends every tracked target's RTT estimate
+// toward the confidence-weighted swarm mean and clamps it back into
+// [rttMinEstimate, rttMaxEstimate]. A target we've barely sampled (low
+// confidence) gets pulled toward the average more strongly than one
+// we've measured heavily, so a handful of probes don't let a fluke
+// estimate stick around unchecked. Exits when ctx is done.
+func (m *Measurer) RunQoSTuner(ctx context.Context) {
+	ticker := time.NewTicker(qosTuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.tuneQoS()
+		}
+	}
+}
+
+func (m *Measurer) tuneQoS() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.qos) == 0 {
+		return
+	}
+	sum := 0.0
+	for _, state := range m.qos {
+		sum += state.rttEstimate
+	}
+	mean := sum / float64(len(m.qos))
+	minMs := float64(rttMinEstimate.Milliseconds())
+	maxMs := float64(rttMaxEstimate.Milliseconds())
+	for _, state := range m.qos {
+		weight := state.rttConfidence / confidenceMax
+		blended := weight*state.rttEstimate + (1-weight)*mean
+		if blended < minMs {
+			blended = minMs
+		}
+		if blended > maxMs {
+			blended = maxMs
+		}
+		state.rttEstimate = blended
+	}
+}
+
+// UpdateBandwidth records an observed transfer of numBytes over duration
+// for peerID. The running average decays with bandwidthHalfLife so a peer
+// that goes idle naturally drifts back toward zero without a background
+// sweeper: avg = avg*2^(-elapsed/halflife) + sample.
+func (m *Measurer) UpdateBandwidth(peerID string, numBytes int64, duration time.Duration) {
+	if duration <= 0 || numBytes <= 0 {
+		return
+	}
+	sample := float64(numBytes) / duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	state, ok := m.bandwidth[peerID]
+	if !ok {
+		m.bandwidth[peerID] = &bandwidthState{avg: sample, lastUpdate: now}
+		return
+	}
+	elapsed := now.Sub(state.lastUpdate)
+	decay := math.Exp2(-elapsed.Seconds() / bandwidthHalfLife.Seconds())
+	state.avg = state.avg*decay + sample
+	state.lastUpdate = now
+}
+
+// GetBandwidth returns peerID's current decayed bandwidth estimate in
+// bytes/sec, applying decay for time elapsed since the last sample.
+func (m *Measurer) GetBandwidth(peerID string) float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.bandwidth[peerID]
+	if !ok {
+		return 0
+	}
+	decay := math.Exp2(-time.Since(state.lastUpdate).Seconds() / bandwidthHalfLife.Seconds())
+	return state.avg * decay
+}
+
+// RecordNegativeHit notes that peerID's advertised Bloom filter gave a
+// false positive for segmentID (fetchSegmentFromPeer got a 404), so
+// future candidate ordering can deprioritize peerID for that segment's
+// bucket until the entry expires.
+func (m *Measurer) RecordNegativeHit(peerID, segmentID string) {
+	bucket := bloomBucket(segmentID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buckets, ok := m.negativeHits[peerID]
+	if !ok {
+		buckets = make(map[uint32]time.Time)
+		m.negativeHits[peerID] = buckets
+	}
+	buckets[bucket] = time.Now().Add(negativeHitTTL)
+}
+
+// IsNegativeHit reports whether peerID has an unexpired false-positive
+// recorded for segmentID's bucket.
+func (m *Measurer) IsNegativeHit(peerID, segmentID string) bool {
+	bucket := bloomBucket(segmentID)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	buckets, ok := m.negativeHits[peerID]
+	if !ok {
+		return false
+	}
+	expiresAt, ok := buckets[bucket]
+	if !ok {
+		return false
+	}
+	return time.Now().Before(expiresAt)
+}
+
+// bloomBucket maps a segment ID to one of negativeHitBuckets buckets, so
+// the negative-hit map's memory stays bounded regardless of how many
+// distinct segments a peer ever asks about.
+func bloomBucket(segmentID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(segmentID))
+	return h.Sum32() % negativeHitBuckets
+}
+
+// MarkAnnounced records peerID as freshly discovered (untracked) unless
+// we've already sent it a request, in which case it stays tracked.
+func (m *Measurer) MarkAnnounced(peerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, tracked := m.tracked[peerID]; tracked {
+		return
+	}
+	m.untracked[peerID] = struct{}{}
+}
+
+// MarkTracked moves peerID from untracked to tracked, meaning we've sent
+// it at least one request since connecting.
+func (m *Measurer) MarkTracked(peerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.untracked, peerID)
+	m.tracked[peerID] = struct{}{}
+}
+
+// SelectPeer picks a candidate to route a segment request to. With
+// probability p_new = min(1, exp(-k*numResponsive/desiredMin)) it explores
+// an untracked candidate at random; otherwise it exploits tracked
+// candidates, sampling proportional to observed bandwidth with a small
+// uniform-random fallback so low-ranked peers aren't starved. Returns ""
+// if candidates is empty.
+func (m *Measurer) SelectPeer(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	m.mu.RLock()
+	var untrackedCandidates, trackedCandidates []string
+	numResponsive := 0
+	for _, c := range candidates {
+		if _, ok := m.untracked[c]; ok {
+			untrackedCandidates = append(untrackedCandidates, c)
+			continue
+		}
+		trackedCandidates = append(trackedCandidates, c)
+		if m.count[c] > 0 {
+			numResponsive++
+		}
+	}
+	weights := make([]float64, len(trackedCandidates))
+	for i, c := range trackedCandidates {
+		if state, ok := m.bandwidth[c]; ok {
+			weights[i] = state.avg
+		}
+	}
+	m.mu.RUnlock()
+
+	pNew := math.Min(1, math.Exp(-exploreRate*float64(numResponsive)/desiredMinResponsive))
+	if len(untrackedCandidates) > 0 && rand.Float64() < pNew {
+		return untrackedCandidates[rand.Intn(len(untrackedCandidates))]
+	}
+
+	if len(trackedCandidates) == 0 {
+		if len(untrackedCandidates) > 0 {
+			return untrackedCandidates[rand.Intn(len(untrackedCandidates))]
+		}
+		return ""
+	}
+
+	if rand.Float64() < uniformFallbackRate {
+		return trackedCandidates[rand.Intn(len(trackedCandidates))]
+	}
+	return weightedSample(trackedCandidates, weights)
+}
+
+// weightedSample picks from items with probability proportional to
+// weights; if every weight is zero (no bandwidth data yet) it falls back
+// to a uniform pick.
+func weightedSample(items []string, weights []float64) string {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return items[rand.Intn(len(items))]
+	}
+	target := rand.Float64() * total
+	cum := 0.0
+	for i, w := range weights {
+		cum += w
+		if target < cum {
+			return items[i]
+		}
+	}
+	return items[len(items)-1]
+}
+
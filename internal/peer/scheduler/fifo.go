@@ -0,0 +1,14 @@
+package scheduler
+
+// FIFO keeps candidates in whatever order the tracker returned them -
+// the peer-selection behavior that predates this package.
+type FIFO struct{}
+
+// NewFIFO returns a Scheduler that leaves candidate order untouched.
+func NewFIFO() *FIFO { return &FIFO{} }
+
+func (f *FIFO) Pick(candidates []Candidate, segID string) []Candidate { return candidates }
+
+func (f *FIFO) Began(peerID string) {}
+
+func (f *FIFO) Ended(peerID string) {}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoCandidates is returned when HedgeFetch is called with no
+// candidates to try.
+var ErrNoCandidates = errors.New("scheduler: no candidates")
+
+// ErrAllCandidatesFailed is returned when every candidate HedgeFetch
+// tried came back with an error.
+var ErrAllCandidatesFailed = errors.New("scheduler: all candidates failed")
+
+// FetchFunc performs the actual network fetch for one candidate,
+// mirroring peerApp.fetchSegmentFromPeer's signature.
+type FetchFunc func(ctx context.Context, c Candidate, segID string) ([]byte, int, error)
+
+// FetchResult is what HedgeFetch returns: the winning candidate and its
+// response.
+type FetchResult struct {
+	Candidate Candidate
+	Data      []byte
+	RTTms     int
+}
+
+type hedgeOutcome struct {
+	result FetchResult
+	err    error
+}
+
+// HedgeFetch fires candidates[0] first, then - if nothing has come back
+// within hedgeAfter - fires the remaining candidates up to the top k in
+// parallel, taking whichever response arrives first and cancelling the
+// rest via ctx. sched.Began/Ended bracket every fetch so a least-loaded
+// scheduler's load tracking reflects hedged requests like any other.
+func HedgeFetch(ctx context.Context, sched Scheduler, candidates []Candidate, segID string, k int, hedgeAfter time.Duration, fetch FetchFunc) (FetchResult, error) {
+	if len(candidates) == 0 {
+		return FetchResult{}, ErrNoCandidates
+	}
+	if k <= 0 {
+		k = 1
+	}
+	if k > len(candidates) {
+		k = len(candidates)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeOutcome, k)
+	launch := func(c Candidate) {
+		sched.Began(c.PeerID)
+		go func() {
+			defer sched.Ended(c.PeerID)
+			data, rtt, err := fetch(ctx, c, segID)
+			results <- hedgeOutcome{result: FetchResult{Candidate: c, Data: data, RTTms: rtt}, err: err}
+		}()
+	}
+
+	launch(candidates[0])
+
+	timer := time.NewTimer(hedgeAfter)
+	defer timer.Stop()
+	hedged := false
+
+	var lastErr error
+	pending := 1
+	for pending > 0 {
+		select {
+		case out := <-results:
+			pending--
+			if out.err == nil {
+				cancel()
+				return out.result, nil
+			}
+			lastErr = out.err
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				for _, c := range candidates[1:k] {
+					launch(c)
+					pending++
+				}
+			}
+		case <-ctx.Done():
+			return FetchResult{}, ctx.Err()
+		}
+	}
+	if lastErr == nil {
+		lastErr = ErrAllCandidatesFailed
+	}
+	return FetchResult{}, lastErr
+}
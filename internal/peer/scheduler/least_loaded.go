@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// loadedConcurrencyThreshold is the in-flight request count below which
+// LeastLoaded considers a peer "not busy" - candidates under the
+// threshold are preferred over ones above it before load is compared at
+// all, so a handful of slightly-busier-but-still-idle peers don't get
+// starved in favor of strictly ranking by count.
+const loadedConcurrencyThreshold = 2
+
+// LeastLoaded tracks in-flight request counts per peer and prefers
+// candidates below loadedConcurrencyThreshold, then by ascending load.
+type LeastLoaded struct {
+	inFlight sync.Map // peerID string -> *atomic.Int32
+}
+
+// NewLeastLoaded returns an empty LeastLoaded scheduler.
+func NewLeastLoaded() *LeastLoaded {
+	return &LeastLoaded{}
+}
+
+func (l *LeastLoaded) Pick(candidates []Candidate, segID string) []Candidate {
+	ordered := make([]Candidate, len(candidates))
+	copy(ordered, candidates)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		loadI, loadJ := l.load(ordered[i].PeerID), l.load(ordered[j].PeerID)
+		belowI, belowJ := loadI < loadedConcurrencyThreshold, loadJ < loadedConcurrencyThreshold
+		if belowI != belowJ {
+			return belowI
+		}
+		return loadI < loadJ
+	})
+	return ordered
+}
+
+func (l *LeastLoaded) load(peerID string) int32 {
+	counter, ok := l.inFlight.Load(peerID)
+	if !ok {
+		return 0
+	}
+	return counter.(*atomic.Int32).Load()
+}
+
+// Began increments peerID's in-flight count.
+func (l *LeastLoaded) Began(peerID string) {
+	l.counter(peerID).Add(1)
+}
+
+// Ended decrements peerID's in-flight count.
+func (l *LeastLoaded) Ended(peerID string) {
+	l.counter(peerID).Add(-1)
+}
+
+func (l *LeastLoaded) counter(peerID string) *atomic.Int32 {
+	actual, _ := l.inFlight.LoadOrStore(peerID, &atomic.Int32{})
+	return actual.(*atomic.Int32)
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import "sort"
+
+// LowestRTT sorts candidates by the local RTT estimator's reading,
+// falling back to the tracker-reported RTTms for a peer this node hasn't
+// measured itself yet.
+type LowestRTT struct {
+	rtt RTTSource
+}
+
+// NewLowestRTT builds a LowestRTT scheduler. rtt may be nil, in which
+// case Pick sorts purely on Candidate.RTTms.
+func NewLowestRTT(rtt RTTSource) *LowestRTT {
+	return &LowestRTT{rtt: rtt}
+}
+
+func (l *LowestRTT) Pick(candidates []Candidate, segID string) []Candidate {
+	ordered := make([]Candidate, len(candidates))
+	copy(ordered, candidates)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return l.estimate(ordered[i]) < l.estimate(ordered[j])
+	})
+	return ordered
+}
+
+// estimate returns our own blended RTT estimate for c.PeerID if we have
+// one, else the tracker-reported RTTms it announced with.
+func (l *LowestRTT) estimate(c Candidate) int {
+	if l.rtt != nil {
+		if blended := l.rtt.BlendedEstimate(c.PeerID); blended > 0 {
+			return blended
+		}
+		if measured := l.rtt.Get(c.PeerID); measured > 0 {
+			return measured
+		}
+	}
+	return c.RTTms
+}
+
+func (l *LowestRTT) Began(peerID string) {}
+
+func (l *LowestRTT) Ended(peerID string) {}
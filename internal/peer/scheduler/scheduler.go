@@ -0,0 +1,56 @@
+// Package scheduler pulls peer-selection policy out of peerApp.requestSegment
+// and behind a Scheduler interface, so the simulator can A/B test routing
+// strategies (first-come-first-served vs. latency-aware vs. load-aware)
+// the same way internal/peer/cache lets it swap eviction policies.
+package scheduler
+
+// Candidate is one peer the tracker offered up as a holder of a segment.
+type Candidate struct {
+	PeerID string
+	// RTTms is the tracker-reported RTT, used as a fallback wherever a
+	// scheduler has no local measurement of its own for this peer yet.
+	RTTms int
+}
+
+// RTTSource supplies a peer's current latency estimate, satisfied by
+// rttpkg.Measurer. Schedulers depend on this narrow interface rather than
+// the concrete Measurer so they stay testable without a real RTT history.
+type RTTSource interface {
+	BlendedEstimate(target string) int
+	Get(target string) int
+}
+
+// Scheduler orders candidates best-first for a given segment and tracks
+// whatever bookkeeping its policy needs around in-flight requests.
+// Implementations that don't need per-request bookkeeping (fifo,
+// lowest-rtt) leave Began/Ended as no-ops rather than requiring callers
+// to type-switch.
+type Scheduler interface {
+	// Pick returns candidates reordered (and optionally filtered)
+	// best-first for segID.
+	Pick(candidates []Candidate, segID string) []Candidate
+	// Began records that a request to peerID has started.
+	Began(peerID string)
+	// Ended records that a request to peerID finished, successfully or not.
+	Ended(peerID string)
+}
+
+const (
+	policyFIFO        = "fifo"
+	policyLowestRTT   = "lowest-rtt"
+	policyLeastLoaded = "least-loaded"
+)
+
+// New constructs the scheduler named by name ("fifo", "lowest-rtt", or
+// "least-loaded"; anything else falls back to "fifo"). rtt is optional -
+// lowest-rtt falls back to each Candidate's own RTTms when nil.
+func New(name string, rtt RTTSource) Scheduler {
+	switch name {
+	case policyLowestRTT:
+		return NewLowestRTT(rtt)
+	case policyLeastLoaded:
+		return NewLeastLoaded()
+	default:
+		return NewFIFO()
+	}
+}
@@ -6,16 +6,88 @@ import (
 	"log"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	"cloud_project/internal/backoff"
 	"github.com/gorilla/websocket"
 )
 
+// Client maintains a persistent signalling session for one peer. On any
+// read/write error it reconnects with exponential backoff and
+// re-announces, so a dropped WebSocket doesn't silently take the peer
+// off the mesh until the next restart.
 type Client struct {
 	url       string
 	room      string
 	peerID    string
 	neighbors []string
-	conn      *websocket.Conn
+
+	mu      sync.RWMutex
+	conn    *websocket.Conn
+	healthy bool
+
+	onConnect    func()
+	onDisconnect func(error)
+
+	messages chan Message
+}
+
+// Message is a decoded point-to-point signalling message addressed to
+// this peer - a WebRTC offer/answer, an ICE candidate, or a path-response
+// answering a request_path this peer sent. Fields not relevant to Type
+// are left zero.
+type Message struct {
+	Type          string
+	From          string
+	SDP           string
+	Candidate     string
+	SDPMid        string
+	SDPMLineIndex *int
+	RequestID     string
+	Hops          []string
+}
+
+type inboundEnvelope struct {
+	Type          string   `json:"type"`
+	Peer          string   `json:"peer"`
+	SDP           string   `json:"sdp"`
+	Candidate     string   `json:"candidate"`
+	SDPMid        string   `json:"sdp_mid"`
+	SDPMLineIndex *int     `json:"sdp_mline_index"`
+	RequestID     string   `json:"request_id"`
+	Hops          []string `json:"hops"`
+}
+
+type offerMessage struct {
+	Type   string `json:"type"`
+	Peer   string `json:"peer"`
+	Target string `json:"target"`
+	SDP    string `json:"sdp"`
+}
+
+type answerMessage struct {
+	Type   string `json:"type"`
+	Peer   string `json:"peer"`
+	Target string `json:"target"`
+	SDP    string `json:"sdp"`
+}
+
+type iceCandidateMessage struct {
+	Type          string `json:"type"`
+	Peer          string `json:"peer"`
+	Target        string `json:"target"`
+	Candidate     string `json:"candidate"`
+	SDPMid        string `json:"sdp_mid,omitempty"`
+	SDPMLineIndex *int   `json:"sdp_mline_index,omitempty"`
+}
+
+type pathResponseMessage struct {
+	Type      string   `json:"type"`
+	Peer      string   `json:"peer"`
+	Target    string   `json:"target"`
+	RequestID string   `json:"request_id,omitempty"`
+	Hops      []string `json:"hops"`
 }
 
 type announceMessage struct {
@@ -30,19 +102,86 @@ type requestPathMessage struct {
 	Target string `json:"target"`
 }
 
+type registerWebseedMessage struct {
+	Type    string            `json:"type"`
+	Peer    string            `json:"peer"`
+	Room    string            `json:"room"`
+	Payload map[string]string `json:"payload"`
+}
+
+// reconnectPolicy backs off 1s -> 2s -> 4s ... capped at 60s with jitter,
+// and never gives up: a peer should keep trying to rejoin the mesh for
+// as long as it's running.
+func reconnectPolicy() backoff.Policy {
+	return backoff.Policy{
+		InitialInterval:     1 * time.Second,
+		MaxInterval:         60 * time.Second,
+		Multiplier:          2,
+		RandomizationFactor: 0.5,
+		MaxElapsedTime:      0,
+	}
+}
+
 func NewClient(baseURL, room, peer string, neighbors []string) *Client {
 	return &Client{
 		url:       strings.TrimSuffix(baseURL, "/"),
 		room:      room,
 		peerID:    peer,
 		neighbors: neighbors,
+		messages:  make(chan Message, 32),
 	}
 }
 
+// Messages returns the channel of decoded point-to-point messages
+// (offer/answer/ice-candidate/path-response) addressed to this peer.
+func (c *Client) Messages() <-chan Message { return c.messages }
+
+// OnConnect registers a callback fired after each successful connect (or
+// reconnect), once the announce for that session has been sent.
+func (c *Client) OnConnect(fn func()) { c.onConnect = fn }
+
+// OnDisconnect registers a callback fired whenever the session drops,
+// with the error that caused it (nil on a clean Close).
+func (c *Client) OnDisconnect(fn func(error)) { c.onDisconnect = fn }
+
+// Healthy reports whether the client currently holds a live session.
+func (c *Client) Healthy() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.healthy
+}
+
+// Connect maintains the persistent session: it dials, announces, and on
+// any error reconnects per reconnectPolicy, re-announcing the peer's
+// neighbor list on every successful reconnect. It blocks until ctx is
+// done.
 func (c *Client) Connect(ctx context.Context) error {
 	if c.url == "" {
 		return nil
 	}
+	b := backoff.New(reconnectPolicy())
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sessionErr := c.runSession(ctx, b)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			wait = reconnectPolicy().MaxInterval
+		}
+		log.Printf("[peer %s] signalling reconnecting in %s: %v", c.peerID, wait, sessionErr)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Client) runSession(ctx context.Context, b *backoff.BackOff) error {
 	parsed, err := url.Parse(c.url)
 	if err != nil {
 		return err
@@ -51,59 +190,206 @@ func (c *Client) Connect(ctx context.Context) error {
 	query.Set("peer", c.peerID)
 	query.Set("room", c.room)
 	parsed.RawQuery = query.Encode()
-	conn, _, err := websocket.DefaultDialer.Dial(parsed.String(), nil)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, parsed.String(), nil)
 	if err != nil {
 		return err
 	}
+	b.Reset()
+
+	c.mu.Lock()
 	c.conn = conn
-	go c.readLoop(ctx)
-	return c.sendAnnounce()
+	c.healthy = true
+	c.mu.Unlock()
+
+	if err := c.sendAnnounce(conn); err != nil {
+		c.teardown(conn, err)
+		return err
+	}
+	if c.onConnect != nil {
+		c.onConnect()
+	}
+
+	readErr := c.readLoop(ctx, conn)
+	c.teardown(conn, readErr)
+	return readErr
 }
 
-func (c *Client) Close() {
-	if c.conn != nil {
-		c.conn.WriteMessage(websocket.CloseMessage, nil)
-		c.conn.Close()
+func (c *Client) teardown(conn *websocket.Conn, cause error) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.healthy = false
+	c.mu.Unlock()
+	conn.Close()
+	if c.onDisconnect != nil {
+		c.onDisconnect(cause)
 	}
 }
 
-func (c *Client) sendAnnounce() error {
-	if c.conn == nil {
-		return nil
+// Close ends the current session, if any. The reconnect loop in Connect
+// exits on its own once ctx is cancelled.
+func (c *Client) Close() {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.healthy = false
+	c.mu.Unlock()
+	if conn != nil {
+		conn.WriteMessage(websocket.CloseMessage, nil)
+		conn.Close()
 	}
+}
+
+func (c *Client) sendAnnounce(conn *websocket.Conn) error {
 	payload, _ := json.Marshal(announceMessage{
 		Type:      "announce",
 		Peer:      c.peerID,
 		Room:      c.room,
 		Neighbors: c.neighbors,
 	})
-	return c.conn.WriteMessage(websocket.TextMessage, payload)
+	return conn.WriteMessage(websocket.TextMessage, payload)
 }
 
-func (c *Client) readLoop(ctx context.Context) {
-	defer c.conn.Close()
+func (c *Client) readLoop(ctx context.Context, conn *websocket.Conn) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		default:
-			_, msg, err := c.conn.ReadMessage()
+			_, msg, err := conn.ReadMessage()
 			if err != nil {
-				log.Printf("[peer %s] signalling closed: %v", c.peerID, err)
-				return
+				return err
 			}
-			log.Printf("[peer %s] signalling message: %s", c.peerID, string(msg))
+			c.dispatch(msg)
 		}
 	}
 }
 
-func (c *Client) RequestPath(target string) error {
-	if c.conn == nil {
+// dispatch decodes an inbound message and, for the point-to-point types a
+// caller negotiating WebRTC needs to react to, pushes it onto Messages().
+// Everything else (path, pex_peers) has no consumer here and is just
+// logged, as every message was before Messages() existed.
+func (c *Client) dispatch(raw []byte) {
+	var env inboundEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		log.Printf("[peer %s] invalid signalling message: %v", c.peerID, err)
+		return
+	}
+	switch env.Type {
+	case "offer", "answer", "ice-candidate", "path-response":
+		c.deliver(Message{
+			Type:          env.Type,
+			From:          env.Peer,
+			SDP:           env.SDP,
+			Candidate:     env.Candidate,
+			SDPMid:        env.SDPMid,
+			SDPMLineIndex: env.SDPMLineIndex,
+			RequestID:     env.RequestID,
+			Hops:          env.Hops,
+		})
+	default:
+		log.Printf("[peer %s] signalling message: %s", c.peerID, string(raw))
+	}
+}
+
+// deliver pushes m onto the Messages channel without blocking the read
+// loop: a consumer that isn't keeping up drops the message rather than
+// stalling every other peer's signalling session, the same tradeoff
+// cmd/signaling's trySend makes for its own send buffers.
+func (c *Client) deliver(m Message) {
+	select {
+	case c.messages <- m:
+	default:
+		log.Printf("[peer %s] dropping %s message: consumer not keeping up", c.peerID, m.Type)
+	}
+}
+
+func (c *Client) writeMessage(payload []byte) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn == nil {
 		return nil
 	}
+	return conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (c *Client) RequestPath(target string) error {
 	payload, _ := json.Marshal(requestPathMessage{
 		Type:   "request_path",
 		Target: target,
 	})
-	return c.conn.WriteMessage(websocket.TextMessage, payload)
+	return c.writeMessage(payload)
+}
+
+// RegisterWebseed tells the hub that webseedID is an HTTP webseed backed
+// by baseURL, so ShortestPath queries in this room can terminate there
+// when no P2P holder exists for a segment.
+func (c *Client) RegisterWebseed(webseedID, baseURL string) error {
+	payload, _ := json.Marshal(registerWebseedMessage{
+		Type:    "register_webseed",
+		Peer:    webseedID,
+		Room:    c.room,
+		Payload: map[string]string{"base_url": baseURL},
+	})
+	return c.writeMessage(payload)
+}
+
+// SendOffer relays a WebRTC SDP offer to target, the first step of
+// negotiating a direct peer connection once RequestPath (or a DHT
+// lookup) has identified who to connect to.
+func (c *Client) SendOffer(target, sdp string) error {
+	payload, _ := json.Marshal(offerMessage{
+		Type:   "offer",
+		Peer:   c.peerID,
+		Target: target,
+		SDP:    sdp,
+	})
+	return c.writeMessage(payload)
+}
+
+// SendAnswer relays a WebRTC SDP answer back to target in response to an
+// offer received via Messages().
+func (c *Client) SendAnswer(target, sdp string) error {
+	payload, _ := json.Marshal(answerMessage{
+		Type:   "answer",
+		Peer:   c.peerID,
+		Target: target,
+		SDP:    sdp,
+	})
+	return c.writeMessage(payload)
+}
+
+// SendICECandidate relays one locally-gathered ICE candidate to target.
+// sdpMid/sdpMLineIndex are carried through as-is; sdpMLineIndex is a
+// pointer because 0 is a valid line index and must be distinguished from
+// "not set".
+func (c *Client) SendICECandidate(target, candidate, sdpMid string, sdpMLineIndex *int) error {
+	payload, _ := json.Marshal(iceCandidateMessage{
+		Type:          "ice-candidate",
+		Peer:          c.peerID,
+		Target:        target,
+		Candidate:     candidate,
+		SDPMid:        sdpMid,
+		SDPMLineIndex: sdpMLineIndex,
+	})
+	return c.writeMessage(payload)
+}
+
+// RespondPath answers target's earlier request_path directly, addressed
+// to just that peer rather than broadcast to every peer on the path the
+// way the hub's own request_path handling does - for a caller that
+// resolved the hop list itself (e.g. from a local DHT lookup) instead of
+// asking the hub to compute it.
+func (c *Client) RespondPath(target, requestID string, hops []string) error {
+	payload, _ := json.Marshal(pathResponseMessage{
+		Type:      "path-response",
+		Peer:      c.peerID,
+		Target:    target,
+		RequestID: requestID,
+		Hops:      hops,
+	})
+	return c.writeMessage(payload)
 }
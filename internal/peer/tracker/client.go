@@ -3,16 +3,26 @@ package tracker
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
 	baseURL string
-	http    *http.Client
+	// psk, if set, signs announce and heartbeat bodies with an
+	// HMAC-SHA256 X-Peer-Auth header, matching a pre-shared key
+	// provisioned for this peer through the tracker's admin API.
+	psk   string
+	nonce int64
+	http  *http.Client
 }
 
 type AnnouncePayload struct {
@@ -22,17 +32,47 @@ type AnnouncePayload struct {
 	RTTms     int      `json:"rtt_ms"`
 	Segments  []string `json:"segments"`
 	Neighbors []string `json:"neighbors"`
+	WebSeeds  []string `json:"webseeds,omitempty"`
+
+	// SegmentsBloom, when set, replaces Segments with a packed Bloom
+	// filter over the same set - sub-kilobyte even at 10k cache entries,
+	// at the cost of the tracker only being able to membership-test
+	// rather than enumerate a peer's segments. SegmentsM/K/N are the
+	// filter's (m, k, n) parameters, required to reconstruct and test it.
+	SegmentsBloom []byte `json:"segments_bloom,omitempty"`
+	SegmentsM     uint32 `json:"segments_m,omitempty"`
+	SegmentsK     uint32 `json:"segments_k,omitempty"`
+	SegmentsN     uint32 `json:"segments_n,omitempty"`
 }
 
 type HeartbeatPayload struct {
 	PeerID    string   `json:"peer_id"`
 	Segments  []string `json:"segments"`
 	Neighbors []string `json:"neighbors"`
+
+	// SegmentsBloom mirrors AnnouncePayload's bloom fields, for peers
+	// heartbeating in bloom advertise mode.
+	SegmentsBloom []byte `json:"segments_bloom,omitempty"`
+	SegmentsM     uint32 `json:"segments_m,omitempty"`
+	SegmentsK     uint32 `json:"segments_k,omitempty"`
+	SegmentsN     uint32 `json:"segments_n,omitempty"`
 }
 
-func NewClient(baseURL string) *Client {
+// ReportPayload reports a peer's misbehavior to the tracker.
+type ReportPayload struct {
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason"`
+}
+
+// NewClient constructs a tracker client. psk may be empty; if set,
+// Announce and Heartbeat sign their bodies with it via X-Peer-Auth, for
+// use with a tracker where this peer has been provisioned a PSK through
+// POST /admin/peers.
+func NewClient(baseURL, psk string) *Client {
 	return &Client{
 		baseURL: strings.TrimSuffix(baseURL, "/"),
+		psk:     psk,
+		nonce:   time.Now().UnixNano(),
 		http: &http.Client{
 			Timeout: 5 * time.Second,
 		},
@@ -40,14 +80,21 @@ func NewClient(baseURL string) *Client {
 }
 
 func (c *Client) Announce(ctx context.Context, payload AnnouncePayload) error {
-	return c.post(ctx, "/announce", payload)
+	return c.post(ctx, "/announce", payload, true)
 }
 
 func (c *Client) Heartbeat(ctx context.Context, payload HeartbeatPayload) error {
-	return c.post(ctx, "/heartbeat", payload)
+	return c.post(ctx, "/heartbeat", payload, true)
+}
+
+// ReportBadPeer tells the tracker that peerID misbehaved (a hash
+// mismatch, a timeout, or a protocol violation), so it can be banned
+// once enough corroborating reports come in.
+func (c *Client) ReportBadPeer(ctx context.Context, peerID, reason string) error {
+	return c.post(ctx, "/report", ReportPayload{PeerID: peerID, Reason: reason}, false)
 }
 
-func (c *Client) post(ctx context.Context, path string, body any) error {
+func (c *Client) post(ctx context.Context, path string, body any, signed bool) error {
 	if c.baseURL == "" {
 		return fmt.Errorf("tracker url not configured")
 	}
@@ -60,6 +107,9 @@ func (c *Client) post(ctx context.Context, path string, body any) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if signed && c.psk != "" {
+		req.Header.Set("X-Peer-Auth", c.sign(data))
+	}
 	resp, err := c.http.Do(req)
 	if err != nil {
 		return err
@@ -71,6 +121,19 @@ func (c *Client) post(ctx context.Context, path string, body any) error {
 	return nil
 }
 
+// sign returns the "<nonce>:<hex hmac>" X-Peer-Auth value for body,
+// using a monotonically increasing nonce (seeded from wall-clock time so
+// it stays ahead of whatever the tracker last saw, even across a peer
+// restart).
+func (c *Client) sign(body []byte) string {
+	nonce := atomic.AddInt64(&c.nonce, 1)
+	nonceStr := strconv.FormatInt(nonce, 10)
+	mac := hmac.New(sha256.New, []byte(c.psk))
+	mac.Write([]byte(nonceStr))
+	mac.Write(body)
+	return nonceStr + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // MeasureRTT measures the RTT to the tracker
 func (c *Client) MeasureRTT(ctx context.Context) (int, error) {
 	if c.baseURL == "" {
@@ -88,4 +151,4 @@ func (c *Client) MeasureRTT(ctx context.Context) (int, error) {
 	defer resp.Body.Close()
 	rtt := int(time.Since(start).Milliseconds())
 	return rtt, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,227 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_project/internal/backoff"
+	"github.com/gorilla/websocket"
+)
+
+// streamOutboxBuffer bounds how many pending delta events a peer's
+// outbound stream can accumulate before the oldest is dropped in favor
+// of the newest, mirroring the events bus's 100k-buffered drop-on-
+// overflow pattern: a tracker that's slow to read shouldn't stall the
+// peer's cache/neighbor bookkeeping.
+const streamOutboxBuffer = 100_000
+
+// StreamEvent is one delta a peer pushes in place of a full heartbeat.
+type StreamEvent struct {
+	Type      string   `json:"type"` // segment_added, segment_evicted, neighbor_changed, rtt_sample
+	SegmentID string   `json:"segment_id,omitempty"`
+	Neighbors []string `json:"neighbors,omitempty"`
+	RTTms     int      `json:"rtt_ms,omitempty"`
+}
+
+// PushMessage is a tracker-initiated notification delivered over the
+// stream: another peer wants a segment this peer holds, or the topology
+// this peer cares about changed.
+type PushMessage struct {
+	Type      string `json:"type"` // peer_wants, topology_changed
+	SegmentID string `json:"segment_id,omitempty"`
+	PeerID    string `json:"peer_id,omitempty"`
+}
+
+// reconnectPolicy backs off 1s -> 2s -> ... capped at 60s with jitter
+// and never gives up, matching signalling.Client's reconnect behavior.
+func reconnectPolicy() backoff.Policy {
+	return backoff.Policy{
+		InitialInterval:     1 * time.Second,
+		MaxInterval:         60 * time.Second,
+		Multiplier:          2,
+		RandomizationFactor: 0.5,
+		MaxElapsedTime:      0,
+	}
+}
+
+// StreamClient maintains a persistent WebSocket to the tracker's
+// /stream endpoint, over which it sends delta events in place of the
+// full Segments/Neighbors payload a heartbeat POST would otherwise
+// resend every interval, and receives push notifications in return. On
+// any read/write error it reconnects with exponential backoff; callers
+// should keep using the HTTP Client for initial registration and as a
+// fallback while Healthy reports false.
+type StreamClient struct {
+	url    string
+	peerID string
+
+	mu      sync.RWMutex
+	conn    *websocket.Conn
+	healthy bool
+	outbox  chan StreamEvent
+
+	onPush func(PushMessage)
+}
+
+// NewStreamClient builds a StreamClient against baseURL (the tracker's
+// HTTP base URL; /stream is dialed as ws(s)://.../stream?peer=peerID).
+func NewStreamClient(baseURL, peerID string) *StreamClient {
+	return &StreamClient{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		peerID: peerID,
+		outbox: make(chan StreamEvent, streamOutboxBuffer),
+	}
+}
+
+// OnPush registers the callback invoked for each PushMessage the
+// tracker sends down the stream.
+func (c *StreamClient) OnPush(fn func(PushMessage)) { c.onPush = fn }
+
+// Healthy reports whether the client currently holds a live session.
+func (c *StreamClient) Healthy() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.healthy
+}
+
+// Send queues ev for delivery, dropping the oldest queued event if the
+// outbox is full rather than blocking the caller.
+func (c *StreamClient) Send(ev StreamEvent) {
+	select {
+	case c.outbox <- ev:
+		return
+	default:
+	}
+	select {
+	case <-c.outbox:
+	default:
+	}
+	select {
+	case c.outbox <- ev:
+	default:
+	}
+}
+
+// Connect maintains the persistent session, reconnecting per
+// reconnectPolicy on any error. It blocks until ctx is done.
+func (c *StreamClient) Connect(ctx context.Context) error {
+	if c.url == "" {
+		return nil
+	}
+	b := backoff.New(reconnectPolicy())
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sessionErr := c.runSession(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			wait = reconnectPolicy().MaxInterval
+		}
+		log.Printf("[peer %s] tracker stream reconnecting in %s: %v", c.peerID, wait, sessionErr)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *StreamClient) runSession(ctx context.Context) error {
+	parsed, err := url.Parse(c.url)
+	if err != nil {
+		return err
+	}
+	parsed.Scheme = wsScheme(parsed.Scheme)
+	query := parsed.Query()
+	query.Set("peer", c.peerID)
+	parsed.RawQuery = query.Encode()
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/stream"
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, parsed.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.healthy = true
+	c.mu.Unlock()
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go c.writeLoop(sessionCtx, conn)
+	readErr := c.readLoop(conn)
+
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.healthy = false
+	c.mu.Unlock()
+	conn.Close()
+	return readErr
+}
+
+func (c *StreamClient) writeLoop(ctx context.Context, conn *websocket.Conn) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-c.outbox:
+			payload, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *StreamClient) readLoop(conn *websocket.Conn) error {
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var push PushMessage
+		if err := json.Unmarshal(msg, &push); err != nil {
+			continue
+		}
+		if c.onPush != nil {
+			c.onPush(push)
+		}
+	}
+}
+
+// Close ends the current session, if any. The reconnect loop in Connect
+// exits on its own once ctx is cancelled.
+func (c *StreamClient) Close() {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.healthy = false
+	c.mu.Unlock()
+	if conn != nil {
+		conn.WriteMessage(websocket.CloseMessage, nil)
+		conn.Close()
+	}
+}
+
+func wsScheme(httpScheme string) string {
+	if httpScheme == "https" {
+		return "wss"
+	}
+	return "ws"
+}
@@ -0,0 +1,116 @@
+// Package wantlist implements a Bitswap-style want-list/have-list
+// exchange between neighboring peers: each peer tracks which segments it
+// is still missing, announces them to its neighbors, and remembers which
+// neighbors have asked it for which segments so a newly landed segment
+// can be pushed out the moment it arrives instead of waiting on the next
+// one-shot push-distribution pass.
+package wantlist
+
+import "sync"
+
+// Entry is one want-list line item: a segment ID and its priority
+// (higher wins when a reconciliation pass has to pick which want to
+// service first).
+type Entry struct {
+	SegmentID string `json:"segment_id"`
+	Priority  int    `json:"priority"`
+}
+
+// Manager tracks this peer's own outstanding wants plus the wants its
+// neighbors have announced to it. Safe for concurrent use.
+type Manager struct {
+	mu sync.Mutex
+	// wants is this peer's own open want-list, segment ID -> priority.
+	wants map[string]int
+	// peerWants is what each neighbor has told us (via POST /wantlist)
+	// it wants from us: neighbor ID -> segment ID -> priority.
+	peerWants map[string]map[string]int
+}
+
+// NewManager returns an empty want-list manager.
+func NewManager() *Manager {
+	return &Manager{
+		wants:     make(map[string]int),
+		peerWants: make(map[string]map[string]int),
+	}
+}
+
+// AddWant registers segmentID as something this peer is missing, raising
+// its priority if it's already on the list.
+func (m *Manager) AddWant(segmentID string, priority int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.wants[segmentID]; !ok || priority > existing {
+		m.wants[segmentID] = priority
+	}
+}
+
+// RemoveWant cancels a want, whether it was satisfied locally, by a
+// neighbor's push, or any other source.
+func (m *Manager) RemoveWant(segmentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.wants, segmentID)
+}
+
+// Wants returns this peer's current open want-list.
+func (m *Manager) Wants() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Entry, 0, len(m.wants))
+	for id, p := range m.wants {
+		out = append(out, Entry{SegmentID: id, Priority: p})
+	}
+	return out
+}
+
+// Wanted reports whether segmentID is currently on this peer's own
+// want-list.
+func (m *Manager) Wanted(segmentID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.wants[segmentID]
+	return ok
+}
+
+// Apply folds a batch of add/remove operations peerID announced about
+// its own wants into our record of what that neighbor wants from us.
+func (m *Manager) Apply(peerID string, add []Entry, remove []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.peerWants[peerID]
+	if !ok {
+		bucket = make(map[string]int)
+		m.peerWants[peerID] = bucket
+	}
+	for _, e := range add {
+		bucket[e.SegmentID] = e.Priority
+	}
+	for _, id := range remove {
+		delete(bucket, id)
+	}
+}
+
+// NeighborsWanting returns the neighbor IDs that have told us they want
+// segmentID, so it can be pushed to them proactively once acquired.
+func (m *Manager) NeighborsWanting(segmentID string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for peerID, bucket := range m.peerWants {
+		if _, ok := bucket[segmentID]; ok {
+			out = append(out, peerID)
+		}
+	}
+	return out
+}
+
+// ClearPeerWant removes peerID's record of wanting segmentID, once it's
+// been pushed to them (or they've cancelled it themselves).
+func (m *Manager) ClearPeerWant(peerID, segmentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bucket, ok := m.peerWants[peerID]; ok {
+		delete(bucket, segmentID)
+	}
+}
@@ -0,0 +1,162 @@
+// Package webseed fetches HLS fMP4 segments over plain HTTP(S) from a
+// configured list of origin CDN URLs, mirroring the webseed fallback
+// BitTorrent clients use when the swarm itself can't deliver a piece.
+// It's the last resort in the peer's fetch chain, after P2P and edge
+// lookups have both failed.
+package webseed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RTTRecorder is the subset of rtt.Measurer a Fetcher needs to track
+// per-URL latency. Satisfied by *rtt.Measurer; accepting the narrow
+// interface here keeps this package from depending on the peer's rtt
+// package.
+type RTTRecorder interface {
+	Update(target string, rttMs int)
+}
+
+// ErrNoWebSeeds is returned when no webseed origin is configured.
+var ErrNoWebSeeds = errors.New("webseed: no webseeds configured")
+
+// checksumEntry mirrors the shape the ffmpeg tool writes to
+// checksums.json: a segment's path relative to the HLS output dir and
+// its SHA-256.
+type checksumEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// ChecksumIndex maps a segment's relative path to its expected SHA-256,
+// as produced by the ffmpeg tool alongside the HLS ladder.
+type ChecksumIndex map[string]string
+
+// LoadChecksums reads a checksums.json produced by tools/ffmpeg.
+func LoadChecksums(path string) (ChecksumIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []checksumEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	idx := make(ChecksumIndex, len(entries))
+	for _, e := range entries {
+		idx[e.Path] = e.SHA256
+	}
+	return idx, nil
+}
+
+// Verify checks data against the checksum recorded for segmentPath. A
+// segment with no recorded checksum passes without error, since not
+// every deployment ships a checksums.json.
+func (idx ChecksumIndex) Verify(segmentPath string, data []byte) error {
+	want, ok := idx[segmentPath]
+	if !ok {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("webseed: checksum mismatch for %s: want %s, got %s", segmentPath, want, got)
+	}
+	return nil
+}
+
+// Fetcher pulls segments from a fixed, ordered list of webseed origins,
+// trying each in turn until one succeeds and verifies.
+type Fetcher struct {
+	urls         []string
+	httpClient   *http.Client
+	checksums    ChecksumIndex
+	rtt          RTTRecorder
+	pathTemplate string
+}
+
+// NewFetcher builds a Fetcher over urls. checksums may be nil, in which
+// case downloaded segments aren't verified. rtt may be nil, in which
+// case per-URL latency isn't recorded anywhere.
+func NewFetcher(urls []string, httpClient *http.Client, checksums ChecksumIndex, rtt RTTRecorder) *Fetcher {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if checksums == nil {
+		checksums = ChecksumIndex{}
+	}
+	return &Fetcher{urls: urls, httpClient: httpClient, checksums: checksums, rtt: rtt}
+}
+
+// WithPathTemplate overrides how a segment path is joined onto a
+// webseed's base URL. tmpl is an fmt.Sprintf template taking the base
+// URL and the segment path, e.g. "%s/blobs/%s" to mount an origin that
+// lays out segments under a "blobs/" prefix instead of the default flat
+// layout. An empty tmpl restores the default (base + "/" + path).
+func (f *Fetcher) WithPathTemplate(tmpl string) *Fetcher {
+	f.pathTemplate = tmpl
+	return f
+}
+
+// Fetch downloads segmentPath from the first webseed that serves it and
+// passes checksum verification. HLS fMP4 segments are already
+// byte-aligned files, so the range request spans the whole segment
+// rather than an offset within it.
+func (f *Fetcher) Fetch(ctx context.Context, segmentPath string) ([]byte, string, error) {
+	if len(f.urls) == 0 {
+		return nil, "", ErrNoWebSeeds
+	}
+	var lastErr error
+	for _, base := range f.urls {
+		data, err := f.fetchFrom(ctx, base, segmentPath)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := f.checksums.Verify(segmentPath, data); err != nil {
+			lastErr = err
+			continue
+		}
+		return data, base, nil
+	}
+	return nil, "", fmt.Errorf("webseed: all webseeds failed for %s: %w", segmentPath, lastErr)
+}
+
+func (f *Fetcher) fetchFrom(ctx context.Context, base, segmentPath string) ([]byte, error) {
+	trimmedBase := strings.TrimSuffix(base, "/")
+	trimmedPath := strings.TrimPrefix(segmentPath, "/")
+	var url string
+	if f.pathTemplate != "" {
+		url = fmt.Sprintf(f.pathTemplate, trimmedBase, trimmedPath)
+	} else {
+		url = trimmedBase + "/" + trimmedPath
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-")
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if f.rtt != nil {
+		f.rtt.Update(base, int(time.Since(start).Milliseconds()))
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("webseed: %s returned status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
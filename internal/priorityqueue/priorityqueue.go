@@ -0,0 +1,204 @@
+// Package priorityqueue mediates a peer's outbound segment sends through
+// a bounded, per-band priority queue instead of the caller performing
+// each HTTP POST inline. Producers push items tagged with a priority
+// band; a small worker pool drains the bands highest-first. This
+// decouples one slow or unreachable neighbor from the rest of a song's
+// distribution: the producer's loop only stalls once every band is
+// saturated, instead of once per send. SendFunc is expected to own its
+// own retry policy (sendSegmentToPeer does, via its circuit breaker and
+// backoff loop); the queue gives it a bounded context tied to Close so a
+// shutdown doesn't wait out a send's full retry budget.
+package priorityqueue
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud_project/pkg/metrics"
+)
+
+// sendBudget bounds how long one item's send (including its own
+// internal retries) may run before the worker gives up on it.
+const sendBudget = 30 * time.Second
+
+// wakePollInterval is how often an idle worker re-checks the bands even
+// without an explicit wake, as a safety net against a missed signal.
+const wakePollInterval = 50 * time.Millisecond
+
+// Item is one outbound segment send: data bound for peerID, queued at
+// Priority (0 = highest; position in the distribution path and cache
+// pressure both feed into it).
+type Item struct {
+	PeerID   string
+	SegID    string
+	Data     []byte
+	Priority int
+}
+
+// SendFunc performs the actual delivery for one item, e.g. peerApp's
+// sendSegmentToPeer. Returning an error causes the worker to retry with
+// backoff up to the queue's configured policy.
+type SendFunc func(ctx context.Context, item Item) error
+
+// Queue is a bounded, per-band priority queue of outbound sends. Safe
+// for concurrent Push from multiple goroutines.
+type Queue struct {
+	bands []chan Item
+	depth []atomic.Int32
+
+	send  SendFunc
+	label string
+	m     *metrics.Metrics
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	signal chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New builds a Queue with bandCount priority bands (0 = highest, each
+// holding up to capacityPerBand items) and starts workers pop()-ing and
+// sending concurrently. label identifies this queue (typically the
+// owning peer's name) in the exposed depth gauge.
+func New(bandCount, capacityPerBand, workers int, label string, send SendFunc, m *metrics.Metrics) *Queue {
+	if bandCount < 1 {
+		bandCount = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		bands:  make([]chan Item, bandCount),
+		depth:  make([]atomic.Int32, bandCount),
+		send:   send,
+		label:  label,
+		m:      m,
+		ctx:    ctx,
+		cancel: cancel,
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	for i := range q.bands {
+		q.bands[i] = make(chan Item, capacityPerBand)
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Push enqueues item onto its priority band. If the band is already at
+// capacity, the band's oldest item is evicted to make room - a full
+// band drops work rather than blocking the producer.
+func (q *Queue) Push(item Item) {
+	band := q.bandFor(item.Priority)
+	if q.tryPush(band, item) {
+		q.wake()
+		return
+	}
+	select {
+	case evicted := <-q.bands[band]:
+		q.setDepth(band, -1)
+		log.Printf("priorityqueue[%s]: band %d full, evicting segment %s bound for %s", q.label, band, evicted.SegID, evicted.PeerID)
+	default:
+	}
+	q.tryPush(band, item)
+	q.wake()
+}
+
+// Depths returns the current item count per band, indexed by band
+// number, for callers that want to log or inspect it directly.
+func (q *Queue) Depths() []int32 {
+	out := make([]int32, len(q.depth))
+	for i := range q.depth {
+		out[i] = q.depth[i].Load()
+	}
+	return out
+}
+
+// Close stops all workers, cancelling any send currently in flight
+// instead of waiting out its retry budget. Items still queued are
+// dropped.
+func (q *Queue) Close() {
+	q.cancel()
+	close(q.stop)
+	q.wg.Wait()
+}
+
+func (q *Queue) tryPush(band int, item Item) bool {
+	select {
+	case q.bands[band] <- item:
+		q.setDepth(band, 1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *Queue) bandFor(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	if priority >= len(q.bands) {
+		return len(q.bands) - 1
+	}
+	return priority
+}
+
+func (q *Queue) setDepth(band, delta int) {
+	depth := q.depth[band].Add(int32(delta))
+	if q.m != nil && q.m.OutboundQueueDepth != nil {
+		q.m.OutboundQueueDepth.WithLabelValues(q.label, strconv.Itoa(band)).Set(float64(depth))
+	}
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// popNext returns the highest-priority item available across all bands,
+// or ok=false if every band is currently empty.
+func (q *Queue) popNext() (Item, int, bool) {
+	for band := range q.bands {
+		select {
+		case item := <-q.bands[band]:
+			q.setDepth(band, -1)
+			return item, band, true
+		default:
+		}
+	}
+	return Item{}, 0, false
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(wakePollInterval)
+	defer ticker.Stop()
+	for {
+		if item, _, ok := q.popNext(); ok {
+			q.process(item)
+			continue
+		}
+		select {
+		case <-q.stop:
+			return
+		case <-q.signal:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) process(item Item) {
+	ctx, cancel := context.WithTimeout(q.ctx, sendBudget)
+	defer cancel()
+	if err := q.send(ctx, item); err != nil {
+		log.Printf("priorityqueue[%s]: giving up sending segment %s to %s: %v", q.label, item.SegID, item.PeerID, err)
+	}
+}
@@ -15,6 +15,10 @@ type Connection struct {
 	Send chan []byte
 }
 
+// PeerID returns the identity this connection was registered under, so
+// callers that only hold a Conn interface value can still key off it.
+func (c *Connection) PeerID() PeerID { return c.Peer }
+
 func NewConnection(peer PeerID, conn *websocket.Conn) *Connection {
 	c := &Connection{
 		Peer: peer,
@@ -97,3 +101,36 @@ func (c *Connection) SendPath(ctx context.Context, path []PeerID) {
 	}
 }
 
+type outboundPeers struct {
+	Type  string     `json:"type"`
+	Peers []PeerInfo `json:"peers"`
+}
+
+// SendPEX delivers a gossiped peer sample to this connection, analogous to
+// SendPath.
+func (c *Connection) SendPEX(ctx context.Context, peers []PeerInfo) {
+	payload, err := json.Marshal(outboundPeers{
+		Type:  "pex_peers",
+		Peers: peers,
+	})
+	if err != nil {
+		log.Printf("marshal pex peers: %v", err)
+		return
+	}
+	select {
+	case c.Send <- payload:
+	case <-ctx.Done():
+	}
+}
+
+// SendRaw delivers an already-encoded message straight through, for
+// Hub.Relay's point-to-point message types (offer/answer/ice-candidate/
+// path-response), which the Hub builds generically rather than via a
+// typed outboundX struct like SendPath/SendPEX.
+func (c *Connection) SendRaw(ctx context.Context, payload []byte) {
+	select {
+	case c.Send <- payload:
+	case <-ctx.Done():
+	}
+}
+
@@ -1,10 +1,15 @@
 package signalling
 
 import (
+	"container/heap"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
 	"sync"
+	"time"
 )
 
 type PeerID string
@@ -25,30 +30,69 @@ type PathRequest struct {
 
 type PathResponse struct {
 	Path []PeerID
+	// Cost is the total weighted edge cost along Path, as used by
+	// KShortestPaths to rank candidates. ShortestPath leaves it zero since
+	// its BFS result is ranked by hop count, not cost.
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// PeerInfo is what gets gossiped between peers via PEX: just enough to let
+// the recipient decide whether to dial in, without round-tripping through
+// the tracker.
+type PeerInfo struct {
+	Peer     PeerID         `json:"peer"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// pexSampleSize caps how many peers a single pex_request response returns.
+// pexMinInterval rate-limits how often a given peer may receive a PEX
+// response, so a chatty client can't turn gossip into a poll loop.
+const (
+	pexSampleSize  = 25
+	pexMinInterval = 60 * time.Second
+)
+
+// Conn is what the Hub needs from a connection: an identity plus push
+// methods for path and PEX results. *Connection satisfies it, and so does
+// mocknet's in-memory connection, so a Hub can be driven by tests without
+// a real WebSocket.
+type Conn interface {
+	PeerID() PeerID
+	SendPath(ctx context.Context, path []PeerID)
+	SendPEX(ctx context.Context, peers []PeerInfo)
+	SendRaw(ctx context.Context, payload []byte)
 }
 
 type Hub struct {
-	mu        sync.RWMutex
-	rooms     map[string]map[PeerID]*Connection
-	graph     map[PeerID]map[PeerID]struct{}
-	roomGraph map[string]map[PeerID]map[PeerID]struct{}
+	mu            sync.RWMutex
+	rooms         map[string]map[PeerID]Conn
+	graph         map[PeerID]map[PeerID]struct{}
+	roomGraph     map[string]map[PeerID]map[PeerID]struct{}
+	roomPeers     map[string]map[PeerID]PeerInfo
+	lastPEXSent   map[string]map[PeerID]time.Time
+	roomWebseeds  map[string]map[PeerID]string             // room -> webseed peer -> HTTP base URL
+	iceCandidates map[string]map[PeerID][]json.RawMessage  // room -> trickling peer -> candidates sent so far
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		rooms:     make(map[string]map[PeerID]*Connection),
-		graph:     make(map[PeerID]map[PeerID]struct{}),
-		roomGraph: make(map[string]map[PeerID]map[PeerID]struct{}),
+		rooms:         make(map[string]map[PeerID]Conn),
+		graph:         make(map[PeerID]map[PeerID]struct{}),
+		roomGraph:     make(map[string]map[PeerID]map[PeerID]struct{}),
+		roomPeers:     make(map[string]map[PeerID]PeerInfo),
+		lastPEXSent:   make(map[string]map[PeerID]time.Time),
+		roomWebseeds:  make(map[string]map[PeerID]string),
+		iceCandidates: make(map[string]map[PeerID][]json.RawMessage),
 	}
 }
 
-func (h *Hub) Register(room string, conn *Connection) {
+func (h *Hub) Register(room string, conn Conn) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if _, ok := h.rooms[room]; !ok {
-		h.rooms[room] = make(map[PeerID]*Connection)
+		h.rooms[room] = make(map[PeerID]Conn)
 	}
-	h.rooms[room][conn.Peer] = conn
+	h.rooms[room][conn.PeerID()] = conn
 }
 
 func (h *Hub) Unregister(room string, peer PeerID) {
@@ -60,6 +104,18 @@ func (h *Hub) Unregister(room string, peer PeerID) {
 			delete(h.rooms, room)
 		}
 	}
+	if peers, ok := h.roomPeers[room]; ok {
+		delete(peers, peer)
+	}
+	if sent, ok := h.lastPEXSent[room]; ok {
+		delete(sent, peer)
+	}
+	if webseeds, ok := h.roomWebseeds[room]; ok {
+		delete(webseeds, peer)
+	}
+	if candidates, ok := h.iceCandidates[room]; ok {
+		delete(candidates, peer)
+	}
 	delete(h.graph, peer)
 	for _, neighbors := range h.graph {
 		delete(neighbors, peer)
@@ -102,6 +158,16 @@ func (h *Hub) Announce(room string, ann Announcement) {
 	for _, neighbor := range ann.Neighbors {
 		h.addUndirectedEdge(roomGraph, ann.Peer, neighbor)
 	}
+	// Webseeds always advertise 100% availability, so every announcing
+	// peer gets a direct edge to each one already known in the room.
+	for webseed := range h.roomWebseeds[room] {
+		h.addUndirectedEdge(roomGraph, ann.Peer, webseed)
+	}
+
+	if _, ok := h.roomPeers[room]; !ok {
+		h.roomPeers[room] = make(map[PeerID]PeerInfo)
+	}
+	h.roomPeers[room][ann.Peer] = PeerInfo{Peer: ann.Peer, Metadata: ann.Metadata}
 }
 
 func (h *Hub) addUndirectedEdge(g map[PeerID]map[PeerID]struct{}, a, b PeerID) {
@@ -183,3 +249,474 @@ func (h *Hub) BroadcastPath(ctx context.Context, room string, path []PeerID) err
 	return nil
 }
 
+// defaultEdgeCost is the traversal cost assigned to a hop when neither
+// endpoint's Announcement.Metadata carries an "rtt" sample - mirrors
+// internal/topology.Graph's defaultEdgeWeight fallback for unmeasured
+// links, so an unmeasured hop is still traversable but never preferred
+// over a measured cheap one.
+const defaultEdgeCost = 50.0
+
+// metadataFloat reads key out of meta as a float64, accepting the numeric
+// types encoding/json can produce (float64 from a parsed request body,
+// plain int from a value built in Go code).
+func metadataFloat(meta map[string]any, key string) (float64, bool) {
+	v, ok := meta[key]
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// edgeCost derives the cost of traversing a<->b from whichever endpoint's
+// Announcement.Metadata carries an "rtt" (milliseconds) and "bandwidth"
+// (Mbps) sample: higher bandwidth discounts the RTT cost, so a slower but
+// fatter link can beat a low-latency but congested one. A hop with no
+// metadata on either end falls back to defaultEdgeCost.
+func edgeCost(peers map[PeerID]PeerInfo, a, b PeerID) float64 {
+	total := 0.0
+	samples := 0
+	for _, id := range [2]PeerID{a, b} {
+		info, ok := peers[id]
+		if !ok {
+			continue
+		}
+		rtt, hasRTT := metadataFloat(info.Metadata, "rtt")
+		if !hasRTT {
+			continue
+		}
+		if bw, hasBW := metadataFloat(info.Metadata, "bandwidth"); hasBW && bw > 0 {
+			rtt = rtt / (1 + bw/100)
+		}
+		total += rtt
+		samples++
+	}
+	if samples == 0 {
+		return defaultEdgeCost
+	}
+	return total / float64(samples)
+}
+
+// pathQueueItem and pathQueue implement a container/heap min-heap over
+// (peer, dist) pairs, the same shape as internal/topology.Graph's
+// dijkstraQueue, adapted to PeerID keys.
+type pathQueueItem struct {
+	peer PeerID
+	dist float64
+}
+
+type pathQueue []pathQueueItem
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)        { *q = append(*q, x.(pathQueueItem)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+// pathCandidateQueue is a container/heap min-heap over candidate
+// PathResponses ordered by Cost, the structure KShortestPaths pops the
+// next-cheapest spur from.
+type pathCandidateQueue []PathResponse
+
+func (q pathCandidateQueue) Len() int           { return len(q) }
+func (q pathCandidateQueue) Less(i, j int) bool { return q[i].Cost < q[j].Cost }
+func (q pathCandidateQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathCandidateQueue) Push(x any)        { *q = append(*q, x.(PathResponse)) }
+func (q *pathCandidateQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+// dijkstraPath computes the minimum weighted-cost path from start to goal
+// over graph, skipping any node in excludeNodes and any edge in
+// excludeEdges. It's the weighted building block both KShortestPaths'
+// Yen's-algorithm spur search and the first-path call underneath it use.
+func dijkstraPath(graph map[PeerID]map[PeerID]struct{}, peers map[PeerID]PeerInfo, start, goal PeerID, excludeNodes map[PeerID]struct{}, excludeEdges map[[2]PeerID]struct{}) (PathResponse, bool) {
+	dist := map[PeerID]float64{start: 0}
+	prev := map[PeerID]PeerID{}
+	visited := map[PeerID]struct{}{}
+
+	pq := &pathQueue{{peer: start, dist: 0}}
+	heap.Init(pq)
+	for pq.Len() > 0 {
+		cur := heap.Pop(pq).(pathQueueItem)
+		if _, done := visited[cur.peer]; done {
+			continue
+		}
+		visited[cur.peer] = struct{}{}
+		if cur.peer == goal {
+			break
+		}
+		for neighbor := range graph[cur.peer] {
+			if _, excluded := excludeNodes[neighbor]; excluded {
+				continue
+			}
+			if _, excluded := excludeEdges[[2]PeerID{cur.peer, neighbor}]; excluded {
+				continue
+			}
+			if _, done := visited[neighbor]; done {
+				continue
+			}
+			next := cur.dist + edgeCost(peers, cur.peer, neighbor)
+			if existing, ok := dist[neighbor]; !ok || next < existing {
+				dist[neighbor] = next
+				prev[neighbor] = cur.peer
+				heap.Push(pq, pathQueueItem{peer: neighbor, dist: next})
+			}
+		}
+	}
+
+	finalDist, ok := dist[goal]
+	if !ok {
+		return PathResponse{}, false
+	}
+	path := []PeerID{goal}
+	for cur := goal; cur != start; {
+		p, ok := prev[cur]
+		if !ok {
+			return PathResponse{}, false
+		}
+		path = append(path, p)
+		cur = p
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return PathResponse{Path: path, Cost: finalDist}, true
+}
+
+// pathCost sums edgeCost along consecutive pairs of path.
+func pathCost(peers map[PeerID]PeerInfo, path []PeerID) float64 {
+	total := 0.0
+	for i := 0; i < len(path)-1; i++ {
+		total += edgeCost(peers, path[i], path[i+1])
+	}
+	return total
+}
+
+// sharesPrefix reports whether path starts with exactly the peers in root.
+func sharesPrefix(path, root []PeerID) bool {
+	if len(path) < len(root) {
+		return false
+	}
+	for i, p := range root {
+		if path[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+// pathKey turns a path into a comparable string, so KShortestPaths can
+// de-duplicate candidate spurs that land back on a path it already found.
+func pathKey(path []PeerID) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = string(p)
+	}
+	return strings.Join(parts, ">")
+}
+
+// KShortestPaths returns up to k loopless paths from from to to in room,
+// ranked by ascending total edge cost (see edgeCost), using Yen's
+// algorithm on top of the weighted shortest path above: the first result
+// is the plain shortest path; each later one is the cheapest spur found
+// by, for every node along the previous result, excluding the edge any
+// already-found path used leaving that same prefix (so Yen never re-offers
+// a path sharing both a prefix and its next hop) and the prefix's own
+// nodes (so a spur can't loop back through ground it already covers).
+// Candidate spurs are kept in a cost-ordered min-heap; the cheapest is
+// promoted into the result list each round until k paths are produced or
+// the heap runs dry.
+func (h *Hub) KShortestPaths(room string, from, to PeerID, k int) ([]PathResponse, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if k <= 0 {
+		return nil, errors.New("k must be positive")
+	}
+
+	graph := h.graph
+	if roomGraph, ok := h.roomGraph[room]; ok && len(roomGraph) > 0 {
+		graph = roomGraph
+	}
+	peers := h.roomPeers[room]
+
+	_, okFrom := graph[from]
+	_, okTo := graph[to]
+	if !okFrom || !okTo {
+		return nil, fmt.Errorf("unknown peer(s) in room %s", room)
+	}
+
+	first, ok := dijkstraPath(graph, peers, from, to, nil, nil)
+	if !ok {
+		return nil, errors.New("no path available")
+	}
+
+	results := []PathResponse{first}
+	candidates := &pathCandidateQueue{}
+	heap.Init(candidates)
+	seen := map[string]struct{}{pathKey(first.Path): {}}
+
+	for len(results) < k {
+		prev := results[len(results)-1]
+		for i := 0; i < len(prev.Path)-1; i++ {
+			spurNode := prev.Path[i]
+			rootPath := append([]PeerID(nil), prev.Path[:i+1]...)
+
+			excludeEdges := map[[2]PeerID]struct{}{}
+			for _, r := range results {
+				if sharesPrefix(r.Path, rootPath) && len(r.Path) > i+1 {
+					excludeEdges[[2]PeerID{r.Path[i], r.Path[i+1]}] = struct{}{}
+				}
+			}
+			excludeNodes := map[PeerID]struct{}{}
+			for _, n := range rootPath[:len(rootPath)-1] {
+				excludeNodes[n] = struct{}{}
+			}
+
+			spur, ok := dijkstraPath(graph, peers, spurNode, to, excludeNodes, excludeEdges)
+			if !ok {
+				continue
+			}
+			total := PathResponse{
+				Path: append(append([]PeerID(nil), rootPath[:len(rootPath)-1]...), spur.Path...),
+				Cost: pathCost(peers, rootPath) + spur.Cost,
+			}
+			key := pathKey(total.Path)
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			heap.Push(candidates, total)
+		}
+
+		if candidates.Len() == 0 {
+			break
+		}
+		results = append(results, heap.Pop(candidates).(PathResponse))
+	}
+
+	return results, nil
+}
+
+// BroadcastMultipath pushes each of paths down only the connections that
+// sit on that specific path, unlike BroadcastPath which sends its one
+// path to every peer on it - a peer fetching disjoint segment ranges over
+// several parallel routes should see only the route it's actually part
+// of.
+func (h *Hub) BroadcastMultipath(ctx context.Context, room string, paths []PathResponse) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	conns, ok := h.rooms[room]
+	if !ok {
+		return fmt.Errorf("room %s not found", room)
+	}
+	for _, path := range paths {
+		for _, peer := range path.Path {
+			conn, ok := conns[peer]
+			if !ok {
+				continue
+			}
+			conn.SendPath(ctx, path.Path)
+		}
+	}
+	return nil
+}
+
+// Relay forwards payload to exactly one peer in room, for message types -
+// a path-response answering one peer's request_path, and the underlying
+// delivery for Offer/Answer/ICECandidate below - that always address a
+// single recipient rather than every peer on a path (BroadcastPath) or
+// the room at large.
+func (h *Hub) Relay(ctx context.Context, room string, to PeerID, payload json.RawMessage) error {
+	h.mu.RLock()
+	conn, ok := h.rooms[room][to]
+	h.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("peer %s not found in room %s", to, room)
+	}
+	conn.SendRaw(ctx, payload)
+	return nil
+}
+
+// Offer relays from's WebRTC SDP offer to to within room, the first leg
+// of ICE negotiation between two Connections.
+func (h *Hub) Offer(ctx context.Context, room string, from, to PeerID, payload json.RawMessage) error {
+	return h.Relay(ctx, room, to, payload)
+}
+
+// Answer relays to's WebRTC SDP answer back to the peer that sent the
+// offer.
+func (h *Hub) Answer(ctx context.Context, room string, from, to PeerID, payload json.RawMessage) error {
+	return h.Relay(ctx, room, to, payload)
+}
+
+// ICECandidate relays a trickled ICE candidate from peer to its intended
+// recipient and records it in room's candidate pool (see AddICECandidate
+// and ICECandidates) so a peer that joins the room mid-negotiation can
+// still pull what's already been offered instead of waiting on a fresh
+// round of trickling.
+func (h *Hub) ICECandidate(ctx context.Context, room string, from, to PeerID, payload json.RawMessage) error {
+	h.AddICECandidate(room, from, payload)
+	return h.Relay(ctx, room, to, payload)
+}
+
+// AddICECandidate records a trickled ICE candidate from peer in room.
+func (h *Hub) AddICECandidate(room string, peer PeerID, candidate json.RawMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.iceCandidates[room]; !ok {
+		h.iceCandidates[room] = make(map[PeerID][]json.RawMessage)
+	}
+	h.iceCandidates[room][peer] = append(h.iceCandidates[room][peer], candidate)
+}
+
+// ICECandidates returns every candidate peer has trickled in room so
+// far, for a late joiner to pull and catch up on negotiation state it
+// missed.
+func (h *Hub) ICECandidates(room string, peer PeerID) []json.RawMessage {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]json.RawMessage(nil), h.iceCandidates[room][peer]...)
+}
+
+// Topology returns a snapshot of room's adjacency graph (room-scoped if
+// one has been built by Announce/RegisterWebseed, otherwise the global
+// graph, matching ShortestPath's fallback) for the /room/{id}/topology
+// observability endpoint.
+func (h *Hub) Topology(room string) map[PeerID][]PeerID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	graph := h.graph
+	if roomGraph, ok := h.roomGraph[room]; ok && len(roomGraph) > 0 {
+		graph = roomGraph
+	}
+
+	snapshot := make(map[PeerID][]PeerID, len(graph))
+	for peer, neighbors := range graph {
+		ids := make([]PeerID, 0, len(neighbors))
+		for n := range neighbors {
+			ids = append(ids, n)
+		}
+		snapshot[peer] = ids
+	}
+	return snapshot
+}
+
+// RegisterWebseed registers peer as an HTTP webseed (borrowed from the
+// BitTorrent webseed model): a synthetic peer backed by baseURL instead
+// of a signalling connection, always reachable and always available.
+// It's wired into the room's graph with an edge to every peer already
+// known there so it can win ShortestPath queries when no P2P holder
+// exists; future Announce calls from that room also connect to it.
+func (h *Hub) RegisterWebseed(room string, peer PeerID, baseURL string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.roomWebseeds[room]; !ok {
+		h.roomWebseeds[room] = make(map[PeerID]string)
+	}
+	h.roomWebseeds[room][peer] = baseURL
+
+	if _, ok := h.roomGraph[room]; !ok {
+		h.roomGraph[room] = make(map[PeerID]map[PeerID]struct{})
+	}
+	roomGraph := h.roomGraph[room]
+	if _, ok := roomGraph[peer]; !ok {
+		roomGraph[peer] = make(map[PeerID]struct{})
+	}
+	for existing := range roomGraph {
+		if existing == peer {
+			continue
+		}
+		h.addUndirectedEdge(roomGraph, peer, existing)
+	}
+}
+
+// WebseedURL returns the HTTP base URL peer was registered with in room,
+// so a caller resolving a ShortestPath that terminates at a webseed can
+// turn that peer ID back into somewhere to actually fetch from.
+func (h *Hub) WebseedURL(room string, peer PeerID) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	url, ok := h.roomWebseeds[room][peer]
+	return url, ok
+}
+
+// PEXSample returns up to pexSampleSize peers known in room, excluding
+// requester and its already-announced neighbors, so gossip surfaces peers
+// the requester doesn't already know about. It returns ok=false if
+// requester has been sampled within pexMinInterval, so a client can't turn
+// gossip into a poll loop.
+func (h *Hub) PEXSample(room string, requester PeerID, excludeNeighbors []PeerID) (peers []PeerInfo, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.lastPEXSent[room]; !ok {
+		h.lastPEXSent[room] = make(map[PeerID]time.Time)
+	}
+	if last, sent := h.lastPEXSent[room][requester]; sent && time.Since(last) < pexMinInterval {
+		return nil, false
+	}
+	h.lastPEXSent[room][requester] = time.Now()
+
+	exclude := map[PeerID]struct{}{requester: {}}
+	for _, n := range excludeNeighbors {
+		exclude[n] = struct{}{}
+	}
+	known := h.roomPeers[room]
+	candidates := make([]PeerInfo, 0, len(known))
+	for id, info := range known {
+		if _, skip := exclude[id]; skip {
+			continue
+		}
+		candidates = append(candidates, info)
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > pexSampleSize {
+		candidates = candidates[:pexSampleSize]
+	}
+	return candidates, true
+}
+
+// MergePeers folds gossiped peer info into room's known-peer set. Peers
+// already known (announced directly or learned from an earlier pex_add)
+// keep their existing entry, so a stale gossip message can't clobber a
+// fresher direct announcement.
+func (h *Hub) MergePeers(room string, peers []PeerInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.roomPeers[room]; !ok {
+		h.roomPeers[room] = make(map[PeerID]PeerInfo)
+	}
+	known := h.roomPeers[room]
+	for _, p := range peers {
+		if p.Peer == "" {
+			continue
+		}
+		if _, exists := known[p.Peer]; exists {
+			continue
+		}
+		known[p.Peer] = p
+	}
+}
+
@@ -0,0 +1,26 @@
+package signalling
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// TURNCredentials computes short-lived TURN REST API credentials for
+// peer, valid until ttl from now: username is "<expiry-unix>:<peerID>",
+// password is base64(HMAC-SHA1(secret, username)) - the coturn
+// static-auth-secret convention, so any TURN server provisioned with the
+// same secret can verify these without calling back into this service.
+// SHA-1 (rather than this codebase's usual HMAC-SHA256, see
+// internal/tracker.Service.VerifyPeerAuth) is what that convention
+// specifies, not a local choice.
+func TURNCredentials(secret string, peer PeerID, ttl time.Duration) (username, password string) {
+	expiry := time.Now().Add(ttl).Unix()
+	username = fmt.Sprintf("%d:%s", expiry, peer)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	password = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return username, password
+}
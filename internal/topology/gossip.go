@@ -0,0 +1,217 @@
+package topology
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+)
+
+// PeerRecord is the wire shape of one peer's state as exchanged between
+// topology managers: everything Upsert/Remove would otherwise require a
+// central `/peers` POST to apply, plus the LamportClock last-writer-wins
+// is decided on and a TombstoneFlag for peers that have been removed
+// rather than just gone quiet.
+type PeerRecord struct {
+	PeerID       string         `json:"peer_id"`
+	Region       string         `json:"region,omitempty"`
+	RTTms        int            `json:"rtt_ms,omitempty"`
+	Neighbors    []string       `json:"neighbors,omitempty"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	LamportClock uint64         `json:"lamport_clock"`
+	Tombstone    bool           `json:"tombstone,omitempty"`
+}
+
+// changelogCap bounds how many recent PeerRecords Graph keeps around for
+// Gossiper to push; older entries are dropped rather than kept forever,
+// on the assumption that anti-entropy picks up anything a dropped entry
+// would have carried.
+const changelogCap = 512
+
+// recordChangeLocked appends rec to the changelog, trimming the oldest
+// entry once changelogCap is exceeded. Callers must hold g.mu.
+func (g *Graph) recordChangeLocked(rec PeerRecord) {
+	g.changelog = append(g.changelog, rec)
+	if len(g.changelog) > changelogCap {
+		g.changelog = g.changelog[len(g.changelog)-changelogCap:]
+	}
+}
+
+// toRecordLocked snapshots nodeID's current state into a PeerRecord
+// stamped with clock, for forwarding after a local Upsert. Callers must
+// hold g.mu.
+func (g *Graph) toRecordLocked(nodeID string, clock uint64, tombstone bool) PeerRecord {
+	rec := PeerRecord{PeerID: nodeID, LamportClock: clock, Tombstone: tombstone}
+	node, ok := g.nodes[nodeID]
+	if !ok {
+		return rec
+	}
+	rec.Region = node.Region
+	rec.RTTms = node.RTTms
+	if len(node.Neighbors) > 0 {
+		rec.Neighbors = make([]string, 0, len(node.Neighbors))
+		for n := range node.Neighbors {
+			rec.Neighbors = append(rec.Neighbors, n)
+		}
+		sort.Strings(rec.Neighbors)
+	}
+	if len(node.Metadata) > 0 {
+		rec.Metadata = node.Metadata
+	}
+	return rec
+}
+
+// ToRecord returns peerID's current state as a PeerRecord, stamped with
+// its last-applied Lamport clock - the exported, lock-taking counterpart
+// to toRecordLocked for callers outside the package that just want a
+// snapshot of one peer's state, such as a periodic health-delta push.
+func (g *Graph) ToRecord(peerID string) PeerRecord {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.toRecordLocked(peerID, g.peerClock[peerID], false)
+}
+
+// RecentChanges returns up to max of the most recently applied
+// PeerRecords (local or received), newest last - what Gossiper pushes to
+// its fanout sample each round.
+func (g *Graph) RecentChanges(max int) []PeerRecord {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if max <= 0 || max > len(g.changelog) {
+		max = len(g.changelog)
+	}
+	out := make([]PeerRecord, max)
+	copy(out, g.changelog[len(g.changelog)-max:])
+	return out
+}
+
+// ApplyRecord merges rec into the graph using last-writer-wins on
+// rec.LamportClock: a record whose clock doesn't exceed the highest one
+// already seen for that peer (including from a tombstone) is stale and
+// ignored. It reports whether rec actually changed local state, so a
+// gossip receiver knows whether there's anything new worth forwarding
+// on to its own fanout.
+func (g *Graph) ApplyRecord(rec PeerRecord) bool {
+	g.mu.Lock()
+	if existing, ok := g.peerClock[rec.PeerID]; ok && rec.LamportClock <= existing {
+		g.mu.Unlock()
+		return false
+	}
+	before := g.neighborSnapshotLocked(rec.PeerID)
+	g.peerClock[rec.PeerID] = rec.LamportClock
+	if rec.LamportClock > g.clock {
+		g.clock = rec.LamportClock
+	}
+	if rec.Tombstone {
+		g.removeLocked(rec.PeerID)
+	} else {
+		g.upsertLocked(rec.PeerID, rec.Region, rec.RTTms, rec.Neighbors, rec.Metadata)
+	}
+	g.recordChangeLocked(rec)
+	diff := g.diffLocked(rec.PeerID, before)
+	hook := g.onChange
+	g.mu.Unlock()
+	g.fireChange(hook, diff)
+	return true
+}
+
+// merkleDepth is how many bits of a peer's kademliaID address its leaf
+// in the anti-entropy tree, giving 2^merkleDepth leaf buckets. Peers are
+// bucketed by ID prefix rather than by position in a sorted list so two
+// managers with different peer sets still agree on which subtree a given
+// peer falls under - the comparison converges instead of just disagreeing
+// about where the boundaries are.
+const merkleDepth = 8
+
+// MerkleNode is one node of the anti-entropy digest tree, addressed by
+// path (a string of '0'/'1' bits from the root, "" being the root
+// itself). Leaf nodes (len(Path) == merkleDepth) also carry the
+// PeerRecords bucketed under that prefix, so a caller that walks down to
+// a mismatched leaf gets the actual records to reconcile in the same
+// round trip instead of needing a separate pull request.
+type MerkleNode struct {
+	Path    string       `json:"path"`
+	Hash    string       `json:"hash"`
+	Leaf    bool         `json:"leaf"`
+	Records []PeerRecord `json:"records,omitempty"`
+}
+
+// Digest computes the MerkleNode at path (root if path is empty). The
+// whole tree is rebuilt from the current peer table on every call rather
+// than maintained incrementally - cheap at this simulator's scale, and
+// it keeps leaves from drifting out of sync with edits applied between
+// digest calls.
+func (g *Graph) Digest(path string) (MerkleNode, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if len(path) > merkleDepth {
+		return MerkleNode{}, false
+	}
+	for _, b := range path {
+		if b != '0' && b != '1' {
+			return MerkleNode{}, false
+		}
+	}
+
+	buckets := make(map[string][]PeerRecord)
+	for nodeID := range g.nodes {
+		prefix := merklePrefix(nodeID)
+		buckets[prefix] = append(buckets[prefix], g.toRecordLocked(nodeID, g.peerClock[nodeID], false))
+	}
+
+	if len(path) == merkleDepth {
+		records := buckets[path]
+		sort.Slice(records, func(i, j int) bool { return records[i].PeerID < records[j].PeerID })
+		return MerkleNode{Path: path, Hash: leafHash(records), Leaf: true, Records: records}, true
+	}
+
+	hash := subtreeHash(path, buckets)
+	return MerkleNode{Path: path, Hash: hash}, true
+}
+
+// merklePrefix returns the first merkleDepth bits of peerID's
+// kademliaID, as a '0'/'1' string, identifying which leaf bucket it
+// falls under.
+func merklePrefix(peerID string) string {
+	id := hashKademliaID(peerID)
+	bits := make([]byte, merkleDepth)
+	for i := 0; i < merkleDepth; i++ {
+		byteIdx, bitIdx := i/8, 7-(i%8)
+		if id[byteIdx]&(1<<uint(bitIdx)) != 0 {
+			bits[i] = '1'
+		} else {
+			bits[i] = '0'
+		}
+	}
+	return string(bits)
+}
+
+// leafHash combines a leaf bucket's records into one hash, order
+// independent since records is pre-sorted by PeerID.
+func leafHash(records []PeerRecord) string {
+	h := sha1.New()
+	for _, rec := range records {
+		h.Write([]byte(rec.PeerID))
+		var clockBytes [8]byte
+		for i := range clockBytes {
+			clockBytes[i] = byte(rec.LamportClock >> (8 * uint(i)))
+		}
+		h.Write(clockBytes[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// subtreeHash recursively combines the hashes of path's two children
+// into one, down to the leaves.
+func subtreeHash(path string, buckets map[string][]PeerRecord) string {
+	if len(path) == merkleDepth {
+		records := buckets[path]
+		sort.Slice(records, func(i, j int) bool { return records[i].PeerID < records[j].PeerID })
+		return leafHash(records)
+	}
+	left := subtreeHash(path+"0", buckets)
+	right := subtreeHash(path+"1", buckets)
+	h := sha1.New()
+	h.Write([]byte(left))
+	h.Write([]byte(right))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,194 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Gossiper drives epidemic push and anti-entropy pull propagation of
+// PeerRecords across a flat mesh of topology managers, so peer upserts
+// don't all have to land on one central instance: every pushInterval it
+// samples fanout random peers from seedPeers and POSTs them whatever's
+// landed in Graph's changelog since the last round, and every
+// antiEntropyInterval it walks one random peer's Merkle digest tree to
+// pull whatever a push round above dropped (e.g. to packet loss).
+type Gossiper struct {
+	graph  *Graph
+	peers  []string
+	fanout int
+	client *http.Client
+	rand   *rand.Rand
+}
+
+// NewGossiper builds a Gossiper that propagates graph's state to the
+// given seed peer base URLs (e.g. "http://topology-2:8090").
+func NewGossiper(graph *Graph, seedPeers []string, fanout int) *Gossiper {
+	if fanout <= 0 {
+		fanout = 3
+	}
+	peers := make([]string, 0, len(seedPeers))
+	for _, p := range seedPeers {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			peers = append(peers, strings.TrimRight(p, "/"))
+		}
+	}
+	return &Gossiper{
+		graph:  graph,
+		peers:  peers,
+		fanout: fanout,
+		client: &http.Client{Timeout: 3 * time.Second},
+		rand:   rand.New(rand.NewSource(1)),
+	}
+}
+
+// Run blocks, driving push and anti-entropy rounds on their own tickers
+// until ctx is canceled.
+func (g *Gossiper) Run(ctx context.Context, pushInterval, antiEntropyInterval time.Duration) {
+	if len(g.peers) == 0 {
+		return
+	}
+	pushTicker := time.NewTicker(pushInterval)
+	aeTicker := time.NewTicker(antiEntropyInterval)
+	defer pushTicker.Stop()
+	defer aeTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pushTicker.C:
+			g.pushRound(ctx)
+		case <-aeTicker.C:
+			g.antiEntropyRound(ctx)
+		}
+	}
+}
+
+// samplePeers picks up to n distinct peers from g.peers without
+// replacement, same shuffle-then-take shape as Hub.PEXSample.
+func (g *Gossiper) samplePeers(n int) []string {
+	candidates := append([]string(nil), g.peers...)
+	g.rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// pushRound forwards the graph's recent changes to a random fanout
+// sample of peers.
+func (g *Gossiper) pushRound(ctx context.Context) {
+	records := g.graph.RecentChanges(changelogCap)
+	if len(records) == 0 {
+		return
+	}
+	for _, base := range g.samplePeers(g.fanout) {
+		go g.push(ctx, base, records)
+	}
+}
+
+func (g *Gossiper) push(ctx context.Context, base string, records []PeerRecord) {
+	body, err := json.Marshal(records)
+	if err != nil {
+		log.Printf("gossip: marshal push to %s: %v", base, err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/gossip/push", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("gossip: build push request to %s: %v", base, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		log.Printf("gossip: push to %s: %v", base, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// ApplyPush applies a batch of received PeerRecords and reports which of
+// them actually changed local state - what the /gossip/push handler
+// forwards on to this Gossiper's own fanout, so new information keeps
+// spreading outward instead of stopping at the first hop.
+func (g *Gossiper) ApplyPush(ctx context.Context, records []PeerRecord) {
+	var changed []PeerRecord
+	for _, rec := range records {
+		if g.graph.ApplyRecord(rec) {
+			changed = append(changed, rec)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	for _, base := range g.samplePeers(g.fanout) {
+		go g.push(ctx, base, changed)
+	}
+}
+
+// antiEntropyRound reconciles against one random peer's digest tree,
+// starting at the root and only descending into subtrees whose hash
+// disagrees with ours.
+func (g *Gossiper) antiEntropyRound(ctx context.Context) {
+	peers := g.samplePeers(1)
+	if len(peers) == 0 {
+		return
+	}
+	g.reconcile(ctx, peers[0], "")
+}
+
+func (g *Gossiper) reconcile(ctx context.Context, base, path string) {
+	local, ok := g.graph.Digest(path)
+	if !ok {
+		return
+	}
+	remote, err := g.fetchDigest(ctx, base, path)
+	if err != nil {
+		log.Printf("gossip: digest %s from %s: %v", path, base, err)
+		return
+	}
+	if local.Hash == remote.Hash {
+		return
+	}
+	if remote.Leaf {
+		for _, rec := range remote.Records {
+			g.graph.ApplyRecord(rec)
+		}
+		return
+	}
+	g.reconcile(ctx, base, path+"0")
+	g.reconcile(ctx, base, path+"1")
+}
+
+func (g *Gossiper) fetchDigest(ctx context.Context, base, path string) (MerkleNode, error) {
+	url := base + "/gossip/digest"
+	if path != "" {
+		url += "?path=" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return MerkleNode{}, err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return MerkleNode{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return MerkleNode{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var node MerkleNode
+	if err := json.NewDecoder(resp.Body).Decode(&node); err != nil {
+		return MerkleNode{}, err
+	}
+	return node, nil
+}
@@ -1,11 +1,16 @@
 package topology
 
 import (
+	"container/heap"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Node struct {
@@ -16,24 +21,180 @@ type Node struct {
 	Metadata  map[string]any `json:"metadata,omitempty"`
 }
 
+// edgeStats is the measurement state kept for one link, keyed on its
+// endpoints sorted lexically so a-b and b-a share one entry. RTTms is
+// the same smoothed sample setEdge always maintained; BandwidthMbps,
+// LossPct and LastProbed are populated either from an Upsert payload's
+// metadata or by a periodic active probe (see Graph.ProbeEdge), so
+// WeightFunc implementations beyond plain RTT (see EdgeWeight) have
+// something to weigh an edge by.
+type edgeStats struct {
+	RTTms         int
+	BandwidthMbps float64
+	LossPct       float64
+	LastProbed    time.Time
+}
+
 type Graph struct {
 	mu    sync.RWMutex
 	nodes map[string]*Node
+	// edges holds the measurement state of each link; see edgeStats.
+	edges map[[2]string]*edgeStats
+
+	// localID is this topology manager's own position in the 160-bit
+	// Kademlia key space (see kademliaID below). It exists purely so the
+	// manager can keep a k-bucket table of the peers it knows about,
+	// same as any Kademlia node would relative to itself; it isn't a
+	// real peer and never appears in nodes.
+	localID kademliaID
+	// buckets holds localID's k-buckets, indexed by XOR-distance prefix
+	// length from localID (bucket i holds peers whose distance falls in
+	// [2^i, 2^(i+1))). It's the seed shortlist FindNode starts its walk
+	// from; kept in sync with nodes by upsertBucket/removeBucket.
+	buckets map[int][]string
+
+	// clock is this manager's Lamport clock, ticked on every locally
+	// applied change so gossiped PeerRecords from here always carry a
+	// fresh timestamp.
+	clock uint64
+	// peerClock is the highest LamportClock seen for each peer ID,
+	// including tombstoned ones, so a stale record (one that predates a
+	// removal) can't resurrect a peer that's since been tombstoned.
+	peerClock map[string]uint64
+	// changelog is a bounded ring of the most recent PeerRecords applied
+	// (locally or received), in apply order - what Gossiper samples from
+	// to push deltas on to other peers.
+	changelog []PeerRecord
+
+	// onChange, if set, is invoked with the GraphDiff produced by each
+	// applied mutation - local Upsert/Remove or an applied gossip
+	// PeerRecord - always after g.mu has been released. See OnChange.
+	onChange ChangeHook
 }
 
 func NewGraph() *Graph {
 	return &Graph{
-		nodes: make(map[string]*Node),
+		nodes:     make(map[string]*Node),
+		edges:     make(map[[2]string]*edgeStats),
+		localID:   hashKademliaID("topology-manager"),
+		buckets:   make(map[int][]string),
+		peerClock: make(map[string]uint64),
 	}
 }
 
-func (g *Graph) Upsert(nodeID string, region string, rtt int, neighbors []string, metadata map[string]any) {
+func edgeKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// setEdge records rtt as the cost of the a-b link if it's the first
+// measurement seen for that pair, or averages it in with the existing
+// one otherwise - a single peer's RTTms is a noisy proxy for per-edge
+// cost, so we smooth it rather than overwrite. bandwidthMbps and lossPct
+// are only applied if positive, since not every caller (e.g. a plain
+// peer upsert with no bandwidth metadata) has a sample for them.
+func (g *Graph) setEdge(a, b string, rtt int, bandwidthMbps, lossPct float64) {
+	if rtt <= 0 || a == b {
+		return
+	}
+	key := edgeKey(a, b)
+	stats, ok := g.edges[key]
+	if !ok {
+		stats = &edgeStats{}
+		g.edges[key] = stats
+	}
+	if stats.RTTms == 0 {
+		stats.RTTms = rtt
+	} else {
+		stats.RTTms = (stats.RTTms + rtt) / 2
+	}
+	if bandwidthMbps > 0 {
+		stats.BandwidthMbps = bandwidthMbps
+	}
+	if lossPct > 0 {
+		stats.LossPct = lossPct
+	}
+	stats.LastProbed = time.Now()
+}
+
+// metadataFloat reads key out of meta as a float64, accepting the
+// numeric types encoding/json can produce (float64 from a parsed
+// request body, plain int from a value built in Go code) - mirrors
+// internal/signalling's metadataFloat helper.
+func metadataFloat(meta map[string]any, key string) (float64, bool) {
+	v, ok := meta[key]
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// ProbeEdge records the result of an active measurement of the a-b link,
+// separate from Upsert's peer-level RTT sample since a probe targets one
+// specific edge rather than a node's overall RTT. Periodic probing is
+// left to the caller (see cmd/topology's probeLoop); ProbeEdge just
+// applies whatever the probe found.
+func (g *Graph) ProbeEdge(a, b string, rttMs int, bandwidthMbps, lossPct float64) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.setEdge(a, b, rttMs, bandwidthMbps, lossPct)
+}
+
+// EdgeStats returns the last-known RTT, bandwidth and loss samples for
+// the a-b link, if any have been recorded.
+func (g *Graph) EdgeStats(a, b string) (rttMs int, bandwidthMbps, lossPct float64, ok bool) {
+	stats, found := g.edgeSnapshot(a, b)
+	if !found {
+		return 0, 0, 0, false
+	}
+	return stats.RTTms, stats.BandwidthMbps, stats.LossPct, true
+}
+
+// edgeSnapshot copies the a-b link's edgeStats under a read lock, so
+// WeightFunc implementations can read it without holding g.mu for the
+// duration of a Dijkstra run.
+func (g *Graph) edgeSnapshot(a, b string) (edgeStats, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	stats, ok := g.edges[edgeKey(a, b)]
+	if !ok {
+		return edgeStats{}, false
+	}
+	return *stats, true
+}
+
+func (g *Graph) Upsert(nodeID string, region string, rtt int, neighbors []string, metadata map[string]any) {
+	g.mu.Lock()
+	before := g.neighborSnapshotLocked(nodeID)
+	g.upsertLocked(nodeID, region, rtt, neighbors, metadata)
+	g.clock++
+	g.peerClock[nodeID] = g.clock
+	g.recordChangeLocked(g.toRecordLocked(nodeID, g.clock, false))
+	diff := g.diffLocked(nodeID, before)
+	hook := g.onChange
+	g.mu.Unlock()
+	g.fireChange(hook, diff)
+}
+
+// upsertLocked does the actual node/edge bookkeeping for Upsert and
+// ApplyRecord alike; callers must hold g.mu for writing and are
+// responsible for bumping g.clock and recording the change themselves,
+// since ApplyRecord's record carries the sender's clock rather than a
+// freshly minted local one.
+func (g *Graph) upsertLocked(nodeID string, region string, rtt int, neighbors []string, metadata map[string]any) {
 	node, ok := g.nodes[nodeID]
 	if !ok {
 		node = &Node{ID: nodeID, Neighbors: make(map[string]struct{})}
 		g.nodes[nodeID] = node
+		g.upsertBucket(nodeID)
 	}
 	if region != "" {
 		node.Region = region
@@ -55,6 +216,8 @@ func (g *Graph) Upsert(nodeID string, region string, rtt int, neighbors []string
 		node.Neighbors = make(map[string]struct{})
 	}
 	
+	bandwidthMbps, _ := metadataFloat(metadata, "bandwidth_mbps")
+	lossPct, _ := metadataFloat(metadata, "loss_pct")
 	for _, neighbor := range neighbors {
 		neighbor = strings.TrimSpace(neighbor)
 		if neighbor == "" || neighbor == nodeID {
@@ -62,7 +225,8 @@ func (g *Graph) Upsert(nodeID string, region string, rtt int, neighbors []string
 		}
 		// Add neighbor to this node
 		node.Neighbors[neighbor] = struct{}{}
-		
+		g.setEdge(nodeID, neighbor, rtt, bandwidthMbps, lossPct)
+
 		// Create bidirectional link if neighbor exists
 		other, ok := g.nodes[neighbor]
 		if ok {
@@ -90,11 +254,125 @@ func (g *Graph) Upsert(nodeID string, region string, rtt int, neighbors []string
 
 func (g *Graph) Remove(peerID string) {
 	g.mu.Lock()
-	defer g.mu.Unlock()
+	before := g.neighborSnapshotLocked(peerID)
+	g.removeLocked(peerID)
+	g.clock++
+	g.peerClock[peerID] = g.clock
+	g.recordChangeLocked(PeerRecord{PeerID: peerID, LamportClock: g.clock, Tombstone: true})
+	diff := g.diffLocked(peerID, before)
+	hook := g.onChange
+	g.mu.Unlock()
+	g.fireChange(hook, diff)
+}
+
+// removeLocked does the actual node/edge/bucket teardown for Remove and
+// a tombstoning ApplyRecord alike; callers must hold g.mu for writing.
+func (g *Graph) removeLocked(peerID string) {
 	delete(g.nodes, peerID)
 	for _, node := range g.nodes {
 		delete(node.Neighbors, peerID)
 	}
+	for key := range g.edges {
+		if key[0] == peerID || key[1] == peerID {
+			delete(g.edges, key)
+		}
+	}
+	g.removeBucket(peerID)
+}
+
+// GraphDiff is the incremental change produced by one Upsert/Remove (or
+// an applied gossip PeerRecord) - what a ChangeHook (see OnChange) fans
+// out to live viewers, so a subscriber like StreamHub can push just what
+// changed instead of making every viewer re-fetch the whole Snapshot.
+type GraphDiff struct {
+	AddedNodes     []string              `json:"added_nodes,omitempty"`
+	RemovedNodes   []string              `json:"removed_nodes,omitempty"`
+	AddedEdges     [][2]string           `json:"added_edges,omitempty"`
+	RemovedEdges   [][2]string           `json:"removed_edges,omitempty"`
+	UpdatedMetrics map[string]PeerRecord `json:"updated_metrics,omitempty"`
+}
+
+// Empty reports whether diff carries no changes at all, so a ChangeHook
+// subscriber can skip broadcasting a no-op.
+func (d GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.UpdatedMetrics) == 0
+}
+
+// ChangeHook is notified of every GraphDiff a mutation produces, always
+// after g.mu has been released - sync.RWMutex isn't reentrant, and a hook
+// is free to call back into Graph (e.g. to read NodeRegion while
+// filtering). See OnChange.
+type ChangeHook func(GraphDiff)
+
+// OnChange registers hook to be called with the GraphDiff from every
+// subsequent Upsert, Remove, or applied gossip PeerRecord. Only one hook
+// is kept - StreamHub is the only intended caller - so a second OnChange
+// call replaces whatever was registered before it.
+func (g *Graph) OnChange(hook ChangeHook) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onChange = hook
+}
+
+// fireChange calls hook with diff, skipping a nil hook or an empty diff.
+// Mutation methods grab hook and diff under g.mu, then call this after
+// unlocking so the hook never runs while the lock is held.
+func (g *Graph) fireChange(hook ChangeHook, diff GraphDiff) {
+	if hook == nil || diff.Empty() {
+		return
+	}
+	hook(diff)
+}
+
+// neighborSnapshotLocked copies nodeID's current neighbor set, or nil if
+// it isn't a known node - the "before" half of diffLocked's before/after
+// comparison. Callers must hold g.mu.
+func (g *Graph) neighborSnapshotLocked(nodeID string) map[string]struct{} {
+	node, ok := g.nodes[nodeID]
+	if !ok {
+		return nil
+	}
+	out := make(map[string]struct{}, len(node.Neighbors))
+	for n := range node.Neighbors {
+		out[n] = struct{}{}
+	}
+	return out
+}
+
+// diffLocked compares nodeID's neighbor set before a mutation (before)
+// against its state now, producing the GraphDiff a ChangeHook sees.
+// before == nil with nodeID now present means the node was just added;
+// nodeID now absent means it was just removed. Callers must hold g.mu.
+func (g *Graph) diffLocked(nodeID string, before map[string]struct{}) GraphDiff {
+	node, exists := g.nodes[nodeID]
+	var diff GraphDiff
+	switch {
+	case exists && before == nil:
+		diff.AddedNodes = []string{nodeID}
+	case !exists && before != nil:
+		diff.RemovedNodes = []string{nodeID}
+	}
+	after := map[string]struct{}{}
+	if exists {
+		for n := range node.Neighbors {
+			after[n] = struct{}{}
+		}
+	}
+	for n := range after {
+		if _, had := before[n]; !had {
+			diff.AddedEdges = append(diff.AddedEdges, edgeKey(nodeID, n))
+		}
+	}
+	for n := range before {
+		if _, has := after[n]; !has {
+			diff.RemovedEdges = append(diff.RemovedEdges, edgeKey(nodeID, n))
+		}
+	}
+	if exists {
+		diff.UpdatedMetrics = map[string]PeerRecord{nodeID: g.toRecordLocked(nodeID, g.peerClock[nodeID], false)}
+	}
+	return diff
 }
 
 func (g *Graph) Snapshot() map[string][]string {
@@ -111,6 +389,64 @@ func (g *Graph) Snapshot() map[string][]string {
 	return out
 }
 
+// NodeRegion returns nodeID's recorded region, if it's a known node with
+// one set.
+func (g *Graph) NodeRegion(nodeID string) (string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	node, ok := g.nodes[nodeID]
+	if !ok || node.Region == "" {
+		return "", false
+	}
+	return node.Region, true
+}
+
+// NodesInRegion returns every known node ID whose region is region.
+func (g *Graph) NodesInRegion(region string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []string
+	for id, node := range g.nodes {
+		if node.Region == region {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// WithinHops returns every node ID reachable from any of roots within
+// depth hops (inclusive of roots themselves) - the neighborhood a
+// StreamHub subscription filter uses to decide which nodes a ?region=&
+// depth= viewer cares about.
+func (g *Graph) WithinHops(roots []string, depth int) map[string]struct{} {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make(map[string]struct{}, len(roots))
+	frontier := make([]string, 0, len(roots))
+	for _, r := range roots {
+		if _, ok := g.nodes[r]; !ok {
+			continue
+		}
+		if _, seen := out[r]; !seen {
+			out[r] = struct{}{}
+			frontier = append(frontier, r)
+		}
+	}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, id := range frontier {
+			for neighbor := range g.nodes[id].Neighbors {
+				if _, seen := out[neighbor]; !seen {
+					out[neighbor] = struct{}{}
+					next = append(next, neighbor)
+				}
+			}
+		}
+		frontier = next
+	}
+	return out
+}
+
 func (g *Graph) BFS(from, to string) ([]string, error) {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
@@ -145,8 +481,292 @@ func (g *Graph) BFS(from, to string) ([]string, error) {
 	return nil, fmt.Errorf("no path between %s and %s", from, to)
 }
 
+// defaultEdgeWeight is used for links with no recorded RTT sample yet,
+// so unmeasured hops are still traversable but never preferred over a
+// measured cheap one.
+const defaultEdgeWeight = 50.0
+
+// EdgeWeight returns the cumulative RTT cost recorded for the a-b link,
+// or defaultEdgeWeight if no sample has been recorded.
+func (g *Graph) EdgeWeight(a, b string) float64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if stats, ok := g.edges[edgeKey(a, b)]; ok && stats.RTTms > 0 {
+		return float64(stats.RTTms)
+	}
+	return defaultEdgeWeight
+}
+
+type dijkstraItem struct {
+	id   string
+	dist float64
+}
+
+type dijkstraQueue []dijkstraItem
+
+func (q dijkstraQueue) Len() int            { return len(q) }
+func (q dijkstraQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q dijkstraQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *dijkstraQueue) Push(x interface{}) { *q = append(*q, x.(dijkstraItem)) }
+func (q *dijkstraQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+// Dijkstra computes shortest-path cost from `from` to every reachable
+// node, using weight(a, b) as the cost of each edge. It returns the
+// cumulative distance and the predecessor on the shortest path for
+// each reached node, so callers can both rank candidates by cost and
+// reconstruct the path if needed.
+//
+// The graph is snapshotted under a read lock up front so weight (which
+// may itself be g.EdgeWeight, taking the same lock) can be called
+// freely while the algorithm runs.
+func (g *Graph) Dijkstra(from string, weight func(a, b string) float64) (map[string]float64, map[string]string) {
+	adjacency, ok := g.snapshotAdjacency(from)
+	dist := map[string]float64{from: 0}
+	prev := map[string]string{}
+	if !ok {
+		return dist, prev
+	}
+
+	visited := make(map[string]struct{}, len(adjacency))
+	pq := &dijkstraQueue{{id: from, dist: 0}}
+	heap.Init(pq)
+	for pq.Len() > 0 {
+		cur := heap.Pop(pq).(dijkstraItem)
+		if _, done := visited[cur.id]; done {
+			continue
+		}
+		visited[cur.id] = struct{}{}
+		for neighbor := range adjacency[cur.id] {
+			if _, done := visited[neighbor]; done {
+				continue
+			}
+			next := cur.dist + weight(cur.id, neighbor)
+			if existing, ok := dist[neighbor]; !ok || next < existing {
+				dist[neighbor] = next
+				prev[neighbor] = cur.id
+				heap.Push(pq, dijkstraItem{id: neighbor, dist: next})
+			}
+		}
+	}
+	return dist, prev
+}
+
+// snapshotAdjacency copies the neighbor sets of every node under a read
+// lock, returning false if from isn't a known node.
+func (g *Graph) snapshotAdjacency(from string) (map[string]map[string]struct{}, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if _, ok := g.nodes[from]; !ok {
+		return nil, false
+	}
+	adjacency := make(map[string]map[string]struct{}, len(g.nodes))
+	for id, node := range g.nodes {
+		neighbors := make(map[string]struct{}, len(node.Neighbors))
+		for n := range node.Neighbors {
+			neighbors[n] = struct{}{}
+		}
+		adjacency[id] = neighbors
+	}
+	return adjacency, true
+}
+
 func WriteJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(payload)
 }
+
+// kademliaID is a 160-bit Kademlia key: a plain SHA-1 digest, kept as a
+// fixed-size array so it's cheap to XOR and compare. Both peer IDs and
+// segment IDs hash into this same space (see FindNode), so a routing
+// decision service can use it to locate the peers "responsible" for a
+// segment the same way it locates a specific peer.
+type kademliaID [sha1.Size]byte
+
+func hashKademliaID(s string) kademliaID {
+	return sha1.Sum([]byte(s))
+}
+
+// xorDistance is the Kademlia metric: the two IDs' bytes XORed together,
+// read as a big-endian integer so "closer" just means "smaller".
+func xorDistance(a, b kademliaID) *big.Int {
+	var x [sha1.Size]byte
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+	return new(big.Int).SetBytes(x[:])
+}
+
+// bucketIndex returns which of self's 160 k-buckets other belongs in:
+// bucket i holds peers whose distance is in [2^i, 2^(i+1)). A distance
+// of zero (other == self) has no bucket; callers skip that case.
+func bucketIndex(self, other kademliaID) int {
+	dist := xorDistance(self, other)
+	if dist.Sign() == 0 {
+		return -1
+	}
+	return dist.BitLen() - 1
+}
+
+// kBucketSize is the bucket capacity / FindNode fan-in (k, in Kademlia
+// terms). lookupAlpha is the lookup parallelism: how many closest
+// not-yet-queried peers get asked per round of FindNode's iterative
+// walk. Both are the standard Kademlia paper's defaults.
+const (
+	kBucketSize = 20
+	lookupAlpha = 3
+)
+
+// upsertBucket places nodeID in the bucket for its distance from
+// localID, dropping it if that bucket is already at kBucketSize
+// entries. Must be called with g.mu held for writing.
+func (g *Graph) upsertBucket(nodeID string) {
+	idx := bucketIndex(g.localID, hashKademliaID(nodeID))
+	if idx < 0 {
+		return
+	}
+	bucket := g.buckets[idx]
+	for _, existing := range bucket {
+		if existing == nodeID {
+			return
+		}
+	}
+	if len(bucket) >= kBucketSize {
+		return
+	}
+	g.buckets[idx] = append(bucket, nodeID)
+}
+
+// removeBucket drops nodeID from whichever bucket holds it, if any.
+// Must be called with g.mu held for writing.
+func (g *Graph) removeBucket(nodeID string) {
+	idx := bucketIndex(g.localID, hashKademliaID(nodeID))
+	if idx < 0 {
+		return
+	}
+	bucket := g.buckets[idx]
+	for i, existing := range bucket {
+		if existing == nodeID {
+			g.buckets[idx] = append(bucket[:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// closestN sorts candidates by distance to target and returns the n
+// closest, deduplicated.
+func closestN(candidates []string, target kademliaID, n int) []string {
+	seen := make(map[string]struct{}, len(candidates))
+	unique := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if _, ok := seen[c]; !ok {
+			seen[c] = struct{}{}
+			unique = append(unique, c)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return xorDistance(hashKademliaID(unique[i]), target).Cmp(xorDistance(hashKademliaID(unique[j]), target)) < 0
+	})
+	if len(unique) > n {
+		unique = unique[:n]
+	}
+	return unique
+}
+
+// FindNode returns the k peers in the graph closest to target by XOR
+// distance. target is usually a peer ID, but since peer IDs and segment
+// IDs hash into the same key space, a routing decision service can just
+// as well pass a segment ID to find the peers "responsible" for it,
+// rather than doing a flat region-based scan.
+//
+// The walk is iterative and alpha-parallel in the Kademlia sense: it
+// seeds its shortlist from the manager's own k-buckets, then repeatedly
+// "queries" the alpha closest not-yet-queried peers in the shortlist by
+// looking at their real graph neighbors (standing in for the contacts a
+// live FIND_NODE RPC would return), folding any closer peers it
+// discovers back into the shortlist. It stops once a round turns up
+// nothing closer than what's already in the shortlist.
+func (g *Graph) FindNode(target string, k int) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if k <= 0 {
+		k = kBucketSize
+	}
+	targetID := hashKademliaID(target)
+
+	seeds := make([]string, 0, len(g.buckets)*kBucketSize)
+	for _, bucket := range g.buckets {
+		seeds = append(seeds, bucket...)
+	}
+	shortlist := closestN(seeds, targetID, k)
+
+	queried := make(map[string]struct{}, len(g.nodes))
+	for {
+		batch := make([]string, 0, lookupAlpha)
+		for _, id := range shortlist {
+			if _, done := queried[id]; done {
+				continue
+			}
+			batch = append(batch, id)
+			if len(batch) == lookupAlpha {
+				break
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		closestBefore := ""
+		if len(shortlist) > 0 {
+			closestBefore = shortlist[0]
+		}
+
+		candidates := append([]string(nil), shortlist...)
+		for _, id := range batch {
+			queried[id] = struct{}{}
+			if node, ok := g.nodes[id]; ok {
+				for neighbor := range node.Neighbors {
+					candidates = append(candidates, neighbor)
+				}
+			}
+		}
+		shortlist = closestN(candidates, targetID, k)
+
+		if len(shortlist) > 0 && shortlist[0] == closestBefore {
+			allQueried := true
+			for _, id := range shortlist {
+				if _, done := queried[id]; !done {
+					allQueried = false
+					break
+				}
+			}
+			if allQueried {
+				break
+			}
+		}
+	}
+	return shortlist
+}
+
+// NeighbourhoodDepth returns the shallowest k-bucket index that first
+// holds fewer than kBucketSize peers - how close to the root of the
+// routing tree the manager's known neighborhood "runs dry". It's the
+// Kademlia notion of a node's bucket-refresh horizon: buckets shallower
+// than this are presumed full and well-populated, while this bucket and
+// deeper ones aren't.
+func (g *Graph) NeighbourhoodDepth() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for i := 0; i < sha1.Size*8; i++ {
+		if len(g.buckets[i]) < kBucketSize {
+			return i
+		}
+	}
+	return sha1.Size * 8
+}
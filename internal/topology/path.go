@@ -0,0 +1,304 @@
+package topology
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WeightFunc costs the a-b edge for ShortestWeightedPath and
+// KShortestPaths. EdgeWeight (plain RTT) is itself a WeightFunc; the
+// variants below read the same per-edge edgeStats to weigh an edge by
+// other measured dimensions instead.
+type WeightFunc func(a, b string) float64
+
+// defaultBandwidthMbps is assumed for an edge with no bandwidth sample
+// yet - the bandwidth-aware counterpart to defaultEdgeWeight, so an
+// unmeasured link stays traversable without being preferred over a
+// measured fast one.
+const defaultBandwidthMbps = 10.0
+
+// LatencyBandwidthWeight costs an edge as its RTT plus a penalty
+// inversely proportional to bandwidth, so a slower but fatter link can
+// still beat a low-latency but congested one - the same RTT/bandwidth
+// tradeoff as internal/signalling's edgeCost, just expressed as an
+// additive penalty since RTTms is already the unit the rest of this
+// package's Dijkstra compares in.
+func (g *Graph) LatencyBandwidthWeight(a, b string) float64 {
+	stats, ok := g.edgeSnapshot(a, b)
+	if !ok || stats.RTTms == 0 {
+		return defaultEdgeWeight
+	}
+	bw := stats.BandwidthMbps
+	if bw <= 0 {
+		bw = defaultBandwidthMbps
+	}
+	return float64(stats.RTTms) + 1000/bw
+}
+
+// LossWeight costs an edge as its RTT scaled up by its loss rate, so a
+// lossy link costs more even at the same measured RTT - packet loss on
+// a relay hop usually means retransmits, which cost more wall-clock time
+// than the RTT sample alone shows.
+func (g *Graph) LossWeight(a, b string) float64 {
+	stats, ok := g.edgeSnapshot(a, b)
+	if !ok || stats.RTTms == 0 {
+		return defaultEdgeWeight
+	}
+	return float64(stats.RTTms) * (1 + stats.LossPct/100)
+}
+
+// JitterPenalizedWeight costs an edge as its RTT plus a staleness
+// penalty: the longer it's been since LastProbed, the less the sample
+// can be trusted to still reflect the link's jitter, so routing steers
+// away from a stale-but-nominally-cheap edge toward one probed
+// recently. edgeStats only keeps a smoothed RTT rather than a per-sample
+// jitter figure, so staleness is the proxy for "how confident are we
+// this RTT is still accurate".
+func (g *Graph) JitterPenalizedWeight(a, b string) float64 {
+	stats, ok := g.edgeSnapshot(a, b)
+	if !ok || stats.RTTms == 0 {
+		return defaultEdgeWeight
+	}
+	return float64(stats.RTTms) + time.Since(stats.LastProbed).Seconds()*0.5
+}
+
+// CompositeWeight costs an edge the way intelligent_routing_demo.go's
+// calculatePeerScore ranks a peer - RTT penalty, bandwidth tier bonus -
+// inverted into a cost (lower is better) and with a loss term folded in,
+// since calculatePeerScore scores a single direct hop and has no
+// equivalent for a relay link's loss rate.
+func (g *Graph) CompositeWeight(a, b string) float64 {
+	stats, ok := g.edgeSnapshot(a, b)
+	if !ok || stats.RTTms == 0 {
+		return defaultEdgeWeight
+	}
+	cost := float64(stats.RTTms) * 0.5
+	switch {
+	case stats.BandwidthMbps >= 500:
+		cost -= 15
+	case stats.BandwidthMbps >= 100:
+		cost -= 10
+	case stats.BandwidthMbps >= 10:
+		cost -= 5
+	}
+	cost += stats.LossPct * 2
+	if cost < 0 {
+		cost = 0
+	}
+	return cost
+}
+
+// ShortestWeightedPath returns the lowest-cost path from from to to
+// under weight, alongside its total cost. It's BFS's weighted
+// counterpart - BFS minimizes hop count, this minimizes weight(a, b)
+// summed along the path - reconstructed from the same all-pairs
+// Dijkstra this package already runs for /paths, rather than a second
+// single-target algorithm.
+func (g *Graph) ShortestWeightedPath(from, to string, weight WeightFunc) ([]string, float64, error) {
+	dist, prev := g.Dijkstra(from, weight)
+	cost, ok := dist[to]
+	if !ok {
+		return nil, 0, fmt.Errorf("no path between %s and %s", from, to)
+	}
+	path := []string{to}
+	for cur := to; cur != from; {
+		p, ok := prev[cur]
+		if !ok {
+			return nil, 0, fmt.Errorf("no path between %s and %s", from, to)
+		}
+		path = append(path, p)
+		cur = p
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, cost, nil
+}
+
+// weightedPath computes the minimum weighted path from start to goal
+// over adjacency, skipping any node in excludeNodes and any edge in
+// excludeEdges - the exclusion-aware Dijkstra core KShortestPaths' Yen's
+// algorithm runs for every candidate spur, mirroring
+// internal/signalling's dijkstraPath adapted to this package's plain
+// string keys.
+func weightedPath(adjacency map[string]map[string]struct{}, start, goal string, excludeNodes map[string]struct{}, excludeEdges map[[2]string]struct{}, weight WeightFunc) ([]string, float64, bool) {
+	dist := map[string]float64{start: 0}
+	prev := map[string]string{}
+	visited := map[string]struct{}{}
+
+	pq := &dijkstraQueue{{id: start, dist: 0}}
+	heap.Init(pq)
+	for pq.Len() > 0 {
+		cur := heap.Pop(pq).(dijkstraItem)
+		if _, done := visited[cur.id]; done {
+			continue
+		}
+		visited[cur.id] = struct{}{}
+		if cur.id == goal {
+			break
+		}
+		for neighbor := range adjacency[cur.id] {
+			if _, excluded := excludeNodes[neighbor]; excluded {
+				continue
+			}
+			if _, excluded := excludeEdges[[2]string{cur.id, neighbor}]; excluded {
+				continue
+			}
+			if _, done := visited[neighbor]; done {
+				continue
+			}
+			next := cur.dist + weight(cur.id, neighbor)
+			if existing, ok := dist[neighbor]; !ok || next < existing {
+				dist[neighbor] = next
+				prev[neighbor] = cur.id
+				heap.Push(pq, dijkstraItem{id: neighbor, dist: next})
+			}
+		}
+	}
+
+	finalDist, ok := dist[goal]
+	if !ok {
+		return nil, 0, false
+	}
+	path := []string{goal}
+	for cur := goal; cur != start; {
+		p, ok := prev[cur]
+		if !ok {
+			return nil, 0, false
+		}
+		path = append(path, p)
+		cur = p
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, finalDist, true
+}
+
+// pathCostAlong sums weight along consecutive pairs of path -
+// KShortestPaths' analogue of internal/signalling's pathCost helper.
+func pathCostAlong(path []string, weight WeightFunc) float64 {
+	total := 0.0
+	for i := 0; i < len(path)-1; i++ {
+		total += weight(path[i], path[i+1])
+	}
+	return total
+}
+
+// sharesPrefix reports whether path starts with exactly the peers in root.
+func sharesPrefix(path, root []string) bool {
+	if len(path) < len(root) {
+		return false
+	}
+	for i, p := range root {
+		if path[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+// pathKey turns a path into a comparable string, so KShortestPaths can
+// de-duplicate candidate spurs that land back on a path already found.
+func pathKey(path []string) string {
+	return strings.Join(path, ">")
+}
+
+// WeightedPath pairs a path with its total cost under whatever
+// WeightFunc produced it - mirrors internal/signalling.PathResponse.
+type WeightedPath struct {
+	Path []string `json:"path"`
+	Cost float64  `json:"cost"`
+}
+
+// weightedPathQueue implements a container/heap min-heap over candidate
+// WeightedPaths ordered by Cost, the same shape as dijkstraQueue.
+type weightedPathQueue []WeightedPath
+
+func (q weightedPathQueue) Len() int            { return len(q) }
+func (q weightedPathQueue) Less(i, j int) bool  { return q[i].Cost < q[j].Cost }
+func (q weightedPathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *weightedPathQueue) Push(x interface{}) { *q = append(*q, x.(WeightedPath)) }
+func (q *weightedPathQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+// KShortestPaths returns up to k loopless paths from from to to, ranked
+// by ascending weight cost, via Yen's algorithm on top of weightedPath:
+// the first result is the plain cheapest path; each later one is the
+// cheapest spur found by, for every node along the previous result,
+// excluding the edge any already-found path used leaving that same
+// prefix and the prefix's own nodes, same structure as
+// internal/signalling.Hub.KShortestPaths adapted to this package's plain
+// string graph. Used for failover: if a path's first hop fails, a
+// routing decision service can fall back to the next-cheapest
+// alternative without recomputing from scratch.
+func (g *Graph) KShortestPaths(from, to string, k int, weight WeightFunc) ([]WeightedPath, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be positive")
+	}
+	adjacency, ok := g.snapshotAdjacency(from)
+	if !ok {
+		return nil, fmt.Errorf("unknown peer %s", from)
+	}
+	if _, ok := adjacency[to]; !ok {
+		return nil, fmt.Errorf("unknown peer %s", to)
+	}
+
+	firstPath, firstCost, ok := weightedPath(adjacency, from, to, nil, nil, weight)
+	if !ok {
+		return nil, fmt.Errorf("no path between %s and %s", from, to)
+	}
+
+	results := []WeightedPath{{Path: firstPath, Cost: firstCost}}
+	candidates := &weightedPathQueue{}
+	heap.Init(candidates)
+	seen := map[string]struct{}{pathKey(firstPath): {}}
+
+	for len(results) < k {
+		prev := results[len(results)-1]
+		for i := 0; i < len(prev.Path)-1; i++ {
+			spurNode := prev.Path[i]
+			rootPath := append([]string(nil), prev.Path[:i+1]...)
+
+			excludeEdges := map[[2]string]struct{}{}
+			for _, r := range results {
+				if sharesPrefix(r.Path, rootPath) && len(r.Path) > i+1 {
+					excludeEdges[[2]string{r.Path[i], r.Path[i+1]}] = struct{}{}
+				}
+			}
+			excludeNodes := map[string]struct{}{}
+			for _, n := range rootPath[:len(rootPath)-1] {
+				excludeNodes[n] = struct{}{}
+			}
+
+			spurPath, spurCost, ok := weightedPath(adjacency, spurNode, to, excludeNodes, excludeEdges, weight)
+			if !ok {
+				continue
+			}
+			total := WeightedPath{
+				Path: append(append([]string(nil), rootPath[:len(rootPath)-1]...), spurPath...),
+				Cost: pathCostAlong(rootPath, weight) + spurCost,
+			}
+			key := pathKey(total.Path)
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			heap.Push(candidates, total)
+		}
+
+		if candidates.Len() == 0 {
+			break
+		}
+		results = append(results, heap.Pop(candidates).(WeightedPath))
+	}
+
+	return results, nil
+}
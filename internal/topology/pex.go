@@ -0,0 +1,161 @@
+package topology
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// PEXPeer is one entry traded in a peer-exchange round: a peer ID, its
+// home region, and a last-observed RTT - the triple EncodePEX packs as
+// "peer_id + region byte + rtt varint" so a whole exchange round stays
+// well under an MTU. Connectable is only meaningful on the push side
+// (see PEX.Push): whether the pushing peer could actually reach it.
+type PEXPeer struct {
+	PeerID      string `json:"peer_id"`
+	Region      string `json:"region,omitempty"`
+	RTTms       int    `json:"rtt_ms,omitempty"`
+	Connectable bool   `json:"connectable,omitempty"`
+}
+
+// pexRegionCodes maps the CDN's known regions (see isNearbyRegion in
+// intelligent_routing_demo.go) to a single compact byte; 0 means
+// "unknown/unset" and is also what an unrecognized region encodes to,
+// since the wire format only has a byte to spend per peer.
+var pexRegionCodes = map[string]byte{
+	"us-east":        1,
+	"us-west":        2,
+	"eu-west":        3,
+	"eu-central":     4,
+	"asia-pacific":   5,
+	"canada":         6,
+	"asia-southeast": 7,
+	"japan":          8,
+	"australia":      9,
+}
+
+var pexRegionNames = func() map[byte]string {
+	names := make(map[byte]string, len(pexRegionCodes))
+	for name, code := range pexRegionCodes {
+		names[code] = name
+	}
+	return names
+}()
+
+// EncodePEX packs peers into the compact wire format: each entry is a
+// length-prefixed peer ID, a one-byte region code, and a varint RTT in
+// milliseconds.
+func EncodePEX(peers []PEXPeer) []byte {
+	buf := make([]byte, 0, len(peers)*16)
+	var varintBuf [binary.MaxVarintLen64]byte
+	for _, p := range peers {
+		buf = append(buf, byte(len(p.PeerID)))
+		buf = append(buf, p.PeerID...)
+		buf = append(buf, pexRegionCodes[p.Region])
+		n := binary.PutUvarint(varintBuf[:], uint64(p.RTTms))
+		buf = append(buf, varintBuf[:n]...)
+	}
+	return buf
+}
+
+// DecodePEX reverses EncodePEX.
+func DecodePEX(data []byte) []PEXPeer {
+	var peers []PEXPeer
+	for len(data) > 0 {
+		idLen := int(data[0])
+		data = data[1:]
+		if idLen > len(data) {
+			break
+		}
+		peerID := string(data[:idLen])
+		data = data[idLen:]
+		if len(data) < 1 {
+			break
+		}
+		regionCode := data[0]
+		data = data[1:]
+		rtt, n := binary.Uvarint(data)
+		if n <= 0 {
+			break
+		}
+		data = data[n:]
+		peers = append(peers, PEXPeer{
+			PeerID: peerID,
+			Region: pexRegionNames[regionCode],
+			RTTms:  int(rtt),
+		})
+	}
+	return peers
+}
+
+// pexMaxPeers caps how many peers a single GET /peers/exchange response
+// returns. pexMinInterval rate-limits how often a given caller may pull,
+// the same shape and scale as signalling.Hub's pexMinInterval, so a
+// client can't turn PEX into a free polling loop against the tracker.
+const (
+	pexMaxPeers    = 25
+	pexMinInterval = 60 * time.Second
+)
+
+// PEX serves BitTorrent-style peer exchange on top of a Graph: callers
+// pull a sample of peers they don't already have (plus a list of peers
+// recently removed, so a stale local cache can evict them), and push
+// back peers they've observed to be good, both without going through
+// the tracker's central /peers endpoint for every segment lookup.
+type PEX struct {
+	graph *Graph
+
+	mu       sync.Mutex
+	lastPull map[string]time.Time
+}
+
+func NewPEX(graph *Graph) *PEX {
+	return &PEX{
+		graph:    graph,
+		lastPull: make(map[string]time.Time),
+	}
+}
+
+// Pull returns up to pexMaxPeers peers the graph knows about that
+// aren't in have, plus the peer IDs tombstoned since the caller last
+// asked. ok is false if callerID has pulled within pexMinInterval, in
+// which case peers and dropped are both nil.
+func (p *PEX) Pull(callerID string, have map[string]struct{}) (peers []PEXPeer, dropped []string, ok bool) {
+	p.mu.Lock()
+	if last, seen := p.lastPull[callerID]; seen && time.Since(last) < pexMinInterval {
+		p.mu.Unlock()
+		return nil, nil, false
+	}
+	p.lastPull[callerID] = time.Now()
+	p.mu.Unlock()
+
+	for _, rec := range p.graph.RecentChanges(changelogCap) {
+		if rec.Tombstone {
+			dropped = append(dropped, rec.PeerID)
+			continue
+		}
+		if _, known := have[rec.PeerID]; known || rec.PeerID == callerID {
+			continue
+		}
+		peers = append(peers, PEXPeer{PeerID: rec.PeerID, Region: rec.Region, RTTms: rec.RTTms})
+		if len(peers) >= pexMaxPeers {
+			break
+		}
+	}
+	return peers, dropped, true
+}
+
+// Push applies peers a caller has observed to be good back into the
+// graph, recording RTT and region the same way a tracker upsert would.
+// Unconnectable peers are recorded too (as a negative signal future
+// ranking could use) rather than dropped, since "I tried to reach X and
+// couldn't" is itself useful information.
+func (p *PEX) Push(callerID string, peers []PEXPeer) {
+	for _, peer := range peers {
+		if peer.PeerID == "" || peer.PeerID == callerID {
+			continue
+		}
+		metadata := map[string]any{"connectable": peer.Connectable}
+		p.graph.Upsert(peer.PeerID, peer.Region, peer.RTTms, nil, metadata)
+	}
+}
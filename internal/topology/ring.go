@@ -0,0 +1,121 @@
+package topology
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Peer is the lightweight, read-only view of one swarm member Ring ranks
+// segment ownership over - just what HRW scoring and a caller's filter
+// need, not the full shape any of this codebase's other peer-facing
+// types (Node, PeerSummary, the routing demo's Peer) carry for their own
+// purposes.
+type Peer struct {
+	ID            string
+	Region        string
+	BandwidthMbps float64
+	Available     bool
+}
+
+// virtualNodesFor returns how many independent hash slots peer gets in
+// Owners' scoring, so a peer advertising more bandwidth ends up owning a
+// proportionally larger share of segments without changing the HRW
+// algorithm itself - the same bandwidth-tier idea CompositeWeight and
+// the routing demo's calculatePeerScore already use for routing cost,
+// spent here on ownership share instead.
+func virtualNodesFor(bandwidthMbps float64) int {
+	switch {
+	case bandwidthMbps >= 500: // fiber
+		return 8
+	case bandwidthMbps >= 100:
+		return 4
+	case bandwidthMbps >= 10:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Ring computes rendezvous (highest random weight, HRW) hashing over a
+// fixed peer set: for any segment ID, each peer's score is the highest
+// hash of (segment, peer, virtual-node index) over its virtual nodes, and
+// the top-scoring peers are that segment's owners. Unlike a hash-mod-N
+// scheme, adding or removing one peer only changes the winner for the
+// segments that peer itself was competing for - roughly a 1/N share of
+// all segments - rather than reshuffling every other peer's assignment.
+// Ring keeps no per-segment state at all: Owners is recomputed from the
+// peer list fresh on every call, same as Graph.Dijkstra recomputes from
+// its adjacency snapshot rather than caching paths.
+type Ring struct {
+	peers []Peer
+}
+
+// NewRing builds a Ring over peers as given. Ring doesn't watch for
+// membership changes; a caller with a live peer set (the tracker, the
+// routing decision service) is expected to build a fresh Ring whenever
+// that set changes rather than mutate one in place.
+func NewRing(peers []Peer) *Ring {
+	cp := make([]Peer, len(peers))
+	copy(cp, peers)
+	return &Ring{peers: cp}
+}
+
+// hrwScore hashes (segmentID, peerID, vnode) into a uint64 weight via
+// SHA-1 - this package already pulls in crypto/sha1 for kademliaID and
+// Digest, and Owners runs at simulator scale rather than in a request hot
+// path, so a faster non-cryptographic hash isn't worth a second import.
+func hrwScore(segmentID, peerID string, vnode int) uint64 {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s|%s|%d", segmentID, peerID, vnode)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// scoredPeer pairs a candidate with its best virtual-node score, so
+// Owners can sort once instead of re-hashing during the sort comparator.
+type scoredPeer struct {
+	peer  Peer
+	score uint64
+}
+
+// Owners returns the top k peers for segmentID by HRW score, restricted
+// to those for which filter returns true (a nil filter admits every
+// peer). The result is deterministic across every caller and every
+// process - none of them need to agree on anything beyond the peer list
+// and segmentID, unlike a central per-segment assignment table. Ties
+// (astronomically unlikely with a 64-bit score) break on peer ID so the
+// order is still fully deterministic.
+func (r *Ring) Owners(segmentID string, k int, filter func(Peer) bool) []Peer {
+	if k <= 0 {
+		return nil
+	}
+	candidates := make([]scoredPeer, 0, len(r.peers))
+	for _, p := range r.peers {
+		if filter != nil && !filter(p) {
+			continue
+		}
+		var best uint64
+		for v := 0; v < virtualNodesFor(p.BandwidthMbps); v++ {
+			if s := hrwScore(segmentID, p.ID, v); s > best {
+				best = s
+			}
+		}
+		candidates = append(candidates, scoredPeer{peer: p, score: best})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].peer.ID < candidates[j].peer.ID
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	out := make([]Peer, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.peer
+	}
+	return out
+}
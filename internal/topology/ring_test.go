@@ -0,0 +1,116 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestRingOwnersChurn builds a 50-peer Ring, records the sole owner
+// (k=1) of 2000 segments, then adds one peer and checks how many of
+// those owners changed. Rendezvous hashing's whole point over a
+// hash-mod-N scheme is that churn only reassigns the segments the
+// new/departing peer itself wins, so the reassignment rate should land
+// near 1/N (1/51 here) rather than anywhere close to the near-100%
+// churn a naive mod-N reshuffle would cause.
+func TestRingOwnersChurn(t *testing.T) {
+	const peerCount = 50
+	const segmentCount = 2000
+
+	var peers []Peer
+	for i := 0; i < peerCount; i++ {
+		peers = append(peers, Peer{ID: fmt.Sprintf("peer-%d", i), BandwidthMbps: 10, Available: true})
+	}
+	before := NewRing(peers)
+
+	segments := make([]string, segmentCount)
+	owners := make(map[string]string, segmentCount)
+	for i := range segments {
+		seg := fmt.Sprintf("segment-%d", i)
+		segments[i] = seg
+		got := before.Owners(seg, 1, nil)
+		if len(got) != 1 {
+			t.Fatalf("segment %s: expected 1 owner, got %d", seg, len(got))
+		}
+		owners[seg] = got[0].ID
+	}
+
+	after := NewRing(append(append([]Peer(nil), peers...), Peer{ID: "peer-new", BandwidthMbps: 10, Available: true}))
+
+	reassigned := 0
+	for _, seg := range segments {
+		got := after.Owners(seg, 1, nil)
+		if len(got) != 1 {
+			t.Fatalf("segment %s: expected 1 owner after churn, got %d", seg, len(got))
+		}
+		if got[0].ID != owners[seg] {
+			reassigned++
+		}
+	}
+
+	// Expected reassignment rate is 1/(peerCount+1); allow generous slack
+	// either side since this is a statistical property, not an exact one.
+	expected := float64(segmentCount) / float64(peerCount+1)
+	if float64(reassigned) > expected*2.5 {
+		t.Fatalf("churn reassigned %d/%d segments, more than 2.5x the expected ~%.0f for adding 1 peer to %d",
+			reassigned, segmentCount, expected, peerCount)
+	}
+	if reassigned == 0 {
+		t.Fatal("expected adding a peer to reassign at least some segments")
+	}
+
+	removed := NewRing(peers[:peerCount-1])
+	reassignedOnRemove := 0
+	for _, seg := range segments {
+		got := removed.Owners(seg, 1, nil)
+		if len(got) != 1 {
+			t.Fatalf("segment %s: expected 1 owner after removal, got %d", seg, len(got))
+		}
+		if got[0].ID != owners[seg] {
+			reassignedOnRemove++
+		}
+	}
+	expectedRemove := float64(segmentCount) / float64(peerCount)
+	if float64(reassignedOnRemove) > expectedRemove*2.5 {
+		t.Fatalf("churn reassigned %d/%d segments, more than 2.5x the expected ~%.0f for removing 1 peer from %d",
+			reassignedOnRemove, segmentCount, expectedRemove, peerCount)
+	}
+}
+
+// TestRingOwnersFilterAndWeighting checks that a filter excludes peers
+// outright and that a fiber-tier peer (more virtual nodes) wins a larger
+// share of segments than a plain peer, without asserting an exact ratio.
+func TestRingOwnersFilterAndWeighting(t *testing.T) {
+	peers := []Peer{
+		{ID: "fiber-1", Region: "us-east", BandwidthMbps: 1000, Available: true},
+		{ID: "plain-1", Region: "us-east", BandwidthMbps: 10, Available: true},
+		{ID: "plain-2", Region: "eu-west", BandwidthMbps: 10, Available: true},
+	}
+	ring := NewRing(peers)
+
+	sameRegion := func(p Peer) bool { return p.Region == "us-east" }
+	for i := 0; i < 20; i++ {
+		got := ring.Owners(fmt.Sprintf("segment-%d", i), 3, sameRegion)
+		for _, p := range got {
+			if p.Region != "us-east" {
+				t.Fatalf("filter leaked a peer from region %s", p.Region)
+			}
+		}
+	}
+
+	fiberWins, plainWins := 0, 0
+	for i := 0; i < 500; i++ {
+		got := ring.Owners(fmt.Sprintf("weighted-%d", i), 1, nil)
+		if len(got) != 1 {
+			t.Fatalf("expected exactly 1 owner, got %d", len(got))
+		}
+		switch got[0].ID {
+		case "fiber-1":
+			fiberWins++
+		case "plain-1", "plain-2":
+			plainWins++
+		}
+	}
+	if fiberWins <= plainWins {
+		t.Fatalf("expected the fiber-tier peer's extra virtual nodes to win more often: fiber=%d plain=%d", fiberWins, plainWins)
+	}
+}
@@ -0,0 +1,278 @@
+package topology
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamSubscriberBuffer bounds how many pending diffs a slow
+// /graph/stream subscriber can accumulate before new ones are dropped -
+// same rationale and figure as events.subscriberBuffer and
+// tracker.streamPushBuffer: a stalled viewer shouldn't back up the hub.
+const streamSubscriberBuffer = 100_000
+
+// streamReplayCap bounds how many past GraphDiffs StreamHub keeps around
+// to replay to a newly-connecting subscriber after its initial snapshot -
+// the same ring-buffer shape as Graph's own changelog.
+const streamReplayCap = 256
+
+// defaultStreamDepth is how many hops a ?region= filter reaches from that
+// region's peers when ?depth= is omitted.
+const defaultStreamDepth = 1
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// streamMessage is one frame pushed down a /graph/stream connection:
+// either the initial full snapshot or a live incremental diff.
+type streamMessage struct {
+	Type     string              `json:"type"` // snapshot, diff
+	Snapshot map[string][]string `json:"snapshot,omitempty"`
+	Diff     *GraphDiff          `json:"diff,omitempty"`
+}
+
+// streamSubscriber receives pre-encoded streamMessages matching its
+// region/depth filter.
+type streamSubscriber struct {
+	ch    chan []byte
+	allow map[string]struct{} // nil means "every node"
+}
+
+// StreamHub fans out a Graph's mutations to /graph/stream viewers as
+// incremental GraphDiffs, so the D3 UI can apply a join-by-key update
+// instead of re-fetching and re-rendering the whole /graph snapshot on
+// every change. It registers itself as graph's one ChangeHook, the same
+// way tracker.StreamHub sits beside a Service without the Service
+// depending back on it.
+type StreamHub struct {
+	mu          sync.RWMutex
+	graph       *Graph
+	subscribers map[*streamSubscriber]struct{}
+	replay      []GraphDiff
+}
+
+// NewStreamHub creates a StreamHub wired to broadcast every diff graph
+// produces, replacing any ChangeHook graph already had registered.
+func NewStreamHub(graph *Graph) *StreamHub {
+	hub := &StreamHub{graph: graph, subscribers: make(map[*streamSubscriber]struct{})}
+	graph.OnChange(hub.broadcast)
+	return hub
+}
+
+// broadcast appends diff to the replay buffer and fans it out to every
+// currently connected subscriber whose filter it passes. It's graph's
+// ChangeHook, so it always runs after graph's own lock has been
+// released.
+func (h *StreamHub) broadcast(diff GraphDiff) {
+	h.mu.Lock()
+	h.replay = append(h.replay, diff)
+	if len(h.replay) > streamReplayCap {
+		h.replay = h.replay[len(h.replay)-streamReplayCap:]
+	}
+	subs := make([]*streamSubscriber, 0, len(h.subscribers))
+	for sub := range h.subscribers {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		h.send(sub, diff)
+	}
+}
+
+// PublishHealthDelta broadcasts updated as a GraphDiff carrying only
+// UpdatedMetrics - the periodic RTT/health refresh cmd/topology's main
+// loop runs independently of any actual Upsert/Remove mutation.
+func (h *StreamHub) PublishHealthDelta(updated map[string]PeerRecord) {
+	if len(updated) == 0 {
+		return
+	}
+	h.broadcast(GraphDiff{UpdatedMetrics: updated})
+}
+
+// send filters diff to sub's allow set and, if anything survives, encodes
+// and pushes it - best-effort and non-blocking, same as
+// events.Bus.Publish: a subscriber whose buffer is full drops the
+// message rather than stalling the broadcaster.
+func (h *StreamHub) send(sub *streamSubscriber, diff GraphDiff) {
+	filtered := filterDiff(diff, sub.allow)
+	if filtered.Empty() {
+		return
+	}
+	encoded, err := json.Marshal(streamMessage{Type: "diff", Diff: &filtered})
+	if err != nil {
+		return
+	}
+	select {
+	case sub.ch <- encoded:
+	default:
+	}
+}
+
+// filterDiff drops anything from diff that allow (nil meaning
+// "everything") doesn't include: nodes not in allow, edges with neither
+// endpoint in allow, and metric updates for a node not in allow.
+func filterDiff(diff GraphDiff, allow map[string]struct{}) GraphDiff {
+	if allow == nil {
+		return diff
+	}
+	var out GraphDiff
+	for _, n := range diff.AddedNodes {
+		if _, ok := allow[n]; ok {
+			out.AddedNodes = append(out.AddedNodes, n)
+		}
+	}
+	for _, n := range diff.RemovedNodes {
+		if _, ok := allow[n]; ok {
+			out.RemovedNodes = append(out.RemovedNodes, n)
+		}
+	}
+	for _, e := range diff.AddedEdges {
+		_, aok := allow[e[0]]
+		_, bok := allow[e[1]]
+		if aok || bok {
+			out.AddedEdges = append(out.AddedEdges, e)
+		}
+	}
+	for _, e := range diff.RemovedEdges {
+		_, aok := allow[e[0]]
+		_, bok := allow[e[1]]
+		if aok || bok {
+			out.RemovedEdges = append(out.RemovedEdges, e)
+		}
+	}
+	for id, rec := range diff.UpdatedMetrics {
+		if _, ok := allow[id]; ok {
+			if out.UpdatedMetrics == nil {
+				out.UpdatedMetrics = make(map[string]PeerRecord)
+			}
+			out.UpdatedMetrics[id] = rec
+		}
+	}
+	return out
+}
+
+// filterSnapshot drops any peer not in allow (nil meaning "everything")
+// from snapshot, and any of its neighbors not in allow either - the
+// region/depth-filtered counterpart to Graph.Snapshot a new subscriber's
+// initial "snapshot" frame uses.
+func filterSnapshot(snapshot map[string][]string, allow map[string]struct{}) map[string][]string {
+	if allow == nil {
+		return snapshot
+	}
+	out := make(map[string][]string, len(allow))
+	for id, neighbors := range snapshot {
+		if _, ok := allow[id]; !ok {
+			continue
+		}
+		kept := make([]string, 0, len(neighbors))
+		for _, n := range neighbors {
+			if _, ok := allow[n]; ok {
+				kept = append(kept, n)
+			}
+		}
+		out[id] = kept
+	}
+	return out
+}
+
+// ServeStream upgrades r to a WebSocket for /graph/stream: it sends an
+// initial snapshot frame, replays whatever GraphDiffs are still in the
+// replay buffer, then streams live diffs until the connection closes.
+// ?region=X&depth=N limits all three to nodes within depth hops of a
+// peer in region X (see Graph.WithinHops), fixed for the life of the
+// connection; omitting region streams everything.
+func (h *StreamHub) ServeStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	allow := h.parseFilter(r)
+	sub := &streamSubscriber{ch: make(chan []byte, streamSubscriberBuffer), allow: allow}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	replay := append([]GraphDiff(nil), h.replay...)
+	h.mu.Unlock()
+	defer h.unregister(sub)
+
+	snapshot := filterSnapshot(h.graph.Snapshot(), allow)
+	if encoded, err := json.Marshal(streamMessage{Type: "snapshot", Snapshot: snapshot}); err == nil {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, encoded); err != nil {
+			return
+		}
+	}
+	for _, diff := range replay {
+		filtered := filterDiff(diff, allow)
+		if filtered.Empty() {
+			continue
+		}
+		encoded, err := json.Marshal(streamMessage{Type: "diff", Diff: &filtered})
+		if err != nil {
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, encoded); err != nil {
+			return
+		}
+	}
+
+	// The only purpose of reading after the handshake is to notice the
+	// client going away; diffs never flow client->server on this stream.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for encoded := range sub.ch {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, encoded); err != nil {
+			return
+		}
+	}
+}
+
+func (h *StreamHub) unregister(sub *streamSubscriber) {
+	h.mu.Lock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.ch)
+	}
+	h.mu.Unlock()
+}
+
+// parseFilter reads ?region=&depth= off r and resolves it to the set of
+// node IDs a subscriber should see, or nil for "everything" if region is
+// omitted.
+func (h *StreamHub) parseFilter(r *http.Request) map[string]struct{} {
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		return nil
+	}
+	depth := defaultStreamDepth
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			depth = parsed
+		}
+	}
+	roots := h.graph.NodesInRegion(region)
+	if len(roots) == 0 {
+		return map[string]struct{}{}
+	}
+	return h.graph.WithinHops(roots, depth)
+}
@@ -0,0 +1,91 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultScrapeInterval is how often TrackerScraper recomputes each
+// segment's per-region breakdown.
+const defaultScrapeInterval = 30 * time.Second
+
+// TrackerScraper periodically aggregates every segment tracked in
+// allSegmentsKey into a per-region holder count, stored as a Redis
+// sorted set (member = region, score = holder count) so a dashboard can
+// see where a segment's swarm is concentrated without re-reading every
+// holder's meta on each request.
+type TrackerScraper struct {
+	rdb      *redis.Client
+	interval time.Duration
+}
+
+// NewTrackerScraper builds a TrackerScraper over rdb. interval <= 0
+// falls back to defaultScrapeInterval.
+func NewTrackerScraper(rdb *redis.Client, interval time.Duration) *TrackerScraper {
+	if interval <= 0 {
+		interval = defaultScrapeInterval
+	}
+	return &TrackerScraper{rdb: rdb, interval: interval}
+}
+
+// Start runs the aggregation loop in a background goroutine until ctx
+// is cancelled.
+func (t *TrackerScraper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.aggregateOnce(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (t *TrackerScraper) aggregateOnce(ctx context.Context) {
+	segments, err := t.rdb.SMembers(ctx, allSegmentsKey).Result()
+	if err != nil {
+		return
+	}
+	for _, seg := range segments {
+		t.aggregateSegment(ctx, seg)
+	}
+}
+
+func (t *TrackerScraper) aggregateSegment(ctx context.Context, segment string) {
+	segmentKey := fmt.Sprintf("%s:%s", segmentKeyPrefix, segment)
+	peerIDs, err := t.rdb.SMembers(ctx, segmentKey).Result()
+	if err != nil {
+		return
+	}
+	regionCounts := make(map[string]int64, len(peerIDs))
+	for _, peerID := range peerIDs {
+		raw, err := t.rdb.Get(ctx, fmt.Sprintf("peer:%s:meta", peerID)).Bytes()
+		if err != nil {
+			continue
+		}
+		var ann AnnounceRequest
+		if err := json.Unmarshal(raw, &ann); err != nil || ann.Region == "" {
+			continue
+		}
+		regionCounts[ann.Region]++
+	}
+
+	regionsKey := fmt.Sprintf("%s:%s:regions", segmentKeyPrefix, segment)
+	t.rdb.Del(ctx, regionsKey)
+	if len(regionCounts) == 0 {
+		return
+	}
+	members := make([]redis.Z, 0, len(regionCounts))
+	for region, count := range regionCounts {
+		members = append(members, redis.Z{Score: float64(count), Member: region})
+	}
+	t.rdb.ZAdd(ctx, regionsKey, members...)
+}
@@ -3,14 +3,22 @@ package tracker
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"cloud_project/internal/events"
+	"cloud_project/pkg/bloom"
 )
 
 const (
@@ -18,12 +26,55 @@ const (
 	heartbeatHashKey   = "peers:heartbeat"
 	segmentKeyPrefix   = "segment"
 	peerSegmentsPrefix = "peer"
+	webseedSetKey      = "tracker:webseeds"
+	webseedWTSetKey    = "tracker:webseeds:wt"
+	banSetKey          = "tracker:bans"
+	banTTL             = 30 * time.Minute
+
+	// defaultBanThreshold is the failure rate (failures / reports) above
+	// which a peer is banned, mirroring the "badPeerIPs" heuristic
+	// BitTorrent trackers use to stop re-serving a poisoned piece.
+	defaultBanThreshold = 0.5
+	// minReportsBeforeBan avoids banning a peer off a single bad report;
+	// a handful of corroborating reports are required first.
+	minReportsBeforeBan = 3
+
+	// pathCostTTL bounds how long a requester's Dijkstra result from the
+	// topology service is reused across lookups - long enough to avoid
+	// hammering /paths on every segment request, short enough that the
+	// graph's churn (peers joining/leaving) doesn't go stale for long.
+	pathCostTTL = 5 * time.Second
+
+	// pskKeyFmt and nonceKeyFmt back signed-announce mode: a peer
+	// provisioned with a PSK (via the admin API) must HMAC-sign its
+	// announce/heartbeat body, and the last-seen nonce is kept so a
+	// captured header can't be replayed.
+	pskKeyFmt   = "peer:%s:psk"
+	nonceKeyFmt = "peer:%s:nonce"
+
+	// allSegmentsKey indexes every segment id ever held by a peer, so
+	// Scrape and TrackerScraper know what to aggregate without scanning
+	// the whole keyspace.
+	allSegmentsKey = "tracker:segments"
 )
 
 type Config struct {
 	TTL           time.Duration
 	TopologyURL   string
 	RegionWeights map[string]int
+	// Events, if set, receives a stream of the service's lifecycle
+	// events (announce, heartbeat, reap, lookup, topology mutation) for
+	// live observers. Nil disables event publishing.
+	Events *events.Bus
+	// AdminToken is the token cmd/tracker requires on the X-Admin-Token
+	// header of /admin/peers requests. The Service itself doesn't
+	// enforce it - it's threaded through Config purely so it travels
+	// with the rest of the tracker's settings.
+	AdminToken string
+	// Stream, if set, lets LookupSegment push a peer_wants hint to the
+	// best-ranked holder of a segment over its open tracker stream, so it
+	// learns about demand ahead of the requester's HTTP fetch landing.
+	Stream *StreamHub
 }
 
 type Service struct {
@@ -32,6 +83,22 @@ type Service struct {
 	httpClient   *http.Client
 	mu           sync.RWMutex
 	regionWeight map[string]int
+	pathCosts    map[string]pathCostEntry
+}
+
+// publish is a nil-safe wrapper so call sites don't need to check
+// whether event streaming is configured.
+func (s *Service) publish(eventType string, data any) {
+	if s.cfg.Events != nil {
+		s.cfg.Events.Publish(eventType, data)
+	}
+}
+
+// pathCostEntry caches one requester's Dijkstra result from the
+// topology service for pathCostTTL.
+type pathCostEntry struct {
+	cost      map[string]float64
+	expiresAt time.Time
 }
 
 func NewService(rdb *redis.Client, cfg Config) *Service {
@@ -42,6 +109,7 @@ func NewService(rdb *redis.Client, cfg Config) *Service {
 		cfg:        cfg,
 		rdb:        rdb,
 		httpClient: &http.Client{Timeout: 5 * time.Second},
+		pathCosts:  make(map[string]pathCostEntry),
 	}
 }
 
@@ -52,29 +120,99 @@ type AnnounceRequest struct {
 	RTTms     int      `json:"rtt_ms"`
 	Segments  []string `json:"segments"`
 	Neighbors []string `json:"neighbors"`
+	WebSeeds  []string `json:"webseeds,omitempty"`
+	// WebSeedsWT is the subset of WebSeeds (by URL) that also accept
+	// WebTransport/HTTP-3 connections, so LookupSegment can tell a
+	// requester which edges it can negotiate the lower-latency
+	// transport with instead of falling back to plain HTTP.
+	WebSeedsWT []string `json:"webseeds_wt,omitempty"`
+
+	// SegmentsBloom, when set, means the peer is advertising its cache
+	// via a Bloom filter instead of enumerating Segments - LookupSegment
+	// falls back to membership-testing it via bloomCandidates. M/K/N are
+	// the filter's parameters, needed to reconstruct it from the bits.
+	SegmentsBloom []byte `json:"segments_bloom,omitempty"`
+	SegmentsM     uint32 `json:"segments_m,omitempty"`
+	SegmentsK     uint32 `json:"segments_k,omitempty"`
+	SegmentsN     uint32 `json:"segments_n,omitempty"`
+
+	// Uploaded, Downloaded, and Left are BEP-3 style byte counters the
+	// peer self-reports on each announce: total bytes sent to other
+	// peers, total bytes fetched so far, and bytes remaining until it
+	// holds a complete copy of what it's fetching (0 once it's a seed).
+	// Scrape derives complete/incomplete swarm counts from Left.
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+	Left       int64 `json:"left"`
+
+	// BandwidthMbps is the peer's self-reported link speed, used only to
+	// weight it in rendezvousCandidates' ownership hashing (a fiber peer
+	// gets more virtual nodes, and so a proportionally larger share of
+	// segments) - it plays no role in LookupSegment's actual membership
+	// checks.
+	BandwidthMbps float64 `json:"bandwidth_mbps,omitempty"`
+
+	// Capabilities are the roles this peer advertises at registration time
+	// (e.g. "seed", "cache", "relay", "edge-gateway", "archival"), mirroring
+	// Algorand's peer-capability gossip model. PeersByCapability is the only
+	// thing that reads this; it plays no role in LookupSegment or
+	// rendezvousCandidates.
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 type HeartbeatRequest struct {
 	PeerID    string   `json:"peer_id"`
 	Segments  []string `json:"segments"`
 	Neighbors []string `json:"neighbors"`
+
+	// SegmentsBloom mirrors AnnounceRequest's bloom fields.
+	SegmentsBloom []byte `json:"segments_bloom,omitempty"`
+	SegmentsM     uint32 `json:"segments_m,omitempty"`
+	SegmentsK     uint32 `json:"segments_k,omitempty"`
+	SegmentsN     uint32 `json:"segments_n,omitempty"`
 }
 
 type LookupResponse struct {
-	Segment string        `json:"segment"`
-	Peers   []PeerSummary `json:"peers"`
+	Segment    string        `json:"segment"`
+	Peers      []PeerSummary `json:"peers"`
+	WebSeeds   []string      `json:"webseeds,omitempty"`
+	WebSeedsWT []string      `json:"webseeds_wt,omitempty"`
 }
 
 type PeerSummary struct {
+	PeerID       string   `json:"peer_id"`
+	Region       string   `json:"region"`
+	RTTms        int      `json:"rtt_ms"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// ReportRequest is submitted by a client that observed a peer misbehave:
+// a hash mismatch on a downloaded segment, a request timeout, or a
+// protocol violation.
+type ReportRequest struct {
 	PeerID string `json:"peer_id"`
-	Region string `json:"region"`
-	RTTms  int    `json:"rtt_ms"`
+	Reason string `json:"reason"`
+	SrcIP  string `json:"src_ip,omitempty"`
+}
+
+// BanEntry describes a peer the tracker has banned, along with the
+// source IP it was reported from, if any.
+type BanEntry struct {
+	PeerID string `json:"peer_id"`
+	SrcIP  string `json:"src_ip,omitempty"`
 }
 
 func (s *Service) HandleAnnounce(ctx context.Context, req AnnounceRequest) error {
 	if req.PeerID == "" {
 		return fmt.Errorf("peer_id required")
 	}
+	banned, err := s.IsBanned(ctx, req.PeerID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return fmt.Errorf("peer %s is banned", req.PeerID)
+	}
 	now := time.Now().Unix()
 	if err := s.rdb.HSet(ctx, heartbeatHashKey, req.PeerID, now).Err(); err != nil {
 		return err
@@ -82,6 +220,12 @@ func (s *Service) HandleAnnounce(ctx context.Context, req AnnounceRequest) error
 	if err := s.storeSegments(ctx, req.PeerID, req.Segments); err != nil {
 		return err
 	}
+	if err := s.storeWebSeeds(ctx, req.WebSeeds); err != nil {
+		return err
+	}
+	if err := s.storeWebSeedsWT(ctx, req.WebSeedsWT); err != nil {
+		return err
+	}
 	metaKey := fmt.Sprintf("peer:%s:meta", req.PeerID)
 	metaBytes, _ := json.Marshal(req)
 	if err := s.rdb.Set(ctx, metaKey, metaBytes, s.cfg.TTL).Err(); err != nil {
@@ -90,6 +234,40 @@ func (s *Service) HandleAnnounce(ctx context.Context, req AnnounceRequest) error
 	if err := s.updateTopology(ctx, req.PeerID, req.Region, req.RTTms, req.Neighbors); err != nil {
 		return err
 	}
+	if err := s.recordCompletion(ctx, req); err != nil {
+		return err
+	}
+	s.publish("announce", req)
+	return nil
+}
+
+// recordCompletion increments each of req's segments' lifetime
+// "downloaded" counter the first time this peer announces it as
+// finished (Left == 0), mirroring the monotonic "downloaded" stat a
+// BEP-48 scrape response reports. A peer re-announcing as a seed on a
+// later heartbeat doesn't count again, tracked via completedPeersKey.
+func (s *Service) recordCompletion(ctx context.Context, req AnnounceRequest) error {
+	if req.Left != 0 {
+		return nil
+	}
+	for _, seg := range req.Segments {
+		seg = strings.TrimSpace(seg)
+		if seg == "" {
+			continue
+		}
+		completedPeersKey := fmt.Sprintf("%s:%s:completed_peers", segmentKeyPrefix, seg)
+		added, err := s.rdb.SAdd(ctx, completedPeersKey, req.PeerID).Result()
+		if err != nil {
+			return err
+		}
+		if added == 0 {
+			continue
+		}
+		statsKey := fmt.Sprintf("%s:%s:stats", segmentKeyPrefix, seg)
+		if err := s.rdb.HIncrBy(ctx, statsKey, "downloaded", 1).Err(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -97,6 +275,13 @@ func (s *Service) HandleHeartbeat(ctx context.Context, req HeartbeatRequest) err
 	if req.PeerID == "" {
 		return fmt.Errorf("peer_id required")
 	}
+	banned, err := s.IsBanned(ctx, req.PeerID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return fmt.Errorf("peer %s is banned", req.PeerID)
+	}
 	now := time.Now().Unix()
 	if err := s.rdb.HSet(ctx, heartbeatHashKey, req.PeerID, now).Err(); err != nil {
 		return err
@@ -105,6 +290,10 @@ func (s *Service) HandleHeartbeat(ctx context.Context, req HeartbeatRequest) err
 		if err := s.storeSegments(ctx, req.PeerID, req.Segments); err != nil {
 			return err
 		}
+	} else if len(req.SegmentsBloom) > 0 {
+		if err := s.storeBloom(ctx, req.PeerID, req.SegmentsBloom, req.SegmentsM, req.SegmentsK, req.SegmentsN); err != nil {
+			return err
+		}
 	}
 	if len(req.Neighbors) > 0 {
 		if err := s.updateTopology(ctx, req.PeerID, "", 0, req.Neighbors); err != nil {
@@ -113,9 +302,213 @@ func (s *Service) HandleHeartbeat(ctx context.Context, req HeartbeatRequest) err
 	}
 	peerKey := fmt.Sprintf("peer:%s:meta", req.PeerID)
 	s.rdb.Expire(ctx, peerKey, s.cfg.TTL)
+	s.publish("heartbeat", req)
+	return nil
+}
+
+// HandleReport records a client's complaint about peer misbehavior
+// (hash mismatch, timeout, protocol violation) and bans the peer once
+// its failure rate crosses defaultBanThreshold, provided it has
+// accumulated at least minReportsBeforeBan reports.
+func (s *Service) HandleReport(ctx context.Context, req ReportRequest) error {
+	if req.PeerID == "" {
+		return fmt.Errorf("peer_id required")
+	}
+	if req.Reason == "" {
+		return fmt.Errorf("reason required")
+	}
+	reportsKey := fmt.Sprintf("peer:%s:reports", req.PeerID)
+	failuresKey := fmt.Sprintf("peer:%s:failures", req.PeerID)
+	reports, err := s.rdb.HIncrBy(ctx, reportsKey, "total", 1).Result()
+	if err != nil {
+		return err
+	}
+	s.rdb.Expire(ctx, reportsKey, s.cfg.TTL)
+	failures, err := s.rdb.HIncrBy(ctx, failuresKey, req.Reason, 1).Result()
+	if err != nil {
+		return err
+	}
+	s.rdb.Expire(ctx, failuresKey, s.cfg.TTL)
+	if reports >= int64(minReportsBeforeBan) && float64(failures)/float64(reports) >= defaultBanThreshold {
+		return s.banPeer(ctx, req.PeerID, req.SrcIP)
+	}
 	return nil
 }
 
+// banPeer records peer and its source IP (if known) in the ban set with
+// banTTL, so a banned peer can eventually rejoin once its segments and
+// reputation have expired.
+func (s *Service) banPeer(ctx context.Context, peerID, srcIP string) error {
+	entry := BanEntry{PeerID: peerID, SrcIP: srcIP}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, fmt.Sprintf("%s:%s", banSetKey, peerID), data, banTTL).Err(); err != nil {
+		return err
+	}
+	return s.rdb.SAdd(ctx, banSetKey, peerID).Err()
+}
+
+// IsBanned reports whether peerID is currently banned.
+func (s *Service) IsBanned(ctx context.Context, peerID string) (bool, error) {
+	banned, err := s.rdb.SIsMember(ctx, banSetKey, peerID).Result()
+	if err != nil {
+		return false, err
+	}
+	if !banned {
+		return false, nil
+	}
+	// The per-peer ban record carries banTTL and may have expired while
+	// the set membership (which has no TTL of its own) hasn't been
+	// cleaned up yet; treat an expired record as not banned.
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("%s:%s", banSetKey, peerID)).Result()
+	if err != nil {
+		return false, err
+	}
+	if exists == 0 {
+		s.rdb.SRem(ctx, banSetKey, peerID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// ListBans returns every currently banned peer.
+func (s *Service) ListBans(ctx context.Context) ([]BanEntry, error) {
+	peerIDs, err := s.rdb.SMembers(ctx, banSetKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	entries := make([]BanEntry, 0, len(peerIDs))
+	for _, id := range peerIDs {
+		raw, err := s.rdb.Get(ctx, fmt.Sprintf("%s:%s", banSetKey, id)).Bytes()
+		if err != nil {
+			s.rdb.SRem(ctx, banSetKey, id)
+			continue
+		}
+		var entry BanEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// PeersByCapability returns every known peer that advertised capability in
+// its most recent announce, for the tracker's GET /peers?capability= query.
+// It walks heartbeatHashKey and loads each peer:%s:meta blob the same way
+// rendezvousCandidates does, but with no hashing or scoring involved - this
+// is just "who said they can do X", not a membership lookup for a segment.
+func (s *Service) PeersByCapability(ctx context.Context, capability string) ([]PeerSummary, error) {
+	peerIDs, err := s.rdb.HKeys(ctx, heartbeatHashKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	matches := make([]PeerSummary, 0, len(peerIDs))
+	for _, id := range peerIDs {
+		metaKey := fmt.Sprintf("peer:%s:meta", id)
+		raw, err := s.rdb.Get(ctx, metaKey).Bytes()
+		if err != nil {
+			continue
+		}
+		var ann AnnounceRequest
+		if err := json.Unmarshal(raw, &ann); err != nil {
+			continue
+		}
+		if !hasCapability(ann.Capabilities, capability) {
+			continue
+		}
+		matches = append(matches, PeerSummary{
+			PeerID:       id,
+			Region:       ann.Region,
+			RTTms:        ann.RTTms,
+			Capabilities: ann.Capabilities,
+		})
+	}
+	return matches, nil
+}
+
+func hasCapability(capabilities []string, want string) bool {
+	for _, c := range capabilities {
+		if c == want {
+			return true
+		}
+	}
+	return false
+}
+
+// ProvisionPeerRequest provisions or rotates the pre-shared key a peer
+// must sign its announce/heartbeat bodies with.
+type ProvisionPeerRequest struct {
+	PeerID string `json:"peer_id"`
+	PSK    string `json:"psk"`
+}
+
+// ProvisionPeer sets peerID's pre-shared key, opting it into
+// signed-announce verification (or rotating its existing key, which
+// also resets its nonce counter since the old one no longer applies).
+func (s *Service) ProvisionPeer(ctx context.Context, req ProvisionPeerRequest) error {
+	if req.PeerID == "" || req.PSK == "" {
+		return fmt.Errorf("peer_id and psk required")
+	}
+	if err := s.rdb.Set(ctx, fmt.Sprintf(pskKeyFmt, req.PeerID), req.PSK, 0).Err(); err != nil {
+		return err
+	}
+	return s.rdb.Del(ctx, fmt.Sprintf(nonceKeyFmt, req.PeerID)).Err()
+}
+
+// RevokePeer immediately removes peerID from the mesh: its PSK, so
+// future announces are rejected outright, and the same cleanup the
+// reaper does for a peer that went silent - its segment sets, heartbeat
+// and meta records, and its node in topology.Graph.
+func (s *Service) RevokePeer(ctx context.Context, peerID string) error {
+	s.removePeer(ctx, peerID)
+	if err := s.rdb.Del(ctx, fmt.Sprintf(pskKeyFmt, peerID)).Err(); err != nil {
+		return err
+	}
+	return s.rdb.Del(ctx, fmt.Sprintf(nonceKeyFmt, peerID)).Err()
+}
+
+// VerifyPeerAuth checks the X-Peer-Auth header ("<nonce>:<hex hmac>")
+// against peerID's provisioned PSK and its last-seen nonce. A peer with
+// no PSK on file hasn't opted into signed-announce mode, so it passes
+// unchecked - this lets the two modes coexist on one tracker during a
+// migration.
+func (s *Service) VerifyPeerAuth(ctx context.Context, peerID string, body []byte, header string) error {
+	psk, err := s.rdb.Get(ctx, fmt.Sprintf(pskKeyFmt, peerID)).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	nonceStr, sig, ok := strings.Cut(header, ":")
+	if !ok || sig == "" {
+		return fmt.Errorf("missing or malformed X-Peer-Auth header")
+	}
+	nonce := parseInt64(nonceStr)
+	if nonce <= 0 {
+		return fmt.Errorf("invalid nonce")
+	}
+	nonceKey := fmt.Sprintf(nonceKeyFmt, peerID)
+	last, err := s.rdb.Get(ctx, nonceKey).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil && nonce <= parseInt64(last) {
+		return fmt.Errorf("stale or replayed nonce")
+	}
+	mac := hmac.New(sha256.New, []byte(psk))
+	mac.Write([]byte(nonceStr))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return s.rdb.Set(ctx, nonceKey, nonceStr, s.cfg.TTL).Err()
+}
+
 func (s *Service) storeSegments(ctx context.Context, peer string, segments []string) error {
 	peerSetKey := fmt.Sprintf("%s:%s:segments", peerSegmentsPrefix, peer)
 	existing, err := s.rdb.SMembers(ctx, peerSetKey).Result()
@@ -137,6 +530,9 @@ func (s *Service) storeSegments(ctx context.Context, peer string, segments []str
 		if err := s.rdb.SAdd(ctx, segmentKey, peer).Err(); err != nil {
 			return err
 		}
+		if err := s.rdb.SAdd(ctx, allSegmentsKey, seg).Err(); err != nil {
+			return err
+		}
 	}
 	for seg := range existingSet {
 		if _, keep := newSet[seg]; !keep {
@@ -160,14 +556,385 @@ func (s *Service) storeSegments(ctx context.Context, peer string, segments []str
 	return nil
 }
 
-func (s *Service) LookupSegment(ctx context.Context, segment string, preferredRegion string) (LookupResponse, error) {
+// TouchPeer refreshes peerID's heartbeat liveness timestamp and its meta
+// TTL without touching its segment or neighbor state. It's what the
+// streaming path calls on every delta event, so a peer pushing only
+// segment_added/segment_evicted events still counts as alive to the
+// reaper without needing a full heartbeat POST.
+func (s *Service) TouchPeer(ctx context.Context, peerID string) error {
+	now := time.Now().Unix()
+	if err := s.rdb.HSet(ctx, heartbeatHashKey, peerID, now).Err(); err != nil {
+		return err
+	}
+	peerKey := fmt.Sprintf("peer:%s:meta", peerID)
+	s.rdb.Expire(ctx, peerKey, s.cfg.TTL)
+	return nil
+}
+
+// ApplySegmentAdded records that peer now holds segment, without
+// re-diffing peer's whole segment set the way storeSegments does - the
+// O(1) counterpart heartbeat streaming needs so per-segment deltas don't
+// cost O(cache size) per event.
+func (s *Service) ApplySegmentAdded(ctx context.Context, peer, segment string) error {
+	segment = strings.TrimSpace(segment)
+	if segment == "" {
+		return fmt.Errorf("segment_id required")
+	}
+	peerSetKey := fmt.Sprintf("%s:%s:segments", peerSegmentsPrefix, peer)
+	segmentKey := fmt.Sprintf("%s:%s", segmentKeyPrefix, segment)
+	if err := s.rdb.SAdd(ctx, segmentKey, peer).Err(); err != nil {
+		return err
+	}
+	if err := s.rdb.SAdd(ctx, allSegmentsKey, segment).Err(); err != nil {
+		return err
+	}
+	if err := s.rdb.SAdd(ctx, peerSetKey, segment).Err(); err != nil {
+		return err
+	}
+	return s.rdb.Expire(ctx, peerSetKey, s.cfg.TTL).Err()
+}
+
+// ApplySegmentEvicted is the converse of ApplySegmentAdded: peer no
+// longer holds segment (its local cache policy evicted it).
+func (s *Service) ApplySegmentEvicted(ctx context.Context, peer, segment string) error {
+	segment = strings.TrimSpace(segment)
+	if segment == "" {
+		return fmt.Errorf("segment_id required")
+	}
+	peerSetKey := fmt.Sprintf("%s:%s:segments", peerSegmentsPrefix, peer)
+	segmentKey := fmt.Sprintf("%s:%s", segmentKeyPrefix, segment)
+	s.rdb.SRem(ctx, segmentKey, peer)
+	return s.rdb.SRem(ctx, peerSetKey, segment).Err()
+}
+
+// ApplyRTTSample folds a single fresh RTT sample into peer's stored
+// announce metadata, so LookupSegment's ranking reflects it without
+// waiting for the next full announce.
+func (s *Service) ApplyRTTSample(ctx context.Context, peer string, rttMs int) error {
+	metaKey := fmt.Sprintf("peer:%s:meta", peer)
+	raw, err := s.rdb.Get(ctx, metaKey).Bytes()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ann AnnounceRequest
+	if err := json.Unmarshal(raw, &ann); err != nil {
+		return err
+	}
+	ann.RTTms = rttMs
+	updated, err := json.Marshal(ann)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, metaKey, updated, s.cfg.TTL).Err()
+}
+
+// storeBloom persists peer's advertised Bloom filter onto its stored
+// announce metadata, the read-modify-write counterpart to ApplyRTTSample
+// for peers heartbeating in bloom mode (HandleAnnounce already writes the
+// whole request, bloom fields included, so this is only needed from
+// HandleHeartbeat).
+func (s *Service) storeBloom(ctx context.Context, peer string, bits []byte, m, k, n uint32) error {
+	metaKey := fmt.Sprintf("peer:%s:meta", peer)
+	raw, err := s.rdb.Get(ctx, metaKey).Bytes()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ann AnnounceRequest
+	if err := json.Unmarshal(raw, &ann); err != nil {
+		return err
+	}
+	ann.SegmentsBloom = bits
+	ann.SegmentsM = m
+	ann.SegmentsK = k
+	ann.SegmentsN = n
+	updated, err := json.Marshal(ann)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, metaKey, updated, s.cfg.TTL).Err()
+}
+
+// bloomCandidates scans every live peer's stored announce metadata for a
+// Bloom filter and returns the ones that may hold segment, supplementing
+// the inverted segmentKey index storeSegments maintains for peers
+// advertising a full Segments list. False positives are expected and are
+// handled downstream by fetchSegmentFromPeer's 404 path.
+func (s *Service) bloomCandidates(ctx context.Context, segment string) ([]string, error) {
+	peerIDs, err := s.rdb.HKeys(ctx, heartbeatHashKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	var matches []string
+	for _, id := range peerIDs {
+		metaKey := fmt.Sprintf("peer:%s:meta", id)
+		raw, err := s.rdb.Get(ctx, metaKey).Bytes()
+		if err != nil {
+			continue
+		}
+		var ann AnnounceRequest
+		if err := json.Unmarshal(raw, &ann); err != nil || len(ann.SegmentsBloom) == 0 {
+			continue
+		}
+		f := bloom.FromBits(ann.SegmentsBloom, ann.SegmentsM, ann.SegmentsK, ann.SegmentsN)
+		if f.MayContain(segment) {
+			matches = append(matches, id)
+		}
+	}
+	return matches, nil
+}
+
+// rendezvousVirtualNodes and rendezvousScore mirror
+// internal/topology.Ring's virtualNodesFor/hrwScore exactly - the
+// tracker talks to the topology manager only over HTTP (see
+// updateTopology), never by importing internal/topology directly, so
+// rendezvousCandidates keeps its own copy of the same small HRW
+// algorithm rather than reaching across that boundary for one function.
+func rendezvousVirtualNodes(bandwidthMbps float64) int {
+	switch {
+	case bandwidthMbps >= 500:
+		return 8
+	case bandwidthMbps >= 100:
+		return 4
+	case bandwidthMbps >= 10:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func rendezvousScore(segment, peerID string, vnode int) uint64 {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d", segment, peerID, vnode)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// rendezvousCandidates returns the top k peer IDs rendezvous hashing
+// assigns ownership of segment to, computed fresh over every live peer's
+// last-known announce metadata in O(N) - no per-segment index to
+// maintain, unlike storeSegments' inverted segmentKey set. It supplements
+// LookupSegment's real membership data the same way bloomCandidates
+// does: these are a segment's "responsible" peers whether or not they've
+// actually fetched it yet, so a miss here just means one less candidate,
+// never a false guarantee that a peer holds the segment.
+func (s *Service) rendezvousCandidates(ctx context.Context, segment string, k int) ([]string, error) {
+	peerIDs, err := s.rdb.HKeys(ctx, heartbeatHashKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	type scored struct {
+		id    string
+		score uint64
+	}
+	candidates := make([]scored, 0, len(peerIDs))
+	for _, id := range peerIDs {
+		metaKey := fmt.Sprintf("peer:%s:meta", id)
+		raw, err := s.rdb.Get(ctx, metaKey).Bytes()
+		if err != nil {
+			continue
+		}
+		var ann AnnounceRequest
+		if err := json.Unmarshal(raw, &ann); err != nil {
+			continue
+		}
+		var best uint64
+		for v := 0; v < rendezvousVirtualNodes(ann.BandwidthMbps); v++ {
+			if sc := rendezvousScore(segment, id, v); sc > best {
+				best = sc
+			}
+		}
+		candidates = append(candidates, scored{id: id, score: best})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].id < candidates[j].id
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.id
+	}
+	return out, nil
+}
+
+// storeWebSeeds folds urls into the tracker-wide set of known webseed
+// origins. Unlike per-peer segments, webseeds aren't scoped to the
+// announcing peer or expired with its TTL: once an origin CDN URL is
+// known it stays known, since it isn't tied to any one peer's liveness.
+func (s *Service) storeWebSeeds(ctx context.Context, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(urls))
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		values = append(values, url)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return s.rdb.SAdd(ctx, webseedSetKey, values...).Err()
+}
+
+// storeWebSeedsWT mirrors storeWebSeeds for the subset of webseed URLs
+// that also accept WebTransport connections.
+func (s *Service) storeWebSeedsWT(ctx context.Context, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(urls))
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		values = append(values, url)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return s.rdb.SAdd(ctx, webseedWTSetKey, values...).Err()
+}
+
+// ListWebSeeds returns every webseed origin announced so far.
+func (s *Service) ListWebSeeds(ctx context.Context) ([]string, error) {
+	urls, err := s.rdb.SMembers(ctx, webseedSetKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// ListWebSeedsWT returns every webseed origin known to also accept
+// WebTransport connections.
+func (s *Service) ListWebSeedsWT(ctx context.Context) ([]string, error) {
+	urls, err := s.rdb.SMembers(ctx, webseedWTSetKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// ScrapeStats is the BEP-48-style swarm summary for a single segment:
+// how many holders are seeds (Complete), how many are still fetching
+// it (Incomplete), and how many completions the tracker has ever
+// registered for it (Downloaded, monotonic).
+type ScrapeStats struct {
+	Complete   int64 `json:"complete"`
+	Incomplete int64 `json:"incomplete"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// ScrapeResponse mirrors BEP-48's "files" map, keyed by segment id
+// instead of by info-hash.
+type ScrapeResponse struct {
+	Files map[string]ScrapeStats `json:"files"`
+}
+
+// Scrape reports complete/incomplete/downloaded swarm counts for each
+// of segments. Complete and incomplete are derived from each current
+// holder's most recently announced Left value (0 = seed, >0 = still
+// fetching); downloaded is the lifetime counter recordCompletion
+// maintains. Unknown or empty segment ids are skipped rather than
+// erroring, so a caller can scrape a batch without one bad id failing
+// the whole request.
+func (s *Service) Scrape(ctx context.Context, segments []string) (ScrapeResponse, error) {
+	files := make(map[string]ScrapeStats, len(segments))
+	for _, seg := range segments {
+		seg = strings.TrimSpace(seg)
+		if seg == "" {
+			continue
+		}
+		segmentKey := fmt.Sprintf("%s:%s", segmentKeyPrefix, seg)
+		peerIDs, err := s.rdb.SMembers(ctx, segmentKey).Result()
+		if err != nil && err != redis.Nil {
+			return ScrapeResponse{}, err
+		}
+		var complete, incomplete int64
+		for _, peerID := range peerIDs {
+			raw, err := s.rdb.Get(ctx, fmt.Sprintf("peer:%s:meta", peerID)).Bytes()
+			if err != nil {
+				continue
+			}
+			var ann AnnounceRequest
+			if err := json.Unmarshal(raw, &ann); err != nil {
+				continue
+			}
+			if ann.Left == 0 {
+				complete++
+			} else {
+				incomplete++
+			}
+		}
+		statsKey := fmt.Sprintf("%s:%s:stats", segmentKeyPrefix, seg)
+		downloaded, err := s.rdb.HGet(ctx, statsKey, "downloaded").Result()
+		if err != nil && err != redis.Nil {
+			return ScrapeResponse{}, err
+		}
+		files[seg] = ScrapeStats{
+			Complete:   complete,
+			Incomplete: incomplete,
+			Downloaded: parseInt64(downloaded),
+		}
+	}
+	return ScrapeResponse{Files: files}, nil
+}
+
+// LookupSegment returns the peers and webseeds known to hold segment,
+// ranked best-first for requesterID (which may be empty, in which case
+// ranking falls back to region/RTT/reputation only - no path cost).
+func (s *Service) LookupSegment(ctx context.Context, segment string, preferredRegion string, requesterID string) (LookupResponse, error) {
 	segmentKey := fmt.Sprintf("%s:%s", segmentKeyPrefix, segment)
 	peerIDs, err := s.rdb.SMembers(ctx, segmentKey).Result()
 	if err != nil && err != redis.Nil {
 		return LookupResponse{}, err
 	}
+	bloomIDs, err := s.bloomCandidates(ctx, segment)
+	if err != nil {
+		return LookupResponse{}, err
+	}
+	rendezvousIDs, err := s.rendezvousCandidates(ctx, segment, 5)
+	if err != nil {
+		return LookupResponse{}, err
+	}
+	if len(bloomIDs) > 0 || len(rendezvousIDs) > 0 {
+		seen := make(map[string]struct{}, len(peerIDs))
+		for _, id := range peerIDs {
+			seen[id] = struct{}{}
+		}
+		for _, id := range append(bloomIDs, rendezvousIDs...) {
+			if _, ok := seen[id]; !ok {
+				peerIDs = append(peerIDs, id)
+				seen[id] = struct{}{}
+			}
+		}
+	}
+	pathCost, err := s.fetchPathCosts(ctx, requesterID)
+	if err != nil {
+		return LookupResponse{}, err
+	}
 	summaries := make([]PeerSummary, 0, len(peerIDs))
 	for _, id := range peerIDs {
+		banned, err := s.IsBanned(ctx, id)
+		if err != nil {
+			return LookupResponse{}, err
+		}
+		if banned {
+			continue
+		}
 		metaKey := fmt.Sprintf("peer:%s:meta", id)
 		raw, err := s.rdb.Get(ctx, metaKey).Bytes()
 		if err != nil {
@@ -183,29 +950,129 @@ func (s *Service) LookupSegment(ctx context.Context, segment string, preferredRe
 			RTTms:  ann.RTTms,
 		})
 	}
-	sortPeers(summaries, preferredRegion)
-	return LookupResponse{
-		Segment: segment,
-		Peers:   summaries,
-	}, nil
+	sortPeers(ctx, s, summaries, preferredRegion, pathCost)
+	webseeds, err := s.ListWebSeeds(ctx)
+	if err != nil {
+		return LookupResponse{}, err
+	}
+	webseedsWT, err := s.ListWebSeedsWT(ctx)
+	if err != nil {
+		return LookupResponse{}, err
+	}
+	resp := LookupResponse{
+		Segment:    segment,
+		Peers:      summaries,
+		WebSeeds:   webseeds,
+		WebSeedsWT: webseedsWT,
+	}
+	if s.cfg.Stream != nil && len(summaries) > 0 {
+		s.cfg.Stream.Push(summaries[0].PeerID, PushMessage{
+			Type:      "peer_wants",
+			SegmentID: segment,
+			PeerID:    requesterID,
+		})
+	}
+	s.publish("lookup", map[string]any{"segment": segment, "requester": requesterID, "peer_count": len(summaries)})
+	return resp, nil
 }
 
-func sortPeers(peers []PeerSummary, preferredRegion string) {
-	less := func(i, j int) bool {
-		ri := peers[i].Region == preferredRegion
-		rj := peers[j].Region == preferredRegion
-		if ri != rj {
-			return ri
-		}
-		return peers[i].RTTms < peers[j].RTTms
+// sortPeers ranks peers best-first with sort.Slice over a blended
+// score: region match, RTT, recent success rate from the reputation
+// subsystem, and (when available) shortest-path cost from the
+// requester. Replaces the old O(n^2) bubble sort, which stopped
+// scaling past a few hundred peers.
+func sortPeers(ctx context.Context, s *Service, peers []PeerSummary, preferredRegion string, pathCost map[string]float64) {
+	scores := make(map[string]float64, len(peers))
+	for _, p := range peers {
+		scores[p.PeerID] = scorePeer(p, preferredRegion, s.successRate(ctx, p.PeerID), pathCost)
 	}
-	for i := 0; i < len(peers); i++ {
-		for j := i + 1; j < len(peers); j++ {
-			if !less(i, j) {
-				peers[i], peers[j] = peers[j], peers[i]
-			}
-		}
+	sort.Slice(peers, func(i, j int) bool {
+		return scores[peers[i].PeerID] > scores[peers[j].PeerID]
+	})
+}
+
+func scorePeer(p PeerSummary, preferredRegion string, successRate float64, pathCost map[string]float64) float64 {
+	score := 0.0
+	if preferredRegion != "" && p.Region == preferredRegion {
+		score += 100
+	}
+	score -= float64(p.RTTms) * 0.5
+	score += successRate * 50
+	if cost, ok := pathCost[p.PeerID]; ok {
+		score -= cost * 0.2
+	}
+	return score
+}
+
+// successRate returns peerID's recent (1 - failures/reports) rate from
+// the reputation subsystem, or 1.0 if it has no reports on file yet.
+func (s *Service) successRate(ctx context.Context, peerID string) float64 {
+	reportsKey := fmt.Sprintf("peer:%s:reports", peerID)
+	total, err := s.rdb.HGet(ctx, reportsKey, "total").Result()
+	if err != nil {
+		return 1.0
+	}
+	reports := parseInt64(total)
+	if reports == 0 {
+		return 1.0
+	}
+	failuresKey := fmt.Sprintf("peer:%s:failures", peerID)
+	byReason, err := s.rdb.HGetAll(ctx, failuresKey).Result()
+	if err != nil {
+		return 1.0
+	}
+	var failures int64
+	for _, v := range byReason {
+		failures += parseInt64(v)
+	}
+	rate := 1 - float64(failures)/float64(reports)
+	if rate < 0 {
+		rate = 0
+	}
+	return rate
+}
+
+// fetchPathCosts returns the shortest-path RTT cost from requesterID to
+// every node the topology service can reach, cached for pathCostTTL. It
+// degrades to nil (no path-cost component in scoring) rather than
+// failing the lookup if requesterID is empty or the topology service
+// can't be reached.
+func (s *Service) fetchPathCosts(ctx context.Context, requesterID string) (map[string]float64, error) {
+	if s.cfg.TopologyURL == "" || requesterID == "" {
+		return nil, nil
+	}
+	s.mu.RLock()
+	entry, ok := s.pathCosts[requesterID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.cost, nil
+	}
+
+	url := fmt.Sprintf("%s/paths?from=%s", strings.TrimSuffix(s.cfg.TopologyURL, "/"), requesterID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// Topology service being unreachable shouldn't fail the lookup -
+		// just score without the path-cost component.
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	var payload struct {
+		Cost map[string]float64 `json:"cost"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, nil
 	}
+	s.mu.Lock()
+	s.pathCosts[requesterID] = pathCostEntry{cost: payload.Cost, expiresAt: time.Now().Add(pathCostTTL)}
+	s.mu.Unlock()
+	return payload.Cost, nil
 }
 
 func (s *Service) StartReaper(ctx context.Context) {
@@ -233,6 +1100,7 @@ func (s *Service) reap(ctx context.Context) {
 		ts := parseInt64(tsStr)
 		if now-ts > int64(s.cfg.TTL.Seconds()) {
 			s.removePeer(ctx, peer)
+			s.publish("reap", map[string]any{"peer_id": peer})
 		}
 	}
 }
@@ -284,6 +1152,7 @@ func (s *Service) updateTopology(ctx context.Context, peerID, region string, rtt
 	if err != nil {
 		return err
 	}
+	s.publish("topology_mutation", payload)
 	resp.Body.Close()
 	return nil
 }
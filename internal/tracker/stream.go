@@ -0,0 +1,154 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamPushBuffer bounds how many pending push messages a peer's
+// stream can accumulate before new ones are dropped, mirroring the
+// events bus's subscriberBuffer: a slow or stalled peer shouldn't back
+// up the tracker.
+const streamPushBuffer = 100_000
+
+// StreamEvent is one delta a peer pushes over its persistent tracker
+// stream in place of re-sending its full state on the next heartbeat.
+type StreamEvent struct {
+	Type      string   `json:"type"` // segment_added, segment_evicted, neighbor_changed, rtt_sample
+	SegmentID string   `json:"segment_id,omitempty"`
+	Neighbors []string `json:"neighbors,omitempty"`
+	RTTms     int      `json:"rtt_ms,omitempty"`
+}
+
+// PushMessage is what the tracker pushes down a peer's stream in
+// response to state changes elsewhere in the swarm.
+type PushMessage struct {
+	Type      string `json:"type"` // peer_wants, topology_changed
+	SegmentID string `json:"segment_id,omitempty"`
+	PeerID    string `json:"peer_id,omitempty"`
+}
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// StreamHub holds one outbound push channel per connected peer. It
+// doesn't reference a Service directly - ServeWS takes one as a
+// parameter - so a Service can hold a StreamHub in its Config purely for
+// Push without a dependency cycle between the two.
+type StreamHub struct {
+	mu    sync.RWMutex
+	peers map[string]chan []byte
+}
+
+func NewStreamHub() *StreamHub {
+	return &StreamHub{peers: make(map[string]chan []byte)}
+}
+
+// ServeWS upgrades r to a WebSocket for the peer named in the "peer"
+// query parameter and runs its session until it disconnects: applying
+// incoming delta events to svc and writing out any push messages queued
+// for it via Push. Intended to back the tracker's /stream endpoint.
+func (h *StreamHub) ServeWS(svc *Service, w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peer")
+	if peerID == "" {
+		http.Error(w, "peer query parameter required", http.StatusBadRequest)
+		return
+	}
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	outbox := h.register(peerID)
+	defer h.unregister(peerID, outbox)
+
+	go func() {
+		for encoded := range outbox {
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, encoded); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var ev StreamEvent
+		if err := json.Unmarshal(msg, &ev); err != nil {
+			continue
+		}
+		if err := h.apply(r.Context(), svc, peerID, ev); err != nil {
+			log.Printf("tracker stream: apply %s from %s failed: %v", ev.Type, peerID, err)
+		}
+	}
+}
+
+func (h *StreamHub) register(peerID string) chan []byte {
+	ch := make(chan []byte, streamPushBuffer)
+	h.mu.Lock()
+	h.peers[peerID] = ch
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *StreamHub) unregister(peerID string, ch chan []byte) {
+	h.mu.Lock()
+	if h.peers[peerID] == ch {
+		delete(h.peers, peerID)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+func (h *StreamHub) apply(ctx context.Context, svc *Service, peerID string, ev StreamEvent) error {
+	if err := svc.TouchPeer(ctx, peerID); err != nil {
+		return err
+	}
+	switch ev.Type {
+	case "segment_added":
+		return svc.ApplySegmentAdded(ctx, peerID, ev.SegmentID)
+	case "segment_evicted":
+		return svc.ApplySegmentEvicted(ctx, peerID, ev.SegmentID)
+	case "neighbor_changed":
+		return svc.updateTopology(ctx, peerID, "", 0, ev.Neighbors)
+	case "rtt_sample":
+		return svc.ApplyRTTSample(ctx, peerID, ev.RTTms)
+	default:
+		return fmt.Errorf("unknown stream event type %q", ev.Type)
+	}
+}
+
+// Push queues msg for delivery down peerID's stream, if it has one
+// open. Delivery is best-effort and non-blocking: a peer that isn't
+// connected, or whose buffer is full, simply misses the push and falls
+// back to discovering the same change on its next poll or heartbeat.
+func (h *StreamHub) Push(peerID string, msg PushMessage) {
+	h.mu.RLock()
+	ch := h.peers[peerID]
+	h.mu.RUnlock()
+	if ch == nil {
+		return
+	}
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case ch <- encoded:
+	default:
+	}
+}
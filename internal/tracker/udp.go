@@ -0,0 +1,225 @@
+package tracker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// UDP tracker actions, named after BEP-15's so the wire shape stays
+// recognizable even though the payload past the fixed header is JSON
+// rather than BEP-15's bencoded/fixed-width fields - the simulator's
+// peers and the /announce HTTP path already share the AnnounceRequest
+// and ScrapeResponse encoders, and this reuses them instead of
+// maintaining a second payload format for one protocol.
+const (
+	udpActionConnect  uint32 = 0
+	udpActionAnnounce uint32 = 1
+	udpActionScrape   uint32 = 2
+	udpActionError    uint32 = 3
+)
+
+// udpProtocolMagic is the fixed connection id a client must present on
+// its first Connect request, exactly as BEP-15 specifies, so the
+// tracker can tell a handshake attempt from a forged or stale
+// connection id.
+const udpProtocolMagic uint64 = 0x41727101980
+
+// udpConnectionTTL bounds how long a minted connection id stays valid,
+// matching BEP-15's two-minute window.
+const udpConnectionTTL = 2 * time.Minute
+
+// udpHeaderSize is the fixed prefix of every UDP tracker packet: an
+// 8-byte connection id (the handshake's output), a 4-byte action, a
+// 4-byte transaction id the client correlates its response by, and a
+// 4-byte length of the JSON payload that follows.
+const udpHeaderSize = 20
+
+type udpHeader struct {
+	ConnectionID  uint64
+	Action        uint32
+	TransactionID uint32
+	PayloadLen    uint32
+}
+
+func (h udpHeader) marshal() []byte {
+	buf := make([]byte, udpHeaderSize)
+	binary.BigEndian.PutUint64(buf[0:8], h.ConnectionID)
+	binary.BigEndian.PutUint32(buf[8:12], h.Action)
+	binary.BigEndian.PutUint32(buf[12:16], h.TransactionID)
+	binary.BigEndian.PutUint32(buf[16:20], h.PayloadLen)
+	return buf
+}
+
+func unmarshalUDPHeader(buf []byte) (udpHeader, error) {
+	if len(buf) < udpHeaderSize {
+		return udpHeader{}, fmt.Errorf("udp tracker: packet too short (%d bytes)", len(buf))
+	}
+	return udpHeader{
+		ConnectionID:  binary.BigEndian.Uint64(buf[0:8]),
+		Action:        binary.BigEndian.Uint32(buf[8:12]),
+		TransactionID: binary.BigEndian.Uint32(buf[12:16]),
+		PayloadLen:    binary.BigEndian.Uint32(buf[16:20]),
+	}, nil
+}
+
+// UDPServer exposes Service's announce/scrape over the compact binary
+// protocol above, alongside the existing JSON HTTP path, for peers that
+// want to avoid HTTP's per-request overhead at simulator scale.
+type UDPServer struct {
+	service *Service
+
+	mu          sync.Mutex
+	connections map[uint64]time.Time // minted connection id -> expiry
+}
+
+// NewUDPServer builds a UDPServer backed by service.
+func NewUDPServer(service *Service) *UDPServer {
+	return &UDPServer{
+		service:     service,
+		connections: make(map[uint64]time.Time),
+	}
+}
+
+// ListenAndServe opens a UDP socket on addr and serves requests until
+// ctx is cancelled.
+func (u *UDPServer) ListenAndServe(ctx context.Context, addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 8192)
+	for {
+		n, remote, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("udp tracker: read error: %v", err)
+			continue
+		}
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		go u.handle(ctx, conn, remote, packet)
+	}
+}
+
+func (u *UDPServer) handle(ctx context.Context, conn *net.UDPConn, remote *net.UDPAddr, packet []byte) {
+	header, err := unmarshalUDPHeader(packet)
+	if err != nil {
+		return
+	}
+	payload := packet[udpHeaderSize:]
+	if int(header.PayloadLen) > len(payload) {
+		return
+	}
+	payload = payload[:header.PayloadLen]
+
+	switch header.Action {
+	case udpActionConnect:
+		u.handleConnect(conn, remote, header)
+	case udpActionAnnounce:
+		u.handleAnnounce(ctx, conn, remote, header, payload)
+	case udpActionScrape:
+		u.handleScrape(ctx, conn, remote, header, payload)
+	default:
+		u.writeError(conn, remote, header.TransactionID, "unknown action")
+	}
+}
+
+func (u *UDPServer) handleConnect(conn *net.UDPConn, remote *net.UDPAddr, header udpHeader) {
+	if header.ConnectionID != udpProtocolMagic {
+		u.writeError(conn, remote, header.TransactionID, "bad connection id")
+		return
+	}
+	connID := u.mintConnectionID()
+	resp := udpHeader{ConnectionID: connID, Action: udpActionConnect, TransactionID: header.TransactionID}
+	conn.WriteToUDP(resp.marshal(), remote)
+}
+
+func (u *UDPServer) mintConnectionID() uint64 {
+	var idBytes [8]byte
+	rand.Read(idBytes[:])
+	id := binary.BigEndian.Uint64(idBytes[:])
+	u.mu.Lock()
+	u.connections[id] = time.Now().Add(udpConnectionTTL)
+	u.mu.Unlock()
+	return id
+}
+
+func (u *UDPServer) validConnection(id uint64) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	expiry, ok := u.connections[id]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(u.connections, id)
+		return false
+	}
+	return true
+}
+
+func (u *UDPServer) handleAnnounce(ctx context.Context, conn *net.UDPConn, remote *net.UDPAddr, header udpHeader, payload []byte) {
+	if !u.validConnection(header.ConnectionID) {
+		u.writeError(conn, remote, header.TransactionID, "bad connection id")
+		return
+	}
+	var req AnnounceRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		u.writeError(conn, remote, header.TransactionID, "malformed announce payload")
+		return
+	}
+	if err := u.service.HandleAnnounce(ctx, req); err != nil {
+		u.writeError(conn, remote, header.TransactionID, err.Error())
+		return
+	}
+	resp := udpHeader{ConnectionID: header.ConnectionID, Action: udpActionAnnounce, TransactionID: header.TransactionID}
+	conn.WriteToUDP(resp.marshal(), remote)
+}
+
+func (u *UDPServer) handleScrape(ctx context.Context, conn *net.UDPConn, remote *net.UDPAddr, header udpHeader, payload []byte) {
+	if !u.validConnection(header.ConnectionID) {
+		u.writeError(conn, remote, header.TransactionID, "bad connection id")
+		return
+	}
+	var segments []string
+	if err := json.Unmarshal(payload, &segments); err != nil {
+		u.writeError(conn, remote, header.TransactionID, "malformed scrape payload")
+		return
+	}
+	resp, err := u.service.Scrape(ctx, segments)
+	if err != nil {
+		u.writeError(conn, remote, header.TransactionID, err.Error())
+		return
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		u.writeError(conn, remote, header.TransactionID, err.Error())
+		return
+	}
+	out := udpHeader{ConnectionID: header.ConnectionID, Action: udpActionScrape, TransactionID: header.TransactionID, PayloadLen: uint32(len(body))}
+	conn.WriteToUDP(append(out.marshal(), body...), remote)
+}
+
+func (u *UDPServer) writeError(conn *net.UDPConn, remote *net.UDPAddr, txID uint32, msg string) {
+	body := []byte(msg)
+	out := udpHeader{Action: udpActionError, TransactionID: txID, PayloadLen: uint32(len(body))}
+	conn.WriteToUDP(append(out.marshal(), body...), remote)
+}
@@ -0,0 +1,161 @@
+// Package bloom implements a minimal Bloom filter, shared by the peer
+// (which builds one from its cache contents to advertise) and the
+// tracker (which membership-tests it on lookup) so segment-ID sets
+// don't have to travel as O(n) strings on the wire.
+package bloom
+
+import "hash/fnv"
+
+const (
+	// bitsPerEntry and hashFuncs give roughly a 1% false-positive rate
+	// at capacity (the standard m = n*10, k = 7 tuning).
+	bitsPerEntry = 10
+	hashFuncs    = 7
+	minBits      = 64
+)
+
+// Params sizes a filter for n entries, returning bit count m and hash
+// function count k.
+func Params(n int) (m, k uint32) {
+	if n <= 0 {
+		return minBits, hashFuncs
+	}
+	bits := uint32(n) * bitsPerEntry
+	if bits < minBits {
+		bits = minBits
+	}
+	return bits, hashFuncs
+}
+
+// Filter is a fixed-size Bloom filter: cheap to test and to ship over
+// the wire, but it can't un-set a bit, so a filter covering a shrinking
+// set (e.g. after a cache eviction) must be rebuilt from scratch rather
+// than mutated.
+type Filter struct {
+	bits []byte
+	m    uint32
+	k    uint32
+	n    uint32
+}
+
+// New returns an empty filter with m bits and k hash functions.
+func New(m, k uint32) *Filter {
+	if m == 0 {
+		m = minBits
+	}
+	if k == 0 {
+		k = hashFuncs
+	}
+	return &Filter{bits: make([]byte, (m+7)/8), m: m, k: k}
+}
+
+// Add inserts key into the filter.
+func (f *Filter) Add(key string) {
+	h1, h2 := split(key)
+	for i := uint32(0); i < f.k; i++ {
+		idx := index(h1, h2, i, f.m)
+		f.bits[idx/8] |= 1 << (idx % 8)
+	}
+	f.n++
+}
+
+// MayContain reports whether key could be a member: false means
+// definitely not present, true means present or a false positive.
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := split(key)
+	for i := uint32(0); i < f.k; i++ {
+		idx := index(h1, h2, i, f.m)
+		if f.bits[idx/8]&(1<<(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Bits returns the filter's packed bit array, for AnnouncePayload.SegmentsBloom.
+func (f *Filter) Bits() []byte { return f.bits }
+
+// Params returns the (m, k, n) a reader needs to reconstruct and test
+// this filter from its raw bits.
+func (f *Filter) Params() (m, k, n uint32) { return f.m, f.k, f.n }
+
+// FromBits reconstructs a Filter from a wire-transmitted bit array and
+// its (m, k) parameters, for the tracker side to membership-test.
+func FromBits(bits []byte, m, k, n uint32) *Filter {
+	return &Filter{bits: bits, m: m, k: k, n: n}
+}
+
+// CountingFilter is a counting-Bloom variant: each slot is a small
+// counter instead of a single bit, so Remove can undo an Add without
+// requiring a full rebuild. Useful when a peer wants its advertised
+// filter to track incremental cache Put/evict events rather than being
+// recomputed from Keys() on every heartbeat.
+type CountingFilter struct {
+	counts []uint8
+	m, k   uint32
+}
+
+// NewCounting returns an empty counting filter with m slots and k hash
+// functions.
+func NewCounting(m, k uint32) *CountingFilter {
+	if m == 0 {
+		m = minBits
+	}
+	if k == 0 {
+		k = hashFuncs
+	}
+	return &CountingFilter{counts: make([]uint8, m), m: m, k: k}
+}
+
+// Add increments key's k slots.
+func (c *CountingFilter) Add(key string) {
+	h1, h2 := split(key)
+	for i := uint32(0); i < c.k; i++ {
+		idx := index(h1, h2, i, c.m)
+		if c.counts[idx] < 255 {
+			c.counts[idx]++
+		}
+	}
+}
+
+// Remove decrements key's k slots, undoing a prior Add. Calling it for
+// a key that was never added (or whose slots have saturated at 255)
+// leaves those slots untouched rather than underflowing.
+func (c *CountingFilter) Remove(key string) {
+	h1, h2 := split(key)
+	for i := uint32(0); i < c.k; i++ {
+		idx := index(h1, h2, i, c.m)
+		if c.counts[idx] > 0 && c.counts[idx] < 255 {
+			c.counts[idx]--
+		}
+	}
+}
+
+// Snapshot collapses the counting filter down to a plain Filter (any
+// non-zero count becomes a set bit), the wire format AnnouncePayload
+// actually sends.
+func (c *CountingFilter) Snapshot() *Filter {
+	bits := make([]byte, (c.m+7)/8)
+	var n uint32
+	for idx, count := range c.counts {
+		if count > 0 {
+			bits[idx/8] |= 1 << (uint32(idx) % 8)
+		}
+	}
+	return &Filter{bits: bits, m: c.m, k: c.k, n: n}
+}
+
+// split hashes key with two independent functions, whose combination
+// via index() simulates k hash functions without computing k of them
+// (Kirsch-Mitzenmacher double hashing).
+func split(key string) (h1, h2 uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(key))
+	b := fnv.New64()
+	b.Write([]byte(key))
+	return a.Sum64(), b.Sum64()
+}
+
+func index(h1, h2 uint64, i, m uint32) uint32 {
+	return uint32((h1 + uint64(i)*h2) % uint64(m))
+}
@@ -0,0 +1,156 @@
+// Package health tracks per-node consecutive-failure counts and derives an
+// exponential-backoff reconnection delay from them - the circuit-breaker
+// bookkeeping FindSegment needs to stop routing through nodes that keep
+// failing or timing out. The backoff curve (20ms base, doubling to a 30s
+// cap, with jitter) mirrors internal/backoff's; this package reimplements
+// it rather than importing it, since cmd/network-topology never depends on
+// cloud_project/* packages (see dht.go, selector.go for the same call).
+package health
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	baseDelay = 20 * time.Millisecond
+	maxDelay  = 30 * time.Second
+)
+
+// State is a node's circuit-breaker state, exported as a metrics label.
+type State string
+
+const (
+	StateClosed   State = "closed"    // healthy, requests routed normally
+	StateOpen     State = "open"      // failing, skipped until NextAttemptAt elapses
+	StateHalfOpen State = "half_open" // backoff elapsed, one trial request in flight
+)
+
+// nodeHealth is one node's failure streak and circuit state.
+type nodeHealth struct {
+	mu               sync.Mutex
+	consecutiveFails int
+	nextAttemptAt    time.Time
+	state            State
+}
+
+// Tracker maintains every known node's circuit state. The zero value is
+// not usable; construct with NewTracker.
+type Tracker struct {
+	mu    sync.RWMutex
+	nodes map[string]*nodeHealth
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{nodes: make(map[string]*nodeHealth)}
+}
+
+func (t *Tracker) nodeFor(id string) *nodeHealth {
+	t.mu.RLock()
+	n, ok := t.nodes[id]
+	t.mu.RUnlock()
+	if ok {
+		return n
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n, ok := t.nodes[id]; ok {
+		return n
+	}
+	n = &nodeHealth{state: StateClosed}
+	t.nodes[id] = n
+	return n
+}
+
+// ReportSuccess resets nodeID's failure streak and closes its circuit.
+func (t *Tracker) ReportSuccess(nodeID string) {
+	n := t.nodeFor(nodeID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.consecutiveFails = 0
+	n.nextAttemptAt = time.Time{}
+	n.state = StateClosed
+}
+
+// ReportFailure records a failed or timed-out request against nodeID,
+// opening its circuit and scheduling the next retry per exponential
+// backoff with jitter.
+func (t *Tracker) ReportFailure(nodeID string) {
+	n := t.nodeFor(nodeID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.consecutiveFails++
+	n.nextAttemptAt = time.Now().Add(backoffDelay(n.consecutiveFails))
+	n.state = StateOpen
+}
+
+func backoffDelay(fails int) time.Duration {
+	d := baseDelay
+	for i := 1; i < fails; i++ {
+		d *= 2
+		if d >= maxDelay {
+			d = maxDelay
+			break
+		}
+	}
+	return jitter(d)
+}
+
+// jitter returns a duration randomized within +/-50% of d, the same full
+// jitter internal/backoff applies to its own intervals.
+func jitter(d time.Duration) time.Duration {
+	delta := 0.5 * float64(d)
+	min := float64(d) - delta
+	max := float64(d) + delta
+	return time.Duration(min + rand.Float64()*(max-min))
+}
+
+// Blocked reports whether nodeID should currently be skipped for routing:
+// its circuit is open and backoff hasn't elapsed yet, or a half-open
+// trial request is already outstanding awaiting its outcome. It's a pure
+// read - safe to call repeatedly while scanning candidates - so claiming
+// the one trial a half-open circuit allows is a separate step; see Claim.
+func (t *Tracker) Blocked(nodeID string) bool {
+	n := t.nodeFor(nodeID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch n.state {
+	case StateOpen:
+		return time.Now().Before(n.nextAttemptAt)
+	case StateHalfOpen:
+		return true
+	default:
+		return false
+	}
+}
+
+// Claim marks nodeID's elapsed-backoff circuit half-open, consuming the
+// one trial request a caller is about to route there. Call it once a
+// candidate has actually been selected for routing, not while merely
+// scanning for eligible candidates (Blocked covers that).
+func (t *Tracker) Claim(nodeID string) {
+	n := t.nodeFor(nodeID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state == StateOpen && !time.Now().Before(n.nextAttemptAt) {
+		n.state = StateHalfOpen
+	}
+}
+
+// State reports nodeID's current circuit state.
+func (t *Tracker) State(nodeID string) State {
+	n := t.nodeFor(nodeID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state
+}
+
+// NextAttemptAt reports when nodeID's circuit next allows a request, the
+// zero value if it's currently closed.
+func (t *Tracker) NextAttemptAt(nodeID string) time.Time {
+	n := t.nodeFor(nodeID)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.nextAttemptAt
+}
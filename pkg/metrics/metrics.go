@@ -6,6 +6,17 @@ type Metrics struct {
 	NodeRequests        *prometheus.CounterVec
 	HTTPRequestTotal    *prometheus.CounterVec
 	SegmentResponseTime *prometheus.HistogramVec
+	TierAccessTotal     *prometheus.CounterVec
+	CacheHitTotal       *prometheus.CounterVec
+	CacheMissTotal      *prometheus.CounterVec
+	OutboundQueueDepth  *prometheus.GaugeVec
+	CircuitBreakerState *prometheus.GaugeVec
+	NodeCircuitState    *prometheus.GaugeVec
+
+	SignalingMessagesSent *prometheus.CounterVec
+	SignalingDropped      *prometheus.CounterVec
+	SignalingClients      *prometheus.GaugeVec
+	SignalingRooms        prometheus.Gauge
 }
 
 func NewMetrics() *Metrics {
@@ -24,6 +35,46 @@ func NewMetrics() *Metrics {
 			NativeHistogramBucketFactor:    2,
 			NativeHistogramMaxBucketNumber: 25,
 		}, []string{"source"}),
+		TierAccessTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tier_access_total",
+			Help: "Total number of segment accesses resolved by cache tier (mem, db, peer, origin).",
+		}, []string{"tier"}),
+		CacheHitTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_hit_total",
+			Help: "Total number of peer cache hits per eviction policy and segment.",
+		}, []string{"policy", "segment"}),
+		CacheMissTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_miss_total",
+			Help: "Total number of peer cache misses per eviction policy and segment.",
+		}, []string{"policy", "segment"}),
+		OutboundQueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "outbound_queue_depth",
+			Help: "Current item count in the outbound segment-send priority queue, per band.",
+		}, []string{"peer", "band"}),
+		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "peer_send_circuit_breaker_state",
+			Help: "Per-destination-peer send circuit breaker state: 0=closed, 1=half-open, 2=open.",
+		}, []string{"peer", "destination"}),
+		NodeCircuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "node_circuit_state",
+			Help: "1 for a node's current pkg/health circuit state, 0 for its other possible states, labeled by node and state (closed, open, half_open).",
+		}, []string{"node", "state"}),
+		SignalingMessagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "signaling_messages_sent_total",
+			Help: "Total number of signaling messages successfully queued to a client, per room and message type.",
+		}, []string{"room", "type"}),
+		SignalingDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "signaling_dropped_total",
+			Help: "Total number of signaling messages dropped because a client's send buffer was full, per room and peer.",
+		}, []string{"room", "peer"}),
+		SignalingClients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "signaling_clients",
+			Help: "Current number of connected signaling clients per room.",
+		}, []string{"room"}),
+		SignalingRooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "signaling_rooms",
+			Help: "Current number of active signaling rooms on this instance.",
+		}),
 	}
 }
 
@@ -37,6 +88,36 @@ func (m *Metrics) Register(registry *prometheus.Registry) error {
 	if err := registry.Register(m.SegmentResponseTime); err != nil {
 		return err
 	}
+	if err := registry.Register(m.TierAccessTotal); err != nil {
+		return err
+	}
+	if err := registry.Register(m.CacheHitTotal); err != nil {
+		return err
+	}
+	if err := registry.Register(m.CacheMissTotal); err != nil {
+		return err
+	}
+	if err := registry.Register(m.OutboundQueueDepth); err != nil {
+		return err
+	}
+	if err := registry.Register(m.CircuitBreakerState); err != nil {
+		return err
+	}
+	if err := registry.Register(m.NodeCircuitState); err != nil {
+		return err
+	}
+	if err := registry.Register(m.SignalingMessagesSent); err != nil {
+		return err
+	}
+	if err := registry.Register(m.SignalingDropped); err != nil {
+		return err
+	}
+	if err := registry.Register(m.SignalingClients); err != nil {
+		return err
+	}
+	if err := registry.Register(m.SignalingRooms); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,159 @@
+// Package reputation tracks per-peer-pair upload/download reciprocity, the
+// tit-for-tat bookkeeping a BitTorrent-style PeerSelector needs to tell
+// generous peers from freeloaders. Counts decay lazily toward neutral the
+// same way internal/peer/rtt's bandwidth estimate does, so a pair's score
+// reflects recent trading behavior rather than whatever happened when the
+// two peers first met.
+package reputation
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// halfLife is how long it takes an idle pair's uploaded/downloaded counts
+// to decay to half their value; a pair that stops trading eventually
+// reads back to neutral (Ratio 1.0) instead of coasting on history.
+const halfLife = 10 * time.Minute
+
+type pairKey struct {
+	From, To string
+}
+
+// counters is one directed (from, to) pair's running byte totals.
+// uploaded/downloaded/lastDecay are atomics so RecordUpload/
+// RecordDownload never need Tracker's map lock, just the per-pair one
+// decay() already serializes via compare-and-swap.
+type counters struct {
+	uploaded   atomic.Int64
+	downloaded atomic.Int64
+	lastDecay  atomic.Int64 // UnixNano of the last decay() application
+}
+
+// decay scales uploaded/downloaded by how much halfLife has elapsed since
+// lastDecay, then advances lastDecay to now. It's called before every
+// read and write, so a pair's numbers are always current without a
+// background goroutine sweeping every pair in the map.
+func (c *counters) decay(now time.Time) {
+	last := c.lastDecay.Load()
+	elapsed := now.Sub(time.Unix(0, last))
+	if elapsed < time.Second {
+		return
+	}
+	factor := math.Exp2(-elapsed.Seconds() / halfLife.Seconds())
+	for {
+		up := c.uploaded.Load()
+		if c.uploaded.CompareAndSwap(up, int64(float64(up)*factor)) {
+			break
+		}
+	}
+	for {
+		down := c.downloaded.Load()
+		if c.downloaded.CompareAndSwap(down, int64(float64(down)*factor)) {
+			break
+		}
+	}
+	c.lastDecay.Store(now.UnixNano())
+}
+
+// Tracker maintains every (fromNode, toNode) pair's upload/download
+// totals. The zero value is not usable; construct with NewTracker.
+type Tracker struct {
+	mu    sync.RWMutex
+	pairs map[pairKey]*counters
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{pairs: make(map[pairKey]*counters)}
+}
+
+func (t *Tracker) pairFor(from, to string) *counters {
+	key := pairKey{from, to}
+	t.mu.RLock()
+	c, ok := t.pairs[key]
+	t.mu.RUnlock()
+	if ok {
+		return c
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.pairs[key]; ok {
+		return c
+	}
+	c = &counters{}
+	c.lastDecay.Store(time.Now().UnixNano())
+	t.pairs[key] = c
+	return c
+}
+
+// RecordUpload records fromNode having served byteCount bytes to toNode.
+func (t *Tracker) RecordUpload(fromNode, toNode string, byteCount int64) {
+	c := t.pairFor(fromNode, toNode)
+	c.decay(time.Now())
+	c.uploaded.Add(byteCount)
+}
+
+// RecordDownload records fromNode having received byteCount bytes from
+// toNode - the other side of the RecordUpload call toNode's own tracker
+// entry for this pair would make.
+func (t *Tracker) RecordDownload(fromNode, toNode string, byteCount int64) {
+	c := t.pairFor(fromNode, toNode)
+	c.decay(time.Now())
+	c.downloaded.Add(byteCount)
+}
+
+// Ratio reports fromNode's upload:download ratio with toNode - above 1.0
+// means fromNode has served toNode more than it's received back, the
+// generous-peer signal a tit-for-tat selector rewards. A pair with no
+// recorded traffic yet is neutral (1.0) rather than 0, so a first-time
+// pairing isn't penalized before either side has had a chance to trade.
+func (t *Tracker) Ratio(fromNode, toNode string) float64 {
+	c := t.pairFor(fromNode, toNode)
+	c.decay(time.Now())
+	up := float64(c.uploaded.Load())
+	down := float64(c.downloaded.Load())
+	if down == 0 {
+		if up == 0 {
+			return 1.0
+		}
+		return up
+	}
+	return up / down
+}
+
+// Snapshot is one counterpart's tallies against a node, the inspectable
+// form Ratio's internals take for the /peers/{id}/reputation endpoint.
+type Snapshot struct {
+	Peer       string  `json:"peer"`
+	Uploaded   int64   `json:"uploaded"`
+	Downloaded int64   `json:"downloaded"`
+	Ratio      float64 `json:"ratio"`
+}
+
+// For returns nodeID's recorded reputation against every peer it's
+// traded with, decaying each pair first so the snapshot reflects current
+// standing rather than stale totals.
+func (t *Tracker) For(nodeID string) []Snapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]Snapshot, 0)
+	for key, c := range t.pairs {
+		if key.From != nodeID {
+			continue
+		}
+		c.decay(time.Now())
+		up := c.uploaded.Load()
+		down := c.downloaded.Load()
+		ratio := 1.0
+		switch {
+		case down > 0:
+			ratio = float64(up) / float64(down)
+		case up > 0:
+			ratio = float64(up)
+		}
+		out = append(out, Snapshot{Peer: key.To, Uploaded: up, Downloaded: down, Ratio: ratio})
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+// Package segmentstore is a content-addressable, deduplicating object
+// store for HLS/LL-HLS segments, backed by MinIO. Every segment's bytes
+// land under a sha256/<hex> key regardless of how many playlist-facing
+// paths (song/bitrate/segmentNNN.ts) reference them, so identical audio
+// transcoded at two bitrates - or re-uploaded on a re-run - is stored
+// once.
+package segmentstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// Config configures a Store's bucket and multipart upload behavior.
+type Config struct {
+	Bucket string
+
+	// PartSize and UploadConcurrency tune PutObject's multipart upload
+	// for large objects (master files spanning many segments' worth of
+	// bytes); both 0 fall back to minio-go's own defaults.
+	PartSize          uint64
+	UploadConcurrency int
+}
+
+// ObjectMeta is the sidecar object PutSegment writes alongside each
+// content-addressed blob, mapping the playlist-facing segment id back
+// to the content hash it currently resolves to.
+type ObjectMeta struct {
+	SegmentID string `json:"segment_id"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+}
+
+// SegmentFile is one local file PutManifest should ensure is present in
+// the store before the manifest that references it goes live.
+type SegmentFile struct {
+	SegmentID string // playlist-facing id, e.g. "song1/128k/segment003.ts"
+	SHA256    string // content hash computed by the processor
+	Path      string // local path to read bytes from
+}
+
+// Store is a thin, dedup-aware wrapper around a MinIO client.
+type Store struct {
+	client *minio.Client
+	cfg    Config
+}
+
+// New builds a Store over client, using cfg's bucket and multipart
+// settings for every upload.
+func New(client *minio.Client, cfg Config) *Store {
+	return &Store{client: client, cfg: cfg}
+}
+
+func shaKey(sha string) string {
+	return "sha256/" + sha
+}
+
+func metaKey(segmentID string) string {
+	return "meta/" + segmentID + ".json"
+}
+
+// PutSegment uploads the file at path to sha256/<sha>, skipping the
+// upload entirely if that key already exists - a HEAD (StatObject), not
+// a full re-read - so the same bytes reached via a different
+// bitrate/song, or a re-run of the same processing job, never cost a
+// second PutObject. It then writes (or overwrites) segmentID's sidecar
+// object so lookups by playlist path can resolve to the content hash.
+func (s *Store) PutSegment(ctx context.Context, segmentID, sha, path string) error {
+	key := shaKey(sha)
+	info, statErr := s.client.StatObject(ctx, s.cfg.Bucket, key, minio.StatObjectOptions{})
+	switch {
+	case statErr == nil:
+		// Already stored under this hash; only the sidecar needs writing.
+	case isNotFoundErr(statErr):
+		uploaded, err := s.uploadContent(ctx, key, path)
+		if err != nil {
+			return fmt.Errorf("put sha object %s: %w", key, err)
+		}
+		info = uploaded
+	default:
+		return fmt.Errorf("stat sha object %s: %w", key, statErr)
+	}
+
+	meta, err := json.Marshal(ObjectMeta{SegmentID: segmentID, SHA256: sha, Size: info.Size})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, s.cfg.Bucket, metaKey(segmentID), bytes.NewReader(meta), int64(len(meta)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("put meta object for %s: %w", segmentID, err)
+	}
+	return nil
+}
+
+func (s *Store) uploadContent(ctx context.Context, key, path string) (minio.ObjectInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	_, err = s.client.PutObject(ctx, s.cfg.Bucket, key, f, stat.Size(), minio.PutObjectOptions{
+		ContentType:    "application/octet-stream",
+		PartSize:       s.cfg.PartSize,
+		NumThreads:     uint(s.cfg.UploadConcurrency),
+		SendContentMd5: true,
+	})
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return s.client.StatObject(ctx, s.cfg.Bucket, key, minio.StatObjectOptions{})
+}
+
+// PutManifest dedup-uploads every file's content (see PutSegment), then
+// writes manifest's bytes to manifestKey last. Writing the manifest
+// only once every referenced segment is confirmed in the store means a
+// reader can never observe a manifest pointing at content that isn't
+// there yet - a failed upload midway through leaves the previous
+// manifest (if any) as the last consistent version.
+func (s *Store) PutManifest(ctx context.Context, files []SegmentFile, manifestKey string, manifest []byte) error {
+	for _, f := range files {
+		if err := s.PutSegment(ctx, f.SegmentID, f.SHA256, f.Path); err != nil {
+			return fmt.Errorf("segment %s: %w", f.SegmentID, err)
+		}
+	}
+	_, err := s.client.PutObject(ctx, s.cfg.Bucket, manifestKey, bytes.NewReader(manifest), int64(len(manifest)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("put manifest object %s: %w", manifestKey, err)
+	}
+	return nil
+}
+
+func isNotFoundErr(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound
+}
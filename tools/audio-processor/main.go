@@ -3,117 +3,212 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// partDuration is the target duration of one LL-HLS partial segment.
+// 200ms keeps playout latency low while staying comfortably above
+// typical LAN/edge RTTs in this simulator.
+const partDuration = 200 * time.Millisecond
+
+// PartInfo describes one LL-HLS partial segment: a byte range within its
+// parent AudioSegment's file, its approximate duration, and whether it
+// can be decoded independently (the first part of a segment always can,
+// since it starts on the segment's keyframe).
+type PartInfo struct {
+	Index           int     `json:"index"`
+	ByteRangeStart  int64   `json:"byteRangeStart"`
+	ByteRangeLength int64   `json:"byteRangeLength"`
+	Duration        float64 `json:"duration"`
+	Independent     bool    `json:"independent"`
+}
+
 type AudioSegment struct {
-	SegmentID    string    `json:"segmentId"`
-	FilePath     string    `json:"filePath"`
-	Size         int64     `json:"size"`
-	Duration     float64   `json:"duration"`
-	SHA256       string    `json:"sha256"`
-	Bitrate      string    `json:"bitrate"`
-	SegmentIndex int       `json:"segmentIndex"`
-	CreatedAt    time.Time `json:"createdAt"`
+	SegmentID    string     `json:"segmentId"`
+	FilePath     string     `json:"filePath"`
+	Size         int64      `json:"size"`
+	Duration     float64    `json:"duration"`
+	SHA256       string     `json:"sha256"`
+	Bitrate      string     `json:"bitrate"`
+	Codec        string     `json:"codec"`
+	SegmentIndex int        `json:"segmentIndex"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	Parts        []PartInfo `json:"parts,omitempty"`
+	// TrackGainDB/AlbumGainDB are ReplayGain-style loudness adjustments
+	// (see replayGainDB), populated only when this bitrate was produced
+	// by NativeTranscoder; ffmpeg-produced segments leave them at 0.
+	TrackGainDB float64 `json:"trackGainDb,omitempty"`
+	AlbumGainDB float64 `json:"albumGainDb,omitempty"`
 }
 
 type AudioManifest struct {
-	SongID       string         `json:"songId"`
-	Title        string         `json:"title"`
-	TotalDuration float64       `json:"totalDuration"`
-	Bitrates     []string       `json:"bitrates"`
-	Segments     []AudioSegment `json:"segments"`
-	CreatedAt    time.Time      `json:"createdAt"`
+	SongID        string            `json:"songId"`
+	Title         string            `json:"title"`
+	TotalDuration float64           `json:"totalDuration"`
+	Bitrates      []string          `json:"bitrates"`
+	CodecsByRate  map[string]string `json:"codecsByRate"` // bitrate -> HLS CODECS string, for the ABR master playlist
+	Segments      []AudioSegment    `json:"segments"`
+	CreatedAt     time.Time         `json:"createdAt"`
+}
+
+// bandwidthByBitrate maps an ffmpeg audio bitrate argument to the
+// approximate peak BANDWIDTH (bits/sec) reported in the master playlist.
+// AAC's container/frame overhead runs a little over the nominal bitrate,
+// so it's padded by ~8% rather than quoting the raw encode rate.
+func bandwidthByBitrate(bitrate string) int {
+	kbps, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(bitrate), "k"))
+	if err != nil || kbps <= 0 {
+		return 0
+	}
+	return int(float64(kbps) * 1000 * 1.08)
 }
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: audio-processor <input_audio_file> [bitrates]")
-		fmt.Println("Example: audio-processor song.mp3 128k,192k,256k")
+		fmt.Println("Usage: audio-processor <input_audio_file> [bitrates] [--ll-hls] [--codec=aac|opus|flac] [--transcoder=ffmpeg|native] [--ffmpeg-path=...]")
+		fmt.Println("Example: audio-processor song.mp3 128k,192k,256k --ll-hls --codec=opus")
 		os.Exit(1)
 	}
 
 	inputFile := os.Args[1]
 	bitrates := []string{"128k", "192k", "256k"}
-	
-	if len(os.Args) > 2 {
-		bitrates = strings.Split(os.Args[2], ",")
+	llHLS := false
+	codec := "aac"
+	transcoderKind := "ffmpeg"
+	ffmpegPath := ""
+
+	rest := os.Args[2:]
+	var bitrateArg string
+	for _, arg := range rest {
+		switch {
+		case arg == "--ll-hls":
+			llHLS = true
+		case strings.HasPrefix(arg, "--codec="):
+			codec = strings.TrimPrefix(arg, "--codec=")
+		case strings.HasPrefix(arg, "--transcoder="):
+			transcoderKind = strings.TrimPrefix(arg, "--transcoder=")
+		case strings.HasPrefix(arg, "--ffmpeg-path="):
+			ffmpegPath = strings.TrimPrefix(arg, "--ffmpeg-path=")
+		default:
+			bitrateArg = arg
+		}
+	}
+	if bitrateArg != "" {
+		bitrates = strings.Split(bitrateArg, ",")
 		for i, br := range bitrates {
 			bitrates[i] = strings.TrimSpace(br)
 		}
 	}
 
+	transcoder, err := NewTranscoder(transcoderKind, ffmpegPath)
+	if err != nil {
+		log.Fatalf("setting up %s transcoder failed: %v", transcoderKind, err)
+	}
+
 	fmt.Printf("🎵 Processing audio file: %s\n", inputFile)
-	fmt.Printf("📊 Bitrates: %v\n", bitrates)
+	fmt.Printf("📊 Bitrates: %v (codec=%s, transcoder=%s)\n", bitrates, codec, transcoderKind)
+	if llHLS {
+		fmt.Println("⚡ LL-HLS mode enabled: emitting partial segments")
+	}
 
 	// Create output directories
 	outputDir := "assets/audio-segments"
 	os.MkdirAll(outputDir, 0755)
 
+	_, hlsCodec, err := codecArgs(codec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	songID := generateSongID(inputFile)
+	manifest := AudioManifest{
+		SongID:       songID,
+		Title:        strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile)),
+		Bitrates:     bitrates,
+		CodecsByRate: make(map[string]string, len(bitrates)),
+		CreatedAt:    time.Now(),
+	}
+
+	segmentExt := segmentExtension(transcoder)
+
 	// Process each bitrate
 	for _, bitrate := range bitrates {
 		fmt.Printf("\n🔄 Processing %s bitrate...\n", bitrate)
-		processBitrate(inputFile, bitrate, outputDir)
+		bitrateDir := filepath.Join(outputDir, bitrate)
+		opts := TranscodeOptions{Bitrate: bitrate, Codec: codec}
+		if err := transcoder.Transcode(inputFile, bitrateDir, opts); err != nil {
+			log.Fatalf("transcoding %s failed: %v", bitrate, err)
+		}
+		segments := processSegments(bitrateDir, bitrate, codec, segmentExt, llHLS)
+		manifest.Segments = append(manifest.Segments, segments...)
+		manifest.CodecsByRate[bitrate] = hlsCodec
+		if bitrate == bitrates[0] {
+			for _, seg := range segments {
+				manifest.TotalDuration += seg.Duration
+			}
+		}
+		writeMediaPlaylist(outputDir, bitrate, segments, llHLS)
 	}
 
+	writeMasterPlaylist(outputDir, bitrates, manifest.CodecsByRate, llHLS)
+	writeManifest(outputDir, manifest)
+
 	fmt.Println("\n✅ Audio processing complete!")
 	fmt.Println("📁 Segments stored in:", outputDir)
 }
 
-func processBitrate(inputFile, bitrate, outputDir string) {
-	bitrateDir := filepath.Join(outputDir, bitrate)
-	os.MkdirAll(bitrateDir, 0755)
-
-	// Create HLS segments using FFmpeg
-	playlistFile := filepath.Join(bitrateDir, "playlist.m3u8")
-	segmentPattern := filepath.Join(bitrateDir, "segment%03d.ts")
-
-	cmd := exec.Command("ffmpeg-portable/ffmpeg-8.0-essentials_build/bin/ffmpeg.exe",
-		"-i", inputFile,
-		"-c:a", "aac",
-		"-b:a", bitrate,
-		"-hls_time", "4", // 4-second segments
-		"-hls_playlist_type", "vod",
-		"-hls_segment_filename", segmentPattern,
-		"-f", "hls",
-		playlistFile,
-		"-y", // Overwrite output files
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("FFmpeg failed for %s: %v", bitrate, err)
+// segmentExtension reports the file extension a transcoder's segments
+// use, so processSegments knows what to glob for: NativeTranscoder
+// writes WAV, everything else (FFmpegTranscoder) writes the usual
+// MPEG-TS segments.
+func segmentExtension(t Transcoder) string {
+	if _, ok := t.(*NativeTranscoder); ok {
+		return ".wav"
 	}
-
-	// Process generated segments
-	processSegments(bitrateDir, bitrate)
+	return ".ts"
 }
 
-func processSegments(bitrateDir, bitrate string) {
-	files, err := filepath.Glob(filepath.Join(bitrateDir, "segment*.ts"))
+// processSegments walks a bitrate's generated segment files and builds
+// their AudioSegment records. When llHLS is set, each segment is
+// additionally sliced into ~partDuration byte-range parts: this
+// pipeline's ffmpeg pass muxes plain HLS (.ts) rather than a dedicated
+// LL-HLS chunked encoder, so the parts are approximated as even
+// byte-range slices of the already-muxed segment rather than
+// independently-encoded chunks. It's a close enough stand-in to
+// exercise the EXT-X-PART wiring without adding a second ffmpeg
+// invocation this tool doesn't otherwise need.
+func processSegments(bitrateDir, bitrate, codec, ext string, llHLS bool) []AudioSegment {
+	files, err := filepath.Glob(filepath.Join(bitrateDir, "segment*"+ext))
 	if err != nil {
 		log.Printf("Error finding segments: %v", err)
-		return
+		return nil
 	}
+	sort.Strings(files)
 
 	fmt.Printf("📦 Found %d segments for %s\n", len(files), bitrate)
 
+	gain := readReplayGain(bitrateDir)
+
+	segments := make([]AudioSegment, 0, len(files))
 	for i, file := range files {
 		segment := AudioSegment{
-			SegmentID:    generateSegmentID(filepath.Base(file)),
+			SegmentID:    generateSegmentID(filepath.Base(file), ext),
 			FilePath:     file,
 			Bitrate:      bitrate,
+			Codec:        codec,
 			SegmentIndex: i,
 			CreatedAt:    time.Now(),
+			TrackGainDB:  gain.TrackGainDB,
+			AlbumGainDB:  gain.AlbumGainDB,
 		}
 
 		// Get file size
@@ -129,16 +224,178 @@ func processSegments(bitrateDir, bitrate string) {
 		// Estimate duration (4 seconds per segment)
 		segment.Duration = 4.0
 
-		fmt.Printf("  📄 %s (%.2f KB, %s)\n", 
-			segment.SegmentID, 
-			float64(segment.Size)/1024, 
+		if llHLS {
+			segment.Parts = sliceIntoParts(segment.Size, segment.Duration)
+		}
+
+		fmt.Printf("  📄 %s (%.2f KB, %s)\n",
+			segment.SegmentID,
+			float64(segment.Size)/1024,
 			segment.SHA256[:8])
+
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// sliceIntoParts divides one segment's bytes into evenly-sized parts of
+// approximately partDuration each, rounding the count up so the last
+// part may run slightly shorter rather than leaving bytes unaccounted
+// for. The first part is marked independent, matching a real LL-HLS
+// encoder which opens every segment on a keyframe.
+func sliceIntoParts(segmentSize int64, segmentDuration float64) []PartInfo {
+	if segmentSize <= 0 || segmentDuration <= 0 {
+		return nil
+	}
+	partCount := int(segmentDuration / partDuration.Seconds())
+	if partCount < 1 {
+		partCount = 1
+	}
+	partBytes := segmentSize / int64(partCount)
+	partSeconds := segmentDuration / float64(partCount)
+
+	parts := make([]PartInfo, 0, partCount)
+	var offset int64
+	for i := 0; i < partCount; i++ {
+		length := partBytes
+		if i == partCount-1 {
+			length = segmentSize - offset // last part absorbs any remainder
+		}
+		parts = append(parts, PartInfo{
+			Index:           i,
+			ByteRangeStart:  offset,
+			ByteRangeLength: length,
+			Duration:        partSeconds,
+			Independent:     i == 0,
+		})
+		offset += length
+	}
+	return parts
+}
+
+// writeMediaPlaylist emits bitrateDir/playlist.m3u8, the classic
+// per-bitrate HLS playlist, and, when llHLS is set, an accompanying
+// llplaylist.m3u8 carrying EXT-X-PART/EXT-X-PART-INF/EXT-X-PRELOAD-HINT
+// tags so LL-HLS-aware players can pull partial segments while a song
+// is still being distributed.
+func writeMediaPlaylist(outputDir, bitrate string, segments []AudioSegment, llHLS bool) {
+	bitrateDir := filepath.Join(outputDir, bitrate)
+
+	var classic strings.Builder
+	classic.WriteString("#EXTM3U\n")
+	classic.WriteString("#EXT-X-VERSION:3\n")
+	classic.WriteString("#EXT-X-TARGETDURATION:4\n")
+	classic.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, seg := range segments {
+		fmt.Fprintf(&classic, "#EXTINF:%.3f,\n%s\n", seg.Duration, filepath.Base(seg.FilePath))
+	}
+	classic.WriteString("#EXT-X-ENDLIST\n")
+	if err := os.WriteFile(filepath.Join(bitrateDir, "playlist.m3u8"), []byte(classic.String()), 0644); err != nil {
+		log.Printf("writing playlist for %s failed: %v", bitrate, err)
+	}
+
+	if !llHLS {
+		return
 	}
+
+	var ll strings.Builder
+	ll.WriteString("#EXTM3U\n")
+	ll.WriteString("#EXT-X-VERSION:9\n")
+	ll.WriteString("#EXT-X-TARGETDURATION:4\n")
+	fmt.Fprintf(&ll, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partDuration.Seconds())
+	ll.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, seg := range segments {
+		name := filepath.Base(seg.FilePath)
+		for _, part := range seg.Parts {
+			fmt.Fprintf(&ll, "#EXT-X-PART:DURATION=%.3f,URI=%q,BYTERANGE=%d@%d%s\n",
+				part.Duration, name, part.ByteRangeLength, part.ByteRangeStart, independentSuffix(part))
+		}
+		fmt.Fprintf(&ll, "#EXTINF:%.3f,\n%s\n", seg.Duration, name)
+	}
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		name := filepath.Base(last.FilePath)
+		fmt.Fprintf(&ll, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=%q,BYTERANGE-START=%d\n", name, last.Size)
+	}
+	ll.WriteString("#EXT-X-ENDLIST\n")
+	if err := os.WriteFile(filepath.Join(bitrateDir, "llplaylist.m3u8"), []byte(ll.String()), 0644); err != nil {
+		log.Printf("writing LL-HLS playlist for %s failed: %v", bitrate, err)
+	}
+}
+
+func independentSuffix(part PartInfo) string {
+	if part.Independent {
+		return ",INDEPENDENT=YES"
+	}
+	return ""
+}
+
+// writeMasterPlaylist emits outputDir/master.m3u8, the ABR ladder's
+// entry point: one #EXT-X-STREAM-INF per bitrate, carrying its peak
+// BANDWIDTH, an AVERAGE-BANDWIDTH equal to the nominal encode rate, and
+// the CODECS string that variant was actually encoded with (from
+// codecsByRate, keyed by bitrate). Variants are ordered
+// lowest-to-highest bandwidth, the convention most HLS players expect
+// for their initial selection.
+func writeMasterPlaylist(outputDir string, bitrates []string, codecsByRate map[string]string, llHLS bool) {
+	ordered := append([]string(nil), bitrates...)
+	sort.Slice(ordered, func(i, j int) bool { return bandwidthByBitrate(ordered[i]) < bandwidthByBitrate(ordered[j]) })
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:9\n")
+	for _, bitrate := range ordered {
+		bw := bandwidthByBitrate(bitrate)
+		if bw == 0 {
+			continue
+		}
+		avgBw := int(float64(bw) / 1.08)
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,CODECS=%q\n", bw, avgBw, codecsByRate[bitrate])
+		b.WriteString(filepath.Join(bitrate, "playlist.m3u8") + "\n")
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "master.m3u8"), []byte(b.String()), 0644); err != nil {
+		log.Printf("writing master playlist failed: %v", err)
+	}
+
+	if !llHLS {
+		return
+	}
+
+	var llMaster strings.Builder
+	llMaster.WriteString("#EXTM3U\n")
+	llMaster.WriteString("#EXT-X-VERSION:9\n")
+	for _, bitrate := range ordered {
+		bw := bandwidthByBitrate(bitrate)
+		if bw == 0 {
+			continue
+		}
+		fmt.Fprintf(&llMaster, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,CODECS=%q\n", bw, int(float64(bw)/1.08), codecsByRate[bitrate])
+		llMaster.WriteString(filepath.Join(bitrate, "llplaylist.m3u8") + "\n")
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "master-ll.m3u8"), []byte(llMaster.String()), 0644); err != nil {
+		log.Printf("writing LL-HLS master playlist failed: %v", err)
+	}
+}
+
+func writeManifest(outputDir string, manifest AudioManifest) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Printf("marshalling manifest failed: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "manifest.json"), data, 0644); err != nil {
+		log.Printf("writing manifest failed: %v", err)
+	}
+}
+
+func generateSongID(inputFile string) string {
+	base := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+	return strings.ReplaceAll(strings.ToLower(base), " ", "_")
 }
 
-func generateSegmentID(filename string) string {
+func generateSegmentID(filename, ext string) string {
 	// Extract song name and segment number
-	base := strings.TrimSuffix(filename, ".ts")
+	base := strings.TrimSuffix(filename, ext)
 	parts := strings.Split(base, "segment")
 	if len(parts) == 2 {
 		return fmt.Sprintf("song_%s", parts[1])
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// replayGainReferenceDBFS is the RMS level (relative to full scale) this
+// tool treats as "no gain needed". Real ReplayGain (EBU R128 / ITU-R
+// BS.1770) runs a K-weighted loudness filter and a gating algorithm;
+// this is a plain RMS approximation, which is close enough to drive
+// consistent-sounding playback across a song's segments without pulling
+// in a loudness-analysis dependency this module doesn't have.
+const replayGainReferenceDBFS = -18.0
+
+// wavSample is one decoded PCM sample, normalized to [-1, 1] regardless
+// of the source bit depth, so resampling and gain analysis don't need to
+// special-case sample width.
+type wavSample = float64
+
+// NativeTranscoder decodes, resamples, and re-encodes audio entirely in
+// Go - decode -> resample -> encode, the same three-stage shape as
+// FFmpegTranscoder's pipeline - without shelling out. It only
+// understands PCM WAV input: this repo has no bundled codec library for
+// compressed formats like mp3/ogg, so asking it to transcode anything
+// else returns a clear error pointing at FFmpegTranscoder instead of
+// silently producing garbage.
+type NativeTranscoder struct{}
+
+func (t *NativeTranscoder) Transcode(inputFile, bitrateDir string, opts TranscodeOptions) error {
+	samples, sourceRate, err := decodeWAV(inputFile)
+	if err != nil {
+		return fmt.Errorf("native transcoder: %w (only PCM WAV input is supported; use the ffmpeg transcoder for other formats)", err)
+	}
+
+	targetRate := sourceRate
+	if opts.SampleRate > 0 && opts.SampleRate != sourceRate {
+		samples = resample(samples, sourceRate, opts.SampleRate)
+		targetRate = opts.SampleRate
+	}
+
+	trackGainDB := replayGainDB(samples)
+
+	if err := os.MkdirAll(bitrateDir, 0755); err != nil {
+		return err
+	}
+
+	const segmentSeconds = 4.0
+	samplesPerSegment := int(segmentSeconds * float64(targetRate))
+	if samplesPerSegment <= 0 {
+		return fmt.Errorf("native transcoder: invalid target sample rate %d", targetRate)
+	}
+
+	var segmentNames []string
+	for start, idx := 0, 0; start < len(samples); start, idx = start+samplesPerSegment, idx+1 {
+		end := start + samplesPerSegment
+		if end > len(samples) {
+			end = len(samples)
+		}
+		name := fmt.Sprintf("segment%03d.wav", idx)
+		if err := writeWAV(filepath.Join(bitrateDir, name), samples[start:end], targetRate, opts.SampleFormat); err != nil {
+			return err
+		}
+		segmentNames = append(segmentNames, name)
+	}
+
+	if err := writeNativePlaylist(bitrateDir, segmentNames, segmentSeconds); err != nil {
+		return err
+	}
+
+	// Album gain can't be computed from a single track in isolation; this
+	// CLI processes one input file per invocation, so it stands in for
+	// the album gain of a one-track "album" rather than guessing at a
+	// multi-track average it has no visibility into.
+	gains := replayGainInfo{TrackGainDB: trackGainDB, AlbumGainDB: trackGainDB}
+	data, err := json.MarshalIndent(gains, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(bitrateDir, "replaygain.json"), data, 0644)
+}
+
+// replayGainInfo is the sidecar NativeTranscoder writes alongside its
+// segments, since the Transcoder interface itself only reports success
+// or failure; processSegments reads it back in to annotate each
+// AudioSegment it builds for this bitrate.
+type replayGainInfo struct {
+	TrackGainDB float64 `json:"trackGainDb"`
+	AlbumGainDB float64 `json:"albumGainDb"`
+}
+
+// readReplayGain loads the sidecar NativeTranscoder wrote, or returns
+// the zero value if this bitrate wasn't produced by it (e.g. ffmpeg).
+func readReplayGain(bitrateDir string) replayGainInfo {
+	data, err := os.ReadFile(filepath.Join(bitrateDir, "replaygain.json"))
+	if err != nil {
+		return replayGainInfo{}
+	}
+	var info replayGainInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return replayGainInfo{}
+	}
+	return info
+}
+
+// replayGainDB estimates a track gain in dB relative to
+// replayGainReferenceDBFS, from the samples' RMS level.
+func replayGainDB(samples []wavSample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sumSquares float64
+	for _, s := range samples {
+		sumSquares += s * s
+	}
+	rms := math.Sqrt(sumSquares / float64(len(samples)))
+	if rms <= 0 {
+		return 0
+	}
+	measuredDBFS := 20 * math.Log10(rms)
+	return replayGainReferenceDBFS - measuredDBFS
+}
+
+// resample converts samples from sourceRate to targetRate via linear
+// interpolation. It's not a band-limited resampler (no anti-aliasing
+// filter), so it will alias on a large downsample, but it keeps this
+// transcoder dependency-free while still normalizing sample rates
+// across variants.
+func resample(samples []wavSample, sourceRate, targetRate int) []wavSample {
+	if sourceRate == targetRate || len(samples) == 0 {
+		return samples
+	}
+	ratio := float64(sourceRate) / float64(targetRate)
+	outLen := int(float64(len(samples)) / ratio)
+	out := make([]wavSample, outLen)
+	for i := range out {
+		srcPos := float64(i) * ratio
+		lo := int(srcPos)
+		frac := srcPos - float64(lo)
+		hi := lo + 1
+		if hi >= len(samples) {
+			hi = len(samples) - 1
+		}
+		out[i] = samples[lo]*(1-frac) + samples[hi]*frac
+	}
+	return out
+}
+
+// decodeWAV reads a canonical PCM WAV file (16-bit signed, the common
+// case this pipeline's test assets use) into samples normalized to
+// [-1, 1], plus its sample rate. Only mono/stereo 16-bit PCM is
+// understood; anything else is reported back as an error.
+func decodeWAV(path string) ([]wavSample, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var riffHeader [12]byte
+	if _, err := readFull(r, riffHeader[:]); err != nil {
+		return nil, 0, err
+	}
+	if string(riffHeader[0:4]) != "RIFF" || string(riffHeader[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("not a RIFF/WAVE file")
+	}
+
+	var sampleRate int
+	var bitsPerSample int
+	var channels int
+	var samples []wavSample
+
+	for {
+		var chunkHeader [8]byte
+		if _, err := readFull(r, chunkHeader[:]); err != nil {
+			break // EOF once we've walked every chunk
+		}
+		chunkID := string(chunkHeader[0:4])
+		chunkSize := binary.LittleEndian.Uint32(chunkHeader[4:8])
+
+		switch chunkID {
+		case "fmt ":
+			body := make([]byte, chunkSize)
+			if _, err := readFull(r, body); err != nil {
+				return nil, 0, err
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+		case "data":
+			if bitsPerSample != 16 {
+				return nil, 0, fmt.Errorf("unsupported bit depth %d (only 16-bit PCM is supported)", bitsPerSample)
+			}
+			body := make([]byte, chunkSize)
+			if _, err := readFull(r, body); err != nil {
+				return nil, 0, err
+			}
+			samples = decode16BitMono(body, channels)
+		default:
+			if _, err := r.Discard(int(chunkSize)); err != nil {
+				return nil, 0, err
+			}
+		}
+		if chunkSize%2 == 1 {
+			r.Discard(1) // chunks are word-aligned
+		}
+	}
+
+	if sampleRate == 0 || samples == nil {
+		return nil, 0, fmt.Errorf("missing fmt or data chunk")
+	}
+	return samples, sampleRate, nil
+}
+
+// decode16BitMono downmixes interleaved 16-bit PCM to mono by averaging
+// channels, since every other stage of this pipeline (resampling, gain
+// analysis, segmenting) works on a single sample stream.
+func decode16BitMono(body []byte, channels int) []wavSample {
+	if channels < 1 {
+		channels = 1
+	}
+	frameBytes := 2 * channels
+	frames := len(body) / frameBytes
+	out := make([]wavSample, frames)
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for c := 0; c < channels; c++ {
+			off := i*frameBytes + c*2
+			v := int16(binary.LittleEndian.Uint16(body[off : off+2]))
+			sum += float64(v) / 32768.0
+		}
+		out[i] = sum / float64(channels)
+	}
+	return out
+}
+
+// writeWAV encodes samples as a mono WAV file at sampleRate. format
+// selects the output sample representation ("i16" default, "i32", or
+// "f32"); unknown values fall back to i16. "f32" is written as true
+// IEEE float32 samples (WAV format tag 3), not 32-bit integer PCM, so a
+// consumer reading the header gets what it promises.
+func writeWAV(path string, samples []wavSample, sampleRate int, format string) error {
+	var bitsPerSample int
+	var audioFormat uint16 = 1 // PCM
+	switch format {
+	case "i32":
+		bitsPerSample = 32
+	case "f32":
+		bitsPerSample = 32
+		audioFormat = 3 // IEEE float
+	default:
+		bitsPerSample = 16
+	}
+
+	dataSize := len(samples) * (bitsPerSample / 8)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	w.WriteString("RIFF")
+	binary.Write(w, binary.LittleEndian, uint32(36+dataSize))
+	w.WriteString("WAVE")
+	w.WriteString("fmt ")
+	binary.Write(w, binary.LittleEndian, uint32(16))
+	binary.Write(w, binary.LittleEndian, audioFormat)
+	binary.Write(w, binary.LittleEndian, uint16(1)) // mono
+	binary.Write(w, binary.LittleEndian, uint32(sampleRate))
+	byteRate := sampleRate * (bitsPerSample / 8)
+	binary.Write(w, binary.LittleEndian, uint32(byteRate))
+	binary.Write(w, binary.LittleEndian, uint16(bitsPerSample/8))
+	binary.Write(w, binary.LittleEndian, uint16(bitsPerSample))
+	w.WriteString("data")
+	binary.Write(w, binary.LittleEndian, uint32(dataSize))
+
+	for _, s := range samples {
+		if s > 1 {
+			s = 1
+		} else if s < -1 {
+			s = -1
+		}
+		switch {
+		case audioFormat == 3:
+			binary.Write(w, binary.LittleEndian, float32(s))
+		case bitsPerSample == 32:
+			binary.Write(w, binary.LittleEndian, int32(s*2147483647))
+		default:
+			binary.Write(w, binary.LittleEndian, int16(s*32767))
+		}
+	}
+	return w.Flush()
+}
+
+// writeNativePlaylist emits a classic HLS playlist over NativeTranscoder's
+// segment files. The segments are WAV, not the TS/fMP4 HLS normally
+// expects; this pipeline's existing peer/edge/tracker services only care
+// about segment byte identity and don't demux the container, so it's
+// left as-is rather than bundling a muxer this tool doesn't need
+// elsewhere.
+func writeNativePlaylist(bitrateDir string, segmentNames []string, segmentSeconds float64) error {
+	var b []byte
+	b = append(b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-PLAYLIST-TYPE:VOD\n"...)
+	for _, name := range segmentNames {
+		b = append(b, fmt.Sprintf("#EXTINF:%.3f,\n%s\n", segmentSeconds, name)...)
+	}
+	b = append(b, "#EXT-X-ENDLIST\n"...)
+	return os.WriteFile(filepath.Join(bitrateDir, "playlist.m3u8"), b, 0644)
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
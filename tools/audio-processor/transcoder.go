@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// TranscodeOptions configures one bitrate/codec variant of a transcode
+// pass.
+type TranscodeOptions struct {
+	Bitrate      string // e.g. "128k"
+	Codec        string // "aac" (default), "opus", or "flac"
+	SampleRate   int    // 0 keeps the source rate
+	SampleFormat string // "i16" (default), "i32", or "f32" - native transcoder only
+}
+
+// Transcoder turns inputFile into 4-second HLS segments plus a classic
+// playlist under bitrateDir, encoded per opts. Implementations are free
+// to shell out or decode in-process; callers only depend on the segment
+// files and playlist landing on disk afterward.
+type Transcoder interface {
+	Transcode(inputFile, bitrateDir string, opts TranscodeOptions) error
+}
+
+// NewTranscoder constructs the transcoder named by kind ("ffmpeg",
+// the default, or "native"). binaryPath is only consulted for "ffmpeg"
+// and may be empty to discover it on PATH.
+func NewTranscoder(kind, binaryPath string) (Transcoder, error) {
+	switch kind {
+	case "native":
+		return &NativeTranscoder{}, nil
+	case "", "ffmpeg":
+		return NewFFmpegTranscoder(binaryPath)
+	default:
+		return nil, fmt.Errorf("unknown transcoder %q", kind)
+	}
+}
+
+// codecArgs maps a codec name to the ffmpeg audio codec args and the HLS
+// CODECS string downstream playlists should advertise for it.
+func codecArgs(codec string) (ffmpegCodec, hlsCodecString string, err error) {
+	switch codec {
+	case "", "aac":
+		return "aac", "mp4a.40.2", nil
+	case "opus":
+		return "libopus", "opus", nil
+	case "flac":
+		return "flac", "fLaC", nil
+	default:
+		return "", "", fmt.Errorf("unsupported codec %q", codec)
+	}
+}
+
+// FFmpegTranscoder shells out to an ffmpeg binary discovered via
+// exec.LookPath (or an explicit path) rather than the fixed Windows
+// ffmpeg-portable layout this tool used to assume, so the same code
+// path runs on Linux CI and containers.
+type FFmpegTranscoder struct {
+	binaryPath string
+}
+
+// NewFFmpegTranscoder resolves binaryPath via exec.LookPath if it's
+// empty, defaulting to "ffmpeg" on PATH.
+func NewFFmpegTranscoder(binaryPath string) (*FFmpegTranscoder, error) {
+	if binaryPath == "" {
+		binaryPath = "ffmpeg"
+	}
+	resolved, err := exec.LookPath(binaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg binary %q not found: %w", binaryPath, err)
+	}
+	return &FFmpegTranscoder{binaryPath: resolved}, nil
+}
+
+func (t *FFmpegTranscoder) Transcode(inputFile, bitrateDir string, opts TranscodeOptions) error {
+	ffmpegCodec, _, err := codecArgs(opts.Codec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(bitrateDir, 0755); err != nil {
+		return err
+	}
+
+	playlistFile := filepath.Join(bitrateDir, "playlist.m3u8")
+	segmentPattern := filepath.Join(bitrateDir, "segment%03d.ts")
+
+	args := []string{
+		"-i", inputFile,
+		"-c:a", ffmpegCodec,
+		"-b:a", opts.Bitrate,
+	}
+	if opts.SampleRate > 0 {
+		args = append(args, "-ar", fmt.Sprintf("%d", opts.SampleRate))
+	}
+	args = append(args,
+		"-hls_time", "4", // 4-second segments
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", segmentPattern,
+		"-f", "hls",
+		playlistFile,
+		"-y", // Overwrite output files
+	)
+
+	cmd := exec.Command(t.binaryPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed for %s/%s: %w", opts.Bitrate, opts.Codec, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// popularSegmentThreshold is the holder-count fraction above which a
+// segment counts as "popular" for rankedCandidates' capability
+// preference - cache peers are worth preferring once enough of the swarm
+// already wants the same segment that a cache's amortized cost pays off.
+const popularSegmentThreshold = 0.1
+
+// assignCapabilities gives peer its advertised roles, mirroring
+// Algorand's peer-capability gossip model: roles other peers and the
+// tracker can route on directly instead of inferring from connection
+// shape. Every peer can at least seed what it already holds; laptops run
+// longer between app restarts and have more memory headroom, so they're
+// the likelier cache/relay candidates. A small, device-independent slice
+// of the swarm is archival - long-lived nodes assumed to keep segments
+// around well after everyone else has evicted them.
+func assignCapabilities(peer *PeerContainer) {
+	peer.Capabilities = append(peer.Capabilities, "seed")
+
+	switch peer.DeviceType {
+	case "laptop":
+		if rand.Float64() < 0.7 {
+			peer.Capabilities = append(peer.Capabilities, "cache")
+		}
+		if rand.Float64() < 0.5 {
+			peer.Capabilities = append(peer.Capabilities, "relay")
+		}
+	case "tablet":
+		if rand.Float64() < 0.3 {
+			peer.Capabilities = append(peer.Capabilities, "cache")
+		}
+	case "smartphone":
+		if rand.Float64() < 0.1 {
+			peer.Capabilities = append(peer.Capabilities, "relay")
+		}
+	}
+
+	if rand.Float64() < 0.05 {
+		peer.Capabilities = append(peer.Capabilities, "archival")
+	}
+}
+
+// hasCapability reports whether peer advertised capability at its last
+// registration.
+func (peer *PeerContainer) hasCapability(capability string) bool {
+	for _, c := range peer.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// isPopularSegment reports whether enough of the swarm already holds
+// segmentID for rankedCandidates to prefer cache peers over its plain
+// RTT/success-rate ranking.
+func (ps *PeerSimulator) isPopularSegment(segmentID string) bool {
+	if len(ps.peers) == 0 {
+		return false
+	}
+	return float64(ps.segmentRarity(segmentID))/float64(len(ps.peers)) >= popularSegmentThreshold
+}
+
+// preferCapability stable-partitions ids so peers advertising capability
+// come first, without disturbing the relative order within either group -
+// used to prefer cache peers for popular segments without discarding
+// rankedCandidates' existing RTT/success-rate ranking.
+func (ps *PeerSimulator) preferCapability(ids []string, capability string) []string {
+	preferred := make([]string, 0, len(ids))
+	rest := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if peer := ps.findPeer(id); peer != nil && peer.hasCapability(capability) {
+			preferred = append(preferred, id)
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	return append(preferred, rest...)
+}
+
+// relayCandidates returns up to n peers near segmentID's key that
+// advertise the "relay" capability, ranked the same way rankedCandidates
+// ranks its own results - dispatchFetch's next hop once its direct
+// candidates all come up empty.
+func (ps *PeerSimulator) relayCandidates(peer *PeerContainer, segmentID string, n int) []string {
+	var relays []string
+	for _, id := range ps.FindNode(peer, segmentID) {
+		if candidate := ps.findPeer(id); candidate != nil && candidate.hasCapability("relay") {
+			relays = append(relays, id)
+		}
+	}
+	sort.Slice(relays, func(i, j int) bool {
+		return ps.statFor(relays[i]).score() > ps.statFor(relays[j]).score()
+	})
+	if len(relays) > n {
+		relays = relays[:n]
+	}
+	return relays
+}
+
+// archivalHolder scans every online archival-capable peer for segmentID.
+// Archival peers are a small, stable tier rather than ones a Kademlia
+// proximity search is likely to surface, so this checks all of them
+// directly instead of routing through FindNode - dispatchFetch's last
+// resort before it gives up on the swarm and asks the origin.
+func (ps *PeerSimulator) archivalHolder(segmentID string) string {
+	for _, candidate := range ps.peers {
+		if !candidate.IsOnline || !candidate.hasCapability("archival") {
+			continue
+		}
+		if ps.segmentHolder(candidate, segmentID) != "" {
+			return candidate.ID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	churnTick = 5 * time.Second // how often runChurnController checks for expired sessions
+
+	// weibullShape is shared across device types; only the scale (derived
+	// from each device's median session length below) varies.
+	weibullShape = 1.5
+
+	slowFaultExtraDelay = 300 * time.Millisecond // "slow" fault mode: added on top of probeSegment's normal delay
+	flakyFailureRate    = 0.5                    // "flaky" fault mode: chance a real answer is reported as a miss anyway
+)
+
+// sessionMedian is each device type's median online-session length before
+// ChurnController ends it - smartphones churn fastest, laptops stay
+// connected far longer, mirroring real app-lifecycle/battery behavior.
+var sessionMedian = map[string]time.Duration{
+	"smartphone": 20 * time.Minute,
+	"tablet":     45 * time.Minute,
+	"laptop":     120 * time.Minute,
+}
+
+// weibullScale converts a desired median into the Weibull scale parameter
+// (lambda) for weibullShape, via median = lambda * (ln 2)^(1/k).
+func weibullScale(median time.Duration) float64 {
+	return float64(median) / math.Pow(math.Ln2, 1/weibullShape)
+}
+
+// sampleSessionLength draws a Weibull-distributed session length for
+// deviceType via inverse-CDF sampling, scaled by churnRate (CHURN_RATE > 1
+// shortens sessions, so operators can dial up churn for stress tests
+// without changing the relative device-type shape).
+func sampleSessionLength(deviceType string, churnRate float64) time.Duration {
+	median, ok := sessionMedian[deviceType]
+	if !ok {
+		median = sessionMedian["tablet"]
+	}
+	if churnRate <= 0 {
+		churnRate = 1
+	}
+	scale := weibullScale(median) / churnRate
+
+	u := rand.Float64()
+	for u == 0 {
+		u = rand.Float64()
+	}
+	sample := scale * math.Pow(-math.Log(u), 1/weibullShape)
+	return time.Duration(sample)
+}
+
+// rejoinDowntime is how long a peer stays offline after a churn-induced
+// departure before ChurnController brings it back.
+func rejoinDowntime() time.Duration {
+	return time.Duration(10+rand.Intn(110)) * time.Second
+}
+
+// ChurnController owns the session-length and fault-injection config this
+// simulator run uses, both configurable via env vars so operators can
+// stress-test edge/origin fallback paths without a rebuild.
+type ChurnController struct {
+	churnRate float64
+	faultMix  map[string]float64
+}
+
+// newChurnController reads CHURN_RATE (a positive multiplier on how often
+// peers churn, default 1) and FAULT_MIX (a "mode=probability,..." list,
+// e.g. "slow=0.1,flaky=0.1,byzantine=0.05", default none) from the
+// environment.
+func newChurnController() *ChurnController {
+	rate := 1.0
+	if raw := os.Getenv("CHURN_RATE"); raw != "" {
+		if parsed, err := strconv.ParseFloat(raw, 64); err == nil && parsed > 0 {
+			rate = parsed
+		}
+	}
+	return &ChurnController{
+		churnRate: rate,
+		faultMix:  parseFaultMix(os.Getenv("FAULT_MIX")),
+	}
+}
+
+// parseFaultMix parses a "mode=probability,mode=probability" string into a
+// map. Unparsable or empty entries are skipped rather than rejecting the
+// whole value, since a typo in one mode shouldn't silently disable fault
+// injection entirely.
+func parseFaultMix(raw string) map[string]float64 {
+	mix := make(map[string]float64)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		prob, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			continue
+		}
+		mix[strings.TrimSpace(parts[0])] = prob
+	}
+	return mix
+}
+
+// assignFaultMode rolls once against the configured FAULT_MIX and gives
+// peer at most one fault mode, so its behavior stays consistent for the
+// life of the run instead of flapping between modes on every request.
+func (c *ChurnController) assignFaultMode(peer *PeerContainer) {
+	roll := rand.Float64()
+	var cumulative float64
+	for _, mode := range []string{"slow", "flaky", "byzantine"} {
+		cumulative += c.faultMix[mode]
+		if roll < cumulative {
+			peer.FaultMode = mode
+			return
+		}
+	}
+}
+
+// runChurnController gives every peer a Weibull-distributed session
+// length at startup, then every churnTick checks whether any peer's
+// session (online or offline) has expired and flips it.
+func (ps *PeerSimulator) runChurnController(ctx context.Context) {
+	next := make(map[string]time.Time, len(ps.peers))
+	now := time.Now()
+	for _, peer := range ps.peers {
+		next[peer.ID] = now.Add(sampleSessionLength(peer.DeviceType, ps.churn.churnRate))
+	}
+
+	ticker := time.NewTicker(churnTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			for _, peer := range ps.peers {
+				if now.Before(next[peer.ID]) {
+					continue
+				}
+				if peer.IsOnline {
+					ps.takePeerOffline(peer)
+					next[peer.ID] = now.Add(rejoinDowntime())
+				} else {
+					ps.rejoinPeer(peer)
+					next[peer.ID] = now.Add(sampleSessionLength(peer.DeviceType, ps.churn.churnRate))
+				}
+			}
+		}
+	}
+}
+
+// takePeerOffline ends peer's session: flips IsOnline, drops its
+// Connections (cascading through removeConnection the same way the old
+// liveness-check model did, so PEX still propagates the departure), and
+// tells the tracker it's gone.
+func (ps *PeerSimulator) takePeerOffline(peer *PeerContainer) {
+	peer.IsOnline = false
+	fmt.Printf("🔌 %s went offline (session ended)\n", peer.ID)
+
+	peer.stateMu.Lock()
+	connections := append([]string(nil), peer.Connections...)
+	peer.stateMu.Unlock()
+	for _, connectionID := range connections {
+		ps.removeConnection(peer, connectionID)
+	}
+	for _, other := range ps.peers {
+		if other.ID == peer.ID {
+			continue
+		}
+		ps.removeConnection(other, peer.ID)
+	}
+
+	jsonData, _ := json.Marshal(map[string]string{"id": peer.ID})
+	http.Post(ps.networkAPI+"/remove-peer", "application/json", bytes.NewBuffer(jsonData))
+}
+
+// rejoinPeer brings peer back online after a churn-induced departure. Its
+// old bucket/connection state is stale - everyone who had it dropped it
+// when it left - so it re-bootstraps from scratch via pingBootstrap (see
+// kademlia.go) and re-announces what it still holds in Storage, same as a
+// real client re-handshaking after a network change.
+func (ps *PeerSimulator) rejoinPeer(peer *PeerContainer) {
+	peer.IsOnline = true
+	peer.LastSeen = time.Now()
+
+	// buckets is kademliaMu's, not stateMu's - take that lock specifically,
+	// the same way every other bucket access in kademlia.go does, rather
+	// than resetting it unguarded against a concurrent FindNode walk.
+	peer.kademliaMu.Lock()
+	peer.buckets = [idBits][]kBucketEntry{}
+	peer.kademliaMu.Unlock()
+
+	peer.stateMu.Lock()
+	peer.Connections = make([]string, 0)
+	memory := peer.Memory
+	storageSnapshot := make(map[string]bool, len(peer.Storage))
+	for segmentID, held := range peer.Storage {
+		storageSnapshot[segmentID] = held
+	}
+	peer.stateMu.Unlock()
+
+	fmt.Printf("🔌 %s rejoined, re-bootstrapping\n", peer.ID)
+
+	ps.pingBootstrap(peer)
+
+	peerData := map[string]interface{}{
+		"id":           peer.ID,
+		"type":         "peer",
+		"region":       peer.Region,
+		"storage":      storageSnapshot,
+		"memory":       memory,
+		"maxMemory":    peer.MaxMemory,
+		"isOnline":     peer.IsOnline,
+		"capabilities": peer.Capabilities,
+	}
+	jsonData, _ := json.Marshal(peerData)
+	http.Post(ps.networkAPI+"/add-peer", "application/json", bytes.NewBuffer(jsonData))
+
+	for segmentID := range storageSnapshot {
+		ps.registerSegment(peer.ID, segmentID)
+		ps.publishSegment(peer, segmentID)
+	}
+}
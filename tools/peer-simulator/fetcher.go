@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	fetchAlpha      = lookupAlpha     // candidate fan-out per segment, same alpha as the Kademlia lookup
+	defaultPeerRTT  = 50.0            // ms, assumed for a peer with no samples yet
+	rttMaxTimeout   = 2 * time.Second // ceiling on qosTuner's computed timeout
+	qosTuneInterval = 2 * time.Second
+	rttEWMAWeight   = 0.3 // how much a fresh sample moves a peer's running RTT/success-rate average
+	fetchPollEvery  = 50 * time.Millisecond
+)
+
+// peerStat is one peer's measured fetch performance: an
+// exponentially-weighted RTT and success rate, updated after every
+// attempt dispatchFetch makes against that peer.
+type peerStat struct {
+	mu          sync.Mutex
+	rtt         float64
+	successRate float64
+	requests    int64
+	successes   int64
+}
+
+// score ranks a peer for rankedCandidates - higher is better, rewarding
+// peers that are both fast and reliable over ones that are merely one or
+// the other.
+func (s *peerStat) score() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.successRate / (s.rtt + 1)
+}
+
+func (s *peerStat) recordSuccess(rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.successes++
+	s.updateLocked(float64(rtt.Milliseconds()), 1)
+}
+
+func (s *peerStat) recordFailure(rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.updateLocked(float64(rtt.Milliseconds()), 0)
+}
+
+func (s *peerStat) updateLocked(rttMs, outcome float64) {
+	s.rtt += rttEWMAWeight * (rttMs - s.rtt)
+	s.successRate += rttEWMAWeight * (outcome - s.successRate)
+}
+
+func (s *peerStat) snapshot() (rtt, successRate float64, requests, successes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rtt, s.successRate, s.requests, s.successes
+}
+
+// statFor returns peerID's peerStat, creating one with optimistic
+// defaults on first use - a peer nobody's dealt with yet hasn't proven
+// itself slow or unreliable.
+func (ps *PeerSimulator) statFor(peerID string) *peerStat {
+	if v, ok := ps.peerStats.Load(peerID); ok {
+		return v.(*peerStat)
+	}
+	fresh := &peerStat{rtt: defaultPeerRTT, successRate: 1.0}
+	actual, _ := ps.peerStats.LoadOrStore(peerID, fresh)
+	return actual.(*peerStat)
+}
+
+// qosTuner holds the one request timeout every dispatchFetch call shares,
+// recomputed periodically from the swarm's current RTT samples.
+type qosTuner struct {
+	mu      sync.Mutex
+	timeout time.Duration
+}
+
+func newQosTuner() *qosTuner {
+	return &qosTuner{timeout: rttMaxTimeout}
+}
+
+func (q *qosTuner) currentTimeout() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.timeout
+}
+
+// retune applies timeout = min(rttMax, 2*weightedRTT/confidence).
+// confidence ramps from 0 toward 1 as more samples accumulate, so the
+// timeout stays loose (capped at rttMax) until there's enough data
+// across the swarm to trust weightedRTT.
+func (q *qosTuner) retune(weightedRTT, confidence float64) {
+	if confidence <= 0 {
+		confidence = 0.01
+	}
+	timeout := time.Duration(2*weightedRTT/confidence) * time.Millisecond
+	if timeout > rttMaxTimeout || timeout <= 0 {
+		timeout = rttMaxTimeout
+	}
+	q.mu.Lock()
+	q.timeout = timeout
+	q.mu.Unlock()
+}
+
+// qosTunerLoop recomputes the shared fetch timeout every qosTuneInterval
+// from the current peerStats.
+func (ps *PeerSimulator) qosTunerLoop(ctx context.Context) {
+	ticker := time.NewTicker(qosTuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var totalRTT, totalRequests, peerCount float64
+			ps.peerStats.Range(func(_, value interface{}) bool {
+				rtt, _, requests, _ := value.(*peerStat).snapshot()
+				totalRTT += rtt
+				totalRequests += float64(requests)
+				peerCount++
+				return true
+			})
+			if peerCount == 0 {
+				continue
+			}
+			confidence := totalRequests / (peerCount * 10)
+			if confidence > 1 {
+				confidence = 1
+			}
+			ps.qos.retune(totalRTT/peerCount, confidence)
+		}
+	}
+}
+
+// fetchJob is one outstanding segment request waiting to be dispatched.
+// The queue orders jobs by deadline first (a job due sooner jumps ahead)
+// and, among equal deadlines, by rarity - the fewer peers known to hold a
+// segment, the higher its priority, so the swarm chases scarce segments
+// before abundant ones.
+type fetchJob struct {
+	Peer      *PeerContainer
+	SegmentID string
+	Deadline  time.Time
+	Rarity    int
+	index     int
+}
+
+type fetchHeap []*fetchJob
+
+func (h fetchHeap) Len() int { return len(h) }
+func (h fetchHeap) Less(i, j int) bool {
+	if !h[i].Deadline.Equal(h[j].Deadline) {
+		return h[i].Deadline.Before(h[j].Deadline)
+	}
+	return h[i].Rarity < h[j].Rarity
+}
+func (h fetchHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *fetchHeap) Push(x interface{}) {
+	job := x.(*fetchJob)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+func (h *fetchHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return job
+}
+
+// fetchQueue is the priority queue outstanding segment requests wait in
+// between simulateRequests enqueuing them and fetchLoop dispatching them.
+type fetchQueue struct {
+	mu    sync.Mutex
+	items fetchHeap
+}
+
+func newFetchQueue() *fetchQueue {
+	return &fetchQueue{}
+}
+
+func (q *fetchQueue) push(job *fetchJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(&q.items, job)
+}
+
+func (q *fetchQueue) pop() *fetchJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.items.Len() == 0 {
+		return nil
+	}
+	return heap.Pop(&q.items).(*fetchJob)
+}
+
+// segmentRarity counts how many peers currently hold segmentID - the
+// queue's tie-breaker, so a segment only one peer has outranks one
+// everybody already has.
+func (ps *PeerSimulator) segmentRarity(segmentID string) int {
+	count := 0
+	for _, peer := range ps.peers {
+		peer.stateMu.Lock()
+		held := peer.Storage[segmentID]
+		peer.stateMu.Unlock()
+		if held {
+			count++
+		}
+	}
+	return count
+}
+
+// enqueueFetch queues a segment request for fetchLoop to dispatch,
+// stamping it with the shared qos timeout as its deadline and the
+// segment's current rarity as its tie-break priority.
+func (ps *PeerSimulator) enqueueFetch(peer *PeerContainer, segmentID string) {
+	ps.fetchQueue.push(&fetchJob{
+		Peer:      peer,
+		SegmentID: segmentID,
+		Deadline:  time.Now().Add(ps.qos.currentTimeout()),
+		Rarity:    ps.segmentRarity(segmentID),
+	})
+}
+
+// fetchLoop pulls one queued job at a time - so a backlog is served in
+// priority order rather than all at once - and dispatches it.
+func (ps *PeerSimulator) fetchLoop(ctx context.Context) {
+	ticker := time.NewTicker(fetchPollEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job := ps.fetchQueue.pop()
+			if job == nil {
+				continue
+			}
+			go ps.dispatchFetch(job)
+		}
+	}
+}
+
+// rankedCandidates finds peers near segmentID's key via the Kademlia
+// overlay (see kademlia.go), then orders them by score = successRate /
+// (rtt + 1) so dispatchFetch queries its most promising peers first
+// instead of everyone FindNode turned up. For a segment popular enough
+// that amortizing a cache peer's cost pays off, cache-capable candidates
+// are pulled to the front of that ranking (see capabilities.go).
+func (ps *PeerSimulator) rankedCandidates(peer *PeerContainer, segmentID string, n int) []string {
+	found := ps.FindNode(peer, segmentID)
+	sort.Slice(found, func(i, j int) bool {
+		return ps.statFor(found[i]).score() > ps.statFor(found[j]).score()
+	})
+	if ps.isPopularSegment(segmentID) {
+		found = ps.preferCapability(found, "cache")
+	}
+	found = ps.preferKnownHolders(peer, segmentID, found)
+	if len(found) > n {
+		found = found[:n]
+	}
+	return found
+}
+
+// probeSegment simulates asking candidateID for segmentID: a small
+// synthetic delay stands in for the network hop, honoring ctx so a slow
+// probe is abandoned once a faster candidate already won. A candidate's
+// FaultMode (see churn.go) can stretch that delay ("slow"), flip a real
+// answer into a reported miss ("flaky"), or claim success without
+// actually holding the segment ("byzantine") - injected failure modes for
+// stress-testing the relay/archival/origin fallback chain in
+// dispatchFetch.
+func (ps *PeerSimulator) probeSegment(ctx context.Context, candidateID, segmentID string) bool {
+	candidate := ps.findPeer(candidateID)
+	if candidate == nil || !candidate.IsOnline {
+		return false
+	}
+
+	delay := time.Duration(20+rand.Intn(80)) * time.Millisecond
+	if candidate.FaultMode == "slow" {
+		delay += slowFaultExtraDelay
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+	}
+
+	if candidate.FaultMode == "byzantine" {
+		return true
+	}
+
+	holds := ps.segmentHolder(candidate, segmentID) != ""
+	if holds && candidate.FaultMode == "flaky" && rand.Float64() < flakyFailureRate {
+		return false
+	}
+	return holds
+}
+
+// raceCandidates queries every candidate concurrently under a shared
+// qos-tuned timeout and returns the first one that answers with the
+// segment. Every candidate's peerStat is updated with what actually
+// happened, win or lose, so future ranking reflects it.
+func (ps *PeerSimulator) raceCandidates(segmentID string, candidates []string) (string, bool) {
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ps.qos.currentTimeout())
+	defer cancel()
+
+	type outcome struct {
+		peerID string
+		ok     bool
+		rtt    time.Duration
+	}
+	results := make(chan outcome, len(candidates))
+	for _, candidateID := range candidates {
+		go func(candidateID string) {
+			start := time.Now()
+			ok := ps.probeSegment(ctx, candidateID, segmentID)
+			results <- outcome{peerID: candidateID, ok: ok, rtt: time.Since(start)}
+		}(candidateID)
+	}
+
+	for received := 0; received < len(candidates); received++ {
+		select {
+		case <-ctx.Done():
+			return "", false
+		case r := <-results:
+			stat := ps.statFor(r.peerID)
+			if r.ok {
+				stat.recordSuccess(r.rtt)
+				return r.peerID, true
+			}
+			stat.recordFailure(r.rtt)
+		}
+	}
+	return "", false
+}
+
+// dispatchFetch tries job.SegmentID against fetchAlpha ranked candidates
+// first (see rankedCandidates), then - if direct candidates all miss or
+// time out - routes through relay-capable peers instead, standing in for
+// a relay forwarding the request deeper into the swarm. Only once both
+// of those come up empty does it check whether an archival peer holds
+// the segment before finally falling back to the network topology API.
+func (ps *PeerSimulator) dispatchFetch(job *fetchJob) {
+	peer := job.Peer
+	segmentID := job.SegmentID
+
+	if holderID, ok := ps.raceCandidates(segmentID, ps.rankedCandidates(peer, segmentID, fetchAlpha)); ok {
+		ps.completeFetch(peer, segmentID, holderID, "Kademlia fetch")
+		return
+	}
+
+	if holderID, ok := ps.raceCandidates(segmentID, ps.relayCandidates(peer, segmentID, fetchAlpha)); ok {
+		ps.completeFetch(peer, segmentID, holderID, "relay fetch")
+		return
+	}
+
+	if holderID := ps.archivalHolder(segmentID); holderID != "" {
+		ps.completeFetch(peer, segmentID, holderID, "archival fetch")
+		return
+	}
+
+	ps.fetchFromTopology(peer, segmentID)
+}
+
+// completeFetch applies a successful fetch's side effects - storage,
+// memory accounting, re-publishing to the DHT, gossiping the new segment
+// to this peer's mesh, and eviction if needed - shared by every source a
+// dispatch can succeed from.
+func (ps *PeerSimulator) completeFetch(peer *PeerContainer, segmentID, source, via string) {
+	peer.stateMu.Lock()
+	peer.Storage[segmentID] = true
+	peer.Memory += 5000000 // 5MB per segment
+	peer.RequestCount++
+	if peer.lastAccess == nil {
+		peer.lastAccess = make(map[string]time.Time)
+	}
+	peer.lastAccess[segmentID] = time.Now()
+	overCapacity := peer.Memory > peer.MaxMemory
+	peer.stateMu.Unlock()
+
+	ps.registerSegment(peer.ID, segmentID)
+	ps.publishSegment(peer, segmentID)
+	ps.broadcastHave(peer, segmentID)
+
+	if overCapacity {
+		ps.evictOldestSegment(peer)
+	}
+
+	fmt.Printf("✅ %s received %s from %s (%s)\n", peer.ID, segmentID, source, via)
+}
+
+// fetchFromTopology is dispatchFetch's fallback when the overlay has no
+// candidates or none answer in time - the network topology request
+// makeRequest always made as a last resort before this file existed.
+func (ps *PeerSimulator) fetchFromTopology(peer *PeerContainer, segmentID string) {
+	ps.mu.Lock()
+	ps.requestCount++
+	reqCount := ps.requestCount
+	ps.mu.Unlock()
+
+	request := PeerRequest{
+		RequestID: fmt.Sprintf("req_%d_%d", time.Now().UnixNano(), reqCount),
+		SegmentID: segmentID,
+		FromPeer:  peer.ID,
+		Timestamp: time.Now(),
+	}
+
+	jsonData, _ := json.Marshal(request)
+	resp, err := http.Post(ps.networkAPI+"/request", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("Request failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var response PeerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		log.Printf("Failed to decode response: %v", err)
+		return
+	}
+
+	if !response.Success {
+		fmt.Printf("❌ %s failed to get %s\n", peer.ID, segmentID)
+		return
+	}
+
+	source := fmt.Sprintf("%s (%d hops, %dms)", response.Source, response.Hops, response.Latency)
+	ps.completeFetch(peer, segmentID, source, "network topology")
+}
+
+// PeerQoS is one peer's exported fetch-quality snapshot.
+type PeerQoS struct {
+	RTT         float64
+	SuccessRate float64
+	Requests    int64
+}
+
+// FetcherMetrics summarizes the swarm's current fetch performance -
+// printStatus's per-cycle snapshot of what qosTuner and peerStats have
+// learned.
+type FetcherMetrics struct {
+	AverageRTT float64
+	HitRate    float64
+	Timeout    time.Duration
+	PerPeer    map[string]PeerQoS
+}
+
+func (ps *PeerSimulator) fetchMetrics() FetcherMetrics {
+	perPeer := make(map[string]PeerQoS)
+	var totalRTT, totalSuccesses, totalRequests float64
+	ps.peerStats.Range(func(key, value interface{}) bool {
+		rtt, successRate, requests, successes := value.(*peerStat).snapshot()
+		perPeer[key.(string)] = PeerQoS{RTT: rtt, SuccessRate: successRate, Requests: requests}
+		totalRTT += rtt
+		totalSuccesses += float64(successes)
+		totalRequests += float64(requests)
+		return true
+	})
+
+	metrics := FetcherMetrics{Timeout: ps.qos.currentTimeout(), PerPeer: perPeer}
+	if len(perPeer) > 0 {
+		metrics.AverageRTT = totalRTT / float64(len(perPeer))
+	}
+	if totalRequests > 0 {
+		metrics.HitRate = totalSuccesses / totalRequests
+	}
+	return metrics
+}
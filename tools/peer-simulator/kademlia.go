@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	idBits         = 160 // sha1 output size in bits
+	kBucketSize    = 20  // max entries per k-bucket
+	lookupAlpha    = 3   // parallel fan-out for FindNode/FindValue
+	bootstrapPings = 5   // peers a new peer pings to seed its buckets
+	shortlistCap   = kBucketSize * 3
+)
+
+// kademliaID is a fixed-length 160-bit identifier. Every PeerContainer
+// gets one derived from sha1(peer.ID), and segment IDs are hashed into
+// the same space so "distance to a segment" and "distance to a peer"
+// are the same XOR metric.
+type kademliaID [sha1.Size]byte
+
+// hashKademliaID derives a kademliaID from an arbitrary string.
+func hashKademliaID(s string) kademliaID {
+	return kademliaID(sha1.Sum([]byte(s)))
+}
+
+// xorDistance is Kademlia's distance metric: the two IDs XORed together
+// and read as a big-endian integer, so closeness is symmetric and
+// doesn't depend on any real network topology.
+func xorDistance(a, b kademliaID) *big.Int {
+	var xor [sha1.Size]byte
+	for i := range a {
+		xor[i] = a[i] ^ b[i]
+	}
+	return new(big.Int).SetBytes(xor[:])
+}
+
+// bucketIndex returns the number of leading bits self and other share,
+// which is which of self's k-buckets other belongs in. Equal IDs share
+// all idBits bits and have no bucket (-1); touchBucket skips that case
+// since a peer never buckets itself.
+func bucketIndex(self, other kademliaID) int {
+	for i := 0; i < sha1.Size; i++ {
+		diff := self[i] ^ other[i]
+		if diff == 0 {
+			continue
+		}
+		for bit := 0; bit < 8; bit++ {
+			if diff&(0x80>>uint(bit)) != 0 {
+				return i*8 + bit
+			}
+		}
+	}
+	return -1
+}
+
+// kBucketEntry is one peer known to occupy a particular bucket, tracked
+// by when it was last confirmed responsive.
+type kBucketEntry struct {
+	PeerID   string
+	LastSeen time.Time
+}
+
+// touchBucket inserts or refreshes candidateID in owner's bucket for its
+// distance from owner. When that bucket is already full, it applies
+// Kademlia's least-recently-seen challenge: the longest-known entry is
+// assumed still good unless it's gone offline, so a newly-seen peer only
+// displaces it if that check fails, rather than the newcomer always
+// winning a slot.
+func (ps *PeerSimulator) touchBucket(owner *PeerContainer, candidateID string) {
+	if candidateID == owner.ID {
+		return
+	}
+	idx := bucketIndex(owner.kademliaID, hashKademliaID(candidateID))
+	if idx < 0 {
+		return
+	}
+
+	owner.kademliaMu.Lock()
+	defer owner.kademliaMu.Unlock()
+
+	bucket := owner.buckets[idx]
+	for i, entry := range bucket {
+		if entry.PeerID == candidateID {
+			bucket[i].LastSeen = time.Now()
+			return
+		}
+	}
+
+	if len(bucket) < kBucketSize {
+		owner.buckets[idx] = append(bucket, kBucketEntry{PeerID: candidateID, LastSeen: time.Now()})
+		ps.addConnection(owner, candidateID)
+		return
+	}
+
+	oldest := bucket[0]
+	if oldestPeer := ps.findPeer(oldest.PeerID); oldestPeer == nil || !oldestPeer.IsOnline {
+		bucket[0] = kBucketEntry{PeerID: candidateID, LastSeen: time.Now()}
+		ps.removeConnection(owner, oldest.PeerID)
+		ps.addConnection(owner, candidateID)
+	}
+	// Otherwise the oldest entry is still alive - keep it, drop candidateID.
+}
+
+// closestKnown returns up to k peer IDs from owner's buckets, sorted by
+// XOR distance to targetID. It's owner's local answer to "who's closest
+// to this key that I know about" - used both to seed a lookup's starting
+// shortlist and as what a queried peer contributes back mid-lookup.
+func (ps *PeerSimulator) closestKnown(owner *PeerContainer, targetID kademliaID, k int) []string {
+	owner.kademliaMu.Lock()
+	type scored struct {
+		id   string
+		dist *big.Int
+	}
+	var all []scored
+	for _, bucket := range owner.buckets {
+		for _, entry := range bucket {
+			all = append(all, scored{id: entry.PeerID, dist: xorDistance(hashKademliaID(entry.PeerID), targetID)})
+		}
+	}
+	owner.kademliaMu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].dist.Cmp(all[j].dist) < 0 })
+	if len(all) > k {
+		all = all[:k]
+	}
+	out := make([]string, len(all))
+	for i, s := range all {
+		out[i] = s.id
+	}
+	return out
+}
+
+// bootstrapKademliaOverlay seeds every peer's k-buckets by "pinging" a
+// small random set of other online peers and inserting each side into
+// the other's table - standing in for a real PING/PONG exchange, since
+// this simulator has no network transport. This replaces the old
+// uniform-random createP2PConnections mesh with locality-aware routing
+// state: who ends up in whose buckets depends on XOR distance, not on a
+// region-weighted coin flip.
+func (ps *PeerSimulator) bootstrapKademliaOverlay() {
+	fmt.Println("🕸️  Bootstrapping Kademlia overlay...")
+
+	edgeConnections := 0
+	maxEdgeConnections := 4
+
+	for _, peer := range ps.peers {
+		// 6% chance to connect to edge server (handled by network topology).
+		// The peers picked here advertise edge-gateway so routing can treat
+		// them as the swarm's entry points to the CDN edge - see
+		// capabilities.go.
+		if rand.Float64() < 0.06 && edgeConnections < maxEdgeConnections {
+			edgeConnections++
+			peer.Capabilities = append(peer.Capabilities, "edge-gateway")
+		}
+
+		ps.pingBootstrap(peer)
+	}
+
+	fmt.Printf("✅ Kademlia overlay bootstrapped with %d edge connections\n", edgeConnections)
+}
+
+// pingBootstrap "pings" up to bootstrapPings random online peers and
+// inserts each side into the other's bucket table - the per-peer unit of
+// work bootstrapKademliaOverlay runs for every peer at startup, and that
+// churn.go's rejoinPeer re-runs for a single peer after it comes back
+// online from a churn-induced departure.
+func (ps *PeerSimulator) pingBootstrap(peer *PeerContainer) {
+	pings := bootstrapPings
+	if pings > len(ps.peers)-1 {
+		pings = len(ps.peers) - 1
+	}
+	tried := make(map[string]bool, pings)
+	for attempts := 0; attempts < pings*3 && len(tried) < pings; attempts++ {
+		candidate := ps.peers[rand.Intn(len(ps.peers))]
+		if candidate.ID == peer.ID || tried[candidate.ID] {
+			continue
+		}
+		tried[candidate.ID] = true
+		if !candidate.IsOnline {
+			continue
+		}
+		ps.touchBucket(peer, candidate.ID)
+		ps.touchBucket(candidate, peer.ID)
+	}
+}
+
+// shortlistEntry is one candidate in an in-progress FindNode/FindValue
+// lookup: its distance from the target, and whether this round's fan-out
+// has already queried it.
+type shortlistEntry struct {
+	PeerID  string
+	Dist    *big.Int
+	Queried bool
+}
+
+func sortShortlist(list []*shortlistEntry) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Dist.Cmp(list[j].Dist) < 0 })
+}
+
+func newShortlist(ps *PeerSimulator, peer *PeerContainer, targetID kademliaID) []*shortlistEntry {
+	var out []*shortlistEntry
+	for _, id := range ps.closestKnown(peer, targetID, kBucketSize) {
+		out = append(out, &shortlistEntry{PeerID: id, Dist: xorDistance(hashKademliaID(id), targetID)})
+	}
+	sortShortlist(out)
+	return out
+}
+
+// nextBatch returns up to n not-yet-queried entries closest to the
+// target, marking them queried so a later round doesn't repeat them.
+func nextBatch(list []*shortlistEntry, n int) []string {
+	var out []string
+	for _, entry := range list {
+		if entry.Queried {
+			continue
+		}
+		entry.Queried = true
+		out = append(out, entry.PeerID)
+		if len(out) == n {
+			break
+		}
+	}
+	return out
+}
+
+// mergeShortlist folds a queried peer's own closest-known IDs into list,
+// and reports whether any of them beat list's current closest distance -
+// FindNode/FindValue stop once a round stops making progress, per the
+// standard Kademlia lookup termination rule.
+func mergeShortlist(list *[]*shortlistEntry, targetID kademliaID, candidates []string) bool {
+	var bestBefore *big.Int
+	if len(*list) > 0 {
+		bestBefore = (*list)[0].Dist
+	}
+	existing := make(map[string]bool, len(*list))
+	for _, e := range *list {
+		existing[e.PeerID] = true
+	}
+
+	progressed := false
+	for _, id := range candidates {
+		if existing[id] {
+			continue
+		}
+		existing[id] = true
+		dist := xorDistance(hashKademliaID(id), targetID)
+		if bestBefore == nil || dist.Cmp(bestBefore) < 0 {
+			progressed = true
+		}
+		*list = append(*list, &shortlistEntry{PeerID: id, Dist: dist})
+	}
+
+	sortShortlist(*list)
+	if len(*list) > shortlistCap {
+		*list = (*list)[:shortlistCap]
+	}
+	return progressed
+}
+
+func shortlistIDs(list []*shortlistEntry) []string {
+	out := make([]string, len(list))
+	for i, e := range list {
+		out[i] = e.PeerID
+	}
+	return out
+}
+
+// FindNode performs an iterative Kademlia node lookup for target,
+// starting from peer's own buckets. Each round queries up to
+// lookupAlpha unqueried shortlist entries concurrently (standing in for
+// pipelined network RPCs), merges their own closest-known peers into the
+// shortlist, and stops once a round turns up nobody closer than the
+// shortlist already has.
+func (ps *PeerSimulator) FindNode(peer *PeerContainer, target string) []string {
+	targetID := hashKademliaID(target)
+	shortlist := newShortlist(ps, peer, targetID)
+
+	for {
+		batch := nextBatch(shortlist, lookupAlpha)
+		if len(batch) == 0 {
+			break
+		}
+
+		responses := make([][]string, len(batch))
+		var wg sync.WaitGroup
+		for i, candidateID := range batch {
+			wg.Add(1)
+			go func(i int, candidateID string) {
+				defer wg.Done()
+				candidate := ps.findPeer(candidateID)
+				if candidate == nil || !candidate.IsOnline {
+					return
+				}
+				responses[i] = ps.closestKnown(candidate, targetID, kBucketSize)
+			}(i, candidateID)
+		}
+		wg.Wait()
+
+		progressed := false
+		for _, closest := range responses {
+			if mergeShortlist(&shortlist, targetID, closest) {
+				progressed = true
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+
+	ids := shortlistIDs(shortlist)
+	if len(ids) > kBucketSize {
+		ids = ids[:kBucketSize]
+	}
+	return ids
+}
+
+// findValueResult is what FindValue returns: either the peer that
+// answered with segmentID (Found), or the closest peers the lookup
+// turned up so the caller still has somewhere to route a publish.
+type findValueResult struct {
+	Found   bool
+	Holder  string
+	Closest []string
+}
+
+// FindValue performs the same iterative lookup as FindNode, but against
+// segmentID's key, and stops early the moment a queried peer actually
+// answers with the segment - either because it holds it directly or
+// because publishSegment stored a pointer to a holder there.
+func (ps *PeerSimulator) FindValue(peer *PeerContainer, segmentID string) findValueResult {
+	targetID := hashKademliaID(segmentID)
+	shortlist := newShortlist(ps, peer, targetID)
+
+	for {
+		batch := nextBatch(shortlist, lookupAlpha)
+		if len(batch) == 0 {
+			break
+		}
+
+		type response struct {
+			holder  string
+			closest []string
+		}
+		responses := make([]response, len(batch))
+		var wg sync.WaitGroup
+		for i, candidateID := range batch {
+			wg.Add(1)
+			go func(i int, candidateID string) {
+				defer wg.Done()
+				candidate := ps.findPeer(candidateID)
+				if candidate == nil || !candidate.IsOnline {
+					return
+				}
+				if holderID := ps.segmentHolder(candidate, segmentID); holderID != "" {
+					responses[i] = response{holder: holderID}
+					return
+				}
+				responses[i] = response{closest: ps.closestKnown(candidate, targetID, kBucketSize)}
+			}(i, candidateID)
+		}
+		wg.Wait()
+
+		progressed := false
+		for _, r := range responses {
+			if r.holder != "" {
+				return findValueResult{Found: true, Holder: r.holder, Closest: shortlistIDs(shortlist)}
+			}
+			if mergeShortlist(&shortlist, targetID, r.closest) {
+				progressed = true
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+
+	return findValueResult{Closest: shortlistIDs(shortlist)}
+}
+
+// segmentHolder answers FindValue's question for one queried peer: does
+// it hold segmentID itself (checking both the segmentNNN.ts and song_NNN
+// naming schemes makeRequest already treats as equivalent), or does its
+// DHT store point at someone who does? Returns the holder's peer ID, or
+// "" if candidate has no answer.
+func (ps *PeerSimulator) segmentHolder(candidate *PeerContainer, segmentID string) string {
+	candidate.stateMu.Lock()
+	songID, hasSongID := songIDForSegment(segmentID)
+	holdsDirectly := candidate.Storage[segmentID] || (hasSongID && candidate.Storage[songID])
+	candidate.stateMu.Unlock()
+	if holdsDirectly {
+		return candidate.ID
+	}
+
+	candidate.kademliaMu.Lock()
+	holders := candidate.dhtStore[segmentID]
+	candidate.kademliaMu.Unlock()
+	for holderID := range holders {
+		return holderID
+	}
+	return ""
+}
+
+// songIDForSegment mirrors the segmentNNN.ts <-> song_NNN compatibility
+// check makeRequest has always done for its P2P hit path.
+func songIDForSegment(segmentID string) (string, bool) {
+	if len(segmentID) < 12 || segmentID[:8] != "segment" {
+		return "", false
+	}
+	var segmentNum int
+	fmt.Sscanf(segmentID, "segment%03d.ts", &segmentNum)
+	return fmt.Sprintf("song_%03d", segmentNum), true
+}
+
+// publishSegment "stores" the (segmentID, peer.ID) pair on the k peers
+// whose Kademlia ID is closest to hash(segmentID) - a real Kademlia
+// STORE RPC. A later FindValue for this segment can then be answered by
+// any of those k peers even if they never fetched the segment
+// themselves, same as a real DHT separates who a value lives on from who
+// happens to be asking for it.
+func (ps *PeerSimulator) publishSegment(peer *PeerContainer, segmentID string) {
+	for _, holderID := range ps.FindNode(peer, segmentID) {
+		holder := ps.findPeer(holderID)
+		if holder == nil {
+			continue
+		}
+		holder.kademliaMu.Lock()
+		if holder.dhtStore == nil {
+			holder.dhtStore = make(map[string]map[string]bool)
+		}
+		if holder.dhtStore[segmentID] == nil {
+			holder.dhtStore[segmentID] = make(map[string]bool)
+		}
+		holder.dhtStore[segmentID][peer.ID] = true
+		holder.kademliaMu.Unlock()
+	}
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/rand"
 	"net/http"
 	"os"
@@ -26,6 +26,36 @@ type PeerContainer struct {
 	LastSeen     time.Time         `json:"lastSeen"`
 	RequestCount int64             `json:"requestCount"`
 	UploadCount  int64             `json:"uploadCount"`
+	Capabilities []string          `json:"capabilities"` // Advertised roles - see capabilities.go
+	FaultMode    string            `json:"-"`            // "", "slow", "flaky", or "byzantine" - see churn.go
+
+	// Kademlia routing state - local to this simulator, never sent to the
+	// network topology API. See kademlia.go.
+	kademliaID kademliaID
+	buckets    [idBits][]kBucketEntry
+	dhtStore   map[string]map[string]bool // segmentID -> peer IDs known to hold it
+	kademliaMu sync.Mutex
+
+	// PEX gossip state - what's changed in Connections since this peer's
+	// last PEX message, and when that message went out. See pex.go.
+	pexLastSent    time.Time
+	pexPendingAdd  map[string]bool
+	pexPendingDrop map[string]bool
+
+	// Replication state - when each Storage entry was last (re)acquired,
+	// for evictOldestSegment's LRU ordering, and what this peer has heard
+	// via HAVE gossip about who else holds a segment, for its last-holder
+	// eviction guard and the fetcher's peer-scoring. See replication.go.
+	lastAccess     map[string]time.Time
+	remoteBitfield map[string]map[string]bool
+
+	// stateMu guards every field above that the fetcher, PEX, churn, and
+	// replication goroutines can all reach concurrently (Storage, Memory,
+	// lastAccess, remoteBitfield, Connections, pexPendingAdd/Drop) - the
+	// same discipline kademliaMu already applies to buckets/dhtStore, just
+	// scoped to this peer's general mutable state instead of its routing
+	// table.
+	stateMu sync.Mutex
 }
 
 // PeerRequest represents a request from this peer
@@ -51,6 +81,14 @@ type PeerSimulator struct {
 	trackerAPI   string
 	mu           sync.RWMutex
 	requestCount int64
+
+	// Fetcher subsystem state - see fetcher.go.
+	peerStats  sync.Map // peer ID -> *peerStat
+	fetchQueue *fetchQueue
+	qos        *qosTuner
+
+	// Churn/fault-injection state - see churn.go.
+	churn *ChurnController
 }
 
 func NewPeerSimulator(networkAPI, trackerAPI string) *PeerSimulator {
@@ -58,6 +96,9 @@ func NewPeerSimulator(networkAPI, trackerAPI string) *PeerSimulator {
 		networkAPI: networkAPI,
 		trackerAPI: trackerAPI,
 		peers:      make([]*PeerContainer, 0),
+		fetchQueue: newFetchQueue(),
+		qos:        newQosTuner(),
+		churn:      newChurnController(),
 	}
 }
 
@@ -92,61 +133,37 @@ func (ps *PeerSimulator) CreatePeers(count int) {
 			Connections: make([]string, 0),
 			IsOnline:    true,
 			LastSeen:    time.Now(),
+			lastAccess:  make(map[string]time.Time),
 		}
-		
+		peer.kademliaID = hashKademliaID(peer.ID)
+		assignCapabilities(peer)
+		ps.churn.assignFaultMode(peer)
+
 		// Give peer some random segments (1-3 segments)
 		segmentCount := rand.Intn(3) + 1
 		for j := 0; j < segmentCount; j++ {
-			segmentID := fmt.Sprintf("segment%03d.ts", rand.Intn(8))
+			segmentID := fmt.Sprintf("segment%03d.ts", rand.Intn(segmentCatalogSize))
 			peer.Storage[segmentID] = true
 			peer.Memory += 5000000 // 5MB per segment
+			peer.lastAccess[segmentID] = time.Now()
 		}
-		
+
 		ps.peers = append(ps.peers, peer)
 	}
-	
-	// Create P2P connections
-	ps.createP2PConnections()
-	
-	fmt.Printf("✅ Created %d peer containers\n", len(ps.peers))
-}
 
-func (ps *PeerSimulator) createP2PConnections() {
-	fmt.Println("🕸️  Creating P2P mesh connections...")
-	
-	// Only 3-4 peers connect directly to edge servers
-	edgeConnections := 0
-	maxEdgeConnections := 4
-	
+	// Bootstrap every peer's Kademlia buckets before publishing anything,
+	// so publishSegment's FindNode walk below has somewhere to route to.
+	ps.bootstrapKademliaOverlay()
+
+	// Publish each peer's initial random segments into the DHT now that
+	// routing state exists.
 	for _, peer := range ps.peers {
-		// 6% chance to connect to edge server
-		if rand.Float64() < 0.06 && edgeConnections < maxEdgeConnections {
-			// This peer will connect to edge server (handled by network topology)
-			edgeConnections++
-		}
-		
-		// Connect to 2-5 other peers
-		peerConnections := rand.Intn(4) + 2
-		connected := 0
-		
-		for _, otherPeer := range ps.peers {
-			if otherPeer.ID != peer.ID && connected < peerConnections {
-				// Higher chance to connect to peers in same region
-				connectProb := 0.3
-				if peer.Region == otherPeer.Region {
-					connectProb = 0.8
-				}
-				
-				if rand.Float64() < connectProb {
-					peer.Connections = append(peer.Connections, otherPeer.ID)
-					otherPeer.Connections = append(otherPeer.Connections, peer.ID)
-					connected++
-				}
-			}
+		for segmentID := range peer.Storage {
+			ps.publishSegment(peer, segmentID)
 		}
 	}
-	
-	fmt.Printf("✅ P2P mesh created with %d edge connections\n", edgeConnections)
+
+	fmt.Printf("✅ Created %d peer containers\n", len(ps.peers))
 }
 
 func (ps *PeerSimulator) StartSimulation() {
@@ -157,10 +174,27 @@ func (ps *PeerSimulator) StartSimulation() {
 	
 	// Start request simulation
 	go ps.simulateRequests()
-	
+
 	// Start periodic status updates
 	go ps.periodicStatusUpdate()
-	
+
+	// Start the fetcher subsystem: qosTuner keeps the shared request
+	// timeout realistic, fetchLoop drains the priority queue simulateRequests
+	// feeds into.
+	ctx := context.Background()
+	go ps.qosTunerLoop(ctx)
+	go ps.fetchLoop(ctx)
+
+	// Start PEX gossip, so the mesh keeps discovering and pruning peers on
+	// its own (see pex.go), and the churn controller that drives those
+	// departures/rejoins in the first place (see churn.go).
+	go ps.pexLoop(ctx)
+	go ps.runChurnController(ctx)
+
+	// Start the rarest-first replicator, so spare capacity goes toward
+	// segments the tracker reports as globally scarce (see replication.go).
+	go ps.replicatorLoop(ctx)
+
 	// Keep running
 	select {}
 }
@@ -171,13 +205,14 @@ func (ps *PeerSimulator) registerPeers() {
 	for _, peer := range ps.peers {
 		// Register peer with network topology
 		peerData := map[string]interface{}{
-			"id":       peer.ID,
-			"type":     "peer",
-			"region":   peer.Region,
-			"storage":  peer.Storage,
-			"memory":   peer.Memory,
-			"maxMemory": peer.MaxMemory,
-			"isOnline": peer.IsOnline,
+			"id":           peer.ID,
+			"type":         "peer",
+			"region":       peer.Region,
+			"storage":      peer.Storage,
+			"memory":       peer.Memory,
+			"maxMemory":    peer.MaxMemory,
+			"isOnline":     peer.IsOnline,
+			"capabilities": peer.Capabilities,
 		}
 		
 		jsonData, _ := json.Marshal(peerData)
@@ -218,98 +253,22 @@ func (ps *PeerSimulator) simulateRequests() {
 		}
 		
 		// Request a random segment (try both formats)
-		segmentNum := rand.Intn(8)
+		segmentNum := rand.Intn(segmentCatalogSize)
 		segmentID := fmt.Sprintf("segment%03d.ts", segmentNum)
 		songID := fmt.Sprintf("song_%03d", segmentNum)
 		
 		// Check if peer already has this segment (either format)
-		if peer.Storage[segmentID] || peer.Storage[songID] {
+		peer.stateMu.Lock()
+		alreadyHeld := peer.Storage[segmentID] || peer.Storage[songID]
+		peer.stateMu.Unlock()
+		if alreadyHeld {
 			continue
 		}
 		
-		// Make request through network topology
-		ps.makeRequest(peer, segmentID)
-	}
-}
-
-func (ps *PeerSimulator) makeRequest(peer *PeerContainer, segmentID string) {
-	ps.mu.Lock()
-	ps.requestCount++
-	ps.mu.Unlock()
-	
-	// First try P2P - check connected peers
-	for _, connectedPeerID := range peer.Connections {
-		connectedPeer := ps.findPeer(connectedPeerID)
-		if connectedPeer != nil {
-			// Check both segment formats for the requested segment
-			// Extract segment number from segmentID (e.g., "segment003.ts" -> 3)
-			var segmentNum int
-			if len(segmentID) >= 12 && segmentID[:8] == "segment" {
-				fmt.Sscanf(segmentID, "segment%03d.ts", &segmentNum)
-			}
-			songIDCheck := fmt.Sprintf("song_%03d", segmentNum)
-			
-			if connectedPeer.Storage[segmentID] || connectedPeer.Storage[songIDCheck] {
-				// Found in P2P network
-				peer.Storage[segmentID] = true
-				peer.Memory += 5000000 // 5MB per segment
-				peer.RequestCount++
-				
-				// Register new segment with tracker
-				ps.registerSegment(peer.ID, segmentID)
-				
-				// If memory is full, remove oldest segment
-				if peer.Memory > peer.MaxMemory {
-					ps.evictOldestSegment(peer)
-				}
-				
-				fmt.Printf("✅ %s received %s from peer %s (P2P, 1 hop, 20ms)\n", 
-					peer.ID, segmentID, connectedPeerID)
-				return
-			}
-		}
-	}
-	
-	// If not found in P2P, try through network topology (edge/origin)
-	request := PeerRequest{
-		RequestID: fmt.Sprintf("req_%d_%d", time.Now().UnixNano(), ps.requestCount),
-		SegmentID: segmentID,
-		FromPeer:  peer.ID,
-		Timestamp: time.Now(),
-	}
-	
-	jsonData, _ := json.Marshal(request)
-	resp, err := http.Post(ps.networkAPI+"/request", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Request failed: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-	
-	var response PeerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		log.Printf("Failed to decode response: %v", err)
-		return
-	}
-	
-	if response.Success {
-		// Peer received the segment
-		peer.Storage[segmentID] = true
-		peer.Memory += 5000000 // 5MB per segment
-		peer.RequestCount++
-		
-		// Register new segment with tracker
-		ps.registerSegment(peer.ID, segmentID)
-		
-		// If memory is full, remove oldest segment
-		if peer.Memory > peer.MaxMemory {
-			ps.evictOldestSegment(peer)
-		}
-		
-		fmt.Printf("✅ %s received %s from %s (%d hops, %dms)\n", 
-			peer.ID, segmentID, response.Source, response.Hops, response.Latency)
-	} else {
-		fmt.Printf("❌ %s failed to get %s\n", peer.ID, segmentID)
+		// Queue the request - fetchLoop dispatches it to the priority
+		// queue's ranked candidates, prioritizing rarer segments over ones
+		// everybody already has (see fetcher.go).
+		ps.enqueueFetch(peer, segmentID)
 	}
 }
 
@@ -322,15 +281,6 @@ func (ps *PeerSimulator) findPeer(peerID string) *PeerContainer {
 	return nil
 }
 
-func (ps *PeerSimulator) evictOldestSegment(peer *PeerContainer) {
-	// Simple LRU: remove first segment found
-	for segmentID := range peer.Storage {
-		delete(peer.Storage, segmentID)
-		peer.Memory -= 5000000
-		break
-	}
-}
-
 func (ps *PeerSimulator) periodicStatusUpdate() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -351,10 +301,12 @@ func (ps *PeerSimulator) printStatus() {
 	for _, peer := range ps.peers {
 		if peer.IsOnline {
 			onlinePeers++
+			peer.stateMu.Lock()
 			for segmentID := range peer.Storage {
 				totalSegments++
 				segmentCounts[segmentID]++
 			}
+			peer.stateMu.Unlock()
 		}
 	}
 	
@@ -369,6 +321,10 @@ func (ps *PeerSimulator) printStatus() {
 			fmt.Printf("     %s: %d peers\n", segmentID, count)
 		}
 	}
+
+	metrics := ps.fetchMetrics()
+	fmt.Printf("   Fetcher QoS: avg RTT %.1fms, hit rate %.0f%%, timeout %s, %d peers tracked\n",
+		metrics.AverageRTT, metrics.HitRate*100, metrics.Timeout, len(metrics.PerPeer))
 	fmt.Println()
 }
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	pexInterval       = 60 * time.Second // rate limit: at most one PEX message sent per peer per this long
+	pexSampleSize     = 10               // recipients a single PEX message is fanned out to
+	pexMaxAdditions   = 5                // anti-flood cap: new peers merged in from one received message
+	pexMaxConnections = 20               // cap on how many Connections a peer keeps
+	pexGossipInterval = 10 * time.Second // how often pexLoop gives every peer a turn to send
+)
+
+// pexMessage is what one peer sends another during gossip: peers it has
+// seen added to or dropped from its own Connections since its last PEX
+// message, so a quiet mesh costs almost nothing to keep converged.
+type pexMessage struct {
+	Added   []string
+	Dropped []string
+}
+
+// addConnection adds candidateID to owner.Connections if it isn't already
+// there and there's room, and queues it as a pending addition so owner's
+// next PEX message tells its neighbors about it. Returns whether it was
+// actually added.
+func (ps *PeerSimulator) addConnection(owner *PeerContainer, candidateID string) bool {
+	owner.stateMu.Lock()
+	defer owner.stateMu.Unlock()
+
+	if candidateID == owner.ID || len(owner.Connections) >= pexMaxConnections {
+		return false
+	}
+	for _, id := range owner.Connections {
+		if id == candidateID {
+			return false
+		}
+	}
+	owner.Connections = append(owner.Connections, candidateID)
+	if owner.pexPendingAdd == nil {
+		owner.pexPendingAdd = make(map[string]bool)
+	}
+	owner.pexPendingAdd[candidateID] = true
+	delete(owner.pexPendingDrop, candidateID)
+	return true
+}
+
+// removeConnection drops candidateID from owner.Connections and queues it
+// as a pending drop, so churn (a peer going offline) propagates through
+// gossip instead of just silently vanishing from one peer's view.
+func (ps *PeerSimulator) removeConnection(owner *PeerContainer, candidateID string) {
+	owner.stateMu.Lock()
+	defer owner.stateMu.Unlock()
+
+	for i, id := range owner.Connections {
+		if id == candidateID {
+			owner.Connections = append(owner.Connections[:i], owner.Connections[i+1:]...)
+			break
+		}
+	}
+	if owner.pexPendingDrop == nil {
+		owner.pexPendingDrop = make(map[string]bool)
+	}
+	owner.pexPendingDrop[candidateID] = true
+	delete(owner.pexPendingAdd, candidateID)
+}
+
+// pexLoop drives PEX gossip: every pexGossipInterval, each online peer
+// whose rate limiter has cleared sends a pexMessage to a random subset of
+// its own Connections, letting the mesh discover new peers and learn
+// about drops without any of it round-tripping through networkAPI.
+func (ps *PeerSimulator) pexLoop(ctx context.Context) {
+	ticker := time.NewTicker(pexGossipInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, peer := range ps.peers {
+				if peer.IsOnline {
+					ps.sendPex(peer)
+				}
+			}
+		}
+	}
+}
+
+// sendPex sends peer's pending adds/drops to a random subset of its
+// Connections, respecting pexInterval's per-peer rate limit so a single
+// peer can't flood the mesh with PEX traffic.
+func (ps *PeerSimulator) sendPex(peer *PeerContainer) {
+	peer.stateMu.Lock()
+	if time.Since(peer.pexLastSent) < pexInterval {
+		peer.stateMu.Unlock()
+		return
+	}
+	if len(peer.pexPendingAdd) == 0 && len(peer.pexPendingDrop) == 0 {
+		peer.stateMu.Unlock()
+		return
+	}
+	peer.pexLastSent = time.Now()
+
+	var msg pexMessage
+	for id := range peer.pexPendingAdd {
+		msg.Added = append(msg.Added, id)
+	}
+	for id := range peer.pexPendingDrop {
+		msg.Dropped = append(msg.Dropped, id)
+	}
+	peer.pexPendingAdd = make(map[string]bool)
+	peer.pexPendingDrop = make(map[string]bool)
+
+	recipients := append([]string(nil), peer.Connections...)
+	peer.stateMu.Unlock()
+
+	rand.Shuffle(len(recipients), func(i, j int) { recipients[i], recipients[j] = recipients[j], recipients[i] })
+	if len(recipients) > pexSampleSize {
+		recipients = recipients[:pexSampleSize]
+	}
+	for _, recipientID := range recipients {
+		recipient := ps.findPeer(recipientID)
+		if recipient == nil || !recipient.IsOnline {
+			continue
+		}
+		ps.receivePex(recipient, msg)
+	}
+}
+
+// receivePex applies a gossiped pexMessage at recipient: up to
+// pexMaxAdditions new peers are merged into recipient.Connections (the
+// anti-flood cap - one message can't hand a peer its whole Connections
+// allowance at once), and every dropped peer is removed if present, so
+// churn a sender observed keeps propagating outward.
+func (ps *PeerSimulator) receivePex(recipient *PeerContainer, msg pexMessage) {
+	added := 0
+	for _, candidateID := range msg.Added {
+		if added >= pexMaxAdditions {
+			break
+		}
+		if ps.addConnection(recipient, candidateID) {
+			added++
+		}
+	}
+	for _, droppedID := range msg.Dropped {
+		ps.removeConnection(recipient, droppedID)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	replicatorInterval = 20 * time.Second
+	segmentCatalogSize = 8       // matches the segmentNNN.ts range CreatePeers/simulateRequests draw from
+	minSpareMemory     = 5000000 // one segment's worth - replicator won't fetch if it wouldn't fit
+)
+
+// haveMessage is what broadcastHave gossips when a peer acquires a new
+// segment: just enough for a recipient to record who has it.
+type haveMessage struct {
+	SegmentID string
+	FromPeer  string
+}
+
+// broadcastHave gossips peer's newly-acquired segmentID to a random 2/3
+// subset of its Connections - a Neo-style partial broadcast, cheaper than
+// flooding every connection but still converging across the mesh as more
+// peers acquire (and re-broadcast) the same segment over time. Recipients
+// fold it into their remoteBitfield.
+func (ps *PeerSimulator) broadcastHave(peer *PeerContainer, segmentID string) {
+	peer.stateMu.Lock()
+	recipients := append([]string(nil), peer.Connections...)
+	peer.stateMu.Unlock()
+	if len(recipients) == 0 {
+		return
+	}
+	rand.Shuffle(len(recipients), func(i, j int) { recipients[i], recipients[j] = recipients[j], recipients[i] })
+
+	fanout := (len(recipients) * 2) / 3
+	if fanout == 0 {
+		fanout = 1
+	}
+	recipients = recipients[:fanout]
+
+	msg := haveMessage{SegmentID: segmentID, FromPeer: peer.ID}
+	for _, recipientID := range recipients {
+		if recipient := ps.findPeer(recipientID); recipient != nil && recipient.IsOnline {
+			ps.receiveHave(recipient, msg)
+		}
+	}
+}
+
+// receiveHave records that msg.FromPeer holds msg.SegmentID in
+// recipient's remoteBitfield.
+func (ps *PeerSimulator) receiveHave(recipient *PeerContainer, msg haveMessage) {
+	recipient.stateMu.Lock()
+	defer recipient.stateMu.Unlock()
+
+	if recipient.remoteBitfield == nil {
+		recipient.remoteBitfield = make(map[string]map[string]bool)
+	}
+	if recipient.remoteBitfield[msg.SegmentID] == nil {
+		recipient.remoteBitfield[msg.SegmentID] = make(map[string]bool)
+	}
+	recipient.remoteBitfield[msg.SegmentID][msg.FromPeer] = true
+}
+
+// preferKnownHolders stable-partitions ids so peers peer's own
+// remoteBitfield confirms hold segmentID (via HAVE gossip) come first - a
+// confirmed holder is a better bet than one FindNode merely surfaced by
+// Kademlia proximity.
+func (ps *PeerSimulator) preferKnownHolders(peer *PeerContainer, segmentID string, ids []string) []string {
+	peer.stateMu.Lock()
+	known := make(map[string]bool, len(peer.remoteBitfield[segmentID]))
+	for id := range peer.remoteBitfield[segmentID] {
+		known[id] = true
+	}
+	peer.stateMu.Unlock()
+
+	if len(known) == 0 {
+		return ids
+	}
+	preferred := make([]string, 0, len(ids))
+	rest := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if known[id] {
+			preferred = append(preferred, id)
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	return append(preferred, rest...)
+}
+
+// isLastKnownHolderLocked reports whether peer's remoteBitfield has heard
+// of no other peer holding segmentID - the conservative default, since
+// absence of gossip isn't proof nobody else has it, but it's the only
+// signal this simulator has. Callers must already hold peer.stateMu.
+func (ps *PeerSimulator) isLastKnownHolderLocked(peer *PeerContainer, segmentID string) bool {
+	return len(peer.remoteBitfield[segmentID]) == 0
+}
+
+// evictOldestSegment evicts peer's least-recently-accessed segment,
+// skipping any segment peer would be the last known holder of per
+// isLastKnownHolderLocked - preventing a capacity-constrained peer from
+// accidentally making a segment disappear from the swarm entirely. If
+// every held segment would be a last-known-holder loss, it refuses to
+// evict anything.
+func (ps *PeerSimulator) evictOldestSegment(peer *PeerContainer) {
+	peer.stateMu.Lock()
+	defer peer.stateMu.Unlock()
+
+	var oldestID string
+	var oldestAt time.Time
+	for segmentID := range peer.Storage {
+		if ps.isLastKnownHolderLocked(peer, segmentID) {
+			continue
+		}
+		accessedAt := peer.lastAccess[segmentID]
+		if oldestID == "" || accessedAt.Before(oldestAt) {
+			oldestID = segmentID
+			oldestAt = accessedAt
+		}
+	}
+	if oldestID == "" {
+		return
+	}
+	delete(peer.Storage, oldestID)
+	delete(peer.lastAccess, oldestID)
+	peer.Memory -= 5000000
+}
+
+// replicatorLoop periodically looks for peers with spare MaxMemory-Memory
+// capacity and proactively fetches the globally rarest segment they don't
+// already hold, so printStatus's segmentCounts stops bottoming out at
+// 0-1 holders for unlucky segments.
+func (ps *PeerSimulator) replicatorLoop(ctx context.Context) {
+	ticker := time.NewTicker(replicatorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			counts, err := ps.globalSegmentCounts()
+			if err != nil {
+				continue
+			}
+			for _, peer := range ps.peers {
+				peer.stateMu.Lock()
+				spare := peer.MaxMemory - peer.Memory
+				peer.stateMu.Unlock()
+				if !peer.IsOnline || spare < minSpareMemory {
+					continue
+				}
+				if segmentID := rarestMissing(peer, counts); segmentID != "" {
+					ps.enqueueFetch(peer, segmentID)
+				}
+			}
+		}
+	}
+}
+
+// globalSegmentCounts asks the tracker's GET /scrape how many peers hold
+// each segment in the known catalog, so replicatorLoop can target the
+// globally rarest ones instead of just what's locally visible.
+func (ps *PeerSimulator) globalSegmentCounts() (map[string]int64, error) {
+	query := url.Values{}
+	for i := 0; i < segmentCatalogSize; i++ {
+		query.Add("segment", fmt.Sprintf("segment%03d.ts", i))
+	}
+
+	resp, err := http.Get(ps.trackerAPI + "/scrape?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var scrape struct {
+		Files map[string]struct {
+			Complete   int64 `json:"complete"`
+			Incomplete int64 `json:"incomplete"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&scrape); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(scrape.Files))
+	for segmentID, stats := range scrape.Files {
+		counts[segmentID] = stats.Complete + stats.Incomplete
+	}
+	return counts, nil
+}
+
+// rarestMissing returns the segment in the catalog with the lowest
+// holder count (per counts) that peer doesn't already have, or "" if
+// peer already holds everything in the catalog.
+func rarestMissing(peer *PeerContainer, counts map[string]int64) string {
+	peer.stateMu.Lock()
+	defer peer.stateMu.Unlock()
+
+	rarest := ""
+	var rarestCount int64 = -1
+	for i := 0; i < segmentCatalogSize; i++ {
+		segmentID := fmt.Sprintf("segment%03d.ts", i)
+		if peer.Storage[segmentID] {
+			continue
+		}
+		count := counts[segmentID]
+		if rarestCount < 0 || count < rarestCount {
+			rarest = segmentID
+			rarestCount = count
+		}
+	}
+	return rarest
+}
@@ -2,177 +2,672 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/yaml.v3"
 )
 
+// PeerData is the tracker's /announce wire shape, reused verbatim for
+// /heartbeat since both accept the same peer-identity fields.
 type PeerData struct {
-	PeerID       string   `json:"peerId"`
-	Addr         string   `json:"addr"`
+	PeerID       string   `json:"peer_id"`
+	Room         string   `json:"room"`
 	Segments     []string `json:"segments"`
+	Neighbors    []string `json:"neighbors"`
 	Region       string   `json:"region"`
-	RTT          int      `json:"rtt"`
+	RTT          int      `json:"rtt_ms"`
 	Bandwidth    string   `json:"bandwidth"`
 	LastSeen     int64    `json:"lastSeen"`
 	Availability float64  `json:"availability"`
 }
 
-func main() {
-	peerCount := 2000
-	if len(os.Args) > 1 {
-		if count, err := strconv.Atoi(os.Args[1]); err == nil {
-			peerCount = count
-		}
-	}
-
-	trackerURL := "http://localhost:8090/announce"
-	signalingURL := "ws://localhost:8091/ws"
-
-	segments := []string{
-		"rickroll/128k/segment000.ts",
-		"rickroll/128k/segment001.ts",
-		"rickroll/128k/segment002.ts",
-		"rickroll/128k/segment003.ts",
-		"rickroll/128k/segment004.ts",
-	}
-
-	regions := []string{
-		"us-east", "us-west", "us-central",
-		"eu-west", "eu-central", "eu-north",
-		"asia-pacific", "asia-southeast", "asia-northeast",
-		"canada", "brazil", "australia", "japan", "india"
-	}
-
-	bandwidthTiers := []struct {
-		tier         string
-		rttRange     [2]int
-		availability float64
-		segmentProb  float64
-	}{
-		{"fiber", [2]int{5, 15}, 0.95, 0.8},
-		{"cable", [2]int{15, 40}, 0.85, 0.6},
-		{"dsl", [2]int{40, 80}, 0.75, 0.4},
-		{"mobile", [2]int{80, 200}, 0.65, 0.3},
-	}
-
-	fmt.Printf("🚀 Simulating %d peers for Rick Roll CDN...\n", peerCount)
-	fmt.Println("📡 Registering peers with tracker...")
-
-	successCount := 0
-	errorCount := 0
-
-	for i := 1; i <= peerCount; i++ {
-		// Random peer characteristics
-		region := regions[rand.Intn(len(regions))]
-		bandwidth := bandwidthTiers[rand.Intn(len(bandwidthTiers))]
-		rtt := rand.Intn(bandwidth.rttRange[1]-bandwidth.rttRange[0]) + bandwidth.rttRange[0]
-
-		// Determine which segments this peer has (realistic distribution)
-		var peerSegments []string
-		for segIdx, segment := range segments {
-			// Higher probability for earlier segments (more popular)
-			probability := bandwidth.segmentProb * (1.0 - float64(segIdx)*0.1)
-			if rand.Float64() < probability {
-				peerSegments = append(peerSegments, segment)
-			}
+var segments = []string{
+	"rickroll/128k/segment000.ts",
+	"rickroll/128k/segment001.ts",
+	"rickroll/128k/segment002.ts",
+	"rickroll/128k/segment003.ts",
+	"rickroll/128k/segment004.ts",
+}
+
+var regions = []string{
+	"us-east", "us-west", "us-central",
+	"eu-west", "eu-central", "eu-north",
+	"asia-pacific", "asia-southeast", "asia-northeast",
+	"canada", "brazil", "australia", "japan", "india",
+}
+
+// bandwidthTier describes one connection class's RTT range, steady-state
+// availability, and how eagerly its peers seed each (popularity-ordered)
+// segment. meanLifetime and meanInterarrival are the Poisson process
+// parameters for this tier: how long a peer of this tier typically stays
+// in the swarm before departing, and how often a new one of this tier
+// shows up in a region, absent any scenario wave.
+type bandwidthTier struct {
+	name             string
+	rttRange         [2]int
+	availability     float64
+	segmentProb      float64
+	meanLifetime     time.Duration
+	meanInterarrival time.Duration
+}
+
+var bandwidthTiers = []bandwidthTier{
+	{"fiber", [2]int{5, 15}, 0.95, 0.8, 20 * time.Minute, 3 * time.Second},
+	{"cable", [2]int{15, 40}, 0.85, 0.6, 12 * time.Minute, 2 * time.Second},
+	{"dsl", [2]int{40, 80}, 0.75, 0.4, 6 * time.Minute, 4 * time.Second},
+	{"mobile", [2]int{80, 200}, 0.65, 0.3, 3 * time.Minute, 1500 * time.Millisecond},
+}
+
+// natType is the NAT behavior a peer's "home router" simulates, which in
+// turn gates how often its direct WebRTC connect attempts to other peers
+// succeed - see natConnectProbability.
+type natType int
+
+const (
+	natFullCone natType = iota
+	natRestricted
+	natSymmetric
+)
+
+func (n natType) String() string {
+	switch n {
+	case natFullCone:
+		return "full-cone"
+	case natRestricted:
+		return "restricted"
+	default:
+		return "symmetric"
+	}
+}
+
+// natWeights is the rough real-world mix of home/carrier NAT behavior:
+// most consumer routers are full-cone or restricted-cone; symmetric NAT
+// (mostly seen behind carrier-grade NAT on mobile networks) is the
+// minority that actually needs a TURN relay to traverse.
+var natWeights = []struct {
+	nat    natType
+	weight float64
+}{
+	{natFullCone, 0.45},
+	{natRestricted, 0.40},
+	{natSymmetric, 0.15},
+}
+
+func pickNAT(rng *rand.Rand) natType {
+	r := rng.Float64()
+	var cum float64
+	for _, w := range natWeights {
+		cum += w.weight
+		if r < cum {
+			return w.nat
 		}
+	}
+	return natSymmetric
+}
 
-		// Only register peers that have at least one segment
-		if len(peerSegments) > 0 {
-			peer := PeerData{
-				PeerID:       fmt.Sprintf("peer-%s-%s-%d", region, bandwidth.tier, i),
-				Addr:         signalingURL,
-				Segments:     peerSegments,
-				Region:       region,
-				RTT:          rtt,
-				Bandwidth:    bandwidth.tier,
-				LastSeen:     time.Now().Unix(),
-				Availability: bandwidth.availability,
-			}
+// natConnectProbability approximates WebRTC ICE hole-punching success
+// between two peers' NAT types without a TURN relay. Symmetric-to-
+// symmetric is the classic failure case; anything involving a full-cone
+// NAT is close to guaranteed.
+func natConnectProbability(a, b natType) float64 {
+	if a > b {
+		a, b = b, a
+	}
+	switch {
+	case a == natFullCone:
+		return 0.95
+	case a == natRestricted && b == natRestricted:
+		return 0.8
+	case a == natRestricted && b == natSymmetric:
+		return 0.35
+	default: // symmetric-symmetric
+		return 0.1
+	}
+}
+
+// scenarioDuration wraps time.Duration so scenario YAML can spell waves
+// out as "5m"/"90s" instead of raw nanosecond integers.
+type scenarioDuration time.Duration
+
+func (d *scenarioDuration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = scenarioDuration(parsed)
+	return nil
+}
+
+// wave perturbs arrival rate, departure rate, or availability for one
+// region and/or bandwidth tier during [Start, Start+Duration) measured
+// from simulator startup. Leaving Region or BandwidthTier empty applies
+// the wave everywhere / to every tier respectively.
+type wave struct {
+	Name                   string           `yaml:"name"`
+	Start                  scenarioDuration `yaml:"start"`
+	Duration               scenarioDuration `yaml:"duration"`
+	Region                 string           `yaml:"region,omitempty"`
+	BandwidthTier          string           `yaml:"bandwidthTier,omitempty"`
+	ArrivalMultiplier      float64          `yaml:"arrivalMultiplier,omitempty"`
+	DepartureMultiplier    float64          `yaml:"departureMultiplier,omitempty"`
+	AvailabilityMultiplier float64          `yaml:"availabilityMultiplier,omitempty"`
+}
+
+func (w wave) active(elapsed time.Duration) bool {
+	start := time.Duration(w.Start)
+	return elapsed >= start && elapsed < start+time.Duration(w.Duration)
+}
+
+func (w wave) appliesTo(region, tier string) bool {
+	return (w.Region == "" || w.Region == region) && (w.BandwidthTier == "" || w.BandwidthTier == tier)
+}
+
+// scenario is the --scenario YAML document: a seed for reproducibility
+// plus the waves to play out on top of the steady-state Poisson process.
+type scenario struct {
+	Seed  int64  `yaml:"seed"`
+	Waves []wave `yaml:"waves"`
+}
+
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing scenario %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// simMetrics is peersim's own small Prometheus surface, separate from
+// pkg/metrics since none of that package's node/signaling gauges mean
+// anything for a synthetic swarm - the ones here describe the swarm
+// itself, not a service receiving traffic from it.
+type simMetrics struct {
+	swarmSize       *prometheus.GaugeVec
+	regionAvailable *prometheus.GaugeVec
+	peersArrived    *prometheus.CounterVec
+	peersDeparted   *prometheus.CounterVec
+	connectAttempts *prometheus.CounterVec
+	connectSuccess  *prometheus.CounterVec
+}
+
+func newSimMetrics() *simMetrics {
+	return &simMetrics{
+		swarmSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "peersim_swarm_size",
+			Help: "Current number of simulated peers considered alive, per region.",
+		}, []string{"region"}),
+		regionAvailable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "peersim_region_availability",
+			Help: "Mean self-reported availability of alive simulated peers, per region.",
+		}, []string{"region"}),
+		peersArrived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "peersim_peers_arrived_total",
+			Help: "Total simulated peers spawned, per region and bandwidth tier.",
+		}, []string{"region", "tier"}),
+		peersDeparted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "peersim_peers_departed_total",
+			Help: "Total simulated peers that left the swarm, per region and bandwidth tier.",
+		}, []string{"region", "tier"}),
+		connectAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "peersim_connect_attempts_total",
+			Help: "Total simulated WebRTC connect attempts, per NAT type pairing.",
+		}, []string{"nat_pair"}),
+		connectSuccess: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "peersim_connect_success_total",
+			Help: "Total simulated WebRTC connect attempts that succeeded, per NAT type pairing.",
+		}, []string{"nat_pair"}),
+	}
+}
+
+func (m *simMetrics) Register(registry *prometheus.Registry) error {
+	for _, c := range []prometheus.Collector{
+		m.swarmSize, m.regionAvailable, m.peersArrived, m.peersDeparted,
+		m.connectAttempts, m.connectSuccess,
+	} {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// simPeer is one simulated swarm member for as long as it's alive.
+type simPeer struct {
+	id       string
+	region   string
+	tier     bandwidthTier
+	nat      natType
+	segments []string
+}
+
+// simulator owns the live peer set and runs the region x tier arrival
+// spawners, each peer's heartbeat/departure lifecycle, and the metrics
+// aggregation loop.
+type simulator struct {
+	trackerURL   string
+	signalingURL string
+	ttl          time.Duration
+	scenario     *scenario
+	rng          *rand.Rand
+	metrics      *simMetrics
+	client       *http.Client
+
+	mu      sync.Mutex
+	peers   map[string]*simPeer
+	started time.Time
+}
+
+func newSimulator(trackerURL, signalingURL string, ttl time.Duration, sc *scenario, seed int64) *simulator {
+	return &simulator{
+		trackerURL:   trackerURL,
+		signalingURL: signalingURL,
+		ttl:          ttl,
+		scenario:     sc,
+		rng:          rand.New(rand.NewSource(seed)),
+		metrics:      newSimMetrics(),
+		client:       &http.Client{Timeout: 5 * time.Second},
+		peers:        make(map[string]*simPeer),
+	}
+}
+
+// elapsed is how long the simulator has been running, the clock every
+// wave's Start/Duration window is measured against.
+func (s *simulator) elapsed() time.Duration {
+	return time.Since(s.started)
+}
+
+// arrivalRate returns the Poisson arrival rate (events/sec) for region
+// and tier, folding in any active wave's ArrivalMultiplier.
+func (s *simulator) arrivalRate(region string, tier bandwidthTier) float64 {
+	base := 1.0 / tier.meanInterarrival.Seconds()
+	if s.scenario == nil {
+		return base
+	}
+	elapsed := s.elapsed()
+	for _, w := range s.scenario.Waves {
+		if w.ArrivalMultiplier != 0 && w.active(elapsed) && w.appliesTo(region, tier.name) {
+			base *= w.ArrivalMultiplier
+		}
+	}
+	return base
+}
+
+// departureRate returns the Poisson departure rate (events/sec) for one
+// peer of tier in region, folding in any active wave's DepartureMultiplier.
+func (s *simulator) departureRate(region string, tier bandwidthTier) float64 {
+	base := 1.0 / tier.meanLifetime.Seconds()
+	if s.scenario == nil {
+		return base
+	}
+	elapsed := s.elapsed()
+	for _, w := range s.scenario.Waves {
+		if w.DepartureMultiplier != 0 && w.active(elapsed) && w.appliesTo(region, tier.name) {
+			base *= w.DepartureMultiplier
+		}
+	}
+	return base
+}
 
-			if err := registerPeer(trackerURL, peer); err == nil {
-				successCount++
-				if successCount%200 == 0 {
-					fmt.Printf("✅ Registered %d peers...\n", successCount)
-				}
-			} else {
-				errorCount++
-				if errorCount%100 == 0 {
-					fmt.Printf("⚠️  %d registration errors so far...\n", errorCount)
-				}
+// availability returns tier's steady-state availability for region,
+// folding in any active wave's AvailabilityMultiplier (e.g. an ISP
+// throttle wave knocking "mobile" availability down for its duration).
+func (s *simulator) availability(region string, tier bandwidthTier) float64 {
+	avail := tier.availability
+	if s.scenario == nil {
+		return avail
+	}
+	elapsed := s.elapsed()
+	for _, w := range s.scenario.Waves {
+		if w.AvailabilityMultiplier != 0 && w.active(elapsed) && w.appliesTo(region, tier.name) {
+			avail *= w.AvailabilityMultiplier
+		}
+	}
+	if avail > 1 {
+		avail = 1
+	}
+	return avail
+}
+
+// exponential samples a Poisson inter-event time for the given rate
+// (events/sec) using inverse-CDF sampling off s.rng, so the whole run is
+// reproducible from its seed.
+func (s *simulator) exponential(ratePerSecond float64) time.Duration {
+	s.mu.Lock()
+	u := s.rng.Float64()
+	s.mu.Unlock()
+	if u <= 0 {
+		u = 1e-9
+	}
+	seconds := -math.Log(u) / ratePerSecond
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// run starts one spawner goroutine per region x bandwidth tier and
+// blocks until ctx is cancelled.
+func (s *simulator) run(ctx context.Context) {
+	s.started = time.Now()
+	var wg sync.WaitGroup
+	for _, region := range regions {
+		for _, tier := range bandwidthTiers {
+			wg.Add(1)
+			go func(region string, tier bandwidthTier) {
+				defer wg.Done()
+				s.spawnLoop(ctx, region, tier)
+			}(region, tier)
+		}
+	}
+	go s.reportLoop(ctx)
+	wg.Wait()
+}
+
+// spawnLoop is one region x tier's Poisson arrival process: it waits an
+// exponentially distributed interarrival time, spawns a peer, then
+// repeats for as long as ctx is live.
+func (s *simulator) spawnLoop(ctx context.Context, region string, tier bandwidthTier) {
+	for {
+		wait := s.exponential(s.arrivalRate(region, tier))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		s.spawnPeer(ctx, region, tier)
+	}
+}
+
+// spawnPeer registers one new simulated peer with the tracker and runs
+// its heartbeat/departure lifecycle until it leaves the swarm or ctx is
+// cancelled.
+func (s *simulator) spawnPeer(ctx context.Context, region string, tier bandwidthTier) {
+	s.mu.Lock()
+	id := fmt.Sprintf("sim-%s-%s-%d", region, tier.name, len(s.peers)+1)
+	peer := &simPeer{
+		id:       id,
+		region:   region,
+		tier:     tier,
+		nat:      pickNAT(s.rng),
+		segments: s.pickSegments(tier),
+	}
+	s.peers[id] = peer
+	s.mu.Unlock()
+	s.metrics.peersArrived.WithLabelValues(region, tier.name).Inc()
+
+	neighbors := s.connectNeighbors(peer)
+	rtt := tier.rttRange[0] + s.randIntn(tier.rttRange[1]-tier.rttRange[0])
+	if err := s.announce(ctx, peer, neighbors, rtt); err != nil {
+		log.Printf("announce %s failed: %v", id, err)
+	}
+
+	departAfter := s.exponential(s.departureRate(region, tier))
+	s.lifecycle(ctx, peer, departAfter)
+}
+
+// lifecycle sends jittered heartbeats - bounded well inside the
+// tracker's reap TTL, so this peer stays visible for exactly as long as
+// it's meant to simulate being online - until departAfter elapses or ctx
+// ends, then drops the peer from the swarm without telling the tracker:
+// real churn looks like a peer that simply stops heartbeating and gets
+// reaped, not one that politely unregisters.
+func (s *simulator) lifecycle(ctx context.Context, peer *simPeer, departAfter time.Duration) {
+	deadline := time.NewTimer(departAfter)
+	defer deadline.Stop()
+	interval := s.heartbeatInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.removePeer(peer)
+			return
+		case <-deadline.C:
+			s.removePeer(peer)
+			s.metrics.peersDeparted.WithLabelValues(peer.region, peer.tier.name).Inc()
+			return
+		case <-ticker.C:
+			neighbors := s.connectNeighbors(peer)
+			if err := s.heartbeat(ctx, peer, neighbors); err != nil {
+				log.Printf("heartbeat %s failed: %v", peer.id, err)
 			}
+			ticker.Reset(s.heartbeatInterval())
 		}
+	}
+}
 
-		// Small delay to avoid overwhelming the tracker
-		if i%100 == 0 {
-			time.Sleep(50 * time.Millisecond)
+// heartbeatInterval jitters around a third of the tracker's TTL, the
+// same "heartbeat well inside the reap window" margin cmd/peer uses.
+func (s *simulator) heartbeatInterval() time.Duration {
+	base := s.ttl / 3
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	jitter := time.Duration(s.randIntn(int(base/2))) - base/4
+	return base + jitter
+}
+
+// connectNeighbors picks a handful of this peer's current regional
+// swarm-mates and simulates a WebRTC connect attempt against each, using
+// natConnectProbability to decide success. Only the peers it "connects"
+// to are reported as neighbors on the next announce/heartbeat.
+func (s *simulator) connectNeighbors(peer *simPeer) []string {
+	const maxCandidates = 5
+	s.mu.Lock()
+	candidates := make([]*simPeer, 0, maxCandidates)
+	for _, other := range s.peers {
+		if other.id == peer.id || other.region != peer.region {
+			continue
+		}
+		candidates = append(candidates, other)
+		if len(candidates) >= maxCandidates {
+			break
 		}
 	}
+	s.mu.Unlock()
 
-	fmt.Println()
-	fmt.Println("🎉 Peer Registration Complete!")
-	fmt.Printf("✅ Successfully registered: %d peers\n", successCount)
-	fmt.Printf("❌ Registration errors: %d\n", errorCount)
-	fmt.Println()
+	neighbors := make([]string, 0, len(candidates))
+	for _, other := range candidates {
+		pair := natPairLabel(peer.nat, other.nat)
+		s.metrics.connectAttempts.WithLabelValues(pair).Inc()
+		if s.randFloat64() < natConnectProbability(peer.nat, other.nat) {
+			s.metrics.connectSuccess.WithLabelValues(pair).Inc()
+			neighbors = append(neighbors, other.id)
+		}
+	}
+	return neighbors
+}
 
-	// Test peer distribution
-	fmt.Println("📊 Testing peer distribution...")
-	for _, segment := range segments {
-		count := queryPeerCount("http://localhost:8090", segment, "us-east")
-		fmt.Printf("🎵 %s : %d peers available\n", segment, count)
+func natPairLabel(a, b natType) string {
+	if a > b {
+		a, b = b, a
 	}
+	return a.String() + "-" + b.String()
+}
 
-	fmt.Println()
-	fmt.Println("🌐 Geographic Distribution Test:")
-	testRegions := []string{"us-east", "us-west", "eu-west", "asia-pacific", "canada"}
-	for _, region := range testRegions {
-		count := queryPeerCount("http://localhost:8090", segments[0], region)
-		fmt.Printf("🌍 %s : %d peers with segment000\n", region, count)
+// pickSegments mirrors the original one-shot simulator's popularity
+// curve: earlier (more popular) segments are more likely to be seeded by
+// a given peer than later ones.
+func (s *simulator) pickSegments(tier bandwidthTier) []string {
+	var picked []string
+	for i, seg := range segments {
+		probability := tier.segmentProb * (1.0 - float64(i)*0.1)
+		if s.randFloat64() < probability {
+			picked = append(picked, seg)
+		}
 	}
+	return picked
+}
 
-	fmt.Println()
-	fmt.Println("🎊 Simulation Complete! Your CDN now has thousands of persistent peers!")
-	fmt.Println("🌐 Visit http://localhost:8000/peers.html to explore the peer network")
-	fmt.Println("🎵 Visit http://localhost:8000/index.html to test Rick Roll streaming")
+func (s *simulator) randFloat64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64()
 }
 
-func registerPeer(trackerURL string, peer PeerData) error {
-	jsonData, err := json.Marshal(peer)
+func (s *simulator) randIntn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Intn(n)
+}
+
+func (s *simulator) removePeer(peer *simPeer) {
+	s.mu.Lock()
+	delete(s.peers, peer.id)
+	s.mu.Unlock()
+}
+
+func (s *simulator) announce(ctx context.Context, peer *simPeer, neighbors []string, rtt int) error {
+	body := PeerData{
+		PeerID:       peer.id,
+		Room:         "rickroll",
+		Segments:     peer.segments,
+		Neighbors:    neighbors,
+		Region:       peer.region,
+		RTT:          rtt,
+		Bandwidth:    peer.tier.name,
+		LastSeen:     time.Now().Unix(),
+		Availability: s.availability(peer.region, peer.tier),
+	}
+	return s.post(ctx, s.trackerURL+"/announce", body)
+}
+
+func (s *simulator) heartbeat(ctx context.Context, peer *simPeer, neighbors []string) error {
+	body := PeerData{
+		PeerID:    peer.id,
+		Segments:  peer.segments,
+		Neighbors: neighbors,
+	}
+	return s.post(ctx, s.trackerURL+"/heartbeat", body)
+}
+
+func (s *simulator) post(ctx context.Context, url string, body PeerData) error {
+	payload, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-
-	resp, err := http.Post(trackerURL, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-
-	if resp.StatusCode != 204 {
+	if resp.StatusCode != http.StatusNoContent {
 		return fmt.Errorf("tracker returned status %d", resp.StatusCode)
 	}
-
 	return nil
 }
 
-func queryPeerCount(trackerURL, segment, region string) int {
-	url := fmt.Sprintf("%s/peers?seg=%s&count=50&region=%s", trackerURL, segment, region)
-	resp, err := http.Get(url)
-	if err != nil {
-		return 0
+// reportLoop periodically recomputes per-region swarm size and mean
+// availability from the live peer set and publishes them as gauges.
+func (s *simulator) reportLoop(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reportOnce()
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	var peers []interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&peers); err != nil {
-		return 0
+func (s *simulator) reportOnce() {
+	s.mu.Lock()
+	counts := make(map[string]int, len(regions))
+	availSum := make(map[string]float64, len(regions))
+	for _, peer := range s.peers {
+		counts[peer.region]++
+		availSum[peer.region] += s.availability(peer.region, peer.tier)
+	}
+	s.mu.Unlock()
+
+	for _, region := range regions {
+		count := counts[region]
+		s.metrics.swarmSize.WithLabelValues(region).Set(float64(count))
+		if count > 0 {
+			s.metrics.regionAvailable.WithLabelValues(region).Set(availSum[region] / float64(count))
+		} else {
+			s.metrics.regionAvailable.WithLabelValues(region).Set(0)
+		}
+	}
+}
+
+func main() {
+	var (
+		trackerURL   = flag.String("tracker", "http://localhost:8090", "Tracker base URL")
+		signalingURL = flag.String("signaling", "ws://localhost:8091/ws", "Signaling server URL")
+		metricsAddr  = flag.String("metrics-addr", ":9101", "Address to serve /metrics on")
+		ttlSeconds   = flag.Int("ttl-seconds", 120, "Tracker reap TTL in seconds; heartbeats are jittered to stay well inside it")
+		scenarioPath = flag.String("scenario", "", "Optional YAML scenario file describing arrival/departure/availability waves")
+		seed         = flag.Int64("seed", 42, "Random seed; the same seed plus the same scenario reproduces the same run")
+		duration     = flag.Duration("duration", 0, "How long to run before exiting; 0 runs until interrupted")
+	)
+	flag.Parse()
+
+	var sc *scenario
+	if *scenarioPath != "" {
+		loaded, err := loadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatalf("loading scenario: %v", err)
+		}
+		sc = loaded
+		if sc.Seed != 0 {
+			*seed = sc.Seed
+		}
+		log.Printf("loaded scenario %s with %d wave(s)", *scenarioPath, len(sc.Waves))
+	}
+
+	sim := newSimulator(*trackerURL, *signalingURL, time.Duration(*ttlSeconds)*time.Second, sc, *seed)
+
+	registry := prometheus.NewRegistry()
+	if err := sim.metrics.Register(registry); err != nil {
+		log.Fatalf("registering metrics: %v", err)
+	}
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		log.Printf("peersim metrics listening on %s", *metricsAddr)
+		if err := http.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("metrics server error: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
 	}
 
-	return len(peers)
+	log.Printf("peersim running (seed=%d, tracker=%s, signaling=%s)", *seed, *trackerURL, *signalingURL)
+	sim.run(ctx)
+	log.Println("peersim stopped")
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// chokeEWMAAlpha smooths each per-neighbor upload throughput sample,
+	// the same role qosEWMAAlpha plays for RTT in qos.go.
+	chokeEWMAAlpha = 0.3
+	// chokeRoundInterval is how often runChokeRound re-picks the
+	// unchoked set, matching btrtrc's 10s choking algorithm cadence.
+	chokeRoundInterval = 10 * time.Second
+	// optimisticUnchokeInterval is how often a peer unchokes one random
+	// additional neighbor regardless of reciprocation, so a newly
+	// connected peer with nothing to reciprocate yet can still bootstrap.
+	optimisticUnchokeInterval = 30 * time.Second
+)
+
+// ChokeStats summarizes one peer's choking behavior for showPeerStatus:
+// how many neighbors are currently unchoked against its UploadSlots
+// budget, how much that set has churned, and how upload requests have
+// been disposed of.
+type ChokeStats struct {
+	Unchoked          int
+	UploadSlots       int
+	Churn             int
+	RequestsServed    int64
+	RequestsQueued    int64
+	RequestsRejected  int64
+}
+
+// RecordUploadTo folds a served upload of size bytes to neighborID into
+// its EWMA throughput estimate - the figure runChokeRound ranks
+// neighbors by by when choosing who this peer reciprocates next round.
+func (p *peerCore) RecordUploadTo(neighborID string, bytes int64) {
+	p.chokeMu.Lock()
+	defer p.chokeMu.Unlock()
+	prev := p.uploadThroughput[neighborID]
+	p.uploadThroughput[neighborID] = chokeEWMAAlpha*float64(bytes) + (1-chokeEWMAAlpha)*prev
+}
+
+// UploadThroughputTo reports the EWMA bytes/round this peer has served
+// neighborID, zero if it's never served it anything.
+func (p *peerCore) UploadThroughputTo(neighborID string) float64 {
+	p.chokeMu.Lock()
+	defer p.chokeMu.Unlock()
+	return p.uploadThroughput[neighborID]
+}
+
+// SetUnchokedPeers replaces the full unchoked set in one step, counting
+// every neighbor whose choked/unchoked state flips as churn.
+func (p *peerCore) SetUnchokedPeers(ids map[string]bool) {
+	p.chokeMu.Lock()
+	defer p.chokeMu.Unlock()
+	for id := range ids {
+		if !p.unchoked[id] {
+			p.chokeChurn++
+		}
+	}
+	for id := range p.unchoked {
+		if !ids[id] {
+			p.chokeChurn++
+		}
+	}
+	p.unchoked = ids
+}
+
+// ReadyForOptimisticUnchoke reports whether optimisticUnchokeInterval has
+// elapsed since this peer's last optimistic pick.
+func (p *peerCore) ReadyForOptimisticUnchoke(now time.Time) bool {
+	p.chokeMu.Lock()
+	defer p.chokeMu.Unlock()
+	return now.Sub(p.lastOptimisticAt) >= optimisticUnchokeInterval
+}
+
+// MarkOptimisticUnchoke records that this peer just spent its optimistic
+// unchoke, resetting the interval runChokeRound checks via
+// ReadyForOptimisticUnchoke.
+func (p *peerCore) MarkOptimisticUnchoke(now time.Time) {
+	p.chokeMu.Lock()
+	defer p.chokeMu.Unlock()
+	p.lastOptimisticAt = now
+}
+
+// RequestUpload simulates neighborID asking this peer for size bytes: a
+// currently-unchoked neighbor is served immediately and its throughput
+// recorded for the next choking round; a choked neighbor is queued if
+// this peer's unchoked set hasn't filled its UploadSlots budget yet
+// (the request may win a slot next round) and rejected outright
+// otherwise. Returns whether the request was served.
+func (p *peerCore) RequestUpload(neighborID string, size int64) bool {
+	p.chokeMu.Lock()
+	served := p.unchoked[neighborID]
+	if served {
+		p.requestsServed++
+	} else if len(p.unchoked) < p.uploadSlots {
+		p.requestsQueued++
+	} else {
+		p.requestsRejected++
+	}
+	p.chokeMu.Unlock()
+
+	if served {
+		p.RecordUploadTo(neighborID, size)
+	}
+	return served
+}
+
+// ChokeStats reports this peer's choking counters for showPeerStatus.
+func (p *peerCore) ChokeStats() ChokeStats {
+	p.chokeMu.Lock()
+	defer p.chokeMu.Unlock()
+	return ChokeStats{
+		Unchoked:         len(p.unchoked),
+		UploadSlots:      p.uploadSlots,
+		Churn:            p.chokeChurn,
+		RequestsServed:   p.requestsServed,
+		RequestsQueued:   p.requestsQueued,
+		RequestsRejected: p.requestsRejected,
+	}
+}
+
+// runChokeRound is btrtrc's choking algorithm ported to this simulator's
+// mesh: every online peer ranks its connected neighbors by how much
+// throughput each has reciprocated to it, unchokes the top UploadSlots
+// of them, and - once every optimisticUnchokeInterval - adds one
+// additional random neighbor so a peer with nothing to reciprocate yet
+// can still bootstrap into the swarm.
+func runChokeRound(peers []Peer, byID map[string]Peer, now time.Time) {
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+		neighbors := peer.ConnectedPeers()
+		if len(neighbors) == 0 {
+			continue
+		}
+
+		type reciprocation struct {
+			id         string
+			throughput float64
+		}
+		ranked := make([]reciprocation, 0, len(neighbors))
+		for _, id := range neighbors {
+			neighbor, ok := byID[id]
+			if !ok || !neighbor.IsOnline() {
+				continue
+			}
+			ranked = append(ranked, reciprocation{id: id, throughput: neighbor.UploadThroughputTo(peer.ID())})
+		}
+		if len(ranked) == 0 {
+			continue
+		}
+		sort.Slice(ranked, func(i, j int) bool { return ranked[i].throughput > ranked[j].throughput })
+
+		slots := peer.UploadSlots()
+		unchoked := make(map[string]bool, slots+1)
+		for i := 0; i < slots && i < len(ranked); i++ {
+			unchoked[ranked[i].id] = true
+		}
+
+		if peer.ReadyForOptimisticUnchoke(now) {
+			pick := ranked[rand.Intn(len(ranked))].id
+			unchoked[pick] = true
+			peer.MarkOptimisticUnchoke(now)
+		}
+
+		peer.SetUnchokedPeers(unchoked)
+	}
+}
+
+// requestSegmentFromMesh looks for a connected peer holding segmentID and
+// asks it for an upload slot via RequestUpload, but only once
+// announcementFetcher has confirmed segmentID - an unconfirmed claim
+// isn't trusted enough to serve yet, however many neighbors announce it.
+// holderFound is false when nobody in the mesh has the segment at all,
+// the signal startPeerBehaviorSimulation uses to fall back to the
+// webseed; served is false when a holder exists but either isn't
+// confirmed yet or has this peer choked this round, in which case the
+// download is left for the next tick rather than granted anyway.
+func requestSegmentFromMesh(peer Peer, byID map[string]Peer, announcementFetcher *AnnouncementFetcher, segmentID string, size int64) (served, holderFound bool) {
+	for _, neighborID := range peer.ConnectedPeers() {
+		neighbor, ok := byID[neighborID]
+		if !ok || !neighbor.IsOnline() || !neighbor.Storage().HasSegment(segmentID) {
+			continue
+		}
+		holderFound = true
+		if !announcementFetcher.IsConfirmed(segmentID) {
+			continue
+		}
+		if neighbor.RequestUpload(peer.ID(), size) {
+			return true, true
+		}
+	}
+	return false, holderFound
+}
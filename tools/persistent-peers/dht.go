@@ -0,0 +1,449 @@
+package main
+
+import (
+	"crypto/sha1"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	dhtBucketSize        = 8               // k
+	dhtAlpha             = 3               // parallelism for iterative lookups
+	dhtIDBits            = 8 * sha1.Size    // 160
+	dhtRepublishInterval = 1 * time.Hour    // how often a peer republishes its segments
+	dhtRefreshInterval   = 30 * time.Second // how often buckets absorb new mesh/PEX contacts
+)
+
+// NodeID is a Kademlia node identifier: SHA1 of a peer ID or segment ID,
+// the shared 160-bit space XOR distance compares both against.
+type NodeID [sha1.Size]byte
+
+func deriveNodeID(key string) NodeID {
+	return sha1.Sum([]byte(key))
+}
+
+// Xor returns the bitwise XOR distance between two IDs - Kademlia's
+// metric: symmetric, respects the triangle inequality, and its bit
+// prefix length is exactly the routing-table bucket index.
+func (a NodeID) Xor(b NodeID) NodeID {
+	var out NodeID
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// Less orders two IDs by big-endian byte value, used to sort candidates
+// by XOR distance to a lookup target.
+func (a NodeID) Less(b NodeID) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// prefixLen returns how many leading bits a and b share, which decides
+// which k-bucket a contact belongs in.
+func prefixLen(a, b NodeID) int {
+	x := a.Xor(b)
+	for i, byteVal := range x {
+		if byteVal == 0 {
+			continue
+		}
+		for bit := 0; bit < 8; bit++ {
+			if byteVal&(0x80>>uint(bit)) != 0 {
+				return i*8 + bit
+			}
+		}
+	}
+	return dhtIDBits
+}
+
+// Contact is one entry in a routing table: enough to identify and
+// re-rank a peer without holding a live reference to it.
+type Contact struct {
+	ID       NodeID
+	PeerID   string
+	LastSeen time.Time
+}
+
+// kBucket holds up to dhtBucketSize contacts sharing a given bit-prefix
+// length with the owning node, most-recently-seen last.
+type kBucket struct {
+	mu       sync.Mutex
+	contacts []Contact
+}
+
+func (b *kBucket) touch(c Contact) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, existing := range b.contacts {
+		if existing.PeerID == c.PeerID {
+			b.contacts = append(b.contacts[:i], b.contacts[i+1:]...)
+			break
+		}
+	}
+	b.contacts = append(b.contacts, c)
+	if len(b.contacts) > dhtBucketSize {
+		// Evict the least-recently-seen contact rather than the
+		// newcomer - Kademlia's bias toward long-lived nodes, which
+		// tend to stay up longer than they've already been up.
+		b.contacts = b.contacts[len(b.contacts)-dhtBucketSize:]
+	}
+}
+
+func (b *kBucket) list() []Contact {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]Contact, len(b.contacts))
+	copy(out, b.contacts)
+	return out
+}
+
+// routingTable is one node's k-bucket table, indexed by shared-prefix
+// length with self.
+type routingTable struct {
+	self    NodeID
+	buckets [dhtIDBits + 1]*kBucket
+}
+
+func newRoutingTable(self NodeID) *routingTable {
+	rt := &routingTable{self: self}
+	for i := range rt.buckets {
+		rt.buckets[i] = &kBucket{}
+	}
+	return rt
+}
+
+func (rt *routingTable) insert(c Contact) {
+	if c.ID == rt.self {
+		return
+	}
+	rt.buckets[prefixLen(rt.self, c.ID)].touch(c)
+}
+
+// closest returns up to count known contacts ordered by XOR distance to
+// target - the FIND_NODE response.
+func (rt *routingTable) closest(target NodeID, count int) []Contact {
+	var all []Contact
+	for _, b := range rt.buckets {
+		all = append(all, b.list()...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].ID.Xor(target).Less(all[j].ID.Xor(target))
+	})
+	if len(all) > count {
+		all = all[:count]
+	}
+	return all
+}
+
+// DHTNode is one peer's view of the Kademlia overlay: its routing table
+// plus the segment-location records it holds as one of the k nodes
+// closest to SHA1(segmentID).
+type DHTNode struct {
+	PeerID string
+	ID     NodeID
+	table  *routingTable
+
+	valuesMu sync.Mutex
+	values   map[string][]string // segmentID -> peer IDs claiming to hold it
+}
+
+func newDHTNode(peerID string) *DHTNode {
+	id := deriveNodeID(peerID)
+	return &DHTNode{
+		PeerID: peerID,
+		ID:     id,
+		table:  newRoutingTable(id),
+		values: make(map[string][]string),
+	}
+}
+
+// FindNode is the FIND_NODE RPC: the alpha contacts this node currently
+// knows about that are closest to target.
+func (n *DHTNode) FindNode(target NodeID) []Contact {
+	return n.table.closest(target, dhtAlpha)
+}
+
+// FindValue is the FIND_VALUE RPC: peers this node has learned hold
+// segmentID via republishing, or - if it knows of none - the alpha
+// contacts closest to SHA1(segmentID) to keep an iterative lookup moving.
+func (n *DHTNode) FindValue(segmentID string) (holders []string, closest []Contact) {
+	n.valuesMu.Lock()
+	holders = append([]string(nil), n.values[segmentID]...)
+	n.valuesMu.Unlock()
+	if len(holders) > 0 {
+		return holders, nil
+	}
+	return nil, n.table.closest(deriveNodeID(segmentID), dhtAlpha)
+}
+
+func (n *DHTNode) storeValue(segmentID, peerID string) {
+	n.valuesMu.Lock()
+	defer n.valuesMu.Unlock()
+	for _, existing := range n.values[segmentID] {
+		if existing == peerID {
+			return
+		}
+	}
+	n.values[segmentID] = append(n.values[segmentID], peerID)
+}
+
+// DHTOverlay is the simulator's whole Kademlia network: every peer's
+// DHTNode, addressable by peer ID so the iterative lookups below can
+// dispatch FIND_NODE/FIND_VALUE without an actual wire protocol.
+type DHTOverlay struct {
+	nodes map[string]*DHTNode
+}
+
+func newDHTOverlay(peers []Peer) *DHTOverlay {
+	overlay := &DHTOverlay{nodes: make(map[string]*DHTNode, len(peers))}
+	for _, peer := range peers {
+		overlay.nodes[peer.ID()] = newDHTNode(peer.ID())
+	}
+	return overlay
+}
+
+// refreshRoutingTables seeds every online peer's k-buckets from its
+// current mesh neighbors and whatever PEX gossip has discovered,
+// standing in for Kademlia's ping-on-inactivity bucket refresh.
+func (o *DHTOverlay) refreshRoutingTables(peers []Peer) {
+	now := time.Now()
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+		node, ok := o.nodes[peer.ID()]
+		if !ok {
+			continue
+		}
+		for _, neighborID := range peer.ConnectedPeers() {
+			node.table.insert(Contact{ID: deriveNodeID(neighborID), PeerID: neighborID, LastSeen: now})
+		}
+		for _, candidate := range peer.Candidates() {
+			node.table.insert(Contact{ID: deriveNodeID(candidate.PeerID), PeerID: candidate.PeerID, LastSeen: now})
+		}
+	}
+}
+
+// closestDistance reports the smallest XOR distance to target among
+// contacts, or the maximum possible distance if contacts is empty.
+func closestDistance(contacts []Contact, target NodeID) NodeID {
+	best := NodeID{}
+	for i := range best {
+		best[i] = 0xFF
+	}
+	for _, c := range contacts {
+		if d := c.ID.Xor(target); d.Less(best) {
+			best = d
+		}
+	}
+	return best
+}
+
+// mergeClosest dedups a and b by peer ID and returns the count closest
+// to target.
+func mergeClosest(a, b []Contact, target NodeID, count int) []Contact {
+	seen := make(map[string]Contact, len(a)+len(b))
+	for _, c := range a {
+		seen[c.PeerID] = c
+	}
+	for _, c := range b {
+		seen[c.PeerID] = c
+	}
+	merged := make([]Contact, 0, len(seen))
+	for _, c := range seen {
+		merged = append(merged, c)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ID.Xor(target).Less(merged[j].ID.Xor(target))
+	})
+	if len(merged) > count {
+		merged = merged[:count]
+	}
+	return merged
+}
+
+// iterativeFindNode performs Kademlia's alpha-parallel iterative lookup:
+// starting from startPeerID's own routing table, it repeatedly queries
+// the alpha closest unqueried contacts and folds their answers back in,
+// stopping once a round fails to turn up anything closer.
+func (o *DHTOverlay) iterativeFindNode(startPeerID string, target NodeID) []Contact {
+	start, ok := o.nodes[startPeerID]
+	if !ok {
+		return nil
+	}
+
+	queried := map[string]bool{startPeerID: true}
+	shortlist := start.FindNode(target)
+
+	for {
+		before := closestDistance(shortlist, target)
+
+		var toQuery []Contact
+		for _, c := range shortlist {
+			if !queried[c.PeerID] {
+				toQuery = append(toQuery, c)
+				if len(toQuery) == dhtAlpha {
+					break
+				}
+			}
+		}
+		if len(toQuery) == 0 {
+			break
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var results []Contact
+		for _, c := range toQuery {
+			queried[c.PeerID] = true
+			wg.Add(1)
+			go func(c Contact) {
+				defer wg.Done()
+				node, ok := o.nodes[c.PeerID]
+				if !ok {
+					return
+				}
+				found := node.FindNode(target)
+				mu.Lock()
+				results = append(results, found...)
+				mu.Unlock()
+			}(c)
+		}
+		wg.Wait()
+
+		shortlist = mergeClosest(shortlist, results, target, dhtBucketSize)
+		if closestDistance(shortlist, target) == before {
+			break
+		}
+	}
+
+	return shortlist
+}
+
+// iterativeFindValue walks the same alpha-parallel shortlist as
+// iterativeFindNode, but short-circuits as soon as any queried node
+// already has holders cached for segmentID.
+func (o *DHTOverlay) iterativeFindValue(startPeerID, segmentID string) []string {
+	start, ok := o.nodes[startPeerID]
+	if !ok {
+		return nil
+	}
+	target := deriveNodeID(segmentID)
+
+	if holders, _ := start.FindValue(segmentID); len(holders) > 0 {
+		return holders
+	}
+	_, shortlist := start.FindValue(segmentID)
+	queried := map[string]bool{startPeerID: true}
+
+	for {
+		before := closestDistance(shortlist, target)
+
+		var toQuery []Contact
+		for _, c := range shortlist {
+			if !queried[c.PeerID] {
+				toQuery = append(toQuery, c)
+				if len(toQuery) == dhtAlpha {
+					break
+				}
+			}
+		}
+		if len(toQuery) == 0 {
+			return nil
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var foundHolders []string
+		var nextContacts []Contact
+		for _, c := range toQuery {
+			queried[c.PeerID] = true
+			wg.Add(1)
+			go func(c Contact) {
+				defer wg.Done()
+				node, ok := o.nodes[c.PeerID]
+				if !ok {
+					return
+				}
+				holders, closest := node.FindValue(segmentID)
+				mu.Lock()
+				defer mu.Unlock()
+				if len(holders) > 0 {
+					foundHolders = append(foundHolders, holders...)
+				} else {
+					nextContacts = append(nextContacts, closest...)
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		if len(foundHolders) > 0 {
+			return foundHolders
+		}
+
+		shortlist = mergeClosest(shortlist, nextContacts, target, dhtBucketSize)
+		if closestDistance(shortlist, target) == before {
+			return nil
+		}
+	}
+}
+
+// republishSegments is Kademlia's periodic store refresh: for every
+// segment a peer currently holds, it looks up the k nodes closest to
+// SHA1(segmentID) and tells each one's DHTNode it holds that segment, so
+// FIND_VALUE stays answerable without re-crawling the mesh.
+func (o *DHTOverlay) republishSegments(peers []Peer) {
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+		for _, segmentID := range peer.Storage().GetSegments() {
+			target := deriveNodeID(segmentID)
+			for _, c := range o.iterativeFindNode(peer.ID(), target) {
+				if node, ok := o.nodes[c.PeerID]; ok {
+					node.storeValue(segmentID, peer.ID())
+				}
+			}
+			// A peer is trivially one of the closest holders of its own
+			// content, so it always answers FIND_VALUE for itself too.
+			if node, ok := o.nodes[peer.ID()]; ok {
+				node.storeValue(segmentID, peer.ID())
+			}
+		}
+	}
+}
+
+// startDHTOverlay builds the Kademlia overlay for peers and drives its
+// background loops: routing-table refresh on the cadence Kademlia uses
+// to ping inactive buckets, and hourly segment republishing - the
+// tracker-less alternative to PeerAnnouncement once peerCount scales
+// past a few thousand.
+func startDHTOverlay(peers []Peer) *DHTOverlay {
+	overlay := newDHTOverlay(peers)
+	overlay.refreshRoutingTables(peers)
+	overlay.republishSegments(peers)
+
+	go func() {
+		ticker := time.NewTicker(dhtRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			overlay.refreshRoutingTables(peers)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(dhtRepublishInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			overlay.republishSegments(peers)
+		}
+	}()
+
+	return overlay
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// blockDelayTimeout bounds how long AnnouncementFetcher waits for a
+	// second, independent corroboration before giving up on a segment
+	// claim - go-ethereum LES's lightFetcher uses the same knob to
+	// decide how long to trust an unconfirmed head announcement.
+	blockDelayTimeout = 10 * time.Second
+	// minConfirmations is how many distinct (Region, /24-equivalent ID
+	// prefix) pairs must claim a segment before LookupSegment treats it
+	// as confirmed rather than an unverified claim.
+	minConfirmations = 2
+
+	// availabilityDecayFactor is multiplied into a peer's Availability
+	// every time its outstanding claims time out without corroboration.
+	availabilityDecayFactor = 0.8
+	// evictionAvailabilityFloor is the Availability below which a
+	// repeatedly-uncorroborated peer is disconnected from the mesh.
+	evictionAvailabilityFloor = 0.1
+)
+
+// segmentClaim is one peer's announcement of holding a segment.
+type segmentClaim struct {
+	peerID string
+	region string
+	prefix string
+}
+
+// segmentClaims tracks every outstanding claim for one segment ID since
+// its first announcement, and whether enough independent claims have
+// arrived to confirm it.
+type segmentClaims struct {
+	firstClaimAt time.Time
+	claims       []segmentClaim
+	confirmed    bool
+}
+
+// AnnouncementFetcher treats PeerAnnouncement.Segments as a claim rather
+// than truth, modeled on go-ethereum LES's lightFetcher
+// (headAnnouncedBy map[Hash][]*peer, blockDelayTimeout): a segment is
+// only confirmed once minConfirmations independent peers corroborate it
+// within blockDelayTimeout of the first claim. Peers whose claims
+// repeatedly go uncorroborated have their Availability decayed and are
+// eventually evicted by PenalizeUnconfirmed.
+type AnnouncementFetcher struct {
+	mu       sync.Mutex
+	segments map[string]*segmentClaims
+}
+
+func newAnnouncementFetcher() *AnnouncementFetcher {
+	return &AnnouncementFetcher{segments: make(map[string]*segmentClaims)}
+}
+
+// idPrefix is this simulator's "/24-equivalent" stand-in: peer IDs are
+// formatted as "peer-<region>-<deviceType>-<bandwidth>-<sequence>" (see
+// main's id generation), so everything before the trailing sequence
+// number plays the same role a /24 subnet would in telling independent
+// announcers apart.
+func idPrefix(peerID string) string {
+	idx := strings.LastIndex(peerID, "-")
+	if idx < 0 {
+		return peerID
+	}
+	return peerID[:idx]
+}
+
+// Announce records peerID's claim to hold each of segments as of now,
+// confirming any segment that reaches minConfirmations distinct
+// (region, idPrefix) pairs within blockDelayTimeout of its first claim.
+// A confirmation window that lapses without enough corroboration is
+// restarted on the next claim rather than let stale claims linger.
+func (f *AnnouncementFetcher) Announce(peerID, region string, segments []string, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := idPrefix(peerID)
+	for _, segmentID := range segments {
+		sc, ok := f.segments[segmentID]
+		if !ok {
+			sc = &segmentClaims{firstClaimAt: now}
+			f.segments[segmentID] = sc
+		}
+		if !sc.confirmed && now.Sub(sc.firstClaimAt) > blockDelayTimeout {
+			sc.firstClaimAt = now
+			sc.claims = nil
+		}
+
+		alreadyClaimed := false
+		for _, c := range sc.claims {
+			if c.peerID == peerID {
+				alreadyClaimed = true
+				break
+			}
+		}
+		if !alreadyClaimed {
+			sc.claims = append(sc.claims, segmentClaim{peerID: peerID, region: region, prefix: prefix})
+		}
+
+		if !sc.confirmed && independentClaimCount(sc.claims) >= minConfirmations {
+			sc.confirmed = true
+		}
+	}
+}
+
+// independentClaimCount counts the distinct (region, idPrefix) pairs
+// among claims - the corroboration signal Announce confirms a segment
+// against.
+func independentClaimCount(claims []segmentClaim) int {
+	seen := make(map[string]bool, len(claims))
+	for _, c := range claims {
+		seen[c.region+"|"+c.prefix] = true
+	}
+	return len(seen)
+}
+
+// IsConfirmed reports whether segmentID has reached minConfirmations
+// independent claims within blockDelayTimeout of its first announcement.
+func (f *AnnouncementFetcher) IsConfirmed(segmentID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sc, ok := f.segments[segmentID]
+	return ok && sc.confirmed
+}
+
+// LookupSegment returns the peer IDs credited toward segmentID's
+// confirmation, or nil if it isn't confirmed yet - the lookup response
+// LookupSegment's real-tracker counterpart would otherwise hand back
+// unverified.
+func (f *AnnouncementFetcher) LookupSegment(segmentID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sc, ok := f.segments[segmentID]
+	if !ok || !sc.confirmed {
+		return nil
+	}
+	holders := make([]string, 0, len(sc.claims))
+	for _, c := range sc.claims {
+		holders = append(holders, c.peerID)
+	}
+	return holders
+}
+
+// Stats reports how many segment IDs the fetcher is currently tracking
+// and how many of those have reached confirmation, the corroboration
+// metric showPeerStatus prints alongside choke/QoS stats.
+func (f *AnnouncementFetcher) Stats() (tracked, confirmed int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sc := range f.segments {
+		tracked++
+		if sc.confirmed {
+			confirmed++
+		}
+	}
+	return tracked, confirmed
+}
+
+// PenalizeUnconfirmed sweeps every segment whose confirmation window has
+// lapsed without reaching minConfirmations, decaying Availability for
+// every peer that claimed it and evicting any peer whose Availability
+// has decayed below evictionAvailabilityFloor - the consequence for
+// peers that keep announcing segments nobody else corroborates.
+func (f *AnnouncementFetcher) PenalizeUnconfirmed(byID map[string]Peer, now time.Time) {
+	f.mu.Lock()
+	dishonest := make(map[string]bool)
+	for segmentID, sc := range f.segments {
+		if sc.confirmed || now.Sub(sc.firstClaimAt) <= blockDelayTimeout {
+			continue
+		}
+		for _, c := range sc.claims {
+			dishonest[c.peerID] = true
+		}
+		delete(f.segments, segmentID)
+	}
+	f.mu.Unlock()
+
+	for peerID := range dishonest {
+		peer, ok := byID[peerID]
+		if !ok {
+			continue
+		}
+		peer.DecayAvailability(availabilityDecayFactor)
+		if peer.Availability() <= evictionAvailabilityFloor {
+			evictPeer(peer, byID)
+		}
+	}
+}
+
+// evictPeer disconnects peer from every neighbor and marks it offline -
+// the consequence of decaying Availability below
+// evictionAvailabilityFloor, keeping the same connection symmetry
+// DropPeer already maintains for a single dropped connection.
+func evictPeer(peer Peer, byID map[string]Peer) {
+	for _, neighborID := range peer.ConnectedPeers() {
+		if neighbor, ok := byID[neighborID]; ok {
+			neighbor.DropPeer(peer.ID())
+		}
+	}
+	peer.SetConnectedPeers(nil)
+	peer.SetOnline(false)
+}
@@ -4,35 +4,226 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
-// PeerContainer represents a user's phone/device with persistent storage
-type PeerContainer struct {
-	ID             string                 `json:"peerId"`
-	Region         string                 `json:"region"`
-	DeviceType     string                 `json:"deviceType"`
-	Bandwidth      string                 `json:"bandwidth"`
-	RTT            int                    `json:"rtt"`
-	Availability   float64                `json:"availability"`
-	Storage        *SlidingWindowStorage  `json:"-"`
-	LastSeen       int64                  `json:"lastSeen"`
-	IsOnline       bool                   `json:"isOnline"`
-	TotalUploads   int64                  `json:"totalUploads"`
-	TotalDownloads int64                  `json:"totalDownloads"`
-	
-	// P2P Network Properties
-	IsSeedPeer     bool     `json:"isSeedPeer"`     // Connects to edge server
-	ConnectedPeers []string `json:"connectedPeers"` // Other peers this peer is connected to
-	MaxConnections int      `json:"maxConnections"` // Max peer connections based on bandwidth
-	UploadSlots    int      `json:"uploadSlots"`    // Available upload slots
+// bandwidthTiers is the fixed set of connection profiles peers are drawn
+// from: how much it can store locally and the RTT/availability range
+// that shapes its mesh behavior. Shared between the random peer
+// generator in main and reconstructPeer's restore path in store.go, so a
+// rehydrated peer gets the same storage capacity a freshly generated one
+// with its bandwidth tier would.
+var bandwidthTiers = []struct {
+	tier            string
+	rttRange        [2]int
+	availability    float64
+	storageCapacity int
+}{
+	{"fiber", [2]int{5, 25}, 0.95, 15},  // Can store 15 segments
+	{"cable", [2]int{20, 50}, 0.88, 12}, // Can store 12 segments
+	{"4g", [2]int{30, 80}, 0.82, 8},     // Can store 8 segments
+	{"3g", [2]int{80, 200}, 0.70, 5},    // Can store 5 segments
+	{"wifi", [2]int{15, 40}, 0.90, 10},  // Can store 10 segments
 }
 
+// storageCapacityFor looks up bandwidth's configured storage capacity,
+// falling back to the 4g tier's if bandwidth doesn't match a known tier.
+func storageCapacityFor(bandwidth string) int {
+	for _, t := range bandwidthTiers {
+		if t.tier == bandwidth {
+			return t.storageCapacity
+		}
+	}
+	return 8
+}
+
+// Peer is the common interface shared by SeedPeer and ClientPeer: the
+// identity, network, and mesh-membership fields every participant has
+// regardless of role. createP2PMesh and the tracker announce path work
+// against this interface rather than branching on a role flag.
+type Peer interface {
+	ID() string
+	Region() string
+	DeviceType() string
+	Bandwidth() string
+	RTT() int
+	Availability() float64
+	Storage() *SlidingWindowStorage
+	IsOnline() bool
+	SetOnline(online bool)
+	LastSeen() int64
+	Touch()
+	RecordDownload()
+	ConnectedPeers() []string
+	AddConnectedPeer(id string)
+	SetConnectedPeers(ids []string)
+	MaxConnections() int
+	IsSeed() bool
+
+	// PEX gossip (btrtrc-style added/dropped exchange, see startPexGossip)
+	BuildGossip(neighborID string, now time.Time) (PexMessage, bool)
+	MergeGossip(msg PexMessage)
+	Candidates() []PexCandidate
+
+	// QoS tuning (go-ethereum downloader's rttEstimate/rttConfidence
+	// pattern, see runQoSTuner)
+	RecordSegmentDelivery(neighborID string, rttMs int)
+	RecordTimeout(neighborID string)
+	NeighborQoS(neighborID string) (rttEstimate float64, confidence float64)
+	DropPeer(id string)
+	QoSStats() QoSStats
+
+	// Persistence (SqlitePeerStore, see store.go)
+	TotalUploads() int64
+	TotalDownloads() int64
+	UploadSlots() int
+
+	// Topology placement (Constraint-based label rules, see topology.go)
+	Labels() map[string]string
+	SetLabels(labels map[string]string)
+
+	// Choking/unchoking (BitTorrent tit-for-tat, see choke.go)
+	RecordUploadTo(neighborID string, bytes int64)
+	UploadThroughputTo(neighborID string) float64
+	SetUnchokedPeers(ids map[string]bool)
+	ReadyForOptimisticUnchoke(now time.Time) bool
+	MarkOptimisticUnchoke(now time.Time)
+	RequestUpload(neighborID string, size int64) bool
+	ChokeStats() ChokeStats
+
+	// Announcement confirmation (go-ethereum LES lightFetcher-style
+	// corroboration, see fetcher.go)
+	DecayAvailability(factor float64)
+}
+
+// peerCore holds the fields and behavior common to both mesh roles.
+// SeedPeer and ClientPeer embed it and add their own capability-specific
+// fields on top.
+type peerCore struct {
+	id             string
+	region         string
+	deviceType     string
+	bandwidth      string
+	rtt            int
+	availability   float64
+	storage        *SlidingWindowStorage
+	lastSeen       int64
+	online         bool
+	totalUploads   int64
+	totalDownloads int64
+	connectedPeers []string
+	maxConnections int
+	uploadSlots    int
+
+	pexMu          sync.Mutex
+	candidates     map[string]PexCandidate
+	lastGossipAt   map[string]time.Time
+	sentToNeighbor map[string]map[string]bool
+
+	qosMu          sync.Mutex
+	rttEstimate    map[string]float64
+	rttConfidence  map[string]float64
+	droppedCount   int
+	failedRequests int
+
+	labels map[string]string
+
+	chokeMu           sync.Mutex
+	uploadThroughput  map[string]float64
+	unchoked          map[string]bool
+	lastOptimisticAt  time.Time
+	chokeChurn        int
+	requestsServed    int64
+	requestsQueued    int64
+	requestsRejected  int64
+}
+
+func (p *peerCore) ID() string                     { return p.id }
+func (p *peerCore) Region() string                 { return p.region }
+func (p *peerCore) DeviceType() string              { return p.deviceType }
+func (p *peerCore) Bandwidth() string               { return p.bandwidth }
+func (p *peerCore) RTT() int                        { return p.rtt }
+func (p *peerCore) Availability() float64           { return p.availability }
+func (p *peerCore) Storage() *SlidingWindowStorage  { return p.storage }
+func (p *peerCore) IsOnline() bool                  { return p.online }
+func (p *peerCore) SetOnline(online bool)           { p.online = online }
+func (p *peerCore) LastSeen() int64                 { return p.lastSeen }
+func (p *peerCore) Touch()                          { p.lastSeen = time.Now().Unix() }
+func (p *peerCore) RecordDownload()                 { p.totalDownloads++ }
+func (p *peerCore) ConnectedPeers() []string         { return p.connectedPeers }
+func (p *peerCore) AddConnectedPeer(id string)       { p.connectedPeers = append(p.connectedPeers, id) }
+func (p *peerCore) SetConnectedPeers(ids []string)   { p.connectedPeers = ids }
+func (p *peerCore) MaxConnections() int             { return p.maxConnections }
+func (p *peerCore) TotalUploads() int64             { return p.totalUploads }
+func (p *peerCore) TotalDownloads() int64           { return p.totalDownloads }
+func (p *peerCore) UploadSlots() int                { return p.uploadSlots }
+func (p *peerCore) Labels() map[string]string       { return p.labels }
+func (p *peerCore) SetLabels(labels map[string]string) { p.labels = labels }
+func (p *peerCore) DecayAvailability(factor float64) { p.availability *= factor }
+
+func newPeerCore(id, region, deviceType, bandwidth string, rtt int, availability float64, storageCapacity, maxConnections, uploadSlots int) peerCore {
+	return peerCore{
+		id:             id,
+		region:         region,
+		deviceType:     deviceType,
+		bandwidth:      bandwidth,
+		rtt:            rtt,
+		availability:   availability,
+		storage:        NewSlidingWindowStorage(storageCapacity),
+		lastSeen:       time.Now().Unix(),
+		online:         true,
+		connectedPeers: make([]string, 0),
+		maxConnections: maxConnections,
+		uploadSlots:    uploadSlots,
+		candidates:     make(map[string]PexCandidate),
+		lastGossipAt:   make(map[string]time.Time),
+		sentToNeighbor: make(map[string]map[string]bool),
+		rttEstimate:    make(map[string]float64),
+		rttConfidence:  make(map[string]float64),
+		labels:         make(map[string]string),
+		uploadThroughput: make(map[string]float64),
+		unchoked:         make(map[string]bool),
+	}
+}
+
+// SeedPeer uplinks to an edge server and anchors the backbone mesh. It
+// announces the edge it's affiliated with and the cache eviction policy
+// it runs locally, neither of which a mesh-only ClientPeer has.
+type SeedPeer struct {
+	peerCore
+	EdgeAffinity string
+	CachePolicy  string
+}
+
+func newSeedPeer(core peerCore, edgeAffinity, cachePolicy string) *SeedPeer {
+	return &SeedPeer{peerCore: core, EdgeAffinity: edgeAffinity, CachePolicy: cachePolicy}
+}
+
+func (p *SeedPeer) IsSeed() bool { return true }
+
+// ClientPeer is mesh-only: it never uplinks to an edge, its upload slots
+// are download-biased, and it announces the seed peer it prefers to pull
+// from once createP2PMesh assigns one.
+type ClientPeer struct {
+	peerCore
+	UpstreamSeed string
+}
+
+func newClientPeer(core peerCore, upstreamSeed string) *ClientPeer {
+	return &ClientPeer{peerCore: core, UpstreamSeed: upstreamSeed}
+}
+
+func (p *ClientPeer) IsSeed() bool { return false }
+
 // SlidingWindowStorage simulates phone storage with limited capacity
 type SlidingWindowStorage struct {
 	segments    map[string]*SegmentInfo
@@ -49,6 +240,9 @@ type SegmentInfo struct {
 	LastAccess   time.Time `json:"lastAccess"`
 }
 
+// PeerAnnouncement is what gets posted to the tracker. EdgeAffinity and
+// CachePolicy are only populated for seed peers; UpstreamSeed is only
+// populated for client peers once the mesh assigns one.
 type PeerAnnouncement struct {
 	PeerID         string   `json:"peerId"`
 	Addr           string   `json:"addr"`
@@ -63,6 +257,144 @@ type PeerAnnouncement struct {
 	ConnectedPeers []string `json:"connectedPeers"`
 	MaxConnections int      `json:"maxConnections"`
 	UploadSlots    int      `json:"uploadSlots"`
+	EdgeAffinity   string   `json:"edgeAffinity,omitempty"`
+	CachePolicy    string   `json:"cachePolicy,omitempty"`
+	UpstreamSeed   string   `json:"upstreamSeed,omitempty"`
+}
+
+const (
+	// pexGossipInterval rate-limits gossip to at most one message per
+	// neighbor, matching btrtrc's PEX cadence.
+	pexGossipInterval = 60 * time.Second
+	// pexMaxPeersPerMsg caps how many newly-connected peers ride in a
+	// single Added list, the same bound btrtrc's PEX extension applies.
+	pexMaxPeersPerMsg = 50
+)
+
+// PexBloom is a tiny one-word Bloom filter summarizing a peer's cached
+// segment set for gossip, so a PexCandidate can hint at what it stores
+// without shipping its full segment list over the wire.
+type PexBloom struct {
+	Bits uint64 `json:"bits"`
+}
+
+func newPexBloom(segments []string) PexBloom {
+	var bits uint64
+	for _, seg := range segments {
+		h := fnv.New64a()
+		h.Write([]byte(seg))
+		bits |= 1 << (h.Sum64() % 64)
+	}
+	return PexBloom{Bits: bits}
+}
+
+// MayContain reports whether segment might be in the peer's cache - a
+// false positive is possible, a false negative never is.
+func (b PexBloom) MayContain(segment string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(segment))
+	return b.Bits&(1<<(h.Sum64()%64)) != 0
+}
+
+// PexCandidate is what a peer learns about a neighbor-of-a-neighbor
+// through gossip: enough to decide whether it's worth connecting to
+// without re-querying the tracker.
+type PexCandidate struct {
+	PeerID    string    `json:"peerId"`
+	Region    string    `json:"region"`
+	RTT       int       `json:"rtt"`
+	Bandwidth string    `json:"bandwidth"`
+	Segments  PexBloom  `json:"segments"`
+	SeenAt    time.Time `json:"seenAt"`
+}
+
+// PexMessage is the compact added/dropped announcement one peer gossips
+// to a connected neighbor, mirroring btrtrc's Peer/PeerConn PEX design.
+type PexMessage struct {
+	FromPeerID string         `json:"fromPeerId"`
+	Added      []PexCandidate `json:"added"`
+	Dropped    []string       `json:"dropped"`
+}
+
+// BuildGossip builds the added/dropped delta neighborID hasn't already
+// been sent, rate-limited to one message per neighbor per
+// pexGossipInterval. ok is false when the rate limit blocks this call.
+func (p *peerCore) BuildGossip(neighborID string, now time.Time) (PexMessage, bool) {
+	p.pexMu.Lock()
+	defer p.pexMu.Unlock()
+
+	if last, ok := p.lastGossipAt[neighborID]; ok && now.Sub(last) < pexGossipInterval {
+		return PexMessage{}, false
+	}
+	p.lastGossipAt[neighborID] = now
+
+	sent := p.sentToNeighbor[neighborID]
+	if sent == nil {
+		sent = make(map[string]bool)
+		p.sentToNeighbor[neighborID] = sent
+	}
+
+	current := make(map[string]bool, len(p.connectedPeers))
+	var added []PexCandidate
+	for _, id := range p.connectedPeers {
+		current[id] = true
+		if !sent[id] {
+			added = append(added, PexCandidate{
+				PeerID:    id,
+				Region:    p.region,
+				RTT:       p.rtt,
+				Bandwidth: p.bandwidth,
+				Segments:  newPexBloom(p.storage.GetSegments()),
+				SeenAt:    now,
+			})
+		}
+	}
+	var dropped []string
+	for id := range sent {
+		if !current[id] {
+			dropped = append(dropped, id)
+		}
+	}
+
+	if len(added) > pexMaxPeersPerMsg {
+		added = added[:pexMaxPeersPerMsg]
+	}
+	for _, c := range added {
+		sent[c.PeerID] = true
+	}
+	for _, id := range dropped {
+		delete(sent, id)
+	}
+
+	return PexMessage{FromPeerID: p.id, Added: added, Dropped: dropped}, true
+}
+
+// MergeGossip folds a neighbor's announcement into this peer's local
+// candidate table.
+func (p *peerCore) MergeGossip(msg PexMessage) {
+	p.pexMu.Lock()
+	defer p.pexMu.Unlock()
+	for _, c := range msg.Added {
+		if c.PeerID == p.id {
+			continue
+		}
+		p.candidates[c.PeerID] = c
+	}
+	for _, id := range msg.Dropped {
+		delete(p.candidates, id)
+	}
+}
+
+// Candidates returns every peer this peer has learned about through
+// gossip, for replaceDeadConnections to draw replacements from.
+func (p *peerCore) Candidates() []PexCandidate {
+	p.pexMu.Lock()
+	defer p.pexMu.Unlock()
+	out := make([]PexCandidate, 0, len(p.candidates))
+	for _, c := range p.candidates {
+		out = append(out, c)
+	}
+	return out
 }
 
 func NewSlidingWindowStorage(capacity int) *SlidingWindowStorage {
@@ -76,9 +408,9 @@ func NewSlidingWindowStorage(capacity int) *SlidingWindowStorage {
 func (s *SlidingWindowStorage) AddSegment(segmentID string, size int64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	
+
 	now := time.Now()
-	
+
 	// If segment already exists, update access
 	if existing, exists := s.segments[segmentID]; exists {
 		existing.AccessCount++
@@ -86,12 +418,12 @@ func (s *SlidingWindowStorage) AddSegment(segmentID string, size int64) {
 		s.updateAccessOrder(segmentID)
 		return
 	}
-	
+
 	// If at capacity, remove least recently used
 	if len(s.segments) >= s.capacity {
 		s.evictLRU()
 	}
-	
+
 	// Add new segment
 	s.segments[segmentID] = &SegmentInfo{
 		SegmentID:    segmentID,
@@ -100,14 +432,14 @@ func (s *SlidingWindowStorage) AddSegment(segmentID string, size int64) {
 		AccessCount:  1,
 		LastAccess:   now,
 	}
-	
+
 	s.accessOrder = append(s.accessOrder, segmentID)
 }
 
 func (s *SlidingWindowStorage) HasSegment(segmentID string) bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	
+
 	if info, exists := s.segments[segmentID]; exists {
 		// Update access (in a real system, this would be done on actual access)
 		info.AccessCount++
@@ -120,7 +452,7 @@ func (s *SlidingWindowStorage) HasSegment(segmentID string) bool {
 func (s *SlidingWindowStorage) GetSegments() []string {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	
+
 	segments := make([]string, 0, len(s.segments))
 	for segmentID := range s.segments {
 		segments = append(segments, segmentID)
@@ -132,7 +464,7 @@ func (s *SlidingWindowStorage) evictLRU() {
 	if len(s.accessOrder) == 0 {
 		return
 	}
-	
+
 	// Remove least recently used
 	lruSegment := s.accessOrder[0]
 	delete(s.segments, lruSegment)
@@ -152,14 +484,14 @@ func (s *SlidingWindowStorage) updateAccessOrder(segmentID string) {
 
 func main() {
 	fmt.Println("🚀 Starting Persistent Peer Container System...")
-	
+
 	peerCount := 2000
 	if len(os.Args) > 1 {
 		if count, err := strconv.Atoi(os.Args[1]); err == nil {
 			peerCount = count
 		}
 	}
-	
+
 	fmt.Printf("📱 Target peer count: %d\n", peerCount)
 
 	trackerURL := "http://localhost:8090/announce"
@@ -181,23 +513,31 @@ func main() {
 	}
 
 	deviceTypes := []string{"smartphone", "tablet", "laptop", "desktop"}
-	
-	bandwidthTiers := []struct {
-		tier         string
-		rttRange     [2]int
-		availability float64
-		storageCapacity int
-	}{
-		{"fiber", [2]int{5, 25}, 0.95, 15},      // Can store 15 segments
-		{"cable", [2]int{20, 50}, 0.88, 12},    // Can store 12 segments
-		{"4g", [2]int{30, 80}, 0.82, 8},        // Can store 8 segments
-		{"3g", [2]int{80, 200}, 0.70, 5},       // Can store 5 segments
-		{"wifi", [2]int{15, 40}, 0.90, 10},     // Can store 10 segments
+
+	edgeServers := []string{"edge-1", "edge-2", "edge-3"}
+
+	// Label pools for the Constraint-based topology rules in topology.go:
+	// isp/nat_type/ipv6/datacenter/zone stand in for the real network
+	// diversity a researcher's config would want to place peers against.
+	isps := []string{"comcast", "at&t", "verizon", "deutsche-telekom", "ntt", "telstra", "vodafone"}
+	natTypes := []string{"full-cone", "restricted-cone", "symmetric", "none"}
+	datacenters := []string{"dc-a", "dc-b", "dc-c"}
+	zoneSuffixes := []string{"a", "b", "c"}
+
+	peerStorePath := "peers.db"
+	if len(os.Args) > 2 {
+		peerStorePath = os.Args[2]
+	}
+	peerStore, err := NewSqlitePeerStore(peerStorePath)
+	if err != nil {
+		fmt.Printf("❌ Cannot open peer store %s: %v\n", peerStorePath, err)
+		return
 	}
+	defer peerStore.Close()
 
 	fmt.Printf("🚀 Creating %d persistent peer containers (simulating user phones)...\n", peerCount)
 	fmt.Println("📱 Each peer has sliding window storage and stays online permanently")
-	
+
 	// Check if tracker is accessible
 	fmt.Println("🔍 Testing tracker connectivity...")
 	if resp, err := http.Get("http://localhost:8090/health"); err != nil {
@@ -209,17 +549,33 @@ func main() {
 		fmt.Println("✅ Tracker is accessible")
 	}
 
-	var peers []*PeerContainer
+	var peers []Peer
 	var wg sync.WaitGroup
 	successCount := 0
 	errorCount := 0
-	
+
+	existingRecords, err := peerStore.Load()
+	if err != nil {
+		fmt.Printf("❌ Loading peer store failed: %v\n", err)
+		return
+	}
+	for _, rec := range existingRecords {
+		if len(peers) >= peerCount {
+			break
+		}
+		peers = append(peers, reconstructPeer(rec))
+	}
+	if len(peers) > 0 {
+		fmt.Printf("💾 Restored %d peer containers from %s\n", len(peers), peerStorePath)
+	}
+
 	// Create peer containers with P2P topology
-	seedPeerCount := max(1, peerCount/15) // ~7% are seed peers
+	toCreate := peerCount - len(peers)
+	seedPeerCount := max(1, toCreate/15) // ~7% of the new peers are seed peers
 	fmt.Printf("🌱 Creating %d seed peers (connect to edge server)\n", seedPeerCount)
-	fmt.Printf("👥 Creating %d regular peers (connect to other peers)\n", peerCount-seedPeerCount)
-	
-	for i := 1; i <= peerCount; i++ {
+	fmt.Printf("👥 Creating %d client peers (connect to other peers)\n", toCreate-seedPeerCount)
+
+	for i := 1; i <= toCreate; i++ {
 		region := regions[rand.Intn(len(regions))]
 		deviceType := deviceTypes[rand.Intn(len(deviceTypes))]
 		bandwidth := bandwidthTiers[rand.Intn(len(bandwidthTiers))]
@@ -228,29 +584,31 @@ func main() {
 		// Determine max connections based on bandwidth and device type
 		maxConnections := getMaxConnections(bandwidth.tier, deviceType)
 		uploadSlots := getUploadSlots(bandwidth.tier, deviceType)
-		
-		peer := &PeerContainer{
-			ID:             fmt.Sprintf("peer-%s-%s-%s-%d", region, deviceType, bandwidth.tier, i),
-			Region:         region,
-			DeviceType:     deviceType,
-			Bandwidth:      bandwidth.tier,
-			RTT:            rtt,
-			Availability:   bandwidth.availability,
-			Storage:        NewSlidingWindowStorage(bandwidth.storageCapacity),
-			LastSeen:       time.Now().Unix(),
-			IsOnline:       true,
-			IsSeedPeer:     i <= seedPeerCount, // First peers are seed peers
-			ConnectedPeers: make([]string, 0),
-			MaxConnections: maxConnections,
-			UploadSlots:    uploadSlots,
+
+		id := fmt.Sprintf("peer-%s-%s-%s-%d", region, deviceType, bandwidth.tier, i)
+		core := newPeerCore(id, region, deviceType, bandwidth.tier, rtt, bandwidth.availability, bandwidth.storageCapacity, maxConnections, uploadSlots)
+
+		var peer Peer
+		if i <= seedPeerCount { // First peers are seed peers
+			peer = newSeedPeer(core, edgeServers[rand.Intn(len(edgeServers))], "lru")
+		} else {
+			peer = newClientPeer(core, "")
 		}
 
+		peer.SetLabels(map[string]string{
+			"isp":        isps[rand.Intn(len(isps))],
+			"nat_type":   natTypes[rand.Intn(len(natTypes))],
+			"ipv6":       strconv.FormatBool(rand.Float64() < 0.4),
+			"datacenter": datacenters[rand.Intn(len(datacenters))],
+			"zone":       fmt.Sprintf("%s-%s", region, zoneSuffixes[rand.Intn(len(zoneSuffixes))]),
+		})
+
 		// Simulate realistic segment distribution
 		// Popular segments are more likely to be cached
 		for segIdx, segment := range segments {
 			// Probability decreases for later segments (less popular)
 			probability := 0.8 - float64(segIdx)*0.15
-			
+
 			// Adjust based on device type and bandwidth
 			switch deviceType {
 			case "smartphone":
@@ -262,10 +620,10 @@ func main() {
 			case "desktop":
 				probability *= 1.0
 			}
-			
+
 			if rand.Float64() < probability {
 				segmentSize := int64(rand.Intn(50000) + 30000) // 30-80KB segments
-				peer.Storage.AddSegment(segment, segmentSize)
+				peer.Storage().AddSegment(segment, segmentSize)
 			}
 		}
 
@@ -276,14 +634,35 @@ func main() {
 	fmt.Println("🕸️  Creating P2P mesh topology...")
 	createP2PMesh(peers)
 
+	byID := make(map[string]Peer, len(peers))
+	for _, peer := range peers {
+		byID[peer.ID()] = peer
+	}
+	fmt.Println("💬 Starting PEX gossip so the mesh can self-heal without the tracker...")
+	startPexGossip(peers, byID)
+
+	fmt.Println("🧭 Starting Kademlia DHT overlay for tracker-less peer/segment lookup...")
+	startDHTOverlay(peers)
+
+	webSeed := newWebSeedPeer([]string{
+		"https://edge-1.cdn.internal",
+		"https://edge-2.cdn.internal",
+		"https://edge-3.cdn.internal",
+	})
+
+	fmt.Println("🔎 Starting announcement fetcher to corroborate segment claims before trusting them...")
+	announcementFetcher := newAnnouncementFetcher()
+
 	fmt.Printf("📡 Registering %d peer containers with tracker...\n", len(peers))
 
 	// Register all peers concurrently
 	for _, peer := range peers {
 		wg.Add(1)
-		go func(p *PeerContainer) {
+		go func(p Peer) {
 			defer wg.Done()
-			
+
+			announcementFetcher.Announce(p.ID(), p.Region(), p.Storage().GetSegments(), time.Now())
+
 			if err := registerPeerContainer(trackerURL, signalingURL, p); err == nil {
 				successCount++
 				if successCount%100 == 0 {
@@ -293,7 +672,7 @@ func main() {
 				errorCount++
 			}
 		}(peer)
-		
+
 		// Small delay to avoid overwhelming tracker
 		time.Sleep(10 * time.Millisecond)
 	}
@@ -308,39 +687,57 @@ func main() {
 
 	// Start persistent peer behavior simulation
 	fmt.Println("🔄 Starting persistent peer behavior simulation...")
-	startPeerBehaviorSimulation(peers, trackerURL, signalingURL)
+	topologyConstraints := loadTopologyConfig(topologyConfigPath)
+	startPeerBehaviorSimulation(peers, byID, webSeed, announcementFetcher, topologyConstraints, trackerURL, signalingURL)
+
+	fmt.Println("💾 Starting peer store maintenance (periodic flush + 7-day stale eviction)...")
+	startPeerStoreMaintenance(peerStore, peers)
 
 	// Keep the program running
 	fmt.Println("📱 Peer containers are now running permanently...")
 	fmt.Println("Press Ctrl+C to stop")
-	
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
 	// Periodic status updates
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-ticker.C:
-			showPeerStatus(peers)
+			showPeerStatus(peers, webSeed, announcementFetcher)
+		case <-sigCh:
+			fmt.Println("\n🛑 Shutting down, flushing peer store...")
+			flushPeersToStore(peerStore, peers)
+			return
 		}
 	}
 }
 
-func registerPeerContainer(trackerURL, signalingURL string, peer *PeerContainer) error {
+func registerPeerContainer(trackerURL, signalingURL string, peer Peer) error {
 	announcement := PeerAnnouncement{
-		PeerID:         peer.ID,
+		PeerID:         peer.ID(),
 		Addr:           signalingURL,
-		Segments:       peer.Storage.GetSegments(),
-		Region:         peer.Region,
-		RTT:            peer.RTT,
-		Bandwidth:      peer.Bandwidth,
-		LastSeen:       peer.LastSeen,
-		Availability:   peer.Availability,
-		DeviceType:     peer.DeviceType,
-		IsSeedPeer:     peer.IsSeedPeer,
-		ConnectedPeers: peer.ConnectedPeers,
-		MaxConnections: peer.MaxConnections,
-		UploadSlots:    peer.UploadSlots,
+		Segments:       peer.Storage().GetSegments(),
+		Region:         peer.Region(),
+		RTT:            peer.RTT(),
+		Bandwidth:      peer.Bandwidth(),
+		LastSeen:       peer.LastSeen(),
+		Availability:   peer.Availability(),
+		DeviceType:     peer.DeviceType(),
+		IsSeedPeer:     peer.IsSeed(),
+		ConnectedPeers: peer.ConnectedPeers(),
+		MaxConnections: peer.MaxConnections(),
+	}
+
+	switch p := peer.(type) {
+	case *SeedPeer:
+		announcement.EdgeAffinity = p.EdgeAffinity
+		announcement.CachePolicy = p.CachePolicy
+	case *ClientPeer:
+		announcement.UpstreamSeed = p.UpstreamSeed
 	}
 
 	jsonData, err := json.Marshal(announcement)
@@ -361,12 +758,12 @@ func registerPeerContainer(trackerURL, signalingURL string, peer *PeerContainer)
 	return nil
 }
 
-func startPeerBehaviorSimulation(peers []*PeerContainer, trackerURL, signalingURL string) {
+func startPeerBehaviorSimulation(peers []Peer, byID map[string]Peer, webSeed *WebSeedPeer, announcementFetcher *AnnouncementFetcher, constraints []Constraint, trackerURL, signalingURL string) {
 	// Simulate peer behavior: downloading new segments, going online/offline, etc.
 	go func() {
 		ticker := time.NewTicker(10 * time.Second)
 		defer ticker.Stop()
-		
+
 		segments := []string{
 			"rickroll/128k/segment000.ts",
 			"rickroll/128k/segment001.ts",
@@ -374,59 +771,96 @@ func startPeerBehaviorSimulation(peers []*PeerContainer, trackerURL, signalingUR
 			"rickroll/128k/segment003.ts",
 			"rickroll/128k/segment004.ts",
 		}
-		
+
 		for {
 			select {
 			case <-ticker.C:
+				// QoS tuner: re-score every peer's connections before the
+				// download pass below so a peer dropped this round gets a
+				// chance to backfill from its PEX candidates immediately.
+				runQoSTuner(peers, byID)
+
+				// Re-balance against the topology config: churn can take
+				// a neighbor offline and leave a Constraint (e.g. "at
+				// least one different-ISP peer") unsatisfied, so swap in
+				// a PEX candidate that would satisfy it.
+				rebalanceTopology(peers, byID, constraints)
+
+				// Choking/unchoking: re-pick each peer's reciprocating
+				// top-N neighbors (plus an occasional optimistic pick)
+				// before the download pass below asks them for slots.
+				runChokeRound(peers, byID, time.Now())
+
+				// Penalize peers whose segment claims timed out without
+				// independent corroboration, evicting the worst offenders.
+				announcementFetcher.PenalizeUnconfirmed(byID, time.Now())
+
 				// Simulate some peers downloading new segments
 				for _, peer := range peers {
-					if !peer.IsOnline {
+					if !peer.IsOnline() {
 						continue
 					}
-					
+
 					// 10% chance to download a new segment
 					if rand.Float64() < 0.1 {
 						segment := segments[rand.Intn(len(segments))]
-						if !peer.Storage.HasSegment(segment) {
+						if !peer.Storage().HasSegment(segment) {
 							segmentSize := int64(rand.Intn(50000) + 30000)
-							peer.Storage.AddSegment(segment, segmentSize)
-							peer.TotalDownloads++
-							
-							// Re-announce to tracker with updated segments
-							go registerPeerContainer(trackerURL, signalingURL, peer)
+							served, holderFound := requestSegmentFromMesh(peer, byID, announcementFetcher, segment, segmentSize)
+							switch {
+							case served:
+								peer.Storage().AddSegment(segment, segmentSize)
+								peer.RecordDownload()
+								announcementFetcher.Announce(peer.ID(), peer.Region(), []string{segment}, time.Now())
+								go registerPeerContainer(trackerURL, signalingURL, peer)
+							case !holderFound:
+								// Nobody in the mesh has it - fall back to
+								// the HTTP origin, same as a real swarm
+								// escaping to its webseed.
+								go webSeed.Fetch(segment, segmentSize)
+								peer.Storage().AddSegment(segment, segmentSize)
+								peer.RecordDownload()
+								announcementFetcher.Announce(peer.ID(), peer.Region(), []string{segment}, time.Now())
+								go registerPeerContainer(trackerURL, signalingURL, peer)
+							default:
+								// A holder exists but the claim isn't
+								// confirmed yet or has peer choked this
+								// round - leave it queued for next tick.
+							}
 						}
 					}
-					
+
 					// Small chance to go offline temporarily (simulate real users)
 					if rand.Float64() < 0.02 { // 2% chance
-						peer.IsOnline = false
-						go func(p *PeerContainer) {
+						peer.SetOnline(false)
+						go func(p Peer) {
 							// Come back online after 30-120 seconds
 							offlineTime := time.Duration(rand.Intn(90)+30) * time.Second
 							time.Sleep(offlineTime)
-							p.IsOnline = true
-							p.LastSeen = time.Now().Unix()
+							p.SetOnline(true)
+							p.Touch()
 							registerPeerContainer(trackerURL, signalingURL, p)
 						}(peer)
 					}
-					
+
 					// Update last seen
-					peer.LastSeen = time.Now().Unix()
+					peer.Touch()
 				}
 			}
 		}
 	}()
-	
+
 	// Periodic re-announcement to keep peers alive in tracker
 	go func() {
 		ticker := time.NewTicker(60 * time.Second)
 		defer ticker.Stop()
-		
+
 		for {
 			select {
 			case <-ticker.C:
 				for _, peer := range peers {
-					if peer.IsOnline {
+					if peer.IsOnline() {
+						announcementFetcher.Announce(peer.ID(), peer.Region(), peer.Storage().GetSegments(), time.Now())
 						go registerPeerContainer(trackerURL, signalingURL, peer)
 					}
 				}
@@ -435,33 +869,52 @@ func startPeerBehaviorSimulation(peers []*PeerContainer, trackerURL, signalingUR
 	}()
 }
 
-func showPeerStatus(peers []*PeerContainer) {
+func showPeerStatus(peers []Peer, webSeed *WebSeedPeer, announcementFetcher *AnnouncementFetcher) {
 	onlinePeers := 0
 	totalSegments := 0
-	
+
 	segmentCounts := make(map[string]int)
-	
+
+	var unchokedSlots, totalSlots, chokeChurn int
+	var requestsServed, requestsQueued, requestsRejected int64
+
 	for _, peer := range peers {
-		if peer.IsOnline {
+		if peer.IsOnline() {
 			onlinePeers++
-			segments := peer.Storage.GetSegments()
+			segments := peer.Storage().GetSegments()
 			totalSegments += len(segments)
-			
+
 			for _, segment := range segments {
 				segmentCounts[segment]++
 			}
+
+			stats := peer.ChokeStats()
+			unchokedSlots += stats.Unchoked
+			totalSlots += stats.UploadSlots
+			chokeChurn += stats.Churn
+			requestsServed += stats.RequestsServed
+			requestsQueued += stats.RequestsQueued
+			requestsRejected += stats.RequestsRejected
 		}
 	}
-	
+
 	fmt.Printf("\n📊 Peer Container Status:\n")
 	fmt.Printf("   Online Peers: %d/%d\n", onlinePeers, len(peers))
 	fmt.Printf("   Total Cached Segments: %d\n", totalSegments)
+	fmt.Printf("   Webseed Bytes Served: %d (swarm escaped this much traffic to the origin)\n", webSeed.BytesServed())
+	fmt.Printf("   Upload Slot Utilization: %d/%d unchoked, %d choke/unchoke flips, requests served=%d queued=%d rejected=%d\n",
+		unchokedSlots, totalSlots, chokeChurn, requestsServed, requestsQueued, requestsRejected)
+	trackedClaims, confirmedClaims := announcementFetcher.Stats()
+	fmt.Printf("   Segment Claims: %d/%d confirmed (>=%d independent peers within %s)\n",
+		confirmedClaims, trackedClaims, minConfirmations, blockDelayTimeout)
 	fmt.Printf("   Segment Distribution:\n")
-	
+
 	for segment, count := range segmentCounts {
 		segmentName := segment[len(segment)-15:] // Last part of segment name
 		fmt.Printf("     %s: %d peers\n", segmentName, count)
 	}
+
+	printQoSLeaderboard(peers)
 }
 
 // Helper functions for P2P network topology
@@ -479,7 +932,7 @@ func getMaxConnections(bandwidth, deviceType string) int {
 	case "wifi":
 		base = 10
 	}
-	
+
 	// Adjust based on device type
 	switch deviceType {
 	case "smartphone":
@@ -508,7 +961,7 @@ func getUploadSlots(bandwidth, deviceType string) int {
 	case "wifi":
 		base = 3
 	}
-	
+
 	// Mobile devices typically have fewer upload slots
 	if deviceType == "smartphone" {
 		return max(1, base-1)
@@ -523,144 +976,239 @@ func max(a, b int) int {
 	return b
 }
 
-// createP2PMesh creates realistic P2P connections between peers
-func createP2PMesh(peers []*PeerContainer) {
+// createP2PMesh creates realistic P2P connections between peers as two
+// clearly-typed passes: client peers connect to a seed plus other
+// clients, then seed peers wire up a backbone among themselves.
+func createP2PMesh(peers []Peer) {
 	fmt.Printf("   🔗 Connecting peers in realistic P2P mesh...\n")
-	
-	// Separate seed peers and regular peers
-	var seedPeers []*PeerContainer
-	var regularPeers []*PeerContainer
-	
+
+	var seedPeers []*SeedPeer
+	var clientPeers []*ClientPeer
+
 	for _, peer := range peers {
-		if peer.IsSeedPeer {
-			seedPeers = append(seedPeers, peer)
-		} else {
-			regularPeers = append(regularPeers, peer)
+		switch p := peer.(type) {
+		case *SeedPeer:
+			seedPeers = append(seedPeers, p)
+		case *ClientPeer:
+			clientPeers = append(clientPeers, p)
 		}
 	}
-	
+
 	fmt.Printf("   🌱 %d seed peers will connect to edge servers\n", len(seedPeers))
-	fmt.Printf("   👥 %d regular peers will connect to other peers\n", len(regularPeers))
-	
-	// Connect regular peers to seed peers and other peers
-	for _, peer := range regularPeers {
-		connectionsNeeded := peer.MaxConnections
-		
+	fmt.Printf("   👥 %d client peers will connect to other peers\n", len(clientPeers))
+
+	constraints := loadTopologyConfig(topologyConfigPath)
+	connectClientPeers(clientPeers, seedPeers, constraints)
+	connectSeedBackbone(seedPeers, constraints)
+
+	// Print mesh statistics
+	totalConnections := 0
+	for _, peer := range peers {
+		totalConnections += len(peer.ConnectedPeers())
+	}
+	totalConnections /= 2 // Each connection is counted twice
+
+	fmt.Printf("   ✅ P2P mesh created: %d total connections\n", totalConnections)
+	fmt.Printf("   📊 Average connections per peer: %.1f\n", float64(totalConnections*2)/float64(len(peers)))
+}
+
+// connectClientPeers wires each client to an upstream seed for content
+// discovery, then fills its remaining connection budget with other
+// clients, preferring the same region and whatever else the topology
+// config's Constraints reward (see connectionScore in topology.go).
+func connectClientPeers(clientPeers []*ClientPeer, seedPeers []*SeedPeer, constraints []Constraint) {
+	for _, peer := range clientPeers {
+		connectionsNeeded := peer.MaxConnections()
+
 		// Try to connect to at least one seed peer (for content discovery)
 		if len(seedPeers) > 0 && connectionsNeeded > 0 {
 			seedPeer := seedPeers[rand.Intn(len(seedPeers))]
 			if canConnect(peer, seedPeer) {
-				peer.ConnectedPeers = append(peer.ConnectedPeers, seedPeer.ID)
-				seedPeer.ConnectedPeers = append(seedPeer.ConnectedPeers, peer.ID)
+				peer.AddConnectedPeer(seedPeer.ID())
+				seedPeer.AddConnectedPeer(peer.ID())
+				peer.UpstreamSeed = seedPeer.ID()
 				connectionsNeeded--
 			}
 		}
-		
-		// Connect to other regular peers (preferably in same region)
+
+		// Connect to other client peers (preferably in same region)
 		attempts := 0
-		maxAttempts := len(regularPeers) * 2
-		
+		maxAttempts := len(clientPeers) * 2
+
 		for connectionsNeeded > 0 && attempts < maxAttempts {
 			attempts++
-			targetPeer := regularPeers[rand.Intn(len(regularPeers))]
-			
-			if targetPeer.ID == peer.ID {
+			targetPeer := clientPeers[rand.Intn(len(clientPeers))]
+
+			if targetPeer.ID() == peer.ID() {
 				continue // Don't connect to self
 			}
-			
+
 			// Check if already connected
 			alreadyConnected := false
-			for _, connectedID := range peer.ConnectedPeers {
-				if connectedID == targetPeer.ID {
+			for _, connectedID := range peer.ConnectedPeers() {
+				if connectedID == targetPeer.ID() {
 					alreadyConnected = true
 					break
 				}
 			}
-			
+
 			if !alreadyConnected && canConnect(peer, targetPeer) {
-				// Prefer peers in same region (80% chance) or nearby regions
-				regionMatch := peer.Region == targetPeer.Region
-				nearbyRegion := areRegionsNearby(peer.Region, targetPeer.Region)
-				
+				// Prefer peers in the same region (80% chance), then add
+				// the topology config's weighted score for whatever
+				// Constraints targetPeer also satisfies (ISP/zone/NAT
+				// diversity, datacenter affinity, etc).
 				connectProbability := 0.3 // Base probability
-				if regionMatch {
+				if peer.Region() == targetPeer.Region() {
 					connectProbability = 0.8
-				} else if nearbyRegion {
-					connectProbability = 0.5
 				}
-				
+				connectProbability += connectionScore(peer, targetPeer, constraints)
+				if connectProbability > 0.95 {
+					connectProbability = 0.95
+				}
+
 				if rand.Float64() < connectProbability {
-					peer.ConnectedPeers = append(peer.ConnectedPeers, targetPeer.ID)
-					targetPeer.ConnectedPeers = append(targetPeer.ConnectedPeers, peer.ID)
+					peer.AddConnectedPeer(targetPeer.ID())
+					targetPeer.AddConnectedPeer(peer.ID())
 					connectionsNeeded--
 				}
 			}
 		}
 	}
-	
-	// Connect seed peers to each other (they form a well-connected backbone)
+}
+
+// connectSeedBackbone wires seed peers to each other, forming a
+// well-connected backbone (at most 3 backbone links per seed). Candidates
+// are tried in order of the topology config's weighted Constraint score
+// so rules like "seed peers must span >=3 zones" get a head start.
+func connectSeedBackbone(seedPeers []*SeedPeer, constraints []Constraint) {
 	for i, seedPeer := range seedPeers {
-		connectionsNeeded := min(seedPeer.MaxConnections-len(seedPeer.ConnectedPeers), 3)
-		
+		connectionsNeeded := min(seedPeer.MaxConnections()-len(seedPeer.ConnectedPeers()), 3)
+		if connectionsNeeded <= 0 {
+			continue
+		}
+
+		candidates := make([]*SeedPeer, 0, len(seedPeers)-1)
 		for j, otherSeed := range seedPeers {
-			if i != j && connectionsNeeded > 0 && canConnect(seedPeer, otherSeed) {
-				// Check if already connected
-				alreadyConnected := false
-				for _, connectedID := range seedPeer.ConnectedPeers {
-					if connectedID == otherSeed.ID {
-						alreadyConnected = true
-						break
-					}
-				}
-				
-				if !alreadyConnected {
-					seedPeer.ConnectedPeers = append(seedPeer.ConnectedPeers, otherSeed.ID)
-					otherSeed.ConnectedPeers = append(otherSeed.ConnectedPeers, seedPeer.ID)
-					connectionsNeeded--
-				}
+			if i != j {
+				candidates = append(candidates, otherSeed)
 			}
 		}
+		sort.Slice(candidates, func(a, b int) bool {
+			return connectionScore(seedPeer, candidates[a], constraints) > connectionScore(seedPeer, candidates[b], constraints)
+		})
+
+		for _, otherSeed := range candidates {
+			if connectionsNeeded <= 0 {
+				break
+			}
+			if !canConnect(seedPeer, otherSeed) || contains(seedPeer.ConnectedPeers(), otherSeed.ID()) {
+				continue
+			}
+
+			seedPeer.AddConnectedPeer(otherSeed.ID())
+			otherSeed.AddConnectedPeer(seedPeer.ID())
+			connectionsNeeded--
+		}
 	}
-	
-	// Print mesh statistics
-	totalConnections := 0
+}
+
+func canConnect(peer1, peer2 Peer) bool {
+	return len(peer1.ConnectedPeers()) < peer1.MaxConnections() &&
+		   len(peer2.ConnectedPeers()) < peer2.MaxConnections()
+}
+
+// startPexGossip runs the PEX protocol's background loops: a frequent
+// gossip round so neighbors learn about each other's connections, and a
+// slower sweep that replaces connections to peers whose IsOnline has
+// flipped false. The tracker stays available as a bootstrap source, but
+// the mesh no longer depends on it to stay connected once it's running.
+func startPexGossip(peers []Peer, byID map[string]Peer) {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			gossipRound(peers, byID, time.Now())
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			replaceDeadConnections(peers, byID)
+		}
+	}()
+}
+
+// gossipRound has every online peer exchange an added/dropped PEX
+// message with each of its connected neighbors (BuildGossip enforces the
+// per-neighbor rate limit), folding whatever it receives into its local
+// candidate table.
+func gossipRound(peers []Peer, byID map[string]Peer, now time.Time) {
 	for _, peer := range peers {
-		totalConnections += len(peer.ConnectedPeers)
+		if !peer.IsOnline() {
+			continue
+		}
+		for _, neighborID := range peer.ConnectedPeers() {
+			neighbor, ok := byID[neighborID]
+			if !ok || !neighbor.IsOnline() {
+				continue
+			}
+			msg, ok := peer.BuildGossip(neighborID, now)
+			if !ok {
+				continue
+			}
+			neighbor.MergeGossip(msg)
+		}
 	}
-	totalConnections /= 2 // Each connection is counted twice
-	
-	fmt.Printf("   ✅ P2P mesh created: %d total connections\n", totalConnections)
-	fmt.Printf("   📊 Average connections per peer: %.1f\n", float64(totalConnections*2)/float64(len(peers)))
 }
 
-func canConnect(peer1, peer2 *PeerContainer) bool {
-	return len(peer1.ConnectedPeers) < peer1.MaxConnections && 
-		   len(peer2.ConnectedPeers) < peer2.MaxConnections
-}
-
-func areRegionsNearby(region1, region2 string) bool {
-	nearbyRegions := map[string][]string{
-		"us-east":         {"us-central", "us-west", "canada"},
-		"us-west":         {"us-central", "us-east"},
-		"us-central":      {"us-east", "us-west", "canada"},
-		"eu-west":         {"eu-central", "eu-north"},
-		"eu-central":      {"eu-west", "eu-north"},
-		"eu-north":        {"eu-west", "eu-central"},
-		"asia-pacific":    {"asia-southeast", "asia-northeast", "australia"},
-		"asia-southeast":  {"asia-pacific", "asia-northeast"},
-		"asia-northeast":  {"asia-pacific", "asia-southeast", "japan"},
-		"canada":          {"us-east", "us-central"},
-		"australia":       {"asia-pacific"},
-		"japan":           {"asia-northeast"},
-		"brazil":          {},
-		"india":           {"asia-southeast"},
-	}
-	
-	if nearby, exists := nearbyRegions[region1]; exists {
-		for _, region := range nearby {
-			if region == region2 {
-				return true
+// replaceDeadConnections drops connections to neighbors that have gone
+// offline and, for peers left under their connection budget, promotes a
+// PEX candidate discovered through gossip in their place - exactly the
+// recovery path that makes the tracker optional once peerCount scales
+// past a few thousand.
+func replaceDeadConnections(peers []Peer, byID map[string]Peer) {
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+
+		var alive, dead []string
+		for _, id := range peer.ConnectedPeers() {
+			if neighbor, ok := byID[id]; ok && neighbor.IsOnline() {
+				alive = append(alive, id)
+			} else {
+				dead = append(dead, id)
+			}
+		}
+		if len(dead) == 0 {
+			continue
+		}
+
+		for _, candidate := range peer.Candidates() {
+			if len(alive) >= len(peer.ConnectedPeers()) {
+				break
+			}
+			if candidate.PeerID == peer.ID() || contains(alive, candidate.PeerID) {
+				continue
 			}
+			neighbor, ok := byID[candidate.PeerID]
+			if !ok || !neighbor.IsOnline() || !canConnect(peer, neighbor) {
+				continue
+			}
+			alive = append(alive, candidate.PeerID)
+			neighbor.AddConnectedPeer(peer.ID())
+		}
+
+		peer.SetConnectedPeers(alive)
+	}
+}
+
+func contains(list []string, id string) bool {
+	for _, v := range list {
+		if v == id {
+			return true
 		}
 	}
 	return false
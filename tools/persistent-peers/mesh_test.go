@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// TestCreateP2PMeshGolden seeds the global RNG and builds a small, fixed
+// peer set so createP2PMesh's output is reproducible, then asserts the
+// invariants the mesh builder promises: nobody exceeds MaxConnections,
+// connections are symmetric, and clients actually end up connected.
+func TestCreateP2PMeshGolden(t *testing.T) {
+	rand.Seed(1)
+
+	var peers []Peer
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("seed-%d", i)
+		core := newPeerCore(id, "us-east", "desktop", "fiber", 15, 0.95, 15, 12, 6)
+		peers = append(peers, newSeedPeer(core, "edge-1", "lru"))
+	}
+	for i := 0; i < 30; i++ {
+		id := fmt.Sprintf("client-%d", i)
+		core := newPeerCore(id, "us-east", "smartphone", "4g", 40, 0.82, 8, 4, 1)
+		peers = append(peers, newClientPeer(core, ""))
+	}
+
+	createP2PMesh(peers)
+
+	byID := make(map[string]Peer, len(peers))
+	for _, peer := range peers {
+		byID[peer.ID()] = peer
+	}
+
+	connectedClients := 0
+	for _, peer := range peers {
+		if got, max := len(peer.ConnectedPeers()), peer.MaxConnections(); got > max {
+			t.Fatalf("peer %s exceeded MaxConnections: %d > %d", peer.ID(), got, max)
+		}
+		for _, otherID := range peer.ConnectedPeers() {
+			other, ok := byID[otherID]
+			if !ok {
+				t.Fatalf("peer %s connected to unknown peer %s", peer.ID(), otherID)
+			}
+			found := false
+			for _, back := range other.ConnectedPeers() {
+				if back == peer.ID() {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("connection %s -> %s is not symmetric", peer.ID(), otherID)
+			}
+		}
+		if _, isClient := peer.(*ClientPeer); isClient && len(peer.ConnectedPeers()) > 0 {
+			connectedClients++
+		}
+	}
+
+	if connectedClients == 0 {
+		t.Fatal("expected at least one client peer to end up connected")
+	}
+}
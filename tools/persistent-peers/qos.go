@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// qosEWMAAlpha weights how much a fresh RTT sample moves the
+	// estimate, the same smoothing the go-ethereum downloader's
+	// rttEstimate applies.
+	qosEWMAAlpha = 0.2
+	// qosConfidenceGrow/qosConfidenceDecay move a neighbor's confidence
+	// toward 1 on delivery and away from it on timeout.
+	qosConfidenceGrow  = 0.05
+	qosConfidenceDecay = 0.3
+	// qosMinConfidence floors confidence so a single bad patch doesn't
+	// make a neighbor permanently unscoreable.
+	qosMinConfidence = 0.05
+	// qosMinSamples is how many scored neighbors a peer needs before the
+	// tuner trusts a 90th-percentile target enough to drop anyone.
+	qosMinSamples = 2
+)
+
+// QoSStats summarizes one peer's connection quality for showPeerStatus's
+// leaderboard: go-ethereum downloader's peerSet exposes the same trio.
+type QoSStats struct {
+	AvgRTT         float64
+	DroppedCount   int
+	FailedRequests int
+}
+
+// RecordSegmentDelivery folds a successful delivery from neighborID into
+// its EWMA RTT estimate and grows confidence toward 1.
+func (p *peerCore) RecordSegmentDelivery(neighborID string, rttMs int) {
+	p.qosMu.Lock()
+	defer p.qosMu.Unlock()
+	if prev, ok := p.rttEstimate[neighborID]; ok {
+		p.rttEstimate[neighborID] = qosEWMAAlpha*float64(rttMs) + (1-qosEWMAAlpha)*prev
+		conf := p.rttConfidence[neighborID] + qosConfidenceGrow
+		if conf > 1 {
+			conf = 1
+		}
+		p.rttConfidence[neighborID] = conf
+	} else {
+		p.rttEstimate[neighborID] = float64(rttMs)
+		p.rttConfidence[neighborID] = 0.5
+	}
+}
+
+// RecordTimeout decays neighborID's confidence after a failed request,
+// the downloader's rttConfidence penalty for a dropped request.
+func (p *peerCore) RecordTimeout(neighborID string) {
+	p.qosMu.Lock()
+	defer p.qosMu.Unlock()
+	p.failedRequests++
+	conf, ok := p.rttConfidence[neighborID]
+	if !ok {
+		conf = 0.5
+	}
+	conf *= 1 - qosConfidenceDecay
+	if conf < qosMinConfidence {
+		conf = qosMinConfidence
+	}
+	p.rttConfidence[neighborID] = conf
+}
+
+// NeighborQoS reports neighborID's current RTT estimate and confidence,
+// zero values if nothing has been recorded for it yet.
+func (p *peerCore) NeighborQoS(neighborID string) (rttEstimate float64, confidence float64) {
+	p.qosMu.Lock()
+	defer p.qosMu.Unlock()
+	return p.rttEstimate[neighborID], p.rttConfidence[neighborID]
+}
+
+// DropPeer ends the connection to id and counts it against
+// droppedCount - the QoS tuner's hook for acting on a bad score.
+func (p *peerCore) DropPeer(id string) {
+	p.qosMu.Lock()
+	delete(p.rttEstimate, id)
+	delete(p.rttConfidence, id)
+	p.droppedCount++
+	p.qosMu.Unlock()
+
+	kept := make([]string, 0, len(p.connectedPeers))
+	for _, existing := range p.connectedPeers {
+		if existing != id {
+			kept = append(kept, existing)
+		}
+	}
+	p.connectedPeers = kept
+}
+
+// QoSStats reports this peer's scoring counters for showPeerStatus's
+// leaderboard.
+func (p *peerCore) QoSStats() QoSStats {
+	p.qosMu.Lock()
+	defer p.qosMu.Unlock()
+	var total float64
+	for _, rtt := range p.rttEstimate {
+		total += rtt
+	}
+	var avg float64
+	if len(p.rttEstimate) > 0 {
+		avg = total / float64(len(p.rttEstimate))
+	}
+	return QoSStats{AvgRTT: avg, DroppedCount: p.droppedCount, FailedRequests: p.failedRequests}
+}
+
+// runQoSTuner is the go-ethereum downloader's qosTuner ported to this
+// simulator's mesh: it simulates one round of requests to each online
+// peer's neighbors to update their RTT/confidence, then drops whichever
+// neighbor scores worst - confidence times measured RTT - if that score
+// exceeds the 90th-percentile RTT target across the peer's own
+// neighbors, backfilling the open slot from the PEX candidate table.
+func runQoSTuner(peers []Peer, byID map[string]Peer) {
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+		neighbors := peer.ConnectedPeers()
+		if len(neighbors) == 0 {
+			continue
+		}
+
+		for _, neighborID := range neighbors {
+			neighbor, ok := byID[neighborID]
+			if !ok || !neighbor.IsOnline() {
+				continue
+			}
+			// Simulate a request to neighbor: it succeeds with
+			// probability equal to its own advertised availability,
+			// standing in for a real timed RPC over the signaling
+			// channel.
+			if rand.Float64() < neighbor.Availability() {
+				rtt := neighbor.RTT() + rand.Intn(20) - 10
+				if rtt < 1 {
+					rtt = 1
+				}
+				peer.RecordSegmentDelivery(neighborID, rtt)
+			} else {
+				peer.RecordTimeout(neighborID)
+			}
+		}
+
+		var rtts []float64
+		scores := make(map[string]float64, len(neighbors))
+		for _, neighborID := range neighbors {
+			rtt, confidence := peer.NeighborQoS(neighborID)
+			if confidence == 0 {
+				continue
+			}
+			rtts = append(rtts, rtt)
+			scores[neighborID] = confidence * rtt
+		}
+		if len(rtts) < qosMinSamples {
+			continue
+		}
+		target := percentile90(rtts)
+
+		worstID, worstScore := "", 0.0
+		for id, score := range scores {
+			if score > worstScore {
+				worstID, worstScore = id, score
+			}
+		}
+		if worstID != "" && worstScore > target {
+			peer.DropPeer(worstID)
+			if neighbor, ok := byID[worstID]; ok {
+				neighbor.DropPeer(peer.ID())
+			}
+			promoteCandidate(peer, byID)
+		}
+	}
+}
+
+// percentile90 returns the 90th-percentile value of values, the QoS
+// tuner's target RTT a neighbor is scored against.
+func percentile90(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	idx := int(float64(len(sorted)-1) * 0.9)
+	return sorted[idx]
+}
+
+// promoteCandidate fills one open connection slot for peer from its PEX
+// candidate table, the same backfill replaceDeadConnections uses for a
+// neighbor that's gone offline.
+func promoteCandidate(peer Peer, byID map[string]Peer) bool {
+	current := peer.ConnectedPeers()
+	for _, candidate := range peer.Candidates() {
+		if candidate.PeerID == peer.ID() || contains(current, candidate.PeerID) {
+			continue
+		}
+		neighbor, ok := byID[candidate.PeerID]
+		if !ok || !neighbor.IsOnline() || !canConnect(peer, neighbor) {
+			continue
+		}
+		peer.AddConnectedPeer(candidate.PeerID)
+		neighbor.AddConnectedPeer(peer.ID())
+		return true
+	}
+	return false
+}
+
+// printQoSLeaderboard prints the best- and worst-scoring online peers by
+// average RTT, so a bad mesh topology shows up as a widening gap between
+// the two rather than just an aggregate average.
+func printQoSLeaderboard(peers []Peer) {
+	type scored struct {
+		id    string
+		stats QoSStats
+	}
+	var rated []scored
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+		stats := peer.QoSStats()
+		if stats.AvgRTT == 0 && stats.DroppedCount == 0 && stats.FailedRequests == 0 {
+			continue
+		}
+		rated = append(rated, scored{id: peer.ID(), stats: stats})
+	}
+	if len(rated) == 0 {
+		return
+	}
+
+	sort.Slice(rated, func(i, j int) bool { return rated[i].stats.AvgRTT < rated[j].stats.AvgRTT })
+
+	fmt.Printf("   QoS Leaderboard (best/worst avg RTT):\n")
+	top := rated[:min(3, len(rated))]
+	for _, r := range top {
+		fmt.Printf("     ✅ %s: avgRTT=%.1fms dropped=%d failed=%d\n", r.id, r.stats.AvgRTT, r.stats.DroppedCount, r.stats.FailedRequests)
+	}
+	bottom := rated[max(0, len(rated)-3):]
+	for i := len(bottom) - 1; i >= 0; i-- {
+		r := bottom[i]
+		fmt.Printf("     ⚠️  %s: avgRTT=%.1fms dropped=%d failed=%d\n", r.id, r.stats.AvgRTT, r.stats.DroppedCount, r.stats.FailedRequests)
+	}
+}
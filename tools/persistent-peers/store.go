@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// peerStoreStaleAfter is how long a peer can go unseen before
+// startPeerStoreMaintenance's eviction sweep drops it.
+const peerStoreStaleAfter = 7 * 24 * time.Hour
+
+// PeerRecord is the persisted shape of one peer container: enough to
+// reconstruct a SeedPeer or ClientPeer and its mesh edges without
+// re-running the random topology generator.
+type PeerRecord struct {
+	ID             string
+	Region         string
+	DeviceType     string
+	Bandwidth      string
+	RTT            int
+	Availability   float64
+	IsSeed         bool
+	EdgeAffinity   string
+	CachePolicy    string
+	UpstreamSeed   string
+	MaxConnections int
+	UploadSlots    int
+	TotalUploads   int64
+	TotalDownloads int64
+	ConnectedPeers []string
+	Segments       []string
+	LastSeen       int64
+}
+
+// PeerStore persists peer identity, mesh membership, and storage
+// contents across restarts, so a longitudinal experiment survives a
+// restart of main instead of re-randomizing every peer.
+type PeerStore interface {
+	Load() ([]PeerRecord, error)
+	Save(rec PeerRecord) error
+	SaveSegments(peerID string, segments []string) error
+	PeersWithSegment(segmentID, region string) ([]string, error)
+	EvictStale(olderThan time.Duration) (int, error)
+	Close() error
+}
+
+// SqlitePeerStore is PeerStore's default implementation, modeled after
+// CKB's SqlitePeerStore: a single *sql.DB behind one mutex, with every
+// exported method taking the lock itself and calling only the
+// lower-case "Locked" helpers below it - never another exported method -
+// so there's no path that reenters the mutex.
+type SqlitePeerStore struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+func NewSqlitePeerStore(path string) (*SqlitePeerStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening peer store %s: %w", path, err)
+	}
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("enabling foreign keys on %s: %w", path, err)
+	}
+	s := &SqlitePeerStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SqlitePeerStore) migrate() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS peers (
+			id TEXT PRIMARY KEY,
+			region TEXT NOT NULL,
+			device_type TEXT NOT NULL,
+			bandwidth TEXT NOT NULL,
+			rtt INTEGER NOT NULL,
+			availability REAL NOT NULL,
+			is_seed INTEGER NOT NULL,
+			edge_affinity TEXT NOT NULL DEFAULT '',
+			cache_policy TEXT NOT NULL DEFAULT '',
+			upstream_seed TEXT NOT NULL DEFAULT '',
+			max_connections INTEGER NOT NULL,
+			upload_slots INTEGER NOT NULL,
+			total_uploads INTEGER NOT NULL DEFAULT 0,
+			total_downloads INTEGER NOT NULL DEFAULT 0,
+			connected_peers TEXT NOT NULL DEFAULT '',
+			last_seen INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_peers_region ON peers(region)`,
+		`CREATE INDEX IF NOT EXISTS idx_peers_bandwidth ON peers(bandwidth)`,
+		`CREATE TABLE IF NOT EXISTS peer_segments (
+			peer_id TEXT NOT NULL REFERENCES peers(id) ON DELETE CASCADE,
+			segment_id TEXT NOT NULL,
+			PRIMARY KEY (peer_id, segment_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_peer_segments_segment ON peer_segments(segment_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("migrating peer store: %w", err)
+		}
+	}
+	return nil
+}
+
+// Load returns every persisted peer, including its segment cache.
+func (s *SqlitePeerStore) Load() ([]PeerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT id, region, device_type, bandwidth, rtt, availability, is_seed,
+		edge_affinity, cache_policy, upstream_seed, max_connections, upload_slots,
+		total_uploads, total_downloads, connected_peers, last_seen FROM peers`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PeerRecord
+	for rows.Next() {
+		var rec PeerRecord
+		var isSeed int
+		var connectedPeersCSV string
+		if err := rows.Scan(&rec.ID, &rec.Region, &rec.DeviceType, &rec.Bandwidth, &rec.RTT, &rec.Availability,
+			&isSeed, &rec.EdgeAffinity, &rec.CachePolicy, &rec.UpstreamSeed, &rec.MaxConnections, &rec.UploadSlots,
+			&rec.TotalUploads, &rec.TotalDownloads, &connectedPeersCSV, &rec.LastSeen); err != nil {
+			return nil, err
+		}
+		rec.IsSeed = isSeed != 0
+		rec.ConnectedPeers = splitCSV(connectedPeersCSV)
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		segments, err := s.segmentsForPeerLocked(records[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		records[i].Segments = segments
+	}
+	return records, nil
+}
+
+// segmentsForPeerLocked assumes the caller already holds s.mu.
+func (s *SqlitePeerStore) segmentsForPeerLocked(peerID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT segment_id FROM peer_segments WHERE peer_id = ?`, peerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var segments []string
+	for rows.Next() {
+		var seg string
+		if err := rows.Scan(&seg); err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, rows.Err()
+}
+
+// Save upserts rec's identity, mesh membership, and counters.
+func (s *SqlitePeerStore) Save(rec PeerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT INTO peers (id, region, device_type, bandwidth, rtt, availability, is_seed,
+			edge_affinity, cache_policy, upstream_seed, max_connections, upload_slots,
+			total_uploads, total_downloads, connected_peers, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			region=excluded.region, device_type=excluded.device_type, bandwidth=excluded.bandwidth,
+			rtt=excluded.rtt, availability=excluded.availability, is_seed=excluded.is_seed,
+			edge_affinity=excluded.edge_affinity, cache_policy=excluded.cache_policy,
+			upstream_seed=excluded.upstream_seed, max_connections=excluded.max_connections,
+			upload_slots=excluded.upload_slots, total_uploads=excluded.total_uploads,
+			total_downloads=excluded.total_downloads, connected_peers=excluded.connected_peers,
+			last_seen=excluded.last_seen`,
+		rec.ID, rec.Region, rec.DeviceType, rec.Bandwidth, rec.RTT, rec.Availability, boolToInt(rec.IsSeed),
+		rec.EdgeAffinity, rec.CachePolicy, rec.UpstreamSeed, rec.MaxConnections, rec.UploadSlots,
+		rec.TotalUploads, rec.TotalDownloads, strings.Join(rec.ConnectedPeers, ","), rec.LastSeen)
+	return err
+}
+
+// SaveSegments replaces peerID's cached segment set with segments.
+func (s *SqlitePeerStore) SaveSegments(peerID string, segments []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM peer_segments WHERE peer_id = ?`, peerID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, seg := range segments {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO peer_segments (peer_id, segment_id) VALUES (?, ?)`, peerID, seg); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PeersWithSegment answers the tracker-style "who has segment X in
+// region Y" query via the segment->peer join table and the region
+// index, an indexed lookup instead of scanning every peer's storage.
+func (s *SqlitePeerStore) PeersWithSegment(segmentID, region string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT p.id FROM peers p
+		JOIN peer_segments ps ON ps.peer_id = p.id
+		WHERE ps.segment_id = ? AND p.region = ?`, segmentID, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// EvictStale deletes (and, via the foreign key cascade, their cached
+// segments) every peer not seen within olderThan, reporting how many
+// rows were removed.
+func (s *SqlitePeerStore) EvictStale(olderThan time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan).Unix()
+	res, err := s.db.Exec(`DELETE FROM peers WHERE last_seen < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SqlitePeerStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Close()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func splitCSV(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// reconstructPeer rebuilds a Peer from a persisted PeerRecord, restoring
+// its storage, connections, and counters exactly as they were flushed so
+// a restarted simulator continues a longitudinal experiment instead of
+// starting a new one.
+func reconstructPeer(rec PeerRecord) Peer {
+	core := newPeerCore(rec.ID, rec.Region, rec.DeviceType, rec.Bandwidth, rec.RTT, rec.Availability,
+		storageCapacityFor(rec.Bandwidth), rec.MaxConnections, rec.UploadSlots)
+	core.lastSeen = rec.LastSeen
+	core.totalUploads = rec.TotalUploads
+	core.totalDownloads = rec.TotalDownloads
+	core.connectedPeers = append([]string(nil), rec.ConnectedPeers...)
+
+	var peer Peer
+	if rec.IsSeed {
+		peer = newSeedPeer(core, rec.EdgeAffinity, rec.CachePolicy)
+	} else {
+		peer = newClientPeer(core, rec.UpstreamSeed)
+	}
+	for _, seg := range rec.Segments {
+		// The store only tracks segment IDs, not their byte size, so a
+		// restored segment's Size starts at 0 - fine for this
+		// simulator, which only ever reads segment presence back out.
+		peer.Storage().AddSegment(seg, 0)
+	}
+	return peer
+}
+
+func peerToRecord(peer Peer) PeerRecord {
+	rec := PeerRecord{
+		ID:             peer.ID(),
+		Region:         peer.Region(),
+		DeviceType:     peer.DeviceType(),
+		Bandwidth:      peer.Bandwidth(),
+		RTT:            peer.RTT(),
+		Availability:   peer.Availability(),
+		IsSeed:         peer.IsSeed(),
+		MaxConnections: peer.MaxConnections(),
+		UploadSlots:    peer.UploadSlots(),
+		TotalUploads:   peer.TotalUploads(),
+		TotalDownloads: peer.TotalDownloads(),
+		ConnectedPeers: peer.ConnectedPeers(),
+		LastSeen:       peer.LastSeen(),
+	}
+	switch p := peer.(type) {
+	case *SeedPeer:
+		rec.EdgeAffinity = p.EdgeAffinity
+		rec.CachePolicy = p.CachePolicy
+	case *ClientPeer:
+		rec.UpstreamSeed = p.UpstreamSeed
+	}
+	return rec
+}
+
+// flushPeersToStore persists every peer's current identity, mesh
+// membership, counters, and segment cache.
+func flushPeersToStore(store PeerStore, peers []Peer) {
+	for _, peer := range peers {
+		if err := store.Save(peerToRecord(peer)); err != nil {
+			fmt.Printf("⚠️  failed to persist peer %s: %v\n", peer.ID(), err)
+			continue
+		}
+		if err := store.SaveSegments(peer.ID(), peer.Storage().GetSegments()); err != nil {
+			fmt.Printf("⚠️  failed to persist segments for peer %s: %v\n", peer.ID(), err)
+		}
+	}
+}
+
+// startPeerStoreMaintenance drives the store's two background
+// responsibilities: a periodic flush of every peer's dirty rows, and a
+// slower sweep evicting anything not seen in peerStoreStaleAfter.
+func startPeerStoreMaintenance(store PeerStore, peers []Peer) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushPeersToStore(store, peers)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			evicted, err := store.EvictStale(peerStoreStaleAfter)
+			if err != nil {
+				fmt.Printf("⚠️  stale peer eviction failed: %v\n", err)
+				continue
+			}
+			if evicted > 0 {
+				fmt.Printf("🧹 evicted %d peers not seen in over 7 days\n", evicted)
+			}
+		}
+	}()
+}
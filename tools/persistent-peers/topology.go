@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// topologyConfigPath is where createP2PMesh and rebalanceTopology look
+// for a user-edited Constraint list; see loadTopologyConfig for the
+// defaults used when the file isn't there.
+const topologyConfigPath = "topology-constraints.json"
+
+// Constraint is one placement rule a topology config can express, e.g.
+// "each peer must connect to at least one peer on a different isp" or
+// "seed peers must span at least 3 zones". Modeled on TiKV PD's
+// label-aware replica scheduler (newConstraints(count,
+// []*Constraint{Labels: ...})).
+//
+// A "*" label value is a diversity rule: a candidate only matches if it
+// differs from the peer on that label. Any other value is an affinity
+// rule: the candidate must match it exactly. MaxCount of 0 means
+// unbounded.
+type Constraint struct {
+	Labels   map[string]string `json:"labels"`
+	MinCount int               `json:"minCount"`
+	MaxCount int               `json:"maxCount"`
+	Weight   float64           `json:"weight"`
+}
+
+// TopologyConfig is the user-editable placement policy loaded from
+// topologyConfigPath, replacing the old hard-coded areRegionsNearby map.
+type TopologyConfig struct {
+	Constraints []Constraint `json:"constraints"`
+}
+
+// defaultTopologyConstraints ships two illustrative rules so the
+// simulator still produces a label-aware mesh without a config file on
+// disk: spread connections across ISPs, and keep seed backbones spanning
+// multiple zones.
+func defaultTopologyConstraints() []Constraint {
+	return []Constraint{
+		{Labels: map[string]string{"isp": "*"}, MinCount: 1, Weight: 0.4},
+		{Labels: map[string]string{"zone": "*"}, MinCount: 3, Weight: 0.2},
+	}
+}
+
+// loadTopologyConfig reads path as a TopologyConfig, falling back to
+// defaultTopologyConstraints when the file is missing, unreadable, or
+// has no constraints - researchers can edit the file without touching
+// Go code, but nothing requires it to exist.
+func loadTopologyConfig(path string) []Constraint {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defaultTopologyConstraints()
+	}
+	var cfg TopologyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil || len(cfg.Constraints) == 0 {
+		return defaultTopologyConstraints()
+	}
+	return cfg.Constraints
+}
+
+// constraintMatches reports whether candidateLabels satisfies c relative
+// to peerLabels. A constraint with no labels never matches.
+func constraintMatches(peerLabels, candidateLabels map[string]string, c Constraint) bool {
+	if len(c.Labels) == 0 {
+		return false
+	}
+	for key, want := range c.Labels {
+		have := candidateLabels[key]
+		if want == "*" {
+			if have == "" || have == peerLabels[key] {
+				return false
+			}
+		} else if have != want {
+			return false
+		}
+	}
+	return true
+}
+
+// connectionScore sums the weight of every constraint candidate
+// satisfies relative to peer - createP2PMesh's weighted replacement for
+// the old region-only connection probability bump.
+func connectionScore(peer, candidate Peer, constraints []Constraint) float64 {
+	var score float64
+	for _, c := range constraints {
+		if constraintMatches(peer.Labels(), candidate.Labels(), c) {
+			score += c.Weight
+		}
+	}
+	return score
+}
+
+// constraintSatisfied reports whether peer's current connections already
+// meet c's MinCount (and stay within MaxCount, when set).
+func constraintSatisfied(peer Peer, byID map[string]Peer, c Constraint) bool {
+	count := 0
+	for _, id := range peer.ConnectedPeers() {
+		neighbor, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if constraintMatches(peer.Labels(), neighbor.Labels(), c) {
+			count++
+		}
+	}
+	if count < c.MinCount {
+		return false
+	}
+	if c.MaxCount > 0 && count > c.MaxCount {
+		return false
+	}
+	return true
+}
+
+// rebalanceTopology is the periodic re-balancer the topology config
+// needs: churn can take a neighbor offline and leave a Constraint
+// unsatisfied, so for every online peer with an unmet constraint it
+// tries to swap in a PEX candidate that would satisfy it.
+func rebalanceTopology(peers []Peer, byID map[string]Peer, constraints []Constraint) {
+	for _, peer := range peers {
+		if !peer.IsOnline() {
+			continue
+		}
+		for _, c := range constraints {
+			if constraintSatisfied(peer, byID, c) {
+				continue
+			}
+			if promoteConstraintCandidate(peer, byID, c, constraints) {
+				break // one swap per tick is enough to make progress
+			}
+		}
+	}
+}
+
+// promoteConstraintCandidate looks for a PEX candidate satisfying the
+// unmet constraint: it connects directly if peer has spare connection
+// budget, otherwise it drops peer's worst-scoring neighbor to make room,
+// mirroring the swap-in/backfill pattern replaceDeadConnections and
+// runQoSTuner already use.
+func promoteConstraintCandidate(peer Peer, byID map[string]Peer, unmet Constraint, constraints []Constraint) bool {
+	current := peer.ConnectedPeers()
+	for _, candidate := range peer.Candidates() {
+		if candidate.PeerID == peer.ID() || contains(current, candidate.PeerID) {
+			continue
+		}
+		neighbor, ok := byID[candidate.PeerID]
+		if !ok || !neighbor.IsOnline() || !constraintMatches(peer.Labels(), neighbor.Labels(), unmet) {
+			continue
+		}
+
+		if len(current) < peer.MaxConnections() {
+			peer.AddConnectedPeer(neighbor.ID())
+			neighbor.AddConnectedPeer(peer.ID())
+			return true
+		}
+
+		worstID := worstScoringNeighbor(peer, byID, constraints)
+		if worstID == "" {
+			return false
+		}
+		peer.DropPeer(worstID)
+		if worst, ok := byID[worstID]; ok {
+			worst.DropPeer(peer.ID())
+		}
+		peer.AddConnectedPeer(neighbor.ID())
+		neighbor.AddConnectedPeer(peer.ID())
+		return true
+	}
+	return false
+}
+
+// worstScoringNeighbor returns the connected neighbor with the lowest
+// connectionScore against peer - the one rebalancing gives up first to
+// make room for a neighbor that would satisfy an unmet constraint.
+func worstScoringNeighbor(peer Peer, byID map[string]Peer, constraints []Constraint) string {
+	worstID, worstScore := "", 0.0
+	first := true
+	for _, id := range peer.ConnectedPeers() {
+		neighbor, ok := byID[id]
+		if !ok {
+			continue
+		}
+		score := connectionScore(peer, neighbor, constraints)
+		if first || score < worstScore {
+			worstID, worstScore = id, score
+			first = false
+		}
+	}
+	return worstID
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// webSeedSimulatedRTT stands in for the extra hop to an HTTP origin
+	// instead of a nearby mesh peer - comfortably worse than even the
+	// slowest real peer's RTT range so selection logic always prefers a
+	// mesh hit when one exists.
+	webSeedSimulatedRTT = 250
+	// webSeedUploadSlots is "effectively unlimited": an origin server
+	// doesn't ration concurrent connections the way a phone on cellular
+	// data does.
+	webSeedUploadSlots = 1 << 20
+	// webSeedRateLimitBytesPerSec caps the shared token bucket all
+	// webseed fetches draw from, modeling the origin's own bandwidth
+	// budget rather than letting escaped traffic look free.
+	webSeedRateLimitBytesPerSec = 5_000_000
+)
+
+// tokenBucket is a minimal shared rate limiter: tokens refill continuously
+// at rate bytes/sec up to capacity, and take blocks until enough have
+// accumulated.
+type tokenBucket struct {
+	mu         sync.Mutex
+	capacity   float64
+	tokens     float64
+	rate       float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(ratePerSec float64) *tokenBucket {
+	return &tokenBucket{capacity: ratePerSec, tokens: ratePerSec, rate: ratePerSec, lastRefill: time.Now()}
+}
+
+func (b *tokenBucket) take(n float64) {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		refilled := b.tokens + now.Sub(b.lastRefill).Seconds()*b.rate
+		if refilled > b.capacity {
+			refilled = b.capacity
+		}
+		b.tokens = refilled
+		b.lastRefill = now
+		if b.tokens >= n {
+			b.tokens -= n
+			b.mu.Unlock()
+			return
+		}
+		wait := time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// WebSeedPeer is a virtual Peer wrapping a fixed list of HTTP origin URLs,
+// modeled after btrtrc's webseed-peer.go: the request strategy can treat
+// it uniformly with a real peer, falling back to it once both the mesh
+// and the DHT overlay have come up empty for a segment.
+type WebSeedPeer struct {
+	peerCore
+	urls        []string
+	limiter     *tokenBucket
+	bytesServed int64
+}
+
+func newWebSeedPeer(urls []string) *WebSeedPeer {
+	core := newPeerCore(webSeedPeerID, "origin", "server", "fiber", webSeedSimulatedRTT, 1.0, 0, webSeedUploadSlots, webSeedUploadSlots)
+	return &WebSeedPeer{
+		peerCore: core,
+		urls:     urls,
+		limiter:  newTokenBucket(webSeedRateLimitBytesPerSec),
+	}
+}
+
+const webSeedPeerID = "webseed-origin"
+
+func (p *WebSeedPeer) IsSeed() bool { return true }
+
+// HasSegment always answers true: an HTTP origin is assumed to hold the
+// full catalog, so it's the source of last resort once the swarm and the
+// DHT overlay both fail to produce a holder.
+func (p *WebSeedPeer) HasSegment(segmentID string) bool { return true }
+
+// Fetch simulates pulling segmentID from one of urls: it waits on the
+// shared rate limiter then charges its cost against bytesServed,
+// standing in for the HTTP GET this simulator has no real transfer to
+// perform.
+func (p *WebSeedPeer) Fetch(segmentID string, size int64) {
+	p.limiter.take(float64(size))
+	atomic.AddInt64(&p.bytesServed, size)
+	p.RecordDownload()
+}
+
+// BytesServed reports how much traffic has escaped the swarm and hit the
+// origin - the numerator of the "swarm efficiency" metric showPeerStatus
+// prints alongside it.
+func (p *WebSeedPeer) BytesServed() int64 { return atomic.LoadInt64(&p.bytesServed) }
@@ -2,24 +2,46 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	"cloud_project/pkg/segmentstore"
+
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// manifestSegment is the slice of audio-processor's AudioManifest this
+// tool needs to dedup-upload segment bytes by content hash. It's a
+// local copy rather than an import of tools/audio-processor's types,
+// since nothing outside that tool should depend on its internal
+// structs - the two only agree on the manifest.json wire shape.
+type manifestSegment struct {
+	FilePath     string `json:"filePath"`
+	SHA256       string `json:"sha256"`
+	Bitrate      string `json:"bitrate"`
+	SegmentIndex int    `json:"segmentIndex"`
+}
+
+type songManifest struct {
+	SongID   string            `json:"songId"`
+	Segments []manifestSegment `json:"segments"`
+}
+
 func main() {
 	var (
-		endpoint = flag.String("endpoint", "127.0.0.1:9000", "MinIO endpoint")
-		access   = flag.String("access", "minioadmin", "Access key")
-		secret   = flag.String("secret", "minioadmin", "Secret key")
-		bucket   = flag.String("bucket", "media", "Bucket name")
-		inDir    = flag.String("in", "assets/hls", "Input directory to upload")
-		useSSL   = flag.Bool("ssl", false, "Use TLS")
+		endpoint          = flag.String("endpoint", "127.0.0.1:9000", "MinIO endpoint")
+		access            = flag.String("access", "minioadmin", "Access key")
+		secret            = flag.String("secret", "minioadmin", "Secret key")
+		bucket            = flag.String("bucket", "media", "Bucket name")
+		inDir             = flag.String("in", "assets/audio-segments", "Directory containing one or more audio-processor manifest.json outputs")
+		useSSL            = flag.Bool("ssl", false, "Use TLS")
+		partSizeMB        = flag.Int("part-size-mb", 16, "Multipart upload part size for large objects, in MB")
+		uploadConcurrency = flag.Int("concurrency", 4, "Concurrent part uploads per object")
 	)
 	flag.Parse()
 
@@ -42,26 +64,62 @@ func main() {
 		}
 	}
 
-	err = filepath.WalkDir(*inDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		rel, _ := filepath.Rel(*inDir, path)
-		contentType := "application/octet-stream"
-		if filepath.Ext(path) == ".m3u8" {
-			contentType = "application/vnd.apple.mpegurl"
-		}
-		_, err = client.FPutObject(ctx, *bucket, rel, path, minio.PutObjectOptions{ContentType: contentType})
-		if err != nil {
-			return fmt.Errorf("upload %s: %w", rel, err)
-		}
-		log.Printf("uploaded %s", rel)
-		return nil
+	store := segmentstore.New(client, segmentstore.Config{
+		Bucket:            *bucket,
+		PartSize:          uint64(*partSizeMB) * 1024 * 1024,
+		UploadConcurrency: *uploadConcurrency,
 	})
+
+	manifestPaths, err := findManifests(*inDir)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("finding manifests under %s: %v", *inDir, err)
+	}
+	if len(manifestPaths) == 0 {
+		log.Fatalf("no manifest.json found under %s", *inDir)
+	}
+	for _, manifestPath := range manifestPaths {
+		if err := uploadSong(ctx, store, manifestPath); err != nil {
+			log.Fatalf("upload %s: %v", manifestPath, err)
+		}
+	}
+}
+
+// findManifests looks for a manifest.json directly under inDir (the
+// layout audio-processor writes for a single song) and, failing that,
+// one directory down (in case multiple songs' outputs are staged as
+// sibling subdirectories of inDir).
+func findManifests(inDir string) ([]string, error) {
+	direct := filepath.Join(inDir, "manifest.json")
+	if _, err := os.Stat(direct); err == nil {
+		return []string{direct}, nil
+	}
+	return filepath.Glob(filepath.Join(inDir, "*", "manifest.json"))
+}
+
+func uploadSong(ctx context.Context, store *segmentstore.Store, manifestPath string) error {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	var m songManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parsing %s: %w", manifestPath, err)
+	}
+
+	files := make([]segmentstore.SegmentFile, 0, len(m.Segments))
+	for _, seg := range m.Segments {
+		segmentID := fmt.Sprintf("%s/%s/segment%03d.ts", m.SongID, seg.Bitrate, seg.SegmentIndex)
+		files = append(files, segmentstore.SegmentFile{
+			SegmentID: segmentID,
+			SHA256:    seg.SHA256,
+			Path:      seg.FilePath,
+		})
+	}
+
+	manifestKey := fmt.Sprintf("manifest/%s.json", m.SongID)
+	if err := store.PutManifest(ctx, files, manifestKey, data); err != nil {
+		return err
 	}
+	log.Printf("uploaded song %s: %d segments deduped by content hash, manifest at %s", m.SongID, len(files), manifestKey)
+	return nil
 }